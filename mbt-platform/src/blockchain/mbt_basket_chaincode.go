@@ -2,14 +2,20 @@
 // A smart contract that manages diversified metal portfolio tokens
 // 50% Gold (BGT), 30% Silver (BST), 20% Platinum (BPT)
 
-package main
+package blockchain
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
@@ -23,14 +29,24 @@ type MetalComposition struct {
 // MBTToken represents a Metal Basket Token
 type MBTToken struct {
 	TokenID        string  `json:"tokenId"`
-	Owner          string  `json:"owner"`
+	Owner          string  `json:"owner"`          // Owner's client identity ID, as returned by GetID()
 	TotalValue     float64 `json:"totalValue"`
 	BGTAmount      float64 `json:"bgtAmount"`      // Gold allocation in BGT tokens
 	BSTAmount      float64 `json:"bstAmount"`      // Silver allocation in BST tokens  
 	BPTAmount      float64 `json:"bptAmount"`      // Platinum allocation in BPT tokens
+	BGTGrams       float64 `json:"bgtGrams"`       // Physical gold backing in grams
+	BSTGrams       float64 `json:"bstGrams"`       // Physical silver backing in grams
+	BPTGrams       float64 `json:"bptGrams"`       // Physical platinum backing in grams
+	CostBasis      float64 `json:"costBasis"`      // Total INR paid, reduced pro rata on redemption
 	CreationTime   string  `json:"creationTime"`
 	LastRebalance  string  `json:"lastRebalance"`
 	Composition    MetalComposition `json:"composition"`
+	Metadata       map[string]string `json:"metadata,omitempty"` // Client bookkeeping tags
+	Locked         bool    `json:"locked"`         // Treasury or escrow hold; excluded from circulation and redemption
+	Version        uint64  `json:"version"`        // Incremented on every write; see putMBTToken
+	Frozen         bool    `json:"frozen"`         // Compliance hold; blocks redemption and transfer
+	FreezeReason   string  `json:"freezeReason,omitempty"`
+	CashAmount     float64 `json:"cashAmount"`     // Value held as cash under the buffer; redeemed first
 }
 
 // BasketHolding represents collective basket holdings
@@ -39,8 +55,517 @@ type BasketHolding struct {
 	TotalBGTValue    float64 `json:"totalBgtValue"`  // Total gold value in basket
 	TotalBSTValue    float64 `json:"totalBstValue"`  // Total silver value in basket
 	TotalBPTValue    float64 `json:"totalBptValue"`  // Total platinum value in basket
+	TotalBGTGrams    float64 `json:"totalBgtGrams"`  // Total gold weight in basket
+	TotalBSTGrams    float64 `json:"totalBstGrams"`  // Total silver weight in basket
+	TotalBPTGrams    float64 `json:"totalBptGrams"`  // Total platinum weight in basket
+	TotalCashValue   float64 `json:"totalCashValue"` // Cash buffer held alongside the metals
 	RebalanceNeeded  bool    `json:"rebalanceNeeded"`
 	LastRebalance    string  `json:"lastRebalance"`
+	Currency         string  `json:"currency"`       // Denomination of all basket values
+	Version          uint64  `json:"version"`        // Incremented on every write; see putBasketHoldings
+	Initialized      bool    `json:"initialized"`    // False until the holdings are first persisted
+}
+
+// PhysicalBacking reports the basket's metal weight and its value at current prices
+type PhysicalBacking struct {
+	BGTGrams   float64 `json:"bgtGrams"`
+	BSTGrams   float64 `json:"bstGrams"`
+	BPTGrams   float64 `json:"bptGrams"`
+	BGTValue   float64 `json:"bgtValue"`
+	BSTValue   float64 `json:"bstValue"`
+	BPTValue   float64 `json:"bptValue"`
+	TotalValue float64 `json:"totalValue"`
+}
+
+// MetalBacking is one metal's backing against its target share of the supply
+type MetalBacking struct {
+	Metal    string  `json:"metal"`
+	Grams    float64 `json:"grams"`
+	Price    float64 `json:"price"`
+	Value    float64 `json:"value"`
+	Required float64 `json:"required"` // Target weight times the supply notional less the cash buffer
+	Ratio    float64 `json:"ratio"`    // Value / Required; 0 when nothing is required
+}
+
+// BackingRatio compares the basket's metals and cash with the notional of the MBT supply
+type BackingRatio struct {
+	MetalValue          float64        `json:"metalValue"`
+	Cash                float64        `json:"cash"`
+	TotalBacking        float64        `json:"totalBacking"`   // MetalValue + Cash
+	SupplyNotional      float64        `json:"supplyNotional"` // Face value of the MBT in issue
+	Ratio               float64        `json:"ratio"`          // TotalBacking / SupplyNotional; 0 with no supply
+	UnderCollateralized bool           `json:"underCollateralized"`
+	Currency            string         `json:"currency"`
+	Metals              []MetalBacking `json:"metals"`
+}
+
+// TokenBatch is the result of a batch token lookup
+type TokenBatch struct {
+	Tokens   map[string]*MBTToken `json:"tokens"`
+	NotFound []string             `json:"notFound"`
+}
+
+// TokenComposition compares a token's live allocation with its target
+type TokenComposition struct {
+	TokenID      string           `json:"tokenId"`
+	CurrentValue float64          `json:"currentValue"` // Metals valued at current prices
+	Current      MetalComposition `json:"current"`      // Percentages at current prices
+	Target       MetalComposition `json:"target"`       // Percentages set at mint
+}
+
+// BlacklistEntry marks a user blocked by sanctions screening
+type BlacklistEntry struct {
+	UserID  string `json:"userId"`
+	AddedAt string `json:"addedAt"`
+}
+
+// TreasuryDestination is an account approved to receive treasury withdrawals
+type TreasuryDestination struct {
+	Destination string `json:"destination"`
+	AddedAt     string `json:"addedAt"`
+}
+
+// EmergencyRedemption records a wind-down redemption that bypassed normal limits
+type EmergencyRedemption struct {
+	TokenID   string  `json:"tokenId"`
+	Owner     string  `json:"owner"`
+	Amount    float64 `json:"amount"`
+	Timestamp string  `json:"timestamp"`
+}
+
+// ResidualRecord is the rounding residual of one redemption, swept to the treasury
+type ResidualRecord struct {
+	TokenID   string  `json:"tokenId"`
+	TxID      string  `json:"txId"`
+	Redeemed  float64 `json:"redeemed"` // Value released from the token
+	Credited  float64 `json:"credited"` // Metal value actually credited to the user
+	Residual  float64 `json:"residual"` // Redeemed minus credited; never negative
+	Timestamp string  `json:"timestamp"`
+}
+
+// RedemptionRecord is one redemption, full or partial, against a token
+type RedemptionRecord struct {
+	TokenID   string  `json:"tokenId"`
+	TxID      string  `json:"txId"`
+	UserID    string  `json:"userId"`
+	Amount    float64 `json:"amount"`    // Value released from the token
+	BGTAmount float64 `json:"bgtAmount"` // Metal value credited, after rounding down
+	BSTAmount float64 `json:"bstAmount"`
+	BPTAmount float64 `json:"bptAmount"`
+	BGTGrams  float64 `json:"bgtGrams"`
+	BSTGrams  float64 `json:"bstGrams"`
+	BPTGrams  float64 `json:"bptGrams"`
+	Cash      float64 `json:"cash"` // Paid from the cash buffer
+	Fee       float64 `json:"fee"`
+	Residual  float64 `json:"residual"` // Swept to the treasury
+	NAV       float64 `json:"nav"`      // Per token, at the time of redemption
+	Currency  string  `json:"currency"`
+	Timestamp string  `json:"timestamp"`
+}
+
+// RedemptionRequest is a redemption waiting in, or processed from, the redemption queue
+type RedemptionRequest struct {
+	RequestID   string  `json:"requestId"` // Transaction ID that queued it
+	TokenID     string  `json:"tokenId"`
+	UserID      string  `json:"userId"`
+	Amount      float64 `json:"amount"`
+	Status      string  `json:"status"`
+	QueuedAt    string  `json:"queuedAt"`
+	ProcessedAt string  `json:"processedAt"`
+	Reason      string  `json:"reason,omitempty"`
+}
+
+// PendingSettlement is a redemption's metal delivery waiting out the settlement delay
+type PendingSettlement struct {
+	SettlementID string  `json:"settlementId"` // Redeeming transaction ID and token ID
+	TokenID      string  `json:"tokenId"`
+	UserID       string  `json:"userId"`
+	BGTAmount    float64 `json:"bgtAmount"`
+	BSTAmount    float64 `json:"bstAmount"`
+	BPTAmount    float64 `json:"bptAmount"`
+	Status       string  `json:"status"`
+	CreatedAt    string  `json:"createdAt"`
+	DueAt        string  `json:"dueAt"`
+	SettledAt    string  `json:"settledAt,omitempty"`
+}
+
+// UserTxRecord is one entry in a user's activity feed
+type UserTxRecord struct {
+	UserID       string  `json:"userId"`
+	Type         string  `json:"type"` // "MINT", "TOPUP", "REDEEM", "TRANSFER_IN", "TRANSFER_OUT"
+	TokenID      string  `json:"tokenId"`
+	Amount       float64 `json:"amount"`
+	Counterparty string  `json:"counterparty,omitempty"` // Other user of a transfer
+	Timestamp    string  `json:"timestamp"`
+	TxID         string  `json:"txId"`
+}
+
+// TransferRecord is one transfer, kept under Transfer~<transferID> so it can be reversed
+type TransferRecord struct {
+	TransferID  string  `json:"transferId"` // Transaction ID of the transfer
+	FromUserID  string  `json:"fromUserId"`
+	ToUserID    string  `json:"toUserId"`
+	FromTokenID string  `json:"fromTokenId"`
+	ToTokenID   string  `json:"toTokenId"` // Recipient's token; equals FromTokenID for a whole-token transfer
+	Amount      float64 `json:"amount"`
+	Timestamp   string  `json:"timestamp"`
+	ReversalOf  string  `json:"reversalOf,omitempty"` // Transfer this one reversed
+	ReversedBy  string  `json:"reversedBy,omitempty"` // Transfer that reversed this one
+	ReversedAt  string  `json:"reversedAt,omitempty"`
+}
+
+// FeeRecord is one fee charged to a user
+type FeeRecord struct {
+	Type      string  `json:"type"` // FEE_MINT, FEE_REDEEM or FEE_CONVERSION
+	Amount    float64 `json:"amount"`
+	UserID    string  `json:"userId"`
+	Timestamp string  `json:"timestamp"`
+	TxID      string  `json:"txId"`
+}
+
+// FeeRecordPage is one page of fee records
+type FeeRecordPage struct {
+	Records      []*FeeRecord `json:"records"`
+	FetchedCount int32        `json:"fetchedCount"` // Records scanned, including those outside the date range
+	Bookmark     string       `json:"bookmark"`     // Pass back to fetch the next page; empty when done
+}
+
+// FeeRevenue totals the fees charged over a period
+type FeeRevenue struct {
+	FromDate    string             `json:"fromDate"`
+	ToDate      string             `json:"toDate"`
+	ByType      map[string]float64 `json:"byType"`
+	Total       float64            `json:"total"`
+	RecordCount int                `json:"recordCount"`
+}
+
+// TokenFreezeEvent is the payload of the TokenFrozen and TokenUnfrozen events
+type TokenFreezeEvent struct {
+	EventSeq  uint64 `json:"eventSeq"`
+	TokenID   string `json:"tokenId"`
+	Frozen    bool   `json:"frozen"`
+	Reason    string `json:"reason,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// ComplianceReport lists every restricted user, token and rebalance operation
+type ComplianceReport struct {
+	Blacklist         []*BlacklistEntry `json:"blacklist"`
+	FrozenTokens      []*MBTToken       `json:"frozenTokens"` // Each carries its FreezeReason
+	LockedTokens      []*MBTToken       `json:"lockedTokens"`
+	FlaggedOperations json.RawMessage   `json:"flaggedOperations"` // As returned by the rebalancing chaincode; null if not configured
+	GeneratedAt       string            `json:"generatedAt"`
+}
+
+// StateCategorySize is the number of keys in one category of world state
+type StateCategorySize struct {
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+	Capped   bool   `json:"capped"` // Counting stopped at MAX_STATE_SCAN_KEYS; Count is a lower bound
+}
+
+// StateSize is a per-category key count of a chaincode's world state
+type StateSize struct {
+	Categories []StateCategorySize `json:"categories"`
+	Timestamp  string              `json:"timestamp"`
+}
+
+// TokenPage is one page of an enumeration of all tokens
+type TokenPage struct {
+	Tokens       []*MBTToken `json:"tokens"`
+	FetchedCount int32       `json:"fetchedCount"`
+	Bookmark     string      `json:"bookmark"` // Pass back to fetch the next page; empty when done
+}
+
+// UserTxPage is one page of a user's activity feed
+type UserTxPage struct {
+	Records      []*UserTxRecord `json:"records"`
+	FetchedCount int32           `json:"fetchedCount"` // Records scanned, including those outside the time range
+	Bookmark     string          `json:"bookmark"`     // Pass back to fetch the next page; empty when done
+}
+
+// MetalExposure is one metal's share of a user's holdings
+type MetalExposure struct {
+	Metal   string  `json:"metal"`
+	Grams   float64 `json:"grams"`
+	Value   float64 `json:"value"`
+	Percent float64 `json:"percent"`
+}
+
+// UserMetalExposure breaks down a user's holdings by metal
+type UserMetalExposure struct {
+	UserID     string          `json:"userId"`
+	Metals     []MetalExposure `json:"metals"`
+	TotalValue float64         `json:"totalValue"`
+}
+
+// UserMetalAllocation is one metal's share of a user's holdings against the basket target
+type UserMetalAllocation struct {
+	Metal         string  `json:"metal"`
+	Value         float64 `json:"value"`
+	Percent       float64 `json:"percent"`       // Share of the user's metal value, 0-100
+	TargetPercent float64 `json:"targetPercent"` // Basket target weight, 0-100
+	Deviation     float64 `json:"deviation"`     // Weight against target, in the basket's deviation mode
+}
+
+// UserAllocation compares a user's personal metal allocation with the basket target
+type UserAllocation struct {
+	UserID        string                `json:"userId"`
+	TotalValue    float64               `json:"totalValue"` // Metal value only; cash is excluded
+	DeviationMode string                `json:"deviationMode"`
+	MaxDeviation  float64               `json:"maxDeviation"` // Largest absolute per-metal deviation
+	Metals        []UserMetalAllocation `json:"metals"`
+}
+
+// HolderShare is one owner's aggregate position across their tokens
+type HolderShare struct {
+	Owner         string  `json:"owner"`
+	TokenCount    int     `json:"tokenCount"`
+	Units         float64 `json:"units"`
+	PercentSupply float64 `json:"percentSupply"` // 0-100
+}
+
+// OwnershipDistribution reports how concentrated MBT holdings are
+type OwnershipDistribution struct {
+	HolderCount     int            `json:"holderCount"`
+	TotalUnits      float64        `json:"totalUnits"`
+	TopHolders      []*HolderShare `json:"topHolders"`
+	TopHoldersShare float64        `json:"topHoldersShare"` // 0-100, combined share of TopHolders
+	HerfindahlIndex float64        `json:"herfindahlIndex"` // Sum of squared supply shares, 0-10000
+}
+
+// UserPnL is a user's unrealized gain or loss across all their tokens
+type UserPnL struct {
+	UserID           string  `json:"userId"`
+	TokenCount       int     `json:"tokenCount"`
+	TotalCost        float64 `json:"totalCost"`
+	TotalMarketValue float64 `json:"totalMarketValue"`
+	UnrealizedPnL    float64 `json:"unrealizedPnl"`
+	ReturnPercent    float64 `json:"returnPercent"`
+	ExcludedTokens   int     `json:"excludedTokens"` // Tokens without a cost basis, left out of every total
+}
+
+// NAVQuote is the basket NAV in the basket's currency
+type NAVQuote struct {
+	NAV        float64 `json:"nav"`
+	TotalValue float64 `json:"totalValue"`
+	Supply     float64 `json:"supply"`
+	Currency   string  `json:"currency"`
+}
+
+// MetalNAVContribution is one metal's share of the basket NAV
+type MetalNAVContribution struct {
+	Metal        string  `json:"metal"` // "BGT", "BST", "BPT"
+	Grams        float64 `json:"grams"`
+	Price        float64 `json:"price"`        // Per gram, in the basket currency
+	Value        float64 `json:"value"`
+	PercentOfNAV float64 `json:"percentOfNav"` // 0-100
+}
+
+// NAVBreakdown is the NAV together with each metal's contribution to it
+type NAVBreakdown struct {
+	NAV        float64                `json:"nav"`
+	TotalValue float64                `json:"totalValue"`
+	Supply     float64                `json:"supply"`
+	Currency   string                 `json:"currency"`
+	Cash       float64                `json:"cash"` // Included in TotalValue
+	Metals     []MetalNAVContribution `json:"metals"`
+}
+
+// NAVSnapshot is the NAV recorded at a point in time
+type NAVSnapshot struct {
+	NAV        float64            `json:"nav"`
+	TotalValue float64            `json:"totalValue"`
+	Supply     float64            `json:"supply"`
+	Currency   string             `json:"currency"`
+	Timestamp  string             `json:"timestamp"`
+	Allocation map[string]float64 `json:"allocation,omitempty"` // Metal code → share of value, 0-1
+	Targets    map[string]float64 `json:"targets,omitempty"`    // Metal code → target share, 0-1
+}
+
+// IncomeRecord is income earned by the basket, such as metal lending fees
+type IncomeRecord struct {
+	Amount    float64 `json:"amount"`
+	Source    string  `json:"source"`
+	Timestamp string  `json:"timestamp"`
+	TxID      string  `json:"txId"`
+}
+
+// BasketYield is the income earned over a period against the basket's average AUM
+type BasketYield struct {
+	FromDate        string  `json:"fromDate"`
+	ToDate          string  `json:"toDate"`
+	Days            int     `json:"days"`
+	TotalIncome     float64 `json:"totalIncome"`
+	AverageAUM      float64 `json:"averageAum"`
+	AUMSamples      int     `json:"aumSamples"`      // NAV snapshots averaged; zero means the current value was used
+	AnnualizedYield float64 `json:"annualizedYield"` // Fraction per year, e.g. 0.02 for 2%
+	Currency        string  `json:"currency"`
+}
+
+// DriftPoint is the largest allocation deviation recorded by one NAV snapshot
+type DriftPoint struct {
+	Timestamp    string  `json:"timestamp"`
+	Metal        string  `json:"metal"`        // Metal with the largest deviation
+	MaxDeviation float64 `json:"maxDeviation"` // Absolute, in the current deviation mode
+}
+
+// DailyNAVChange compares the current NAV with the last snapshot from a prior day
+type DailyNAVChange struct {
+	CurrentNAV         float64 `json:"currentNav"`
+	CurrentTimestamp   string  `json:"currentTimestamp"`
+	HasPriorSnapshot   bool    `json:"hasPriorSnapshot"` // False leaves the reference and change fields zero
+	ReferenceNAV       float64 `json:"referenceNav"`
+	ReferenceTimestamp string  `json:"referenceTimestamp"`
+	Change             float64 `json:"change"`
+	ChangePercent      float64 `json:"changePercent"`
+	Currency           string  `json:"currency"`
+}
+
+// RebalanceAdjustment is the change an executed rebalance makes to the basket's
+// holdings, keyed by metal code
+type RebalanceAdjustment struct {
+	Values map[string]float64 `json:"values"` // Value bought (positive) or sold (negative)
+	Grams  map[string]float64 `json:"grams"`  // Weight bought (positive) or sold (negative)
+}
+
+// BasketLimits are the basket's fund capacity rules
+type BasketLimits struct {
+	MaxBasketAUM     float64 `json:"maxBasketAum"`     // Cap on total basket value; zero means unlimited
+	MinMintRemaining float64 `json:"minMintRemaining"` // Capacity below this is too small to mint into
+}
+
+// BasketCapacity reports how much more value the basket can accept
+type BasketCapacity struct {
+	MaxBasketAUM float64 `json:"maxBasketAum"`
+	CurrentAUM   float64 `json:"currentAum"`
+	Remaining    float64 `json:"remaining"` // Zero when unlimited; see Unlimited
+	Unlimited    bool    `json:"unlimited"`
+}
+
+// MetalPrice is a single metal's price with its provenance
+type MetalPrice struct {
+	Metal     string  `json:"metal"`
+	Price     float64 `json:"price"` // Per gram
+	Currency  string  `json:"currency"`
+	Source    string  `json:"source"` // "manual" for an operator override, "quorum" for oracle medians, or "fallback" for reference prices
+	Timestamp string  `json:"timestamp"`
+}
+
+// MetalAllocation is one metal's share of a prospective mint
+type MetalAllocation struct {
+	Metal  string  `json:"metal"` // "BGT", "BST", "BPT"
+	Amount float64 `json:"amount"`
+	Grams  float64 `json:"grams"`
+	Price  float64 `json:"price"` // Per gram
+}
+
+// MintQuote previews what a mint of a given amount would produce
+type MintQuote struct {
+	Amount       float64           `json:"amount"`
+	Units        float64           `json:"units"`        // MBT units that would be issued
+	EffectiveNAV float64           `json:"effectiveNav"` // Price per unit applied by the mint
+	MarketNAV    float64           `json:"marketNav"`    // Current basket NAV; zero with no supply
+	Fee          float64           `json:"fee"`
+	Cash         float64           `json:"cash"` // Held as cash under the buffer rather than allocated to metals
+	Currency     string            `json:"currency"`
+	Allocations  []MetalAllocation `json:"allocations"`
+}
+
+// TokenValuation is a token's cost against its current market value
+type TokenValuation struct {
+	TokenID            string  `json:"tokenId"`
+	Owner              string  `json:"owner"`
+	CostBasis          float64 `json:"costBasis"`
+	CostBasisAvailable bool    `json:"costBasisAvailable"` // False for tokens minted before cost tracking
+	MarketValue        float64 `json:"marketValue"`        // Backing grams at current prices, plus cash
+	UnrealizedPnL      float64 `json:"unrealizedPnl"`      // Zero when the cost basis is unavailable
+	UnrealizedPnLPct   float64 `json:"unrealizedPnlPct"`
+	HoldingPeriodDays  float64 `json:"holdingPeriodDays"`
+	Currency           string  `json:"currency"`
+	ValuedAt           string  `json:"valuedAt"`
+}
+
+// RedeemableToken is how much of one token can be redeemed right now
+type RedeemableToken struct {
+	TokenID    string  `json:"tokenId"`
+	TotalValue float64 `json:"totalValue"`
+	Queued     float64 `json:"queued"`           // Already waiting in the redemption queue
+	Redeemable float64 `json:"redeemable"`       // Zero when Reason is set
+	Reason     string  `json:"reason,omitempty"` // Why nothing can be redeemed
+}
+
+// MaxRedeemable is the total a user can redeem right now across their tokens
+type MaxRedeemable struct {
+	UserID string             `json:"userId"`
+	Total  float64            `json:"total"`
+	Reason string             `json:"reason,omitempty"` // Set when the user cannot redeem at all
+	Tokens []*RedeemableToken `json:"tokens"`
+}
+
+// AlertPreference is a user's alert thresholds; a zero threshold is disabled
+type AlertPreference struct {
+	UserID               string  `json:"userId"`
+	PortfolioDropPercent float64 `json:"portfolioDropPercent"` // Alert when value falls this fraction below ReferenceValue
+	PortfolioBelow       float64 `json:"portfolioBelow"`       // Alert when value falls below this amount
+	ReferenceValue       float64 `json:"referenceValue"`       // Value a drop is measured from; reset when a drop alert fires
+	BelowAlerted         bool    `json:"belowAlerted"`         // PortfolioBelow fired and value has not recovered
+	UpdatedAt            string  `json:"updatedAt"`
+	LastAlertAt          string  `json:"lastAlertAt,omitempty"`
+}
+
+// UserAlert is one alert threshold a user's portfolio crossed
+type UserAlert struct {
+	UserID         string  `json:"userId"`
+	Kind           string  `json:"kind"` // "PORTFOLIO_DROP" or "PORTFOLIO_BELOW"
+	Threshold      float64 `json:"threshold"`
+	Value          float64 `json:"value"`
+	ReferenceValue float64 `json:"referenceValue,omitempty"`
+}
+
+// AlertTriggeredEvent carries every alert raised by one CheckAndEmitAlerts call,
+// since Fabric delivers a single event per transaction
+type AlertTriggeredEvent struct {
+	EventSeq  uint64       `json:"eventSeq"`
+	Alerts    []*UserAlert `json:"alerts"`
+	Timestamp string       `json:"timestamp"`
+}
+
+// MetalChaincodeConfig names the underlying metal token chaincodes
+type MetalChaincodeConfig struct {
+	BGTChaincode string `json:"bgtChaincode"`
+	BSTChaincode string `json:"bstChaincode"`
+	BPTChaincode string `json:"bptChaincode"`
+	OracleChaincode string `json:"oracleChaincode"` // Price and FX rate oracle
+	RebalancingChaincode string `json:"rebalancingChaincode"` // Consulted for in-flight rebalances; empty skips the check
+	Channel      string `json:"channel"` // Empty means the basket's own channel
+}
+
+// OracleQuorum lists the oracle chaincodes metal prices are taken from. With no
+// oracles configured, the reference price table is used instead.
+type OracleQuorum struct {
+	Oracles          []string `json:"oracles"`
+	Quorum           int      `json:"quorum"`           // Minimum number of oracles that must respond
+	TolerancePercent float64  `json:"tolerancePercent"` // Max distance of any response from the median
+}
+
+// PauseFlags records which operations are suspended during an incident
+type PauseFlags struct {
+	MintPaused      bool   `json:"mintPaused"`      // MintMBT, MintMBTInKind and AddToMBT
+	RedeemPaused    bool   `json:"redeemPaused"`    // RedeemMBT and ProcessRedemptionQueue
+	RebalancePaused bool   `json:"rebalancePaused"` // RebalanceBasket, ApplyRebalanceAdjustment and rebalance execution
+	TransferPaused  bool   `json:"transferPaused"`  // TransferMBT
+	UpdatedAt       string `json:"updatedAt,omitempty"`
+}
+
+// ManualPrice is an operator-set metal price that overrides the feed until it expires
+type ManualPrice struct {
+	Metal     string  `json:"metal"`
+	Price     float64 `json:"price"`    // Per gram
+	Currency  string  `json:"currency"` // Basket currency when the price was set
+	ExpiresAt string  `json:"expiresAt"`
+	SetBy     string  `json:"setBy"`
+	SetAt     string  `json:"setAt"`
 }
 
 // MBTBasketContract is the main smart contract for MBT operations
@@ -48,7 +573,7 @@ type MBTBasketContract struct {
 	contractapi.Contract
 }
 
-// Composition percentages (initialized at contract deployment)
+// Default composition, used until a rebalancing chaincode supplies policy targets
 const (
 	GOLD_ALLOCATION   = 0.50  // 50%
 	SILVER_ALLOCATION = 0.30  // 30%
@@ -59,429 +584,6397 @@ const (
 const (
 	MAX_DEVIATION_PERCENT = 0.05 // 5% deviation triggers rebalance
 	REBALANCE_INTERVAL_DAYS = 30 // 30 days maximum between rebalances
+	COMPOSITION_TOLERANCE_PERCENT = 0.05 // Default gap from a target weight still counted as on target
+)
+
+// Deviation calculation modes
+const (
+	DEVIATION_ABSOLUTE = "ABSOLUTE" // Current weight minus target, in percentage points
+	DEVIATION_RELATIVE = "RELATIVE" // Absolute deviation as a fraction of the target
+)
+
+// BASE_CURRENCY is the currency the platform's reference prices are quoted in
+const BASE_CURRENCY = "INR"
+
+// Reference metal prices per gram, by currency. Other currencies are
+// converted from BASE_CURRENCY using the oracle FX rate.
+var metalPricesByCurrency = map[string]map[string]float64{
+	"INR": {
+		"BGT": 5800.0,  // Gold price per gram in INR
+		"BST": 75.0,    // Silver price per gram in INR
+		"BPT": 3200.0,  // Platinum price per gram in INR
+	},
+}
+
+// metalCodes maps friendly metal names to their canonical token codes
+var metalCodes = map[string]string{
+	"gold":     "BGT",
+	"silver":   "BST",
+	"platinum": "BPT",
+}
+
+// normalizeMetal accepts a friendly metal name or a token code in any case and
+// returns the canonical token code
+func normalizeMetal(code string) (string, error) {
+	trimmed := strings.TrimSpace(code)
+	if canonical, ok := metalCodes[strings.ToLower(trimmed)]; ok {
+		return canonical, nil
+	}
+	for _, canonical := range metalCodes {
+		if strings.ToUpper(trimmed) == canonical {
+			return canonical, nil
+		}
+	}
+	return "", fmt.Errorf("unknown metal code %q", code)
+}
+
+// metalName returns the friendly name for a metal code or name
+func metalName(code string) (string, error) {
+	canonical, err := normalizeMetal(code)
+	if err != nil {
+		return "", err
+	}
+	for name, metalCode := range metalCodes {
+		if metalCode == canonical {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown metal code %q", code)
+}
+
+// Contract operating modes
+const (
+	MODE_ACTIVE   = "ACTIVE"
+	MODE_WINDDOWN = "WINDDOWN" // Fund closure: emergency redemptions allowed
+)
+
+// Operations that can be paused independently; PAUSE_ALL pauses every one
+const (
+	PAUSE_MINT      = "MINT"
+	PAUSE_REDEEM    = "REDEEM"
+	PAUSE_REBALANCE = "REBALANCE"
+	PAUSE_TRANSFER  = "TRANSFER"
+	PAUSE_ALL       = "ALL"
+)
+
+// Redemption modes
+const (
+	REDEMPTION_MODE_IMMEDIATE = "IMMEDIATE" // RedeemMBT settles at once
+	REDEMPTION_MODE_QUEUED    = "QUEUED"    // RedeemMBT queues for ProcessRedemptionQueue
+)
+
+// Queued redemption statuses
+const (
+	REDEMPTION_QUEUED   = "QUEUED"
+	REDEMPTION_SETTLED  = "SETTLED"
+	REDEMPTION_REJECTED = "REJECTED" // No longer valid when processed; see Reason
+)
+
+// Metal delivery settlement statuses
+const (
+	SETTLEMENT_PENDING = "PENDING"
+	SETTLEMENT_SETTLED = "SETTLED"
+)
+
+// User activity record types
+const (
+	USER_TX_MINT         = "MINT"
+	USER_TX_TOPUP        = "TOPUP"
+	USER_TX_REDEEM       = "REDEEM"
+	USER_TX_TRANSFER_IN  = "TRANSFER_IN"
+	USER_TX_TRANSFER_OUT = "TRANSFER_OUT"
+)
+
+// Fee record types
+const (
+	FEE_MINT       = "MINT"
+	FEE_REDEEM     = "REDEEM"
+	FEE_CONVERSION = "CONVERSION"
+)
+
+// ErrConcurrentModification is returned when a record is written from a copy that
+// does not match its committed version. Reads never see the transaction's own
+// writes, so within a chaincode call this only fires when one transaction writes
+// the same record twice, which is a bug. Conflicts between concurrent transactions
+// are caught by Fabric's read-set validation at commit, which invalidates the later
+// transaction with MVCC_READ_CONFLICT; clients should resubmit it.
+var ErrConcurrentModification = errors.New("concurrent modification")
+
+// DEFAULT_REVERSAL_WINDOW_HOURS is how long a transfer stays reversible until
+// SetReversalWindowHours is called
+const DEFAULT_REVERSAL_WINDOW_HOURS = 24
+
+// ErrNotFound is returned when a requested record does not exist
+var ErrNotFound = errors.New("not found")
+
+// MAX_BATCH_SIZE caps the number of tokens fetched in one batch lookup
+const MAX_BATCH_SIZE = 100
+
+// MAX_STATE_SCAN_KEYS caps the keys counted per category by GetStateSize
+const MAX_STATE_SCAN_KEYS = 10000
+
+// Token metadata limits
+const (
+	MAX_METADATA_ENTRIES = 20
+	MAX_METADATA_LENGTH  = 128 // Per key and per value
+)
+
+// REDEMPTION_CREDIT_DECIMALS is the precision metal credits are paid at on
+// redemption; the rounded-off remainder is swept to the treasury
+const REDEMPTION_CREDIT_DECIMALS = 2
+
+// Holdings accounting guards
+const (
+	HOLDINGS_EPSILON        = 1e-9  // Float dust below this is treated as zero
+	CLAMP_NEGATIVE_HOLDINGS = false // Clamp negative holdings to zero with a warning instead of rejecting
 )
 
 // MintMBT mints new MBT tokens by allocating funds to BGT, BST, BPT
 func (c *MBTBasketContract) MintMBT(ctx contractapi.TransactionContextInterface, 
 	owner string, totalAmount float64, userID string) error {
 	
-	log.Printf("Minting MBT tokens: Owner=%s, Amount=%.2f, UserID=%s", owner, totalAmount, userID)
+	return c.mintMBT(ctx, owner, totalAmount, userID, nil)
+}
+
+// MintMBTWithMetadata mints new MBT tokens tagged with client metadata
+func (c *MBTBasketContract) MintMBTWithMetadata(ctx contractapi.TransactionContextInterface, 
+	owner string, totalAmount float64, userID string, metadataJSON string) error {
 	
-	// Verify user has sufficient balance or payment
-	balance, err := c.GetUserBalance(ctx, userID, totalAmount)
+	metadata, err := parseTokenMetadata(metadataJSON)
 	if err != nil {
-		return fmt.Errorf("failed to get user balance: %v", err)
-	}
-	if balance < totalAmount {
-		return fmt.Errorf("insufficient balance: required %.2f, available %.2f", totalAmount, balance)
+		return err
 	}
 	
-	// Calculate allocation amounts
-	goldAmount := totalAmount * GOLD_ALLOCATION
-	silverAmount := totalAmount * SILVER_ALLOCATION
-	platinumAmount := totalAmount * PLATINUM_ALLOCATION
-	
-	// Generate unique token ID
-	tokenID := fmt.Sprintf("MBT-%d", time.Now().UnixNano())
+	return c.mintMBT(ctx, owner, totalAmount, userID, metadata)
+}
+
+// MintMBTByMetalWeight mints the basket amount whose share of one metal is the
+// requested weight in grams at current prices
+func (c *MBTBasketContract) MintMBTByMetalWeight(ctx contractapi.TransactionContextInterface, 
+	owner, metal string, grams float64, userID string) error {
 	
-	// Create MBT token record
-	mbtToken := MBTToken{
-		TokenID:     tokenID,
-		Owner:       owner,
-		TotalValue:  totalAmount,
-		BGTAmount:   goldAmount,
-		BSTAmount:   silverAmount,
-		BPTAmount:   platinumAmount,
-		CreationTime: time.Now().Format(time.RFC3339),
-		LastRebalance: time.Now().Format(time.RFC3339),
-		Composition: MetalComposition{
-			Gold:     GOLD_ALLOCATION * 100,
-			Silver:   SILVER_ALLOCATION * 100,
-			Platinum: PLATINUM_ALLOCATION * 100,
-		},
+	metal, err := normalizeMetal(metal)
+	if err != nil {
+		return err
 	}
 	
-	// Store MBT token
-	tokenJSON, err := json.Marshal(mbtToken)
-	if err != nil {
-		return fmt.Errorf("failed to marshal token: %v", err)
+	if grams <= 0 {
+		return fmt.Errorf("grams must be positive")
 	}
 	
-	err = ctx.GetStub().PutState(tokenID, tokenJSON)
+	prices, err := c.GetMBTPrices(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to store token: %v", err)
+		return fmt.Errorf("failed to get metal prices: %v", err)
 	}
 	
-	// Deduct payment from user account
-	err = c.DeductUserBalance(ctx, userID, totalAmount)
+	targets, err := c.GetBasketCompositionTargets(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to deduct balance: %v", err)
+		return err
+	}
+	if targets[metal] <= 0 {
+		return fmt.Errorf("%s has no target allocation", metal)
 	}
 	
-	// Allocate to underlying metal tokens (simulate blockchain calls)
-	err = c.AllocateToMetalTokens(ctx, userID, goldAmount, silverAmount, platinumAmount)
+	cashBuffer, err := cashBufferPercent(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to allocate to metal tokens: %v", err)
+		return err
 	}
 	
-	// Update basket holdings
-	err = c.UpdateBasketHoldings(ctx, totalAmount, goldAmount, silverAmount, platinumAmount, true)
+	feePercent, err := c.GetMintFeePercent(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to update basket holdings: %v", err)
+		return err
 	}
 	
-	log.Printf("Successfully minted MBT token: %s", tokenID)
-	return nil
+	// Invert mintAllocation: metal value = net * (1 - buffer) * target = grams * price,
+	// grossed up so the net left after the mint fee buys the requested weight
+	totalAmount := grams * prices[metal] / (targets[metal] * (1 - cashBuffer) * (1 - feePercent))
+	
+	log.Printf("Minting by weight: %.4f g of %s requires %.2f", grams, metal, totalAmount)
+	return c.mintMBT(ctx, owner, totalAmount, userID, nil)
 }
 
-// AllocateToMetalTokens simulates allocation to BGT, BST, BPT tokens
-func (c *MBTBasketContract) AllocateToMetalTokens(ctx contractapi.TransactionContextInterface, 
-	userID string, goldAmount, silverAmount, platinumAmount float64) error {
+// mintMBT performs a mint for the exported mint variants
+func (c *MBTBasketContract) mintMBT(ctx contractapi.TransactionContextInterface, 
+	owner string, totalAmount float64, userID string, metadata map[string]string) error {
 	
-	// In a real implementation, this would interact with BGT, BST, BPT chaincodes
-	log.Printf("Allocating to metal tokens: Gold=%.2f, Silver=%.2f, Platinum=%.2f", 
-		goldAmount, silverAmount, platinumAmount)
+	log.Printf("Minting MBT tokens: Owner=%s, Amount=%.2f, UserID=%s", owner, totalAmount, userID)
 	
-	// Simulate successful allocation
-	return nil
-}
-
-// GetMBTToken retrieves MBT token information
-func (c *MBTBasketContract) GetMBTToken(ctx contractapi.TransactionContextInterface, tokenID string) (*MBTToken, error) {
-	tokenJSON, err := ctx.GetStub().GetState(tokenID)
+	err := requireUserOrAdmin(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read token data: %v", err)
+		return err
 	}
 	
-	if tokenJSON == nil {
-		return nil, fmt.Errorf("token %s does not exist", tokenID)
+	err = c.checkMintAllowed(ctx, owner, userID, totalAmount)
+	if err != nil {
+		return err
 	}
 	
-	var token MBTToken
-	err = json.Unmarshal(tokenJSON, &token)
+	// Verify user has sufficient balance or payment
+	balance, err := c.GetUserBalance(ctx, userID, totalAmount)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal token: %v", err)
+		return fmt.Errorf("failed to get user balance: %v", err)
+	}
+	if balance < totalAmount {
+		return fmt.Errorf("insufficient balance: required %.2f, available %.2f", totalAmount, balance)
+	}
+	
+	// Take the fee; the net is allocated and issued at par
+	feePercent, err := c.GetMintFeePercent(ctx)
+	if err != nil {
+		return err
+	}
+	pricing := priceMint(totalAmount, feePercent)
+	
+	// Calculate allocation amounts, converted to grams at current prices;
+	// grams stay fixed afterwards
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get metal prices: %v", err)
+	}
+	targets, err := c.GetBasketCompositionTargets(ctx)
+	if err != nil {
+		return err
+	}
+	cashBuffer, err := cashBufferPercent(ctx)
+	if err != nil {
+		return err
+	}
+	amounts, grams, cash, err := mintAllocation(pricing.Net, cashBuffer, prices, targets)
+	if err != nil {
+		return err
+	}
+	
+	// Deduct payment from user account
+	err = c.DeductUserBalance(ctx, userID, totalAmount)
+	if err != nil {
+		return fmt.Errorf("failed to deduct balance: %v", err)
+	}
+	
+	err = chargeMintFee(ctx, pricing.Fee, userID)
+	if err != nil {
+		return err
+	}
+	
+	return c.issueMBT(ctx, owner, userID, pricing.Net, totalAmount, cash, amounts, grams, targets, metadata, false)
+}
+
+// MintMBTInKind mints MBT against metal tokens deposited by the user instead of cash.
+// Amounts are in grams and are valued at current prices; a deposit whose value split
+// strays from the target composition by more than the composition tolerance is rejected
+// unless rebalanceAfter is set, in which case the deposit is accepted and the basket is
+// flagged for rebalance.
+func (c *MBTBasketContract) MintMBTInKind(ctx contractapi.TransactionContextInterface, 
+	owner string, bgtAmount float64, bstAmount float64, bptAmount float64, userID string, rebalanceAfter bool) error {
+	
+	grams := map[string]float64{"BGT": bgtAmount, "BST": bstAmount, "BPT": bptAmount}
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		if grams[metal] < 0 {
+			return fmt.Errorf("deposit of %s cannot be negative", metal)
+		}
+	}
+	
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get metal prices: %v", err)
+	}
+	targets, err := c.GetBasketCompositionTargets(ctx)
+	if err != nil {
+		return err
+	}
+	
+	amounts := map[string]float64{}
+	totalAmount := 0.0
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		amounts[metal] = grams[metal] * prices[metal]
+		totalAmount += amounts[metal]
+	}
+	if totalAmount <= 0 {
+		return fmt.Errorf("deposit must contain at least one metal")
+	}
+	
+	tolerance, err := compositionTolerance(ctx)
+	if err != nil {
+		return err
+	}
+	
+	// Token composition records the split actually deposited
+	weights := map[string]float64{}
+	offComposition := false
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		weights[metal] = amounts[metal] / totalAmount
+		if math.Abs(weights[metal]-targets[metal]) <= tolerance {
+			continue
+		}
+		if !rebalanceAfter {
+			return fmt.Errorf("deposit is off-composition: %s is %.2f%% of value, target %.2f%%", 
+				metal, weights[metal]*100, targets[metal]*100)
+		}
+		offComposition = true
+	}
+	
+	log.Printf("Minting MBT in kind: Owner=%s, Value=%.2f, UserID=%s", owner, totalAmount, userID)
+	
+	err = requireUserOrAdmin(ctx, userID)
+	if err != nil {
+		return err
+	}
+	
+	err = c.checkMintAllowed(ctx, owner, userID, totalAmount)
+	if err != nil {
+		return err
+	}
+	
+	// Fees are charged in currency, so a deposit in kind pays none and the token
+	// is issued at the full value deposited
+	err = c.collectMetalDeposit(ctx, userID, grams)
+	if err != nil {
+		return fmt.Errorf("failed to collect metal deposit: %v", err)
+	}
+	
+	return c.issueMBT(ctx, owner, userID, totalAmount, totalAmount, 0, amounts, grams, weights, nil, offComposition)
+}
+
+// checkMintAllowed runs the guards every path that issues new MBT value shares: the
+// mint pause, sanctions screening of payer and owner, the basket capacity and the
+// rebalance-in-progress check
+func (c *MBTBasketContract) checkMintAllowed(ctx contractapi.TransactionContextInterface, 
+	owner, userID string, amount float64) error {
+	
+	err := checkNotPaused(ctx, PAUSE_MINT)
+	if err != nil {
+		return err
+	}
+	
+	err = checkNotBlacklisted(ctx, owner)
+	if err != nil {
+		return err
+	}
+	err = checkNotBlacklisted(ctx, userID)
+	if err != nil {
+		return err
+	}
+	
+	err = c.checkCapacity(ctx, amount)
+	if err != nil {
+		return err
+	}
+	
+	return checkBasketNotBusy(ctx)
+}
+
+// mintPricing is what a cash mint of a gross amount pays and issues
+type mintPricing struct {
+	Net float64 // Left after the fee; allocated to the basket and issued as token value
+	Fee float64
+}
+
+// priceMint takes the fee from a gross mint amount. Token value is denominated in the
+// basket currency and issued at par, so the net is both what the basket receives and
+// what the token's TotalValue and the supply grow by. Every cash mint path and the
+// mint quote go through here.
+func priceMint(amount, feePercent float64) *mintPricing {
+	netPaise, feePaise := splitFee(amount, feePercent)
+	return &mintPricing{
+		Net: float64(netPaise) / 100,
+		Fee: float64(feePaise) / 100,
+	}
+}
+
+// chargeMintFee records a mint fee and sweeps it to the treasury
+func chargeMintFee(ctx contractapi.TransactionContextInterface, fee float64, userID string) error {
+	err := recordFee(ctx, FEE_MINT, fee, userID)
+	if err != nil {
+		return err
+	}
+	
+	return sweepToTreasury(ctx, fee)
+}
+
+// issueMBT creates and stores a token for a mint that has already been paid for,
+// allocating the metal amounts, keeping cash in the buffer and updating basket holdings.
+// The token is issued at par for totalAmount, the sum of the metal amounts and cash,
+// and records the amount paid, fee included, as its cost basis. flagRebalance marks
+// the basket for rebalance whatever its deviation after the mint.
+func (c *MBTBasketContract) issueMBT(ctx contractapi.TransactionContextInterface, owner string, userID string, 
+	totalAmount, costBasis, cash float64, amounts, grams, weights map[string]float64, metadata map[string]string, 
+	flagRebalance bool) error {
+	
+	goldAmount, silverAmount, platinumAmount := amounts["BGT"], amounts["BST"], amounts["BPT"]
+	goldGrams, silverGrams, platinumGrams := grams["BGT"], grams["BST"], grams["BPT"]
+	
+	// Derive the token ID and times from the transaction so every endorsing peer
+	// writes the same token
+	tokenID := "MBT-" + ctx.GetStub().GetTxID()
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	
+	// Create MBT token record
+	mbtToken := MBTToken{
+		TokenID:     tokenID,
+		Owner:       owner,
+		TotalValue:  totalAmount,
+		BGTAmount:   goldAmount,
+		BSTAmount:   silverAmount,
+		BPTAmount:   platinumAmount,
+		BGTGrams:    goldGrams,
+		BSTGrams:    silverGrams,
+		BPTGrams:    platinumGrams,
+		CostBasis:   costBasis,
+		CashAmount:  cash,
+		Metadata:    metadata,
+		CreationTime: now.Format(time.RFC3339),
+		LastRebalance: now.Format(time.RFC3339),
+		Composition: MetalComposition{
+			Gold:     weights["BGT"] * 100,
+			Silver:   weights["BST"] * 100,
+			Platinum: weights["BPT"] * 100,
+		},
+	}
+	
+	// Allocate to underlying metal tokens; on failure the token is never stored
+	err = c.AllocateToMetalTokens(ctx, userID, goldAmount, silverAmount, platinumAmount)
+	if err != nil {
+		return fmt.Errorf("failed to allocate to metal tokens: %v", err)
+	}
+	
+	// Store MBT token
+	err = c.putMBTToken(ctx, &mbtToken)
+	if err != nil {
+		return err
+	}
+	
+	err = putTokenDateIndex(ctx, &mbtToken)
+	if err != nil {
+		return err
+	}
+	
+	// Update basket holdings
+	err = c.updateBasketHoldings(ctx, totalAmount, goldAmount, silverAmount, platinumAmount, cash, 
+		goldGrams, silverGrams, platinumGrams, true, flagRebalance)
+	if err != nil {
+		return fmt.Errorf("failed to update basket holdings: %v", err)
+	}
+	
+	err = recordUserTx(ctx, userID, USER_TX_MINT, tokenID, costBasis, "")
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Successfully minted MBT token: %s", tokenID)
+	return nil
+}
+
+// mintAllocation sets aside the cash buffer share of a mint amount, splits the rest
+// across metals by the target composition and converts each share to grams, both
+// keyed by metal code
+func mintAllocation(totalAmount, cashBuffer float64, prices, targets map[string]float64) (amounts, grams map[string]float64, cash float64, err error) {
+	cash = totalAmount * cashBuffer
+	metalAmount := totalAmount - cash
+	amounts = map[string]float64{
+		"BGT": metalAmount * targets["BGT"],
+		"BST": metalAmount * targets["BST"],
+		"BPT": metalAmount * targets["BPT"],
+	}
+	grams = map[string]float64{}
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		grams[metal], err = safeDivide(amounts[metal], prices[metal])
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to convert %s to grams: %v", metal, err)
+		}
+	}
+	return amounts, grams, cash, nil
+}
+
+// GetMintQuote previews a mint of the given amount without writing state, priced as
+// mintMBT prices it: the mint fee is taken first and the net is issued at par, one
+// unit per unit of currency, so the effective NAV is always 1. The basket's market
+// NAV is reported alongside for comparison.
+func (c *MBTBasketContract) GetMintQuote(ctx contractapi.TransactionContextInterface, amount float64) (*MintQuote, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("mint amount must be positive")
+	}
+	
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metal prices: %v", err)
+	}
+	
+	feePercent, err := c.GetMintFeePercent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	pricing := priceMint(amount, feePercent)
+	
+	nav, err := c.GetMBTNAV(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	targets, err := c.GetBasketCompositionTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	cashBuffer, err := cashBufferPercent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	amounts, grams, cash, err := mintAllocation(pricing.Net, cashBuffer, prices, targets)
+	if err != nil {
+		return nil, err
+	}
+	
+	quote := &MintQuote{
+		Amount:       amount,
+		Units:        pricing.Net,
+		EffectiveNAV: 1,
+		MarketNAV:    nav.NAV,
+		Fee:          pricing.Fee,
+		Cash:         cash,
+		Currency:     nav.Currency,
+		Allocations:  []MetalAllocation{},
+	}
+	
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		quote.Allocations = append(quote.Allocations, MetalAllocation{
+			Metal:  metal,
+			Amount: amounts[metal],
+			Grams:  grams[metal],
+			Price:  prices[metal],
+		})
+	}
+	
+	return quote, nil
+}
+
+// GetMintFeePercent retrieves the fee taken from every cash mint and top-up, as a
+// fraction of the amount paid
+func (c *MBTBasketContract) GetMintFeePercent(ctx contractapi.TransactionContextInterface) (float64, error) {
+	feeBytes, err := ctx.GetStub().GetState("MINT_FEE_PERCENT")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read mint fee: %v", err)
+	}
+	
+	if feeBytes == nil {
+		return 0, nil // No fee until one is set
+	}
+	
+	feePercent, err := strconv.ParseFloat(string(feeBytes), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mint fee: %v", err)
+	}
+	
+	return feePercent, nil
+}
+
+// SetMintFeePercent sets the mint fee as a fraction of the amount paid (admin only)
+func (c *MBTBasketContract) SetMintFeePercent(ctx contractapi.TransactionContextInterface, feePercent float64) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if math.IsNaN(feePercent) || feePercent < 0 || feePercent >= 1 {
+		return fmt.Errorf("mint fee must be at least 0 and below 1, got %v", feePercent)
+	}
+	
+	err = putFloatState(ctx, "MINT_FEE_PERCENT", feePercent)
+	if err != nil {
+		return fmt.Errorf("failed to store mint fee: %v", err)
+	}
+	
+	log.Printf("Mint fee set to %.4f%%", feePercent*100)
+	return nil
+}
+
+// AddToMBT tops up an existing MBT token, allocating the additional amount by the
+// token's composition. Cost basis grows by the amount paid, so the average cost
+// per unit stays weighted across all contributions.
+func (c *MBTBasketContract) AddToMBT(ctx contractapi.TransactionContextInterface, 
+	tokenID string, additionalAmount float64, userID string) error {
+	
+	log.Printf("Adding to MBT token: TokenID=%s, Amount=%.2f, UserID=%s", tokenID, additionalAmount, userID)
+	
+	if additionalAmount <= 0 {
+		return fmt.Errorf("additional amount must be positive")
+	}
+	
+	err := requireUserOrAdmin(ctx, userID)
+	if err != nil {
+		return err
+	}
+	
+	token, err := c.GetMBTToken(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	
+	// Verify ownership
+	if token.Owner != userID {
+		return fmt.Errorf("unauthorized: user does not own this token")
+	}
+	
+	if token.Locked {
+		return fmt.Errorf("token %s is locked", tokenID)
+	}
+	
+	err = checkNotFrozen(token)
+	if err != nil {
+		return err
+	}
+	
+	err = c.checkMintAllowed(ctx, token.Owner, userID, additionalAmount)
+	if err != nil {
+		return err
+	}
+	
+	balance, err := c.GetUserBalance(ctx, userID, additionalAmount)
+	if err != nil {
+		return fmt.Errorf("failed to get user balance: %v", err)
+	}
+	if balance < additionalAmount {
+		return fmt.Errorf("insufficient balance: required %.2f, available %.2f", additionalAmount, balance)
+	}
+	
+	feePercent, err := c.GetMintFeePercent(ctx)
+	if err != nil {
+		return err
+	}
+	pricing := priceMint(additionalAmount, feePercent)
+	
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get metal prices: %v", err)
+	}
+	
+	cashBuffer, err := cashBufferPercent(ctx)
+	if err != nil {
+		return err
+	}
+	
+	// Keep the cash buffer share of the net and allocate the rest by the token's own composition
+	cash := pricing.Net * cashBuffer
+	metalAmount := pricing.Net - cash
+	goldAmount := metalAmount * token.Composition.Gold / 100
+	silverAmount := metalAmount * token.Composition.Silver / 100
+	platinumAmount := metalAmount * token.Composition.Platinum / 100
+	goldGrams := goldAmount / prices["BGT"]
+	silverGrams := silverAmount / prices["BST"]
+	platinumGrams := platinumAmount / prices["BPT"]
+	
+	token.TotalValue += pricing.Net
+	token.BGTAmount += goldAmount
+	token.BSTAmount += silverAmount
+	token.BPTAmount += platinumAmount
+	token.BGTGrams += goldGrams
+	token.BSTGrams += silverGrams
+	token.BPTGrams += platinumGrams
+	token.CashAmount += cash
+	token.CostBasis += additionalAmount
+	
+	err = c.putMBTToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	
+	err = c.DeductUserBalance(ctx, userID, additionalAmount)
+	if err != nil {
+		return fmt.Errorf("failed to deduct balance: %v", err)
+	}
+	
+	err = chargeMintFee(ctx, pricing.Fee, userID)
+	if err != nil {
+		return err
+	}
+	
+	err = c.AllocateToMetalTokens(ctx, userID, goldAmount, silverAmount, platinumAmount)
+	if err != nil {
+		return fmt.Errorf("failed to allocate to metal tokens: %v", err)
+	}
+	
+	err = c.UpdateBasketHoldings(ctx, pricing.Net, goldAmount, silverAmount, platinumAmount, cash, 
+		goldGrams, silverGrams, platinumGrams, true)
+	if err != nil {
+		return fmt.Errorf("failed to update basket holdings: %v", err)
+	}
+	
+	err = recordUserTx(ctx, userID, USER_TX_TOPUP, tokenID, additionalAmount, "")
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Successfully added to MBT token: %s", tokenID)
+	return nil
+}
+
+// AllocateToMetalTokens credits the user's allocation on the BGT, BST, BPT chaincodes
+func (c *MBTBasketContract) AllocateToMetalTokens(ctx contractapi.TransactionContextInterface, 
+	userID string, goldAmount, silverAmount, platinumAmount float64) error {
+	
+	log.Printf("Allocating to metal tokens: Gold=%.2f, Silver=%.2f, Platinum=%.2f", 
+		goldAmount, silverAmount, platinumAmount)
+	
+	amounts := map[string]float64{"BGT": goldAmount, "BST": silverAmount, "BPT": platinumAmount}
+	completed := []string{}
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		err := c.InvokeMetalTokenChaincode(ctx, metal, "credit", userID, amounts[metal])
+		if err != nil {
+			rollbackErr := c.reverseMetalAllocations(ctx, userID, completed, amounts)
+			if rollbackErr != nil {
+				return fmt.Errorf("%v (rollback also failed: %v)", err, rollbackErr)
+			}
+			return err
+		}
+		completed = append(completed, metal)
+	}
+	
+	return nil
+}
+
+// reverseMetalAllocations debits metals already credited by a failed allocation,
+// most recent first. Every reversal is attempted; the first failure is returned.
+func (c *MBTBasketContract) reverseMetalAllocations(ctx contractapi.TransactionContextInterface, 
+	userID string, completed []string, amounts map[string]float64) error {
+	
+	var firstErr error
+	for i := len(completed) - 1; i >= 0; i-- {
+		metal := completed[i]
+		err := c.InvokeMetalTokenChaincode(ctx, metal, "debit", userID, amounts[metal])
+		if err != nil {
+			log.Printf("Failed to reverse %s allocation of %.2f for %s: %v", metal, amounts[metal], userID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		log.Printf("Reversed %s allocation of %.2f for %s", metal, amounts[metal], userID)
+	}
+	
+	return firstErr
+}
+
+// InvokeMetalTokenChaincode calls a function on the chaincode backing the given metal
+func (c *MBTBasketContract) InvokeMetalTokenChaincode(ctx contractapi.TransactionContextInterface, 
+	metal, function, userID string, amount float64) error {
+	
+	if amount == 0 {
+		return nil
+	}
+	
+	metal, err := normalizeMetal(metal)
+	if err != nil {
+		return err
+	}
+	
+	config, err := c.GetMetalChaincodeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	
+	chaincodeName := ""
+	switch metal {
+	case "BGT":
+		chaincodeName = config.BGTChaincode
+	case "BST":
+		chaincodeName = config.BSTChaincode
+	case "BPT":
+		chaincodeName = config.BPTChaincode
+	default:
+		return fmt.Errorf("unknown metal token %s", metal)
+	}
+	
+	args := [][]byte{
+		[]byte(function),
+		[]byte(userID),
+		[]byte(strconv.FormatFloat(amount, 'f', -1, 64)),
+	}
+	
+	response := ctx.GetStub().InvokeChaincode(chaincodeName, args, config.Channel)
+	if response.Status != shim.OK {
+		return fmt.Errorf("%s %s on %s failed with status %d: %s", 
+			function, metal, chaincodeName, response.Status, response.Message)
+	}
+	
+	log.Printf("Invoked %s.%s for user %s: %.2f", chaincodeName, function, userID, amount)
+	return nil
+}
+
+// GetMetalChaincodeConfig retrieves the metal token chaincode configuration
+func (c *MBTBasketContract) GetMetalChaincodeConfig(ctx contractapi.TransactionContextInterface) (*MetalChaincodeConfig, error) {
+	return getMetalChaincodeConfig(ctx)
+}
+
+// getMetalChaincodeConfig reads the external chaincode configuration shared by both contracts
+func getMetalChaincodeConfig(ctx contractapi.TransactionContextInterface) (*MetalChaincodeConfig, error) {
+	configJSON, err := ctx.GetStub().GetState("METAL_CHAINCODE_CONFIG")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metal chaincode config: %v", err)
+	}
+	
+	if configJSON == nil {
+		// Default to the standard chaincode names on the same channel
+		return &MetalChaincodeConfig{
+			BGTChaincode: "bgt",
+			BSTChaincode: "bst",
+			BPTChaincode: "bpt",
+			OracleChaincode: "price-oracle",
+		}, nil
+	}
+	
+	var config MetalChaincodeConfig
+	err = json.Unmarshal(configJSON, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metal chaincode config: %v", err)
+	}
+	
+	return &config, nil
+}
+
+// SetMetalChaincodeConfig stores the metal token chaincode names and channel (admin only)
+func (c *MBTBasketContract) SetMetalChaincodeConfig(ctx contractapi.TransactionContextInterface, configJSON string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	var config MetalChaincodeConfig
+	err = json.Unmarshal([]byte(configJSON), &config)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal metal chaincode config: %v", err)
+	}
+	
+	if config.BGTChaincode == "" || config.BSTChaincode == "" || config.BPTChaincode == "" {
+		return fmt.Errorf("all metal chaincode names are required")
+	}
+	
+	if config.OracleChaincode == "" {
+		config.OracleChaincode = "price-oracle"
+	}
+	
+	storedJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metal chaincode config: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState("METAL_CHAINCODE_CONFIG", storedJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store metal chaincode config: %v", err)
+	}
+	
+	return nil
+}
+
+// GetBasketLimits retrieves the basket capacity limits; none are set by default
+func (c *MBTBasketContract) GetBasketLimits(ctx contractapi.TransactionContextInterface) (*BasketLimits, error) {
+	limitsJSON, err := ctx.GetStub().GetState("BASKET_LIMITS")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read basket limits: %v", err)
+	}
+	
+	if limitsJSON == nil {
+		return &BasketLimits{}, nil
+	}
+	
+	var limits BasketLimits
+	err = json.Unmarshal(limitsJSON, &limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal basket limits: %v", err)
+	}
+	
+	return &limits, nil
+}
+
+// SetBasketLimits stores the basket capacity limits (admin only)
+func (c *MBTBasketContract) SetBasketLimits(ctx contractapi.TransactionContextInterface, limitsJSON string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	var limits BasketLimits
+	err = json.Unmarshal([]byte(limitsJSON), &limits)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal basket limits: %v", err)
+	}
+	
+	if limits.MaxBasketAUM < 0 || limits.MinMintRemaining < 0 {
+		return fmt.Errorf("basket limits must not be negative")
+	}
+	
+	storedJSON, err := json.Marshal(limits)
+	if err != nil {
+		return fmt.Errorf("failed to marshal basket limits: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState("BASKET_LIMITS", storedJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store basket limits: %v", err)
+	}
+	
+	return nil
+}
+
+// GetRemainingCapacity reports how much more value can be minted into the basket.
+// Once remaining capacity falls below MinMintRemaining the basket is treated as full.
+func (c *MBTBasketContract) GetRemainingCapacity(ctx contractapi.TransactionContextInterface) (*BasketCapacity, error) {
+	limits, err := c.GetBasketLimits(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	capacity := &BasketCapacity{
+		MaxBasketAUM: limits.MaxBasketAUM,
+		CurrentAUM:   holdings.TotalBGTValue + holdings.TotalBSTValue + holdings.TotalBPTValue,
+		Unlimited:    limits.MaxBasketAUM == 0,
+	}
+	
+	if capacity.Unlimited {
+		return capacity, nil
+	}
+	
+	capacity.Remaining = limits.MaxBasketAUM - capacity.CurrentAUM
+	if capacity.Remaining < limits.MinMintRemaining || capacity.Remaining < 0 {
+		capacity.Remaining = 0
+	}
+	
+	return capacity, nil
+}
+
+// checkCapacity rejects adding amount to the basket if it would exceed MaxBasketAUM
+func (c *MBTBasketContract) checkCapacity(ctx contractapi.TransactionContextInterface, amount float64) error {
+	capacity, err := c.GetRemainingCapacity(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if !capacity.Unlimited && amount > capacity.Remaining {
+		return fmt.Errorf("mint of %.2f exceeds basket capacity: %.2f remaining", amount, capacity.Remaining)
+	}
+	
+	return nil
+}
+
+// GetMBTToken retrieves MBT token information
+func (c *MBTBasketContract) GetMBTToken(ctx contractapi.TransactionContextInterface, tokenID string) (*MBTToken, error) {
+	tokenJSON, err := ctx.GetStub().GetState(tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token data: %v", err)
+	}
+	
+	if tokenJSON == nil {
+		return nil, fmt.Errorf("token %s does not exist", tokenID)
+	}
+	
+	var token MBTToken
+	err = json.Unmarshal(tokenJSON, &token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token: %v", err)
+	}
+	
+	return &token, nil
+}
+
+// putMBTToken stores a token and increments its version, rejecting the write with
+// ErrConcurrentModification if the token was already written in this transaction.
+// A new token must have version 0. The OwnerToken index follows any change of owner.
+func (c *MBTBasketContract) putMBTToken(ctx contractapi.TransactionContextInterface, token *MBTToken) error {
+	storedJSON, err := ctx.GetStub().GetState(token.TokenID)
+	if err != nil {
+		return fmt.Errorf("failed to read token data: %v", err)
+	}
+	
+	storedVersion := uint64(0)
+	storedOwner := ""
+	if storedJSON != nil {
+		var stored MBTToken
+		err = json.Unmarshal(storedJSON, &stored)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal token: %v", err)
+		}
+		storedVersion = stored.Version
+		storedOwner = stored.Owner
+	}
+	
+	if storedVersion != token.Version {
+		return fmt.Errorf("%w: token %s at version %d, update based on version %d", 
+			ErrConcurrentModification, token.TokenID, storedVersion, token.Version)
+	}
+	
+	err = checkFinite("token "+token.TokenID,
+		numericField{"TotalValue", token.TotalValue},
+		numericField{"BGTAmount", token.BGTAmount},
+		numericField{"BSTAmount", token.BSTAmount},
+		numericField{"BPTAmount", token.BPTAmount},
+		numericField{"BGTGrams", token.BGTGrams},
+		numericField{"BSTGrams", token.BSTGrams},
+		numericField{"BPTGrams", token.BPTGrams},
+		numericField{"CostBasis", token.CostBasis},
+		numericField{"CashAmount", token.CashAmount},
+	)
+	if err != nil {
+		return err
+	}
+	
+	token.Version++
+	
+	tokenJSON, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal token: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(token.TokenID, tokenJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store token: %v", err)
+	}
+	
+	if storedOwner != token.Owner {
+		if storedOwner != "" {
+			err = deleteOwnerIndex(ctx, storedOwner, token.TokenID)
+			if err != nil {
+				return err
+			}
+		}
+		err = putOwnerIndex(ctx, token.Owner, token.TokenID)
+		if err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+// deleteMBTToken removes a token and its OwnerToken index entry
+func deleteMBTToken(ctx contractapi.TransactionContextInterface, token *MBTToken) error {
+	err := ctx.GetStub().DelState(token.TokenID)
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %v", err)
+	}
+	
+	err = deleteTokenDateIndex(ctx, token)
+	if err != nil {
+		return err
+	}
+	
+	return deleteOwnerIndex(ctx, token.Owner, token.TokenID)
+}
+
+// tokenDateIndexKey builds the TokenByDate~<YYYY-MM-DD>~<tokenID> key for a token's
+// creation date, in UTC
+func tokenDateIndexKey(ctx contractapi.TransactionContextInterface, token *MBTToken) (string, error) {
+	created, err := time.Parse(time.RFC3339, token.CreationTime)
+	if err != nil {
+		return "", fmt.Errorf("invalid creation time on token %s: %v", token.TokenID, err)
+	}
+	
+	indexKey, err := ctx.GetStub().CreateCompositeKey("TokenByDate", 
+		[]string{created.UTC().Format("2006-01-02"), token.TokenID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create date index key: %v", err)
+	}
+	
+	return indexKey, nil
+}
+
+// putTokenDateIndex writes a token's TokenByDate entry; call once, when the token is
+// created by a mint, an import or a transfer split
+func putTokenDateIndex(ctx contractapi.TransactionContextInterface, token *MBTToken) error {
+	indexKey, err := tokenDateIndexKey(ctx, token)
+	if err != nil {
+		return err
+	}
+	
+	err = ctx.GetStub().PutState(indexKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to store date index: %v", err)
+	}
+	
+	return nil
+}
+
+// deleteTokenDateIndex removes a token's TokenByDate entry
+func deleteTokenDateIndex(ctx contractapi.TransactionContextInterface, token *MBTToken) error {
+	indexKey, err := tokenDateIndexKey(ctx, token)
+	if err != nil {
+		return err
+	}
+	
+	err = ctx.GetStub().DelState(indexKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete date index: %v", err)
+	}
+	
+	return nil
+}
+
+// putOwnerIndex writes the OwnerToken~<owner>~<tokenID> entry that lets owner
+// lookups run as key scans, without CouchDB
+func putOwnerIndex(ctx contractapi.TransactionContextInterface, owner, tokenID string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey("OwnerToken", []string{owner, tokenID})
+	if err != nil {
+		return fmt.Errorf("failed to create owner index key: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(indexKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to store owner index: %v", err)
+	}
+	
+	return nil
+}
+
+// deleteOwnerIndex removes a token's OwnerToken entry for the given owner
+func deleteOwnerIndex(ctx contractapi.TransactionContextInterface, owner, tokenID string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey("OwnerToken", []string{owner, tokenID})
+	if err != nil {
+		return fmt.Errorf("failed to create owner index key: %v", err)
+	}
+	
+	err = ctx.GetStub().DelState(indexKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete owner index: %v", err)
+	}
+	
+	return nil
+}
+
+// scanTokenBatch reads up to batchSize tokens in key order from startKey, or from the
+// first token when it is empty, and returns them with the key of the next token,
+// empty when none remain (admin only). Fabric rejects paginated queries in
+// transactions that write, so batches for index rebuilds come from a plain range
+// query cut off by hand.
+func scanTokenBatch(ctx contractapi.TransactionContextInterface, 
+	batchSize int32, startKey string) ([]*MBTToken, string, error) {
+	
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	
+	if batchSize <= 0 || batchSize > MAX_BATCH_SIZE {
+		return nil, "", fmt.Errorf("batch size must be between 1 and %d", MAX_BATCH_SIZE)
+	}
+	
+	if startKey == "" {
+		startKey = "MBT-"
+	}
+	if !strings.HasPrefix(startKey, "MBT-") {
+		return nil, "", fmt.Errorf("start key %s is not a token key", startKey)
+	}
+	
+	iterator, err := ctx.GetStub().GetStateByRange(startKey, "MBT.")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query tokens: %v", err)
+	}
+	defer iterator.Close()
+	
+	tokens := []*MBTToken{}
+	for iterator.HasNext() {
+		tokenJSON, err := iterator.Next()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read token: %v", err)
+		}
+		
+		if int32(len(tokens)) == batchSize {
+			return tokens, tokenJSON.Key, nil
+		}
+		
+		var token MBTToken
+		err = json.Unmarshal(tokenJSON.Value, &token)
+		if err != nil {
+			continue // Skip invalid tokens
+		}
+		
+		tokens = append(tokens, &token)
+	}
+	
+	return tokens, "", nil
+}
+
+// RebuildOwnerIndex writes OwnerToken entries for up to batchSize tokens from startKey
+// and returns the key to start the next batch from, empty when done (admin only).
+// Needed once for tokens stored before the index existed.
+func (c *MBTBasketContract) RebuildOwnerIndex(ctx contractapi.TransactionContextInterface, 
+	batchSize int32, startKey string) (string, error) {
+	
+	tokens, nextKey, err := scanTokenBatch(ctx, batchSize, startKey)
+	if err != nil {
+		return "", err
+	}
+	
+	for _, token := range tokens {
+		err = putOwnerIndex(ctx, token.Owner, token.TokenID)
+		if err != nil {
+			return "", err
+		}
+	}
+	
+	log.Printf("Indexed owners of %d tokens", len(tokens))
+	return nextKey, nil
+}
+
+// RebuildTokenDateIndex writes TokenByDate entries for up to batchSize tokens from
+// startKey and returns the key to start the next batch from, empty when done (admin
+// only). Needed once for tokens minted before the index existed.
+func (c *MBTBasketContract) RebuildTokenDateIndex(ctx contractapi.TransactionContextInterface, 
+	batchSize int32, startKey string) (string, error) {
+	
+	tokens, nextKey, err := scanTokenBatch(ctx, batchSize, startKey)
+	if err != nil {
+		return "", err
+	}
+	
+	for _, token := range tokens {
+		err = putTokenDateIndex(ctx, token)
+		if err != nil {
+			return "", err
+		}
+	}
+	
+	log.Printf("Indexed creation dates of %d tokens", len(tokens))
+	return nextKey, nil
+}
+
+// GetTokensCreatedInRange pages through the tokens created between fromTS and toTS
+// (RFC3339, inclusive) by creation date, using the TokenByDate index (admin only).
+// The bookmark is "<date>|<index bookmark>"; entries outside the exact times on the
+// first and last days are skipped, so a page may hold fewer than pageSize tokens
+// while the bookmark is non-empty.
+func (c *MBTBasketContract) GetTokensCreatedInRange(ctx contractapi.TransactionContextInterface, 
+	fromTS, toTS string, pageSize int32, bookmark string) (*TokenPage, error) {
+	
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	from, err := time.Parse(time.RFC3339, fromTS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from timestamp: %v", err)
+	}
+	to, err := time.Parse(time.RFC3339, toTS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to timestamp: %v", err)
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("to timestamp must not be before from timestamp")
+	}
+	
+	if pageSize <= 0 || pageSize > MAX_BATCH_SIZE {
+		return nil, fmt.Errorf("page size must be between 1 and %d", MAX_BATCH_SIZE)
+	}
+	
+	firstDay := from.UTC().Truncate(24 * time.Hour)
+	lastDay := to.UTC().Truncate(24 * time.Hour)
+	if lastDay.Sub(firstDay).Hours()/24 >= MAX_REPORT_DAYS {
+		return nil, fmt.Errorf("range exceeds %d days", MAX_REPORT_DAYS)
+	}
+	
+	day := firstDay
+	dayBookmark := ""
+	if bookmark != "" {
+		parts := strings.SplitN(bookmark, "|", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid bookmark")
+		}
+		day, err = time.Parse("2006-01-02", parts[0])
+		if err != nil || day.Before(firstDay) || day.After(lastDay) {
+			return nil, fmt.Errorf("invalid bookmark")
+		}
+		dayBookmark = parts[1]
+	}
+	
+	page := &TokenPage{Tokens: []*MBTToken{}}
+	
+	for ; !day.After(lastDay); day = day.Add(24 * time.Hour) {
+		remaining := pageSize - page.FetchedCount
+		iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(
+			"TokenByDate", []string{day.Format("2006-01-02")}, remaining, dayBookmark)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query date index: %v", err)
+		}
+		
+		tokenIDs := []string{}
+		for iterator.HasNext() {
+			entry, err := iterator.Next()
+			if err != nil {
+				iterator.Close()
+				return nil, fmt.Errorf("failed to read date index: %v", err)
+			}
+			
+			_, attributes, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+			if err != nil || len(attributes) != 2 {
+				continue // Skip malformed index entries
+			}
+			tokenIDs = append(tokenIDs, attributes[1])
+		}
+		iterator.Close()
+		
+		for _, tokenID := range tokenIDs {
+			token, err := c.GetMBTToken(ctx, tokenID)
+			if err != nil {
+				continue // Index entry for a token no longer stored
+			}
+			
+			created, err := time.Parse(time.RFC3339, token.CreationTime)
+			if err != nil || created.Before(from) || created.After(to) {
+				continue
+			}
+			page.Tokens = append(page.Tokens, token)
+		}
+		
+		page.FetchedCount += metadata.FetchedRecordsCount
+		if metadata.FetchedRecordsCount >= remaining {
+			// Page full; resume on this day if it has more entries, else on the next
+			if metadata.Bookmark != "" {
+				page.Bookmark = day.Format("2006-01-02") + "|" + metadata.Bookmark
+			} else if next := day.Add(24 * time.Hour); !next.After(lastDay) {
+				page.Bookmark = next.Format("2006-01-02") + "|"
+			}
+			return page, nil
+		}
+		dayBookmark = ""
+	}
+	
+	return page, nil
+}
+
+// GetStateSize counts the basket's keys by category (admin only). Values are not
+// decoded, and each count stops at MAX_STATE_SCAN_KEYS.
+func (c *MBTBasketContract) GetStateSize(ctx contractapi.TransactionContextInterface) (*StateSize, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	size := &StateSize{Categories: []StateCategorySize{}, Timestamp: timestamp}
+	
+	tokens, err := countRangeKeys(ctx, "tokens", "MBT-", "MBT.")
+	if err != nil {
+		return nil, err
+	}
+	size.Categories = append(size.Categories, tokens)
+	
+	for _, category := range []struct{ name, objectType string }{
+		{"snapshots", "NAVSnapshot"},
+		{"redemptions", "Redemption"},
+		{"settlements", "Settlement"},
+		{"fees", "Fee"},
+		{"transfers", "Transfer"},
+		{"alertPreferences", "AlertPref"},
+	} {
+		count, err := countCompositeKeys(ctx, category.name, category.objectType)
+		if err != nil {
+			return nil, err
+		}
+		size.Categories = append(size.Categories, count)
+	}
+	
+	return size, nil
+}
+
+// countRangeKeys counts the keys in [startKey, endKey), up to MAX_STATE_SCAN_KEYS
+func countRangeKeys(ctx contractapi.TransactionContextInterface, category, startKey, endKey string) (StateCategorySize, error) {
+	iterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+	if err != nil {
+		return StateCategorySize{}, fmt.Errorf("failed to query %s: %v", category, err)
+	}
+	defer iterator.Close()
+	
+	return countKeys(category, iterator)
+}
+
+// countCompositeKeys counts the composite keys of an object type, up to MAX_STATE_SCAN_KEYS
+func countCompositeKeys(ctx contractapi.TransactionContextInterface, category, objectType string) (StateCategorySize, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(objectType, []string{})
+	if err != nil {
+		return StateCategorySize{}, fmt.Errorf("failed to query %s: %v", category, err)
+	}
+	defer iterator.Close()
+	
+	return countKeys(category, iterator)
+}
+
+// countKeys advances an iterator without decoding values, stopping at MAX_STATE_SCAN_KEYS
+func countKeys(category string, iterator shim.StateQueryIteratorInterface) (StateCategorySize, error) {
+	size := StateCategorySize{Category: category}
+	for iterator.HasNext() {
+		if size.Count >= MAX_STATE_SCAN_KEYS {
+			size.Capped = true
+			break
+		}
+		
+		_, err := iterator.Next()
+		if err != nil {
+			return StateCategorySize{}, fmt.Errorf("failed to read %s: %v", category, err)
+		}
+		size.Count++
+	}
+	
+	return size, nil
+}
+
+// GetAllTokens pages through every MBT token in key order (admin only)
+func (c *MBTBasketContract) GetAllTokens(ctx contractapi.TransactionContextInterface, 
+	pageSize int32, bookmark string) (*TokenPage, error) {
+	
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	if pageSize <= 0 || pageSize > MAX_BATCH_SIZE {
+		return nil, fmt.Errorf("page size must be between 1 and %d", MAX_BATCH_SIZE)
+	}
+	
+	// "." sorts immediately after "-", so this range covers every MBT- key
+	iterator, metadata, err := ctx.GetStub().GetStateByRangeWithPagination("MBT-", "MBT.", pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %v", err)
+	}
+	defer iterator.Close()
+	
+	page := &TokenPage{Tokens: []*MBTToken{}}
+	
+	for iterator.HasNext() {
+		tokenJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %v", err)
+		}
+		
+		var token MBTToken
+		err = json.Unmarshal(tokenJSON.Value, &token)
+		if err != nil {
+			continue // Skip invalid tokens
+		}
+		
+		page.Tokens = append(page.Tokens, &token)
+	}
+	
+	page.FetchedCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+	if page.FetchedCount < pageSize {
+		page.Bookmark = "" // Last page
+	}
+	
+	return page, nil
+}
+
+// GetTokensByValueRange pages through tokens whose total value lies in
+// [minValue, maxValue] (admin only). On CouchDB peers this is a rich query backed by
+// the totalValue index; on LevelDB peers it falls back to a filtered key scan, where
+// a page may hold fewer than pageSize tokens while the bookmark is still non-empty.
+func (c *MBTBasketContract) GetTokensByValueRange(ctx contractapi.TransactionContextInterface, 
+	minValue, maxValue float64, pageSize int32, bookmark string) (*TokenPage, error) {
+	
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	if minValue > maxValue {
+		return nil, fmt.Errorf("min value %.2f exceeds max value %.2f", minValue, maxValue)
+	}
+	
+	if pageSize <= 0 || pageSize > MAX_BATCH_SIZE {
+		return nil, fmt.Errorf("page size must be between 1 and %d", MAX_BATCH_SIZE)
+	}
+	
+	queryJSON, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"_id":        map[string]string{"$regex": "^MBT-"},
+			"totalValue": map[string]float64{"$gte": minValue, "$lte": maxValue},
+		},
+		"use_index": []string{"_design/indexTotalValueDoc", "indexTotalValue"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token query: %v", err)
+	}
+	
+	iterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(string(queryJSON), pageSize, bookmark)
+	if err != nil {
+		log.Printf("Rich query unavailable, scanning tokens by key: %v", err)
+		iterator, metadata, err = ctx.GetStub().GetStateByRangeWithPagination("MBT-", "MBT.", pageSize, bookmark)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query tokens: %v", err)
+		}
+	}
+	defer iterator.Close()
+	
+	page := &TokenPage{Tokens: []*MBTToken{}}
+	
+	for iterator.HasNext() {
+		tokenJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %v", err)
+		}
+		
+		var token MBTToken
+		err = json.Unmarshal(tokenJSON.Value, &token)
+		if err != nil {
+			continue // Skip invalid tokens
+		}
+		
+		// Redundant for the rich query; filters the key scan
+		if token.TotalValue < minValue || token.TotalValue > maxValue {
+			continue
+		}
+		
+		page.Tokens = append(page.Tokens, &token)
+	}
+	
+	page.FetchedCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+	if page.FetchedCount < pageSize {
+		page.Bookmark = "" // Last page
+	}
+	
+	return page, nil
+}
+
+// SetTokenMetadata replaces a token's metadata tags (token owner only)
+func (c *MBTBasketContract) SetTokenMetadata(ctx contractapi.TransactionContextInterface, tokenID, metadataJSON string) error {
+	metadata, err := parseTokenMetadata(metadataJSON)
+	if err != nil {
+		return err
+	}
+	
+	token, err := c.GetMBTToken(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	
+	callerID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	
+	if token.Owner != callerID {
+		return fmt.Errorf("unauthorized: caller does not own this token")
+	}
+	
+	token.Metadata = metadata
+	
+	err = c.putMBTToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	
+	return nil
+}
+
+// GetTokensByTag finds tokens whose metadata has the given key and value
+func (c *MBTBasketContract) GetTokensByTag(ctx contractapi.TransactionContextInterface, key, value string) ([]*MBTToken, error) {
+	if key == "" || strings.ContainsAny(key, ".$") {
+		return nil, fmt.Errorf("invalid metadata key %q", key)
+	}
+	
+	return queryTokens(ctx, map[string]interface{}{"metadata." + key: value})
+}
+
+// parseTokenMetadata parses and validates a metadata JSON object; empty input means no metadata
+func parseTokenMetadata(metadataJSON string) (map[string]string, error) {
+	if metadataJSON == "" {
+		return nil, nil
+	}
+	
+	var metadata map[string]string
+	err := json.Unmarshal([]byte(metadataJSON), &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata: %v", err)
+	}
+	
+	if len(metadata) > MAX_METADATA_ENTRIES {
+		return nil, fmt.Errorf("metadata has %d entries, maximum is %d", len(metadata), MAX_METADATA_ENTRIES)
+	}
+	
+	for key, value := range metadata {
+		if key == "" || strings.ContainsAny(key, ".$") {
+			return nil, fmt.Errorf("invalid metadata key %q", key)
+		}
+		if len(key) > MAX_METADATA_LENGTH || len(value) > MAX_METADATA_LENGTH {
+			return nil, fmt.Errorf("metadata entry %q exceeds %d characters", key, MAX_METADATA_LENGTH)
+		}
+	}
+	
+	return metadata, nil
+}
+
+// copyMetadata returns an independent copy of token metadata
+func copyMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	return copied
+}
+
+// LockToken holds a token out of circulation and redemption (admin only)
+func (c *MBTBasketContract) LockToken(ctx contractapi.TransactionContextInterface, tokenID string) error {
+	return c.setTokenLocked(ctx, tokenID, true)
+}
+
+// UnlockToken returns a locked token to circulation (admin only)
+func (c *MBTBasketContract) UnlockToken(ctx contractapi.TransactionContextInterface, tokenID string) error {
+	return c.setTokenLocked(ctx, tokenID, false)
+}
+
+// setTokenLocked sets a token's lock flag
+func (c *MBTBasketContract) setTokenLocked(ctx contractapi.TransactionContextInterface, tokenID string, locked bool) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	token, err := c.GetMBTToken(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	
+	if token.Locked == locked {
+		return fmt.Errorf("token %s is already in the requested lock state", tokenID)
+	}
+	
+	token.Locked = locked
+	
+	err = c.putMBTToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Set lock on MBT token %s to %t", tokenID, locked)
+	return nil
+}
+
+// FreezeToken blocks redemption and transfer of a token pending investigation (admin only)
+func (c *MBTBasketContract) FreezeToken(ctx contractapi.TransactionContextInterface, tokenID, reason string) error {
+	if reason == "" {
+		return fmt.Errorf("freeze reason must not be empty")
+	}
+	return c.setTokenFrozen(ctx, tokenID, true, reason)
+}
+
+// UnfreezeToken lifts a compliance freeze (admin only)
+func (c *MBTBasketContract) UnfreezeToken(ctx contractapi.TransactionContextInterface, tokenID string) error {
+	return c.setTokenFrozen(ctx, tokenID, false, "")
+}
+
+// setTokenFrozen sets a token's freeze flag and emits TokenFrozen or TokenUnfrozen
+func (c *MBTBasketContract) setTokenFrozen(ctx contractapi.TransactionContextInterface, 
+	tokenID string, frozen bool, reason string) error {
+	
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	token, err := c.GetMBTToken(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	
+	if token.Frozen == frozen {
+		return fmt.Errorf("token %s is already in the requested freeze state", tokenID)
+	}
+	
+	token.Frozen = frozen
+	token.FreezeReason = reason
+	
+	err = c.putMBTToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	eventName := "TokenUnfrozen"
+	if frozen {
+		eventName = "TokenFrozen"
+	}
+	
+	err = emitEvent(ctx, eventName, &TokenFreezeEvent{
+		TokenID:   tokenID,
+		Frozen:    frozen,
+		Reason:    reason,
+		Timestamp: timestamp,
+	})
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Set freeze on MBT token %s to %t", tokenID, frozen)
+	return nil
+}
+
+// setEventSeq implements sequencedEvent
+func (e *TokenFreezeEvent) setEventSeq(seq uint64) { e.EventSeq = seq }
+
+// checkNotFrozen rejects operations on a frozen token
+func checkNotFrozen(token *MBTToken) error {
+	if token.Frozen {
+		return fmt.Errorf("token %s is frozen: %s", token.TokenID, token.FreezeReason)
+	}
+	return nil
+}
+
+// GetCirculatingSupply returns the total MBT supply less the value of locked tokens
+func (c *MBTBasketContract) GetCirculatingSupply(ctx contractapi.TransactionContextInterface) (float64, error) {
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return 0, err
+	}
+	
+	lockedTokens, err := queryTokens(ctx, map[string]interface{}{"locked": true})
+	if err != nil {
+		return 0, err
+	}
+	
+	lockedValue := 0.0
+	for _, token := range lockedTokens {
+		lockedValue += token.TotalValue
+	}
+	
+	circulating := holdings.TotalMBTSupply - lockedValue
+	if circulating < 0 {
+		circulating = 0
+	}
+	
+	return circulating, nil
+}
+
+// GetMBTTokensBatch retrieves several tokens in one call; IDs that do not exist
+// are reported in NotFound instead of failing the call
+func (c *MBTBasketContract) GetMBTTokensBatch(ctx contractapi.TransactionContextInterface, tokenIDsJSON string) (*TokenBatch, error) {
+	var tokenIDs []string
+	err := json.Unmarshal([]byte(tokenIDsJSON), &tokenIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token IDs: %v", err)
+	}
+	
+	if len(tokenIDs) > MAX_BATCH_SIZE {
+		return nil, fmt.Errorf("batch of %d tokens exceeds maximum of %d", len(tokenIDs), MAX_BATCH_SIZE)
+	}
+	
+	batch := &TokenBatch{
+		Tokens:   map[string]*MBTToken{},
+		NotFound: []string{},
+	}
+	
+	for _, tokenID := range tokenIDs {
+		tokenJSON, err := ctx.GetStub().GetState(tokenID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token data: %v", err)
+		}
+		
+		if tokenJSON == nil {
+			batch.NotFound = append(batch.NotFound, tokenID)
+			continue
+		}
+		
+		var token MBTToken
+		err = json.Unmarshal(tokenJSON, &token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal token %s: %v", tokenID, err)
+		}
+		
+		batch.Tokens[tokenID] = &token
+	}
+	
+	return batch, nil
+}
+
+// GetTokenComposition computes a token's current metal percentages at current
+// prices alongside its target composition
+func (c *MBTBasketContract) GetTokenComposition(ctx contractapi.TransactionContextInterface, tokenID string) (*TokenComposition, error) {
+	token, err := c.GetMBTToken(ctx, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	goldValue := token.BGTGrams * prices["BGT"]
+	silverValue := token.BSTGrams * prices["BST"]
+	platinumValue := token.BPTGrams * prices["BPT"]
+	
+	composition := &TokenComposition{
+		TokenID:      tokenID,
+		CurrentValue: goldValue + silverValue + platinumValue,
+		Target:       token.Composition,
+	}
+	
+	if composition.CurrentValue > 0 {
+		composition.Current = MetalComposition{
+			Gold:     goldValue / composition.CurrentValue * 100,
+			Silver:   silverValue / composition.CurrentValue * 100,
+			Platinum: platinumValue / composition.CurrentValue * 100,
+		}
+	}
+	
+	return composition, nil
+}
+
+// GetBasketHoldings retrieves current basket holdings
+func (c *MBTBasketContract) GetBasketHoldings(ctx contractapi.TransactionContextInterface) (*BasketHolding, error) {
+	holdingsJSON, err := ctx.GetStub().GetState("BASKET_HOLDINGS")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holdings data: %v", err)
+	}
+	
+	if holdingsJSON == nil {
+		// Not initialized yet: empty holdings with no LastRebalance
+		holdings := BasketHolding{
+			TotalMBTSupply: 0,
+			TotalBGTValue:  0,
+			TotalBSTValue:  0,
+			TotalBPTValue:  0,
+			RebalanceNeeded: false,
+			Currency:       BASE_CURRENCY,
+			Initialized:    false,
+		}
+		
+		return &holdings, nil
+	}
+	
+	var holdings BasketHolding
+	err = json.Unmarshal(holdingsJSON, &holdings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal holdings: %v", err)
+	}
+	
+	holdings.Initialized = true // Holdings stored before the flag existed
+	
+	if holdings.Currency == "" {
+		holdings.Currency = BASE_CURRENCY // Baskets created before currency support
+	}
+	
+	return &holdings, nil
+}
+
+// InitializeBasket persists the initial basket holdings once (admin only)
+func (c *MBTBasketContract) InitializeBasket(ctx contractapi.TransactionContextInterface) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if holdings.Initialized {
+		return fmt.Errorf("basket holdings are already initialized")
+	}
+	
+	return c.putBasketHoldings(ctx, holdings)
+}
+
+// ImportToken seeds a token migrated from a legacy system (admin only, before
+// ActivateBasket). The token must be internally consistent: metal amounts sum to
+// its total value and its composition sums to 100%. Holdings grow by its amounts.
+func (c *MBTBasketContract) ImportToken(ctx contractapi.TransactionContextInterface, tokenJSON string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	activated, err := isBasketActivated(ctx)
+	if err != nil {
+		return err
+	}
+	if activated {
+		return fmt.Errorf("imports are closed: the basket has been activated")
+	}
+	
+	var token MBTToken
+	err = json.Unmarshal([]byte(tokenJSON), &token)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal token: %v", err)
+	}
+	
+	if !strings.HasPrefix(token.TokenID, "MBT-") || token.Owner == "" {
+		return fmt.Errorf("imported token needs an MBT- token ID and an owner")
+	}
+	
+	if token.TotalValue <= 0 {
+		return fmt.Errorf("imported token %s must have a positive total value", token.TokenID)
+	}
+	
+	for _, value := range []float64{token.BGTAmount, token.BSTAmount, token.BPTAmount, 
+		token.BGTGrams, token.BSTGrams, token.BPTGrams, token.CostBasis} {
+		if value < 0 {
+			return fmt.Errorf("imported token %s has a negative amount", token.TokenID)
+		}
+	}
+	
+	metalTotal := token.BGTAmount + token.BSTAmount + token.BPTAmount
+	if math.Abs(metalTotal-token.TotalValue) > 0.01 {
+		return fmt.Errorf("imported token %s: metal amounts sum to %.2f, total value is %.2f", 
+			token.TokenID, metalTotal, token.TotalValue)
+	}
+	
+	compositionTotal := token.Composition.Gold + token.Composition.Silver + token.Composition.Platinum
+	if math.Abs(compositionTotal-100) > 0.01 {
+		return fmt.Errorf("imported token %s: composition sums to %.2f%%, expected 100%%", 
+			token.TokenID, compositionTotal)
+	}
+	
+	err = checkNotBlacklisted(ctx, token.Owner)
+	if err != nil {
+		return err
+	}
+	
+	existing, err := ctx.GetStub().GetState(token.TokenID)
+	if err != nil {
+		return fmt.Errorf("failed to read token data: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("token %s already exists", token.TokenID)
+	}
+	
+	token.Version = 0 // Legacy versions do not carry over
+	
+	err = c.putMBTToken(ctx, &token)
+	if err != nil {
+		return err
+	}
+	
+	err = putTokenDateIndex(ctx, &token)
+	if err != nil {
+		return err
+	}
+	
+	err = c.UpdateBasketHoldings(ctx, token.TotalValue, token.BGTAmount, token.BSTAmount, token.BPTAmount, 
+		token.CashAmount, token.BGTGrams, token.BSTGrams, token.BPTGrams, true)
+	if err != nil {
+		return fmt.Errorf("failed to update basket holdings: %v", err)
+	}
+	
+	log.Printf("Imported MBT token %s for %s", token.TokenID, token.Owner)
+	return nil
+}
+
+// ActivateBasket ends the migration window, after which ImportToken is rejected (admin only)
+func (c *MBTBasketContract) ActivateBasket(ctx contractapi.TransactionContextInterface) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	activated, err := isBasketActivated(ctx)
+	if err != nil {
+		return err
+	}
+	if activated {
+		return fmt.Errorf("basket is already activated")
+	}
+	
+	err = ctx.GetStub().PutState("BASKET_ACTIVATED", []byte("true"))
+	if err != nil {
+		return fmt.Errorf("failed to store activation: %v", err)
+	}
+	
+	log.Println("Basket activated; token imports are closed")
+	return nil
+}
+
+// isBasketActivated reports whether ActivateBasket has been called
+func isBasketActivated(ctx contractapi.TransactionContextInterface) (bool, error) {
+	activated, err := ctx.GetStub().GetState("BASKET_ACTIVATED")
+	if err != nil {
+		return false, fmt.Errorf("failed to read activation: %v", err)
+	}
+	return activated != nil, nil
+}
+
+// SetBasketCurrency sets the basket's denomination (admin only, before any mint)
+func (c *MBTBasketContract) SetBasketCurrency(ctx contractapi.TransactionContextInterface, currency string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if len(currency) != 3 {
+		return fmt.Errorf("invalid currency code %s", currency)
+	}
+	
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if holdings.TotalMBTSupply != 0 {
+		return fmt.Errorf("cannot change currency of a basket with tokens in circulation")
+	}
+	
+	holdings.Currency = currency
+	
+	err = c.putBasketHoldings(ctx, holdings)
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Basket currency set to %s", currency)
+	return nil
+}
+
+// putBasketHoldings stores holdings and increments their version. The holdings must
+// carry the Version they were read at, so a second write in the same transaction is
+// rejected with ErrConcurrentModification; writes from concurrent transactions are
+// caught by Fabric's MVCC validation at commit instead.
+func (c *MBTBasketContract) putBasketHoldings(ctx contractapi.TransactionContextInterface, holdings *BasketHolding) error {
+	stored, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if stored.Version != holdings.Version {
+		return fmt.Errorf("%w: basket holdings at version %d, update based on version %d", 
+			ErrConcurrentModification, stored.Version, holdings.Version)
+	}
+	
+	if !holdings.Initialized {
+		// First write fixes the rebalance clock at this transaction's time
+		now, err := txTime(ctx)
+		if err != nil {
+			return err
+		}
+		holdings.LastRebalance = now.Format(time.RFC3339)
+		holdings.Initialized = true
+	}
+	
+	err = checkFinite("basket holdings",
+		numericField{"TotalMBTSupply", holdings.TotalMBTSupply},
+		numericField{"TotalBGTValue", holdings.TotalBGTValue},
+		numericField{"TotalBSTValue", holdings.TotalBSTValue},
+		numericField{"TotalBPTValue", holdings.TotalBPTValue},
+		numericField{"TotalBGTGrams", holdings.TotalBGTGrams},
+		numericField{"TotalBSTGrams", holdings.TotalBSTGrams},
+		numericField{"TotalBPTGrams", holdings.TotalBPTGrams},
+		numericField{"TotalCashValue", holdings.TotalCashValue},
+	)
+	if err != nil {
+		return err
+	}
+	
+	holdings.Version++
+	
+	holdingsJSON, err := json.Marshal(holdings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal holdings: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState("BASKET_HOLDINGS", holdingsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store holdings: %v", err)
+	}
+	
+	return nil
+}
+
+// UpdateBasketHoldings updates the basket aggregate holdings
+func (c *MBTBasketContract) UpdateBasketHoldings(ctx contractapi.TransactionContextInterface, 
+	mbtAmount, bgtValue, bstValue, bptValue, cashValue, bgtGrams, bstGrams, bptGrams float64, isMint bool) error {
+	
+	return c.updateBasketHoldings(ctx, mbtAmount, bgtValue, bstValue, bptValue, cashValue, 
+		bgtGrams, bstGrams, bptGrams, isMint, false)
+}
+
+// updateBasketHoldings applies a holdings update and recomputes the rebalance flag,
+// which flagRebalance forces on. Holdings are written once, so callers that need the
+// flag set must pass it here rather than update holdings again in the transaction.
+func (c *MBTBasketContract) updateBasketHoldings(ctx contractapi.TransactionContextInterface, 
+	mbtAmount, bgtValue, bstValue, bptValue, cashValue, bgtGrams, bstGrams, bptGrams float64, 
+	isMint, flagRebalance bool) error {
+	
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if isMint {
+		holdings.TotalMBTSupply += mbtAmount
+		holdings.TotalBGTValue += bgtValue
+		holdings.TotalBSTValue += bstValue
+		holdings.TotalBPTValue += bptValue
+		holdings.TotalCashValue += cashValue
+		holdings.TotalBGTGrams += bgtGrams
+		holdings.TotalBSTGrams += bstGrams
+		holdings.TotalBPTGrams += bptGrams
+	} else {
+		holdings.TotalMBTSupply -= mbtAmount
+		holdings.TotalBGTValue -= bgtValue
+		holdings.TotalBSTValue -= bstValue
+		holdings.TotalBPTValue -= bptValue
+		holdings.TotalCashValue -= cashValue
+		holdings.TotalBGTGrams -= bgtGrams
+		holdings.TotalBSTGrams -= bstGrams
+		holdings.TotalBPTGrams -= bptGrams
+	}
+	
+	// Reject (or clamp) any update that would drive holdings negative
+	fields := []struct {
+		name  string
+		value *float64
+	}{
+		{"TotalMBTSupply", &holdings.TotalMBTSupply},
+		{"TotalBGTValue", &holdings.TotalBGTValue},
+		{"TotalBSTValue", &holdings.TotalBSTValue},
+		{"TotalBPTValue", &holdings.TotalBPTValue},
+		{"TotalCashValue", &holdings.TotalCashValue},
+		{"TotalBGTGrams", &holdings.TotalBGTGrams},
+		{"TotalBSTGrams", &holdings.TotalBSTGrams},
+		{"TotalBPTGrams", &holdings.TotalBPTGrams},
+	}
+	for _, field := range fields {
+		if *field.value >= 0 {
+			continue
+		}
+		if *field.value > -HOLDINGS_EPSILON {
+			*field.value = 0
+			continue
+		}
+		if CLAMP_NEGATIVE_HOLDINGS {
+			log.Printf("Warning: clamping negative %s (%.6f) to zero", field.name, *field.value)
+			*field.value = 0
+			continue
+		}
+		return fmt.Errorf("holdings update would make %s negative: %.6f", field.name, *field.value)
+	}
+	
+	// Check if rebalancing is needed
+	mode, err := c.GetDeviationMode(ctx)
+	if err != nil {
+		return err
+	}
+	
+	targets, err := c.GetBasketCompositionTargets(ctx)
+	if err != nil {
+		return err
+	}
+	
+	holdings.RebalanceNeeded, err = c.CheckRebalanceNeeded(ctx, holdings, targets, mode)
+	if err != nil {
+		return err
+	}
+	holdings.RebalanceNeeded = holdings.RebalanceNeeded || flagRebalance
+	
+	err = c.putBasketHoldings(ctx, holdings)
+	if err != nil {
+		return err
+	}
+	
+	return nil
+}
+
+// CheckRebalanceNeeded determines if portfolio rebalancing is required, measuring
+// the rebalance interval against the transaction time
+func (c *MBTBasketContract) CheckRebalanceNeeded(ctx contractapi.TransactionContextInterface, 
+	holdings *BasketHolding, targets map[string]float64, deviationMode string) (bool, error) {
+	if holdings.TotalMBTSupply == 0 {
+		return false, nil
+	}
+	
+	totalValue := holdings.TotalBGTValue + holdings.TotalBSTValue + holdings.TotalBPTValue
+	if totalValue == 0 {
+		return false, nil
+	}
+	
+	// Calculate current allocations
+	currentGoldPct := holdings.TotalBGTValue / totalValue
+	currentSilverPct := holdings.TotalBSTValue / totalValue
+	currentPlatinumPct := holdings.TotalBPTValue / totalValue
+	
+	// Check deviations from target allocations
+	goldDeviation := abs(allocationDeviation(currentGoldPct, targets["BGT"], deviationMode))
+	silverDeviation := abs(allocationDeviation(currentSilverPct, targets["BST"], deviationMode))
+	platinumDeviation := abs(allocationDeviation(currentPlatinumPct, targets["BPT"], deviationMode))
+	
+	// Trigger rebalancing if any allocation deviates by more than threshold
+	if goldDeviation > MAX_DEVIATION_PERCENT || 
+		silverDeviation > MAX_DEVIATION_PERCENT || 
+		platinumDeviation > MAX_DEVIATION_PERCENT {
+		return true, nil
+	}
+	
+	// Check time-based rebalancing
+	if holdings.LastRebalance == "" {
+		return false, nil // Clock starts when the holdings are first persisted
+	}
+	
+	lastRebalance, err := time.Parse(time.RFC3339, holdings.LastRebalance)
+	if err != nil {
+		return true, nil // If we can't parse the date, trigger rebalance
+	}
+	
+	now, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+	
+	daysSinceRebalance := now.Sub(lastRebalance).Hours() / 24
+	if daysSinceRebalance >= REBALANCE_INTERVAL_DAYS {
+		return true, nil
+	}
+	
+	return false, nil
+}
+
+// GetDeviationMode retrieves how allocation deviations are measured
+func (c *MBTBasketContract) GetDeviationMode(ctx contractapi.TransactionContextInterface) (string, error) {
+	modeBytes, err := ctx.GetStub().GetState("DEVIATION_MODE")
+	if err != nil {
+		return "", fmt.Errorf("failed to read deviation mode: %v", err)
+	}
+	
+	if modeBytes == nil {
+		return DEVIATION_ABSOLUTE, nil
+	}
+	
+	return string(modeBytes), nil
+}
+
+// SetDeviationMode sets how allocation deviations are measured (admin only)
+func (c *MBTBasketContract) SetDeviationMode(ctx contractapi.TransactionContextInterface, mode string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if mode != DEVIATION_ABSOLUTE && mode != DEVIATION_RELATIVE {
+		return fmt.Errorf("unknown deviation mode %s", mode)
+	}
+	
+	err = ctx.GetStub().PutState("DEVIATION_MODE", []byte(mode))
+	if err != nil {
+		return fmt.Errorf("failed to store deviation mode: %v", err)
+	}
+	
+	log.Printf("Deviation mode set to %s", mode)
+	return nil
+}
+
+// allocationDeviation measures a weight against its target in the given mode.
+// Relative deviation against a zero target falls back to absolute.
+func allocationDeviation(current, target float64, mode string) float64 {
+	if mode == DEVIATION_RELATIVE && target != 0 {
+		return (current - target) / target
+	}
+	return current - target
+}
+
+// requireUserOrAdmin rejects a caller acting for another user. User IDs, token owners
+// included, are client identity IDs as returned by GetID(); admins may act for anyone.
+func requireUserOrAdmin(ctx contractapi.TransactionContextInterface, userID string) error {
+	callerID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if callerID != userID && requireAdmin(ctx) != nil {
+		return fmt.Errorf("unauthorized: caller cannot act for user %s", userID)
+	}
+	return nil
+}
+
+// requireAdmin rejects callers without the "admin" identity attribute
+func requireAdmin(ctx contractapi.TransactionContextInterface) error {
+	value, found, err := ctx.GetClientIdentity().GetAttributeValue("admin")
+	if err != nil {
+		return fmt.Errorf("failed to read admin attribute: %v", err)
+	}
+	if !found || value != "true" {
+		return fmt.Errorf("unauthorized: caller is not an admin")
+	}
+	return nil
+}
+
+// sequencedEvent is an event payload that carries the contract's event sequence number
+type sequencedEvent interface {
+	setEventSeq(seq uint64)
+}
+
+// emitEvent increments the EVENT_SEQ counter, stamps the payload with it and sets
+// the event, all in the calling transaction, so consumers can detect gaps. Fabric
+// delivers one event per transaction; emit at most once per transaction.
+func emitEvent(ctx contractapi.TransactionContextInterface, name string, payload sequencedEvent) error {
+	seqBytes, err := ctx.GetStub().GetState("EVENT_SEQ")
+	if err != nil {
+		return fmt.Errorf("failed to read event sequence: %v", err)
+	}
+	
+	seq := uint64(0)
+	if seqBytes != nil {
+		seq, err = strconv.ParseUint(string(seqBytes), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid event sequence: %v", err)
+		}
+	}
+	seq++
+	
+	err = ctx.GetStub().PutState("EVENT_SEQ", []byte(strconv.FormatUint(seq, 10)))
+	if err != nil {
+		return fmt.Errorf("failed to store event sequence: %v", err)
+	}
+	
+	payload.setEventSeq(seq)
+	
+	eventJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+	
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to emit event: %v", err)
+	}
+	
+	return nil
+}
+
+// requireComplianceOrAdmin rejects callers without the "compliance" or "admin" identity attribute
+func requireComplianceOrAdmin(ctx contractapi.TransactionContextInterface) error {
+	value, found, err := ctx.GetClientIdentity().GetAttributeValue("compliance")
+	if err != nil {
+		return fmt.Errorf("failed to read compliance attribute: %v", err)
+	}
+	if found && value == "true" {
+		return nil
+	}
+	
+	err = requireAdmin(ctx)
+	if err != nil {
+		return fmt.Errorf("unauthorized: caller is not a compliance officer or admin")
+	}
+	return nil
+}
+
+// txTimestamp returns the transaction timestamp as a fixed-width UTC string
+// so that keys built from it sort chronologically
+func txTimestamp(ctx contractapi.TransactionContextInterface) (string, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	return now.Format("2006-01-02T15:04:05.000000000Z"), nil
+}
+
+// txTime returns the transaction timestamp, which is identical on every endorsing peer
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	ts, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return ts.AsTime().UTC(), nil
+}
+
+// abs returns absolute value of a float64
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// safeDivide divides, failing on a zero denominator or a non-finite result
+func safeDivide(numerator, denominator float64) (float64, error) {
+	if denominator == 0 {
+		return 0, fmt.Errorf("division by zero: %g / 0", numerator)
+	}
+	result := numerator / denominator
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, fmt.Errorf("non-finite result dividing %g by %g", numerator, denominator)
+	}
+	return result, nil
+}
+
+// numericField names a number checked before it is written to state
+type numericField struct {
+	name  string
+	value float64
+}
+
+// checkFinite rejects NaN and infinite values so they never reach state
+func checkFinite(kind string, fields ...numericField) error {
+	for _, field := range fields {
+		if math.IsNaN(field.value) || math.IsInf(field.value, 0) {
+			return fmt.Errorf("refusing to store %s: %s is %v", kind, field.name, field.value)
+		}
+	}
+	return nil
+}
+
+// putFloatState stores a finite number as a decimal string
+func putFloatState(ctx contractapi.TransactionContextInterface, key string, value float64) error {
+	err := checkFinite(key, numericField{"value", value})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte(strconv.FormatFloat(value, 'f', -1, 64)))
+}
+
+// RedeemMBT redeems MBT tokens for underlying metals
+func (c *MBTBasketContract) RedeemMBT(ctx contractapi.TransactionContextInterface, 
+	tokenID string, amount float64, userID string) error {
+	
+	log.Printf("Redeeming MBT tokens: TokenID=%s, Amount=%.2f, UserID=%s", tokenID, amount, userID)
+	
+	err := requireUserOrAdmin(ctx, userID)
+	if err != nil {
+		return err
+	}
+	
+	err = checkNotPaused(ctx, PAUSE_REDEEM)
+	if err != nil {
+		return err
+	}
+	
+	err = checkNotBlacklisted(ctx, userID)
+	if err != nil {
+		return err
+	}
+	
+	// Get MBT token
+	token, err := c.GetMBTToken(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	
+	// Verify ownership
+	if token.Owner != userID {
+		return fmt.Errorf("unauthorized: user does not own this token")
+	}
+	
+	if token.Locked {
+		return fmt.Errorf("token %s is locked", tokenID)
+	}
+	
+	err = checkNotFrozen(token)
+	if err != nil {
+		return err
+	}
+	
+	if amount > token.TotalValue {
+		return fmt.Errorf("insufficient token balance: requested %.2f, available %.2f", amount, token.TotalValue)
+	}
+	
+	err = checkBasketNotBusy(ctx)
+	if err != nil {
+		return err
+	}
+	
+	redemptionMode, err := c.GetRedemptionMode(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if redemptionMode == REDEMPTION_MODE_QUEUED {
+		return c.enqueueRedemption(ctx, tokenID, amount, userID)
+	}
+	
+	err = c.settleRedemption(ctx, token, amount, userID)
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Successfully redeemed MBT token: %s", tokenID)
+	return nil
+}
+
+// GetRedemptionMode retrieves whether redemptions settle immediately or queue
+func (c *MBTBasketContract) GetRedemptionMode(ctx contractapi.TransactionContextInterface) (string, error) {
+	modeBytes, err := ctx.GetStub().GetState("REDEMPTION_MODE")
+	if err != nil {
+		return "", fmt.Errorf("failed to read redemption mode: %v", err)
+	}
+	
+	if modeBytes == nil {
+		return REDEMPTION_MODE_IMMEDIATE, nil
+	}
+	
+	return string(modeBytes), nil
+}
+
+// SetRedemptionMode switches between immediate and queued redemptions (admin only)
+func (c *MBTBasketContract) SetRedemptionMode(ctx contractapi.TransactionContextInterface, mode string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if mode != REDEMPTION_MODE_IMMEDIATE && mode != REDEMPTION_MODE_QUEUED {
+		return fmt.Errorf("unknown redemption mode %s", mode)
+	}
+	
+	err = ctx.GetStub().PutState("REDEMPTION_MODE", []byte(mode))
+	if err != nil {
+		return fmt.Errorf("failed to store redemption mode: %v", err)
+	}
+	
+	log.Printf("Redemption mode set to %s", mode)
+	return nil
+}
+
+// enqueueRedemption records a validated redemption for later settlement under
+// RedemptionQueue~<txTS>~<txID>, so the queue iterates in FIFO order
+func (c *MBTBasketContract) enqueueRedemption(ctx contractapi.TransactionContextInterface, 
+	tokenID string, amount float64, userID string) error {
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	request := RedemptionRequest{
+		RequestID: ctx.GetStub().GetTxID(),
+		TokenID:   tokenID,
+		UserID:    userID,
+		Amount:    amount,
+		Status:    REDEMPTION_QUEUED,
+		QueuedAt:  timestamp,
+	}
+	
+	queueKey, err := ctx.GetStub().CreateCompositeKey("RedemptionQueue", []string{timestamp, request.RequestID})
+	if err != nil {
+		return fmt.Errorf("failed to create redemption queue key: %v", err)
+	}
+	
+	err = putRedemptionRequest(ctx, queueKey, &request)
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Queued redemption %s of %.2f from MBT token %s", request.RequestID, amount, tokenID)
+	return nil
+}
+
+// putRedemptionRequest stores a redemption request under its queue key
+func putRedemptionRequest(ctx contractapi.TransactionContextInterface, queueKey string, request *RedemptionRequest) error {
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal redemption request: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(queueKey, requestJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store redemption request: %v", err)
+	}
+	
+	return nil
+}
+
+// GetRedemptionQueue lists redemptions still waiting to settle, oldest first
+func (c *MBTBasketContract) GetRedemptionQueue(ctx contractapi.TransactionContextInterface) ([]*RedemptionRequest, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("RedemptionQueue", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redemption queue: %v", err)
+	}
+	defer iterator.Close()
+	
+	queue := []*RedemptionRequest{}
+	
+	for iterator.HasNext() {
+		requestJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redemption request: %v", err)
+		}
+		
+		var request RedemptionRequest
+		err = json.Unmarshal(requestJSON.Value, &request)
+		if err != nil {
+			continue // Skip invalid requests
+		}
+		
+		if request.Status == REDEMPTION_QUEUED {
+			queue = append(queue, &request)
+		}
+	}
+	
+	return queue, nil
+}
+
+// ProcessRedemptionQueue settles up to maxToProcess queued redemptions in FIFO order
+// and returns how many it settled or rejected (admin only). Requests no longer valid
+// are rejected. Processing stops early at a request for a token or user already
+// handled in this run; it is settled on the next run, since state written in a
+// transaction cannot be read back until it commits.
+func (c *MBTBasketContract) ProcessRedemptionQueue(ctx contractapi.TransactionContextInterface, maxToProcess int) (int, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	
+	if maxToProcess <= 0 || maxToProcess > MAX_BATCH_SIZE {
+		return 0, fmt.Errorf("maxToProcess must be between 1 and %d", MAX_BATCH_SIZE)
+	}
+	
+	err = checkNotPaused(ctx, PAUSE_REDEEM)
+	if err != nil {
+		return 0, err
+	}
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+	
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("RedemptionQueue", []string{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query redemption queue: %v", err)
+	}
+	defer iterator.Close()
+	
+	var total redeemedShare
+	touchedTokens := map[string]bool{}
+	touchedUsers := map[string]bool{}
+	processed := 0
+	
+	for iterator.HasNext() && processed < maxToProcess {
+		requestJSON, err := iterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read redemption request: %v", err)
+		}
+		
+		var request RedemptionRequest
+		err = json.Unmarshal(requestJSON.Value, &request)
+		if err != nil || request.Status != REDEMPTION_QUEUED {
+			continue
+		}
+		
+		if touchedTokens[request.TokenID] || touchedUsers[request.UserID] {
+			break
+		}
+		
+		request.ProcessedAt = timestamp
+		token, reason := c.checkQueuedRedemption(ctx, &request)
+		if reason != "" {
+			request.Status = REDEMPTION_REJECTED
+			request.Reason = reason
+			log.Printf("Rejected queued redemption %s: %s", request.RequestID, reason)
+		} else {
+			share, err := c.releaseTokenShare(ctx, token, request.Amount, request.UserID)
+			if err != nil {
+				return 0, fmt.Errorf("failed to settle redemption %s: %v", request.RequestID, err)
+			}
+			total.add(share)
+			
+			err = recordUserTx(ctx, request.UserID, USER_TX_REDEEM, request.TokenID, request.Amount, "")
+			if err != nil {
+				return 0, err
+			}
+			
+			request.Status = REDEMPTION_SETTLED
+			touchedTokens[request.TokenID] = true
+			touchedUsers[request.UserID] = true
+		}
+		
+		err = putRedemptionRequest(ctx, requestJSON.Key, &request)
+		if err != nil {
+			return 0, err
+		}
+		processed++
+	}
+	
+	// One treasury sweep and holdings update for the whole batch
+	err = sweepToTreasury(ctx, total.Residual)
+	if err != nil {
+		return 0, err
+	}
+	
+	if total.Amount > 0 {
+		err = c.UpdateBasketHoldings(ctx, total.Amount, total.BGT, total.BST, total.BPT, total.Cash, 
+			total.BGTGrams, total.BSTGrams, total.BPTGrams, false)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update basket holdings: %v", err)
+		}
+	}
+	
+	log.Printf("Processed %d queued redemptions", processed)
+	return processed, nil
+}
+
+// checkQueuedRedemption re-validates a queued redemption against current state and
+// returns the token, or a reason the redemption can no longer settle
+func (c *MBTBasketContract) checkQueuedRedemption(ctx contractapi.TransactionContextInterface, 
+	request *RedemptionRequest) (*MBTToken, string) {
+	
+	token, err := c.GetMBTToken(ctx, request.TokenID)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if token.Owner != request.UserID {
+		return nil, "user no longer owns this token"
+	}
+	if token.Locked {
+		return nil, "token is locked"
+	}
+	if token.Frozen {
+		return nil, "token is frozen: " + token.FreezeReason
+	}
+	if request.Amount > token.TotalValue {
+		return nil, fmt.Sprintf("insufficient token balance: requested %.2f, available %.2f", 
+			request.Amount, token.TotalValue)
+	}
+	err = checkNotBlacklisted(ctx, request.UserID)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return token, ""
+}
+
+// settleRedemption returns the underlying metals for part or all of a token and
+// updates the token and basket holdings. Callers perform all eligibility checks.
+func (c *MBTBasketContract) settleRedemption(ctx contractapi.TransactionContextInterface, 
+	token *MBTToken, amount float64, userID string) error {
+	
+	share, err := c.releaseTokenShare(ctx, token, amount, userID)
+	if err != nil {
+		return err
+	}
+	
+	err = sweepToTreasury(ctx, share.Residual)
+	if err != nil {
+		return err
+	}
+	
+	// Update basket holdings
+	err = c.UpdateBasketHoldings(ctx, share.Amount, share.BGT, share.BST, share.BPT, share.Cash, 
+		share.BGTGrams, share.BSTGrams, share.BPTGrams, false)
+	if err != nil {
+		return fmt.Errorf("failed to update basket holdings: %v", err)
+	}
+	
+	return recordUserTx(ctx, userID, USER_TX_REDEEM, token.TokenID, amount, "")
+}
+
+// redeemedShare is the value and metal released by redeeming part of a token.
+// The metal values are exact; the user is credited them rounded down, and the
+// difference is the residual.
+type redeemedShare struct {
+	Amount   float64
+	BGT      float64
+	BST      float64
+	BPT      float64
+	BGTGrams float64
+	BSTGrams float64
+	BPTGrams float64
+	Cash     float64 // Paid from the cash buffer, exactly
+	Residual float64
+}
+
+// add accumulates another share into this one
+func (s *redeemedShare) add(other *redeemedShare) {
+	s.Amount += other.Amount
+	s.BGT += other.BGT
+	s.BST += other.BST
+	s.BPT += other.BPT
+	s.BGTGrams += other.BGTGrams
+	s.BSTGrams += other.BSTGrams
+	s.BPTGrams += other.BPTGrams
+	s.Cash += other.Cash
+	s.Residual += other.Residual
+}
+
+// roundDown truncates value toward zero at the given number of decimals
+func roundDown(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Floor(value*scale) / scale
+}
+
+// FEE_RATE_SCALE is the resolution fee percentages are fixed to for integer fee
+// arithmetic: parts per million, so 0.1% is 1000
+const FEE_RATE_SCALE = 1000000
+
+// splitFee divides an amount into the user's net and the fee, both in paise. The
+// fee rounds up to the next paise, in the treasury's favour, and the net is the
+// amount less the fee, so net + fee equals the amount exactly. Integer arithmetic
+// keeps the result identical on every peer.
+func splitFee(amount, feePercent float64) (netPaise, feePaise int64) {
+	amountPaise := int64(math.Round(amount * 100))
+	rate := int64(math.Round(feePercent * FEE_RATE_SCALE))
+	if amountPaise <= 0 || rate <= 0 {
+		return amountPaise, 0
+	}
+	
+	feePaise = (amountPaise*rate + FEE_RATE_SCALE - 1) / FEE_RATE_SCALE
+	return amountPaise - feePaise, feePaise
+}
+
+// recordResidual stores the rounding residual of one token redemption under
+// Residual~<tokenID>~<txID>
+func recordResidual(ctx contractapi.TransactionContextInterface, 
+	tokenID string, redeemed, credited, residual float64) error {
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	record := ResidualRecord{
+		TokenID:   tokenID,
+		TxID:      ctx.GetStub().GetTxID(),
+		Redeemed:  redeemed,
+		Credited:  credited,
+		Residual:  residual,
+		Timestamp: timestamp,
+	}
+	
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal residual record: %v", err)
+	}
+	
+	recordKey, err := ctx.GetStub().CreateCompositeKey("Residual", []string{tokenID, record.TxID})
+	if err != nil {
+		return fmt.Errorf("failed to create residual record key: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(recordKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store residual record: %v", err)
+	}
+	
+	return nil
+}
+
+// recordRedemption stores the redemption trail entry for a token under
+// Redemption~<tokenID>~<txTS>, so a token's history iterates in time order
+func (c *MBTBasketContract) recordRedemption(ctx contractapi.TransactionContextInterface, tokenID, userID string, 
+	share *redeemedShare, creditBGT, creditBST, creditBPT float64) error {
+	
+	quote, err := c.GetMBTNAV(ctx)
+	if err != nil {
+		return err
+	}
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	record := RedemptionRecord{
+		TokenID:   tokenID,
+		TxID:      ctx.GetStub().GetTxID(),
+		UserID:    userID,
+		Amount:    share.Amount,
+		BGTAmount: creditBGT,
+		BSTAmount: creditBST,
+		BPTAmount: creditBPT,
+		BGTGrams:  share.BGTGrams,
+		BSTGrams:  share.BSTGrams,
+		BPTGrams:  share.BPTGrams,
+		Cash:      share.Cash,
+		Fee:       0, // Redemptions carry no fee
+		Residual:  share.Residual,
+		NAV:       quote.NAV,
+		Currency:  quote.Currency,
+		Timestamp: timestamp,
+	}
+	
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal redemption record: %v", err)
+	}
+	
+	recordKey, err := ctx.GetStub().CreateCompositeKey("Redemption", []string{tokenID, timestamp})
+	if err != nil {
+		return fmt.Errorf("failed to create redemption record key: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(recordKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store redemption record: %v", err)
+	}
+	
+	return nil
+}
+
+// GetTokenRedemptionHistory lists a token's redemptions, oldest first. Admins see all
+// of them; other callers only the redemptions they made themselves.
+func (c *MBTBasketContract) GetTokenRedemptionHistory(ctx contractapi.TransactionContextInterface, tokenID string) ([]*RedemptionRecord, error) {
+	callerID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+	admin := requireAdmin(ctx) == nil
+	
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("Redemption", []string{tokenID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query redemption history: %v", err)
+	}
+	defer iterator.Close()
+	
+	history := []*RedemptionRecord{}
+	for iterator.HasNext() {
+		recordJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redemption record: %v", err)
+		}
+		
+		var record RedemptionRecord
+		err = json.Unmarshal(recordJSON.Value, &record)
+		if err != nil {
+			continue // Skip invalid records
+		}
+		
+		if admin || record.UserID == callerID {
+			history = append(history, &record)
+		}
+	}
+	
+	return history, nil
+}
+
+// sweepToTreasury adds redemption residuals to TREASURY_BALANCE. Call at most once
+// per transaction, since the balance cannot be read back after writing.
+func sweepToTreasury(ctx contractapi.TransactionContextInterface, amount float64) error {
+	if amount == 0 {
+		return nil
+	}
+	
+	balance, err := getTreasuryBalance(ctx)
+	if err != nil {
+		return err
+	}
+	
+	balance += amount
+	
+	err = putFloatState(ctx, "TREASURY_BALANCE", balance)
+	if err != nil {
+		return fmt.Errorf("failed to store treasury balance: %v", err)
+	}
+	
+	return nil
+}
+
+// getTreasuryBalance reads the accumulated redemption residuals
+func getTreasuryBalance(ctx contractapi.TransactionContextInterface) (float64, error) {
+	balanceBytes, err := ctx.GetStub().GetState("TREASURY_BALANCE")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read treasury balance: %v", err)
+	}
+	
+	if balanceBytes == nil {
+		return 0, nil
+	}
+	
+	balance, err := strconv.ParseFloat(string(balanceBytes), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid treasury balance: %v", err)
+	}
+	
+	return balance, nil
+}
+
+// GetTreasuryBalance returns the redemption residuals swept to the treasury so far
+func (c *MBTBasketContract) GetTreasuryBalance(ctx contractapi.TransactionContextInterface) (float64, error) {
+	return getTreasuryBalance(ctx)
+}
+
+// AddTreasuryDestination approves an account to receive treasury withdrawals (admin only)
+func (c *MBTBasketContract) AddTreasuryDestination(ctx contractapi.TransactionContextInterface, destination string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if destination == "" {
+		return fmt.Errorf("destination must not be empty")
+	}
+	
+	addedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	entryJSON, err := json.Marshal(TreasuryDestination{Destination: destination, AddedAt: addedAt})
+	if err != nil {
+		return fmt.Errorf("failed to marshal treasury destination: %v", err)
+	}
+	
+	entryKey, err := ctx.GetStub().CreateCompositeKey("TreasuryDestination", []string{destination})
+	if err != nil {
+		return fmt.Errorf("failed to create treasury destination key: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(entryKey, entryJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store treasury destination: %v", err)
+	}
+	
+	log.Printf("Added treasury destination %s", destination)
+	return nil
+}
+
+// RemoveTreasuryDestination withdraws an account's approval (admin only)
+func (c *MBTBasketContract) RemoveTreasuryDestination(ctx contractapi.TransactionContextInterface, destination string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	entryKey, err := ctx.GetStub().CreateCompositeKey("TreasuryDestination", []string{destination})
+	if err != nil {
+		return fmt.Errorf("failed to create treasury destination key: %v", err)
+	}
+	
+	err = ctx.GetStub().DelState(entryKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete treasury destination: %v", err)
+	}
+	
+	log.Printf("Removed treasury destination %s", destination)
+	return nil
+}
+
+// GetTreasuryDestinations lists the accounts approved to receive treasury withdrawals
+func (c *MBTBasketContract) GetTreasuryDestinations(ctx contractapi.TransactionContextInterface) ([]*TreasuryDestination, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("TreasuryDestination", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query treasury destinations: %v", err)
+	}
+	defer iterator.Close()
+	
+	destinations := []*TreasuryDestination{}
+	
+	for iterator.HasNext() {
+		entryJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read treasury destination: %v", err)
+		}
+		
+		var entry TreasuryDestination
+		err = json.Unmarshal(entryJSON.Value, &entry)
+		if err != nil {
+			continue // Skip invalid entries
+		}
+		
+		destinations = append(destinations, &entry)
+	}
+	
+	return destinations, nil
+}
+
+// WithdrawTreasury pays part of the treasury balance to an approved destination (admin only)
+func (c *MBTBasketContract) WithdrawTreasury(ctx contractapi.TransactionContextInterface, 
+	destination string, amount float64) error {
+	
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if amount <= 0 {
+		return fmt.Errorf("withdrawal amount must be positive")
+	}
+	
+	entryKey, err := ctx.GetStub().CreateCompositeKey("TreasuryDestination", []string{destination})
+	if err != nil {
+		return fmt.Errorf("failed to create treasury destination key: %v", err)
+	}
+	
+	entry, err := ctx.GetStub().GetState(entryKey)
+	if err != nil {
+		return fmt.Errorf("failed to read treasury destination: %v", err)
+	}
+	if entry == nil {
+		return fmt.Errorf("destination %s is not an approved treasury destination", destination)
+	}
+	
+	balance, err := getTreasuryBalance(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if amount > balance {
+		return fmt.Errorf("insufficient treasury balance: requested %.2f, available %.2f", amount, balance)
+	}
+	
+	balance -= amount
+	
+	err = putFloatState(ctx, "TREASURY_BALANCE", balance)
+	if err != nil {
+		return fmt.Errorf("failed to store treasury balance: %v", err)
+	}
+	
+	// In real implementation, would pay the amount out to the destination account
+	log.Printf("Withdrew %.2f from treasury to %s", amount, destination)
+	return nil
+}
+
+// releaseTokenShare returns the metals for part or all of a token and updates or
+// deletes the token. Basket holdings are left to the caller.
+func (c *MBTBasketContract) releaseTokenShare(ctx contractapi.TransactionContextInterface, 
+	token *MBTToken, amount float64, userID string) (*redeemedShare, error) {
+	
+	tokenID := token.TokenID
+	
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Draw on the token's cash buffer first; only the remainder is taken from
+	// the metals, pro rata to the metal value the token holds
+	cash := math.Min(amount, token.CashAmount)
+	metalRatio := 0.0
+	if metalValue := token.TotalValue - token.CashAmount; metalValue > 0 {
+		metalRatio, err = safeDivide(amount-cash, metalValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redemption ratio: %v", err)
+		}
+	}
+	redemptionRatio, err := safeDivide(amount, token.TotalValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redemption ratio: %v", err)
+	}
+	share := &redeemedShare{
+		Amount:   amount,
+		BGT:      token.BGTAmount * metalRatio,
+		BST:      token.BSTAmount * metalRatio,
+		BPT:      token.BPTAmount * metalRatio,
+		BGTGrams: token.BGTGrams * metalRatio,
+		BSTGrams: token.BSTGrams * metalRatio,
+		BPTGrams: token.BPTGrams * metalRatio,
+		Cash:     cash,
+	}
+	
+	// Credit whole units of the smallest denomination; the remainder is swept.
+	// Credits are close to the amount, so amount - credited is exact and
+	// credited + residual always equals the amount.
+	creditBGT := roundDown(share.BGT, REDEMPTION_CREDIT_DECIMALS)
+	creditBST := roundDown(share.BST, REDEMPTION_CREDIT_DECIMALS)
+	creditBPT := roundDown(share.BPT, REDEMPTION_CREDIT_DECIMALS)
+	credited := creditBGT + creditBST + creditBPT + cash
+	share.Residual = amount - credited
+	if share.Residual < 0 {
+		return nil, fmt.Errorf("credits %.6f exceed redeemed value %.6f", credited, amount)
+	}
+	
+	if cash > 0 {
+		err = c.creditUserBalance(ctx, userID, cash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pay from cash buffer: %v", err)
+		}
+	}
+	
+	// Deliver the metals now, or schedule delivery if a settlement delay applies.
+	// A redemption covered by the cash buffer moves no metal.
+	if creditBGT+creditBST+creditBPT > 0 {
+		err = c.deliverMetals(ctx, tokenID, userID, creditBGT, creditBST, creditBPT)
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	err = recordResidual(ctx, tokenID, amount, credited, share.Residual)
+	if err != nil {
+		return nil, err
+	}
+	
+	err = c.recordRedemption(ctx, tokenID, userID, share, creditBGT, creditBST, creditBPT)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Update token amount or delete if fully redeemed
+	if amount == token.TotalValue {
+		err = deleteMBTToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		token.TotalValue -= amount
+		token.BGTAmount -= share.BGT
+		token.BSTAmount -= share.BST
+		token.BPTAmount -= share.BPT
+		token.BGTGrams -= share.BGTGrams
+		token.BSTGrams -= share.BSTGrams
+		token.BPTGrams -= share.BPTGrams
+		token.CashAmount -= share.Cash
+		token.CostBasis -= token.CostBasis * redemptionRatio
+		token.LastRebalance = now.Format(time.RFC3339)
+		
+		err = c.putMBTToken(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	return share, nil
+}
+
+// deliverMetals credits redeemed metals to the user at once or, with a settlement
+// delay configured, records a PendingSettlement under Settlement~<dueTS>~<txID>~<tokenID>
+// for SettlePendingRedemptions. The token and holdings are reduced immediately either way.
+func (c *MBTBasketContract) deliverMetals(ctx contractapi.TransactionContextInterface, 
+	tokenID, userID string, bgtAmount, bstAmount, bptAmount float64) error {
+	
+	delayHours, err := c.GetSettlementDelayHours(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if delayHours == 0 {
+		// In real implementation, would interact with metal token chaincodes
+		err = c.ProcessMetalRedemption(ctx, userID, bgtAmount, bstAmount, bptAmount)
+		if err != nil {
+			return fmt.Errorf("failed to process metal redemption: %v", err)
+		}
+		return nil
+	}
+	
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	
+	txID := ctx.GetStub().GetTxID()
+	settlement := PendingSettlement{
+		SettlementID: txID + "-" + tokenID,
+		TokenID:      tokenID,
+		UserID:       userID,
+		BGTAmount:    bgtAmount,
+		BSTAmount:    bstAmount,
+		BPTAmount:    bptAmount,
+		Status:       SETTLEMENT_PENDING,
+		CreatedAt:    now.Format("2006-01-02T15:04:05.000000000Z"),
+		DueAt:        now.Add(time.Duration(delayHours) * time.Hour).Format("2006-01-02T15:04:05.000000000Z"),
+	}
+	
+	settlementKey, err := ctx.GetStub().CreateCompositeKey("Settlement", []string{settlement.DueAt, txID, tokenID})
+	if err != nil {
+		return fmt.Errorf("failed to create settlement key: %v", err)
+	}
+	
+	err = putPendingSettlement(ctx, settlementKey, &settlement)
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Scheduled metal delivery %s for %s, due %s", settlement.SettlementID, userID, settlement.DueAt)
+	return nil
+}
+
+// putPendingSettlement stores a settlement under its key
+func putPendingSettlement(ctx contractapi.TransactionContextInterface, settlementKey string, settlement *PendingSettlement) error {
+	settlementJSON, err := json.Marshal(settlement)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settlement: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(settlementKey, settlementJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store settlement: %v", err)
+	}
+	
+	return nil
+}
+
+// GetSettlementDelayHours retrieves how long redeemed metals wait before delivery
+func (c *MBTBasketContract) GetSettlementDelayHours(ctx contractapi.TransactionContextInterface) (int, error) {
+	delayBytes, err := ctx.GetStub().GetState("SETTLEMENT_DELAY_HOURS")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read settlement delay: %v", err)
+	}
+	
+	if delayBytes == nil {
+		return 0, nil
+	}
+	
+	delayHours, err := strconv.Atoi(string(delayBytes))
+	if err != nil {
+		return 0, fmt.Errorf("invalid settlement delay: %v", err)
+	}
+	
+	return delayHours, nil
+}
+
+// SetSettlementDelayHours sets the T+N delay on metal delivery; zero delivers at
+// redemption (admin only). Already scheduled settlements keep their due time.
+func (c *MBTBasketContract) SetSettlementDelayHours(ctx contractapi.TransactionContextInterface, delayHours int) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if delayHours < 0 {
+		return fmt.Errorf("settlement delay must not be negative")
+	}
+	
+	err = ctx.GetStub().PutState("SETTLEMENT_DELAY_HOURS", []byte(strconv.Itoa(delayHours)))
+	if err != nil {
+		return fmt.Errorf("failed to store settlement delay: %v", err)
+	}
+	
+	log.Printf("Settlement delay set to %d hours", delayHours)
+	return nil
+}
+
+// SettlePendingRedemptions delivers the metals of settlements now due, oldest due
+// first, up to MAX_BATCH_SIZE per call, and returns how many it settled (admin only)
+func (c *MBTBasketContract) SettlePendingRedemptions(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return 0, err
+	}
+	
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("Settlement", []string{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query settlements: %v", err)
+	}
+	defer iterator.Close()
+	
+	settled := 0
+	for iterator.HasNext() && settled < MAX_BATCH_SIZE {
+		settlementJSON, err := iterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read settlement: %v", err)
+		}
+		
+		var settlement PendingSettlement
+		err = json.Unmarshal(settlementJSON.Value, &settlement)
+		if err != nil || settlement.Status != SETTLEMENT_PENDING {
+			continue
+		}
+		
+		// Keys sort by due time, so nothing after this one is due either
+		if settlement.DueAt > timestamp {
+			break
+		}
+		
+		err = c.ProcessMetalRedemption(ctx, settlement.UserID, 
+			settlement.BGTAmount, settlement.BSTAmount, settlement.BPTAmount)
+		if err != nil {
+			return 0, fmt.Errorf("failed to settle %s: %v", settlement.SettlementID, err)
+		}
+		
+		settlement.Status = SETTLEMENT_SETTLED
+		settlement.SettledAt = timestamp
+		
+		err = putPendingSettlement(ctx, settlementJSON.Key, &settlement)
+		if err != nil {
+			return 0, err
+		}
+		settled++
+	}
+	
+	log.Printf("Settled %d pending redemptions", settled)
+	return settled, nil
+}
+
+// GetPendingSettlements lists a user's metal deliveries not yet settled, earliest due first
+func (c *MBTBasketContract) GetPendingSettlements(ctx contractapi.TransactionContextInterface, userID string) ([]*PendingSettlement, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("Settlement", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settlements: %v", err)
+	}
+	defer iterator.Close()
+	
+	settlements := []*PendingSettlement{}
+	
+	for iterator.HasNext() {
+		settlementJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read settlement: %v", err)
+		}
+		
+		var settlement PendingSettlement
+		err = json.Unmarshal(settlementJSON.Value, &settlement)
+		if err != nil {
+			continue // Skip invalid settlements
+		}
+		
+		if settlement.UserID == userID && settlement.Status == SETTLEMENT_PENDING {
+			settlements = append(settlements, &settlement)
+		}
+	}
+	
+	return settlements, nil
+}
+
+// EmergencyRedeem redeems a whole token during wind-down, bypassing holding
+// periods, redemption limits and fees
+func (c *MBTBasketContract) EmergencyRedeem(ctx contractapi.TransactionContextInterface, tokenID, userID string) error {
+	err := requireUserOrAdmin(ctx, userID)
+	if err != nil {
+		return err
+	}
+	
+	mode, err := c.GetContractMode(ctx)
+	if err != nil {
+		return err
+	}
+	if mode != MODE_WINDDOWN {
+		return fmt.Errorf("emergency redemption is only available in %s mode", MODE_WINDDOWN)
+	}
+	
+	token, err := c.GetMBTToken(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	
+	// Verify ownership
+	if token.Owner != userID {
+		return fmt.Errorf("unauthorized: user does not own this token")
+	}
+	
+	if token.Locked {
+		return fmt.Errorf("token %s is locked", tokenID)
+	}
+	
+	err = checkNotFrozen(token)
+	if err != nil {
+		return err
+	}
+	
+	amount := token.TotalValue
+	err = c.settleRedemption(ctx, token, amount, userID)
+	if err != nil {
+		return err
+	}
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	record := EmergencyRedemption{
+		TokenID:   tokenID,
+		Owner:     userID,
+		Amount:    amount,
+		Timestamp: timestamp,
+	}
+	
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal emergency redemption: %v", err)
+	}
+	
+	recordKey, err := ctx.GetStub().CreateCompositeKey("EmergencyRedemption", []string{tokenID})
+	if err != nil {
+		return fmt.Errorf("failed to create emergency redemption key: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(recordKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store emergency redemption: %v", err)
+	}
+	
+	log.Printf("Emergency redemption of MBT token %s for %.2f", tokenID, amount)
+	return nil
+}
+
+// GetContractMode retrieves the contract operating mode
+func (c *MBTBasketContract) GetContractMode(ctx contractapi.TransactionContextInterface) (string, error) {
+	modeBytes, err := ctx.GetStub().GetState("CONTRACT_MODE")
+	if err != nil {
+		return "", fmt.Errorf("failed to read contract mode: %v", err)
+	}
+	
+	if modeBytes == nil {
+		return MODE_ACTIVE, nil
+	}
+	
+	return string(modeBytes), nil
+}
+
+// SetContractMode switches the contract operating mode (admin only)
+func (c *MBTBasketContract) SetContractMode(ctx contractapi.TransactionContextInterface, mode string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if mode != MODE_ACTIVE && mode != MODE_WINDDOWN {
+		return fmt.Errorf("unknown contract mode %s", mode)
+	}
+	
+	err = ctx.GetStub().PutState("CONTRACT_MODE", []byte(mode))
+	if err != nil {
+		return fmt.Errorf("failed to store contract mode: %v", err)
+	}
+	
+	log.Printf("Contract mode set to %s", mode)
+	return nil
+}
+
+// GetPauseFlags retrieves which operations are paused; none are by default
+func (c *MBTBasketContract) GetPauseFlags(ctx contractapi.TransactionContextInterface) (*PauseFlags, error) {
+	return getPauseFlags(ctx)
+}
+
+// getPauseFlags reads the PAUSE_FLAGS record
+func getPauseFlags(ctx contractapi.TransactionContextInterface) (*PauseFlags, error) {
+	flagsJSON, err := ctx.GetStub().GetState("PAUSE_FLAGS")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pause flags: %v", err)
+	}
+	
+	flags := &PauseFlags{}
+	if flagsJSON == nil {
+		return flags, nil
+	}
+	
+	err = json.Unmarshal(flagsJSON, flags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pause flags: %v", err)
+	}
+	
+	return flags, nil
+}
+
+// SetOperationPaused pauses or resumes one operation: PAUSE_MINT, PAUSE_REDEEM,
+// PAUSE_REBALANCE or PAUSE_TRANSFER, or every one with PAUSE_ALL (admin only)
+func (c *MBTBasketContract) SetOperationPaused(ctx contractapi.TransactionContextInterface, operation string, paused bool) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	flags, err := getPauseFlags(ctx)
+	if err != nil {
+		return err
+	}
+	
+	operation = strings.ToUpper(operation)
+	switch operation {
+	case PAUSE_MINT:
+		flags.MintPaused = paused
+	case PAUSE_REDEEM:
+		flags.RedeemPaused = paused
+	case PAUSE_REBALANCE:
+		flags.RebalancePaused = paused
+	case PAUSE_TRANSFER:
+		flags.TransferPaused = paused
+	case PAUSE_ALL:
+		flags.MintPaused = paused
+		flags.RedeemPaused = paused
+		flags.RebalancePaused = paused
+		flags.TransferPaused = paused
+	default:
+		return fmt.Errorf("unknown operation %q: must be %s, %s, %s, %s or %s", 
+			operation, PAUSE_MINT, PAUSE_REDEEM, PAUSE_REBALANCE, PAUSE_TRANSFER, PAUSE_ALL)
+	}
+	
+	flags.UpdatedAt, err = txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	flagsJSON, err := json.Marshal(flags)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pause flags: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState("PAUSE_FLAGS", flagsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store pause flags: %v", err)
+	}
+	
+	log.Printf("Set pause on %s to %t", operation, paused)
+	return nil
+}
+
+// SetPaused pauses or resumes every operation at once (admin only)
+func (c *MBTBasketContract) SetPaused(ctx contractapi.TransactionContextInterface, paused bool) error {
+	return c.SetOperationPaused(ctx, PAUSE_ALL, paused)
+}
+
+// checkNotPaused rejects an operation an admin has paused
+func checkNotPaused(ctx contractapi.TransactionContextInterface, operation string) error {
+	flags, err := getPauseFlags(ctx)
+	if err != nil {
+		return err
+	}
+	
+	paused := map[string]bool{
+		PAUSE_MINT:      flags.MintPaused,
+		PAUSE_REDEEM:    flags.RedeemPaused,
+		PAUSE_REBALANCE: flags.RebalancePaused,
+		PAUSE_TRANSFER:  flags.TransferPaused,
+	}
+	if paused[operation] {
+		return fmt.Errorf("%s operations are paused", strings.ToLower(operation))
+	}
+	
+	return nil
+}
+
+// TransferMBT transfers part or all of a token's value to another owner. A full
+// transfer changes the token's owner; a partial transfer splits off a new token.
+func (c *MBTBasketContract) TransferMBT(ctx contractapi.TransactionContextInterface, 
+	tokenID string, amount float64, fromUserID, toUserID string) error {
+	
+	log.Printf("Transferring MBT tokens: TokenID=%s, Amount=%.2f, From=%s, To=%s", tokenID, amount, fromUserID, toUserID)
+	
+	err := requireUserOrAdmin(ctx, fromUserID)
+	if err != nil {
+		return err
+	}
+	
+	err = checkNotPaused(ctx, PAUSE_TRANSFER)
+	if err != nil {
+		return err
+	}
+	
+	return c.transferMBT(ctx, tokenID, amount, fromUserID, toUserID, "")
+}
+
+// transferMBT moves amount of a token from one user to another, splitting the token
+// when only part of it moves, and records the transfer. reversalOf names the
+// transfer being undone, if any.
+func (c *MBTBasketContract) transferMBT(ctx contractapi.TransactionContextInterface, 
+	tokenID string, amount float64, fromUserID, toUserID, reversalOf string) error {
+	
+	err := checkNotBlacklisted(ctx, fromUserID)
+	if err != nil {
+		return err
+	}
+	err = checkNotBlacklisted(ctx, toUserID)
+	if err != nil {
+		return err
+	}
+	
+	if amount <= 0 {
+		return fmt.Errorf("transfer amount must be positive")
+	}
+	
+	if fromUserID == toUserID {
+		return fmt.Errorf("cannot transfer a token to its current owner")
+	}
+	
+	token, err := c.GetMBTToken(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	
+	// Verify ownership
+	if token.Owner != fromUserID {
+		return fmt.Errorf("unauthorized: user does not own this token")
+	}
+	
+	err = checkNotFrozen(token)
+	if err != nil {
+		return err
+	}
+	
+	if amount > token.TotalValue {
+		return fmt.Errorf("insufficient token balance: requested %.2f, available %.2f", amount, token.TotalValue)
+	}
+	
+	if amount == token.TotalValue {
+		token.Owner = toUserID
+		
+		err = c.putMBTToken(ctx, token)
+		if err != nil {
+			return err
+		}
+		
+		err = recordTransfer(ctx, fromUserID, toUserID, tokenID, tokenID, amount, reversalOf)
+		if err != nil {
+			return err
+		}
+		
+		log.Printf("Successfully transferred MBT token %s to %s", tokenID, toUserID)
+		return nil
+	}
+	
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	
+	// Split the transferred share into a new token for the recipient
+	ratio := amount / token.TotalValue
+	newToken := *token
+	newToken.TokenID = fmt.Sprintf("MBT-%s-SPLIT", ctx.GetStub().GetTxID())
+	newToken.Owner = toUserID
+	newToken.TotalValue = amount
+	newToken.BGTAmount = token.BGTAmount * ratio
+	newToken.BSTAmount = token.BSTAmount * ratio
+	newToken.BPTAmount = token.BPTAmount * ratio
+	newToken.BGTGrams = token.BGTGrams * ratio
+	newToken.BSTGrams = token.BSTGrams * ratio
+	newToken.BPTGrams = token.BPTGrams * ratio
+	newToken.CostBasis = token.CostBasis * ratio
+	newToken.CashAmount = token.CashAmount * ratio
+	newToken.CreationTime = now.Format(time.RFC3339)
+	newToken.Metadata = copyMetadata(token.Metadata)
+	newToken.Version = 0
+	
+	token.TotalValue -= amount
+	token.BGTAmount -= newToken.BGTAmount
+	token.BSTAmount -= newToken.BSTAmount
+	token.BPTAmount -= newToken.BPTAmount
+	token.BGTGrams -= newToken.BGTGrams
+	token.BSTGrams -= newToken.BSTGrams
+	token.BPTGrams -= newToken.BPTGrams
+	token.CostBasis -= newToken.CostBasis
+	token.CashAmount -= newToken.CashAmount
+	
+	for _, t := range []*MBTToken{token, &newToken} {
+		err = c.putMBTToken(ctx, t)
+		if err != nil {
+			return err
+		}
+	}
+	
+	// The split is a new token created now, so it joins the creation date index
+	err = putTokenDateIndex(ctx, &newToken)
+	if err != nil {
+		return err
+	}
+	
+	err = recordTransfer(ctx, fromUserID, toUserID, tokenID, newToken.TokenID, amount, reversalOf)
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Successfully transferred %.2f of MBT token %s to %s as %s", amount, tokenID, toUserID, newToken.TokenID)
+	return nil
+}
+
+// recordTransfer stores a TransferRecord keyed by the transaction ID and adds the
+// transfer to both parties' activity feeds
+func recordTransfer(ctx contractapi.TransactionContextInterface, 
+	fromUserID, toUserID, fromTokenID, toTokenID string, amount float64, reversalOf string) error {
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	err = putTransferRecord(ctx, &TransferRecord{
+		TransferID:  ctx.GetStub().GetTxID(),
+		FromUserID:  fromUserID,
+		ToUserID:    toUserID,
+		FromTokenID: fromTokenID,
+		ToTokenID:   toTokenID,
+		Amount:      amount,
+		Timestamp:   timestamp,
+		ReversalOf:  reversalOf,
+	})
+	if err != nil {
+		return err
+	}
+	
+	err = recordUserTx(ctx, fromUserID, USER_TX_TRANSFER_OUT, fromTokenID, amount, toUserID)
+	if err != nil {
+		return err
+	}
+	return recordUserTx(ctx, toUserID, USER_TX_TRANSFER_IN, toTokenID, amount, fromUserID)
+}
+
+// putTransferRecord stores a transfer record under Transfer~<transferID>
+func putTransferRecord(ctx contractapi.TransactionContextInterface, record *TransferRecord) error {
+	recordKey, err := ctx.GetStub().CreateCompositeKey("Transfer", []string{record.TransferID})
+	if err != nil {
+		return fmt.Errorf("failed to create transfer record key: %v", err)
+	}
+	
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transfer record: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(recordKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store transfer record: %v", err)
+	}
+	
+	return nil
+}
+
+// GetTransferRecord retrieves a transfer by its transaction ID
+func (c *MBTBasketContract) GetTransferRecord(ctx contractapi.TransactionContextInterface, transferID string) (*TransferRecord, error) {
+	recordKey, err := ctx.GetStub().CreateCompositeKey("Transfer", []string{transferID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transfer record key: %v", err)
+	}
+	
+	recordJSON, err := ctx.GetStub().GetState(recordKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transfer record: %v", err)
+	}
+	if recordJSON == nil {
+		return nil, fmt.Errorf("transfer %s %w", transferID, ErrNotFound)
+	}
+	
+	var record TransferRecord
+	err = json.Unmarshal(recordJSON, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transfer record: %v", err)
+	}
+	
+	return &record, nil
+}
+
+// ReverseTransfer moves a mistaken transfer's value back to the sender (admin only).
+// It is rejected once the reversal window has passed, if the transfer was already
+// reversed or is itself a reversal, or if the recipient's token no longer holds the
+// transferred value. The reversal is a transfer of its own, linked both ways.
+func (c *MBTBasketContract) ReverseTransfer(ctx contractapi.TransactionContextInterface, transferID string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	record, err := c.GetTransferRecord(ctx, transferID)
+	if err != nil {
+		return err
+	}
+	
+	if record.ReversedBy != "" {
+		return fmt.Errorf("transfer %s was already reversed by %s", transferID, record.ReversedBy)
+	}
+	if record.ReversalOf != "" {
+		return fmt.Errorf("transfer %s is itself a reversal of %s", transferID, record.ReversalOf)
+	}
+	
+	windowHours, err := c.GetReversalWindowHours(ctx)
+	if err != nil {
+		return err
+	}
+	
+	transferredAt, err := time.Parse("2006-01-02T15:04:05.000000000Z", record.Timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp on transfer %s: %v", transferID, err)
+	}
+	
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if now.After(transferredAt.Add(time.Duration(windowHours) * time.Hour)) {
+		return fmt.Errorf("transfer %s is outside the %d hour reversal window", transferID, windowHours)
+	}
+	
+	token, err := c.GetMBTToken(ctx, record.ToTokenID)
+	if err != nil {
+		return fmt.Errorf("recipient token of transfer %s is gone: %v", transferID, err)
+	}
+	if token.Owner != record.ToUserID || token.TotalValue < record.Amount {
+		return fmt.Errorf("transferred value of %s has moved on: recipient token %s holds %.2f of %.2f", 
+			transferID, token.TokenID, token.TotalValue, record.Amount)
+	}
+	
+	err = c.transferMBT(ctx, record.ToTokenID, record.Amount, record.ToUserID, record.FromUserID, transferID)
+	if err != nil {
+		return fmt.Errorf("failed to reverse transfer %s: %v", transferID, err)
+	}
+	
+	record.ReversedBy = ctx.GetStub().GetTxID()
+	record.ReversedAt = now.UTC().Format("2006-01-02T15:04:05.000000000Z")
+	
+	err = putTransferRecord(ctx, record)
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Reversed transfer %s of %.2f from %s back to %s", transferID, record.Amount, record.ToUserID, record.FromUserID)
+	return nil
+}
+
+// GetReversalWindowHours retrieves how long after a transfer it may be reversed
+func (c *MBTBasketContract) GetReversalWindowHours(ctx contractapi.TransactionContextInterface) (int, error) {
+	windowBytes, err := ctx.GetStub().GetState("REVERSAL_WINDOW_HOURS")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read reversal window: %v", err)
+	}
+	
+	if windowBytes == nil {
+		return DEFAULT_REVERSAL_WINDOW_HOURS, nil
+	}
+	
+	windowHours, err := strconv.Atoi(string(windowBytes))
+	if err != nil {
+		return 0, fmt.Errorf("invalid reversal window: %v", err)
+	}
+	
+	return windowHours, nil
+}
+
+// SetReversalWindowHours sets how long transfers stay reversible; zero disables
+// reversal (admin only)
+func (c *MBTBasketContract) SetReversalWindowHours(ctx contractapi.TransactionContextInterface, windowHours int) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if windowHours < 0 {
+		return fmt.Errorf("reversal window must not be negative")
+	}
+	
+	err = ctx.GetStub().PutState("REVERSAL_WINDOW_HOURS", []byte(strconv.Itoa(windowHours)))
+	if err != nil {
+		return fmt.Errorf("failed to store reversal window: %v", err)
+	}
+	
+	log.Printf("Transfer reversal window set to %d hours", windowHours)
+	return nil
+}
+
+// recordUserTx stores an activity record under UserTx~<userID>~<txTS>~<txID>,
+// so a user's records sort by time
+func recordUserTx(ctx contractapi.TransactionContextInterface, 
+	userID, txType, tokenID string, amount float64, counterparty string) error {
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	record := UserTxRecord{
+		UserID:       userID,
+		Type:         txType,
+		TokenID:      tokenID,
+		Amount:       amount,
+		Counterparty: counterparty,
+		Timestamp:    timestamp,
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+	
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal activity record: %v", err)
+	}
+	
+	recordKey, err := ctx.GetStub().CreateCompositeKey("UserTx", []string{userID, timestamp, record.TxID})
+	if err != nil {
+		return fmt.Errorf("failed to create activity record key: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(recordKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store activity record: %v", err)
+	}
+	
+	return nil
+}
+
+// GetUserTransactionHistory returns one page of a user's activity, oldest first.
+// fromTS and toTS are inclusive transaction timestamps; either may be empty for an
+// open bound. Records outside the range are skipped, so a page may hold fewer than
+// pageSize records while the bookmark is still non-empty.
+func (c *MBTBasketContract) GetUserTransactionHistory(ctx contractapi.TransactionContextInterface, 
+	userID, fromTS, toTS string, pageSize int32, bookmark string) (*UserTxPage, error) {
+	
+	if pageSize <= 0 || pageSize > MAX_BATCH_SIZE {
+		return nil, fmt.Errorf("page size must be between 1 and %d", MAX_BATCH_SIZE)
+	}
+	
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(
+		"UserTx", []string{userID}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query activity records: %v", err)
+	}
+	defer iterator.Close()
+	
+	page := &UserTxPage{Records: []*UserTxRecord{}}
+	
+	for iterator.HasNext() {
+		recordJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read activity record: %v", err)
+		}
+		
+		var record UserTxRecord
+		err = json.Unmarshal(recordJSON.Value, &record)
+		if err != nil {
+			continue // Skip invalid records
+		}
+		
+		if (fromTS != "" && record.Timestamp < fromTS) || (toTS != "" && record.Timestamp > toTS) {
+			continue
+		}
+		
+		page.Records = append(page.Records, &record)
+	}
+	
+	page.FetchedCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+	if page.FetchedCount < pageSize {
+		page.Bookmark = "" // Last page
+	}
+	
+	return page, nil
+}
+
+// recordFee stores a fee charged to a user under Fee~<txTS>~<txID>~<type>, so fee
+// records iterate in time order. Zero fees are not recorded.
+func recordFee(ctx contractapi.TransactionContextInterface, feeType string, amount float64, userID string) error {
+	if amount == 0 {
+		return nil
+	}
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	record := FeeRecord{
+		Type:      feeType,
+		Amount:    amount,
+		UserID:    userID,
+		Timestamp: timestamp,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+	
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fee record: %v", err)
+	}
+	
+	recordKey, err := ctx.GetStub().CreateCompositeKey("Fee", []string{timestamp, record.TxID, feeType})
+	if err != nil {
+		return fmt.Errorf("failed to create fee record key: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(recordKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store fee record: %v", err)
+	}
+	
+	return nil
+}
+
+// feeDateRange converts inclusive YYYY-MM-DD dates to the transaction timestamps
+// bounding them
+func feeDateRange(fromDate, toDate string) (string, string, error) {
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid from date: %v", err)
+	}
+	
+	to, err := time.Parse("2006-01-02", toDate)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid to date: %v", err)
+	}
+	
+	if to.Before(from) {
+		return "", "", fmt.Errorf("to date must not be before from date")
+	}
+	
+	fromTS := from.Format("2006-01-02T15:04:05.000000000Z")
+	toTS := to.Add(24*time.Hour - time.Nanosecond).Format("2006-01-02T15:04:05.000000000Z")
+	return fromTS, toTS, nil
+}
+
+// GetFeeRevenue sums the fees charged between two inclusive dates by fee type
+// (admin only)
+func (c *MBTBasketContract) GetFeeRevenue(ctx contractapi.TransactionContextInterface, 
+	fromDate, toDate string) (*FeeRevenue, error) {
+	
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	fromTS, toTS, err := feeDateRange(fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("Fee", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fee records: %v", err)
+	}
+	defer iterator.Close()
+	
+	revenue := &FeeRevenue{
+		FromDate: fromDate,
+		ToDate:   toDate,
+		ByType:   map[string]float64{FEE_MINT: 0, FEE_REDEEM: 0, FEE_CONVERSION: 0},
+	}
+	
+	for iterator.HasNext() {
+		recordJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fee record: %v", err)
+		}
+		
+		var record FeeRecord
+		err = json.Unmarshal(recordJSON.Value, &record)
+		if err != nil {
+			continue // Skip invalid records
+		}
+		
+		if record.Timestamp < fromTS {
+			continue
+		}
+		if record.Timestamp > toTS {
+			break // Records are in time order
+		}
+		
+		revenue.ByType[record.Type] += record.Amount
+		revenue.RecordCount++
+	}
+	
+	for _, feeType := range []string{FEE_MINT, FEE_REDEEM, FEE_CONVERSION} {
+		revenue.Total += revenue.ByType[feeType]
+	}
+	
+	return revenue, nil
+}
+
+// GetFeeRecords returns one page of the individual fees charged between two
+// inclusive dates, oldest first (admin only). Records outside the range are
+// skipped, so a page may hold fewer than pageSize records while the bookmark is
+// still non-empty.
+func (c *MBTBasketContract) GetFeeRecords(ctx contractapi.TransactionContextInterface, 
+	fromDate, toDate string, pageSize int32, bookmark string) (*FeeRecordPage, error) {
+	
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	if pageSize <= 0 || pageSize > MAX_BATCH_SIZE {
+		return nil, fmt.Errorf("page size must be between 1 and %d", MAX_BATCH_SIZE)
+	}
+	
+	fromTS, toTS, err := feeDateRange(fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(
+		"Fee", []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fee records: %v", err)
+	}
+	defer iterator.Close()
+	
+	page := &FeeRecordPage{Records: []*FeeRecord{}}
+	
+	for iterator.HasNext() {
+		recordJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fee record: %v", err)
+		}
+		
+		var record FeeRecord
+		err = json.Unmarshal(recordJSON.Value, &record)
+		if err != nil {
+			continue // Skip invalid records
+		}
+		
+		if record.Timestamp < fromTS || record.Timestamp > toTS {
+			continue
+		}
+		
+		page.Records = append(page.Records, &record)
+	}
+	
+	page.FetchedCount = metadata.FetchedRecordsCount
+	page.Bookmark = metadata.Bookmark
+	if page.FetchedCount < pageSize {
+		page.Bookmark = "" // Last page
+	}
+	
+	return page, nil
+}
+
+// AddToBlacklist blocks a user from minting, transferring and redeeming (admin only)
+func (c *MBTBasketContract) AddToBlacklist(ctx contractapi.TransactionContextInterface, userID string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if userID == "" {
+		return fmt.Errorf("user ID must not be empty")
+	}
+	
+	addedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	entryJSON, err := json.Marshal(BlacklistEntry{UserID: userID, AddedAt: addedAt})
+	if err != nil {
+		return fmt.Errorf("failed to marshal blacklist entry: %v", err)
+	}
+	
+	entryKey, err := ctx.GetStub().CreateCompositeKey("Blacklist", []string{userID})
+	if err != nil {
+		return fmt.Errorf("failed to create blacklist key: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(entryKey, entryJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store blacklist entry: %v", err)
+	}
+	
+	log.Printf("Added %s to blacklist", userID)
+	return nil
+}
+
+// RemoveFromBlacklist lifts a user's block (admin only)
+func (c *MBTBasketContract) RemoveFromBlacklist(ctx contractapi.TransactionContextInterface, userID string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	entryKey, err := ctx.GetStub().CreateCompositeKey("Blacklist", []string{userID})
+	if err != nil {
+		return fmt.Errorf("failed to create blacklist key: %v", err)
+	}
+	
+	err = ctx.GetStub().DelState(entryKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete blacklist entry: %v", err)
+	}
+	
+	log.Printf("Removed %s from blacklist", userID)
+	return nil
+}
+
+// GetComplianceReport gathers the blacklist, frozen and locked tokens, and flagged
+// rebalance operations in one call (compliance or admin only)
+func (c *MBTBasketContract) GetComplianceReport(ctx contractapi.TransactionContextInterface) (*ComplianceReport, error) {
+	err := requireComplianceOrAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	generatedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	report := &ComplianceReport{Blacklist: []*BlacklistEntry{}, GeneratedAt: generatedAt}
+	
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("Blacklist", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blacklist: %v", err)
+	}
+	defer iterator.Close()
+	
+	for iterator.HasNext() {
+		entryJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blacklist entry: %v", err)
+		}
+		
+		var entry BlacklistEntry
+		err = json.Unmarshal(entryJSON.Value, &entry)
+		if err != nil {
+			continue // Skip invalid entries
+		}
+		
+		report.Blacklist = append(report.Blacklist, &entry)
+	}
+	
+	report.FrozenTokens, err = queryTokens(ctx, map[string]interface{}{"frozen": true})
+	if err != nil {
+		return nil, err
+	}
+	
+	report.LockedTokens, err = queryTokens(ctx, map[string]interface{}{"locked": true})
+	if err != nil {
+		return nil, err
+	}
+	
+	config, err := getMetalChaincodeConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	if config.RebalancingChaincode != "" {
+		args := [][]byte{[]byte("GetFlaggedOperations")}
+		response := ctx.GetStub().InvokeChaincode(config.RebalancingChaincode, args, config.Channel)
+		if response.Status != shim.OK {
+			return nil, fmt.Errorf("failed to fetch flagged operations: %s", response.Message)
+		}
+		report.FlaggedOperations = response.Payload
+	}
+	
+	return report, nil
+}
+
+// IsBlacklisted reports whether a user is on the sanctions blacklist
+func (c *MBTBasketContract) IsBlacklisted(ctx contractapi.TransactionContextInterface, userID string) (bool, error) {
+	return isBlacklisted(ctx, userID)
+}
+
+// isBlacklisted looks up a user's blacklist entry
+func isBlacklisted(ctx contractapi.TransactionContextInterface, userID string) (bool, error) {
+	entryKey, err := ctx.GetStub().CreateCompositeKey("Blacklist", []string{userID})
+	if err != nil {
+		return false, fmt.Errorf("failed to create blacklist key: %v", err)
+	}
+	
+	entryJSON, err := ctx.GetStub().GetState(entryKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read blacklist entry: %v", err)
+	}
+	
+	return entryJSON != nil, nil
+}
+
+// checkNotBlacklisted rejects blacklisted users with a compliance error
+func checkNotBlacklisted(ctx contractapi.TransactionContextInterface, userID string) error {
+	blacklisted, err := isBlacklisted(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if blacklisted {
+		return fmt.Errorf("compliance: user %s is blacklisted", userID)
+	}
+	return nil
+}
+
+// ProcessMetalRedemption processes redemption of underlying metal tokens
+func (c *MBTBasketContract) ProcessMetalRedemption(ctx contractapi.TransactionContextInterface, 
+	userID string, bgtAmount, bstAmount, bptAmount float64) error {
+	
+	log.Printf("Processing metal redemption for user %s: BGT=%.2f, BST=%.2f, BPT=%.2f", 
+		userID, bgtAmount, bstAmount, bptAmount)
+	
+	amounts := map[string]float64{"BGT": bgtAmount, "BST": bstAmount, "BPT": bptAmount}
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		err := c.InvokeMetalTokenChaincode(ctx, metal, "debit", userID, amounts[metal])
+		if err != nil {
+			return err
+		}
+	}
+	
+	return nil
+}
+
+// GetUserBalance gets user account balance (simulation)
+func (c *MBTBasketContract) GetUserBalance(ctx contractapi.TransactionContextInterface, userID string, amount float64) (float64, error) {
+	// In real implementation, would query user account balance
+	return 1000000.0, nil // Simulate sufficient balance
+}
+
+// DeductUserBalance deducts amount from user balance (simulation)
+func (c *MBTBasketContract) DeductUserBalance(ctx contractapi.TransactionContextInterface, userID string, amount float64) error {
+	// In real implementation, would deduct from user account
+	log.Printf("Deducting %.2f from user %s balance", amount, userID)
+	return nil
+}
+
+// creditUserBalance pays an amount into the user's account (simulation)
+func (c *MBTBasketContract) creditUserBalance(ctx contractapi.TransactionContextInterface, userID string, amount float64) error {
+	// In real implementation, would credit the user account
+	log.Printf("Crediting %.2f to user %s balance", amount, userID)
+	return nil
+}
+
+// collectMetalDeposit takes custody of metal tokens deposited for an in-kind mint (simulation)
+func (c *MBTBasketContract) collectMetalDeposit(ctx contractapi.TransactionContextInterface, userID string, grams map[string]float64) error {
+	// In real implementation, would move the user's metal tokens into basket custody
+	log.Printf("Collecting deposit from user %s: BGT=%.4fg, BST=%.4fg, BPT=%.4fg", 
+		userID, grams["BGT"], grams["BST"], grams["BPT"])
+	return nil
+}
+
+// RebalanceBasket performs portfolio rebalancing
+func (c *MBTBasketContract) RebalanceBasket(ctx contractapi.TransactionContextInterface) error {
+	log.Println("Starting basket rebalancing process")
+	
+	err := checkNotPaused(ctx, PAUSE_REBALANCE)
+	if err != nil {
+		return err
+	}
+	
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if !holdings.RebalanceNeeded {
+		log.Println("Rebalancing not needed at this time")
+		return nil
+	}
+	
+	totalValue := holdings.TotalBGTValue + holdings.TotalBSTValue + holdings.TotalBPTValue
+	if totalValue == 0 {
+		log.Println("No holdings to rebalance")
+		return nil
+	}
+	
+	// Calculate target allocations
+	targets, err := c.GetBasketCompositionTargets(ctx)
+	if err != nil {
+		return err
+	}
+	targetBGT := totalValue * targets["BGT"]
+	targetBST := totalValue * targets["BST"]
+	targetBPT := totalValue * targets["BPT"]
+	
+	// Calculate rebalancing needs
+	rebalanceBGT := targetBGT - holdings.TotalBGTValue
+	rebalanceBST := targetBST - holdings.TotalBSTValue
+	rebalanceBPT := targetBPT - holdings.TotalBPTValue
+	
+	log.Printf("Rebalancing requirements: BGT=%.2f, BST=%.2f, BPT=%.2f", 
+		rebalanceBGT, rebalanceBST, rebalanceBPT)
+	
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get metal prices: %v", err)
+	}
+	
+	// In real implementation, would execute rebalancing trades
+	// For now, just update the holdings to reflect the rebalancing
+	holdings.TotalBGTValue = targetBGT
+	holdings.TotalBSTValue = targetBST
+	holdings.TotalBPTValue = targetBPT
+	holdings.TotalBGTGrams += rebalanceBGT / prices["BGT"]
+	holdings.TotalBSTGrams += rebalanceBST / prices["BST"]
+	holdings.TotalBPTGrams += rebalanceBPT / prices["BPT"]
+	holdings.RebalanceNeeded = false
+	holdings.LastRebalance = now.Format(time.RFC3339)
+	
+	err = c.putBasketHoldings(ctx, holdings)
+	if err != nil {
+		return err
+	}
+	
+	log.Println("Basket rebalancing completed successfully")
+	return nil
+}
+
+// ApplyRebalanceAdjustment records the trades of a rebalance executed by the
+// rebalancing chaincode in the basket holdings (admin only)
+func (c *MBTBasketContract) ApplyRebalanceAdjustment(ctx contractapi.TransactionContextInterface, adjustmentJSON string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	err = checkNotPaused(ctx, PAUSE_REBALANCE)
+	if err != nil {
+		return err
+	}
+	
+	var adjustment RebalanceAdjustment
+	err = json.Unmarshal([]byte(adjustmentJSON), &adjustment)
+	if err != nil {
+		return fmt.Errorf("invalid rebalance adjustment JSON: %v", err)
+	}
+	
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return err
+	}
+	
+	holdings.TotalBGTValue += adjustment.Values["BGT"]
+	holdings.TotalBSTValue += adjustment.Values["BST"]
+	holdings.TotalBPTValue += adjustment.Values["BPT"]
+	holdings.TotalBGTGrams += adjustment.Grams["BGT"]
+	holdings.TotalBSTGrams += adjustment.Grams["BST"]
+	holdings.TotalBPTGrams += adjustment.Grams["BPT"]
+	holdings.RebalanceNeeded = false
+	holdings.LastRebalance = now.Format(time.RFC3339)
+	
+	// Reject trades that would leave any metal's value or weight negative; rounding
+	// residue is zeroed as UpdateBasketHoldings does
+	fields := []struct {
+		name  string
+		value *float64
+	}{
+		{"TotalBGTValue", &holdings.TotalBGTValue},
+		{"TotalBSTValue", &holdings.TotalBSTValue},
+		{"TotalBPTValue", &holdings.TotalBPTValue},
+		{"TotalBGTGrams", &holdings.TotalBGTGrams},
+		{"TotalBSTGrams", &holdings.TotalBSTGrams},
+		{"TotalBPTGrams", &holdings.TotalBPTGrams},
+	}
+	for _, field := range fields {
+		if *field.value >= 0 {
+			continue
+		}
+		if *field.value > -HOLDINGS_EPSILON {
+			*field.value = 0
+			continue
+		}
+		return fmt.Errorf("rebalance adjustment would make %s negative: %.6f", field.name, *field.value)
+	}
+	
+	err = c.putBasketHoldings(ctx, holdings)
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Applied rebalance adjustment: %v", adjustment.Values)
+	return nil
+}
+
+// GetMBTPrices retrieves current prices for metals (simulation)
+func (c *MBTBasketContract) GetMBTPrices(ctx contractapi.TransactionContextInterface) (map[string]float64, error) {
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	return fetchMetalPrices(ctx, holdings.Currency)
+}
+
+// GetMetalPrice returns one metal's price per gram in the basket currency and where
+// it came from: an unexpired manual override ("manual"), the median of the oracle
+// quorum ("quorum") when one is configured, otherwise the reference table
+// ("fallback") converted at the oracle FX rate.
+func (c *MBTBasketContract) GetMetalPrice(ctx contractapi.TransactionContextInterface, metalCode string) (*MetalPrice, error) {
+	metal, err := normalizeMetal(metalCode)
+	if err != nil {
+		return nil, fmt.Errorf("metal %q %w", metalCode, ErrNotFound)
+	}
+	
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	prices, err := fetchMetalPrices(ctx, holdings.Currency)
+	if err != nil {
+		return nil, err
+	}
+	
+	price, ok := prices[metal]
+	if !ok {
+		return nil, fmt.Errorf("price for %s %w", metal, ErrNotFound)
+	}
+	
+	quorum, err := getOracleQuorum(ctx)
+	if err != nil {
+		return nil, err
+	}
+	source := "fallback"
+	if len(quorum.Oracles) > 0 {
+		source = "quorum"
+	}
+	
+	manual, err := getManualPrice(ctx, metal)
+	if err != nil {
+		return nil, err
+	}
+	if manual != nil {
+		source = "manual"
+	}
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	return &MetalPrice{
+		Metal:     metal,
+		Price:     price,
+		Currency:  holdings.Currency,
+		Source:    source,
+		Timestamp: timestamp,
+	}, nil
+}
+
+// ConvertCurrency converts an amount between currencies at the oracle FX rate
+func (c *MBTBasketContract) ConvertCurrency(ctx contractapi.TransactionContextInterface, 
+	amount float64, from, to string) (float64, error) {
+	
+	rate, err := fetchFXRate(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	
+	return amount * rate, nil
+}
+
+// fetchMetalPrices returns metal prices per gram in the given currency. Unexpired
+// manual prices take precedence over the feed, which is not consulted at all when
+// every metal has one.
+func fetchMetalPrices(ctx contractapi.TransactionContextInterface, currency string) (map[string]float64, error) {
+	if currency == "" {
+		currency = BASE_CURRENCY
+	}
+	
+	manual := map[string]float64{}
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		override, err := getManualPrice(ctx, metal)
+		if err != nil {
+			return nil, err
+		}
+		if override == nil {
+			continue
+		}
+		
+		rate := 1.0
+		if override.Currency != currency {
+			rate, err = fetchFXRate(ctx, override.Currency, currency)
+			if err != nil {
+				return nil, err
+			}
+		}
+		manual[metal] = override.Price * rate
+		log.Printf("Using manual %s price %.2f %s set by %s, expiring %s", 
+			metal, manual[metal], currency, override.SetBy, override.ExpiresAt)
+	}
+	
+	if len(manual) == 3 {
+		return manual, nil
+	}
+	
+	prices, err := fetchFeedPrices(ctx, currency)
+	if err != nil {
+		return nil, err
+	}
+	for metal, price := range manual {
+		prices[metal] = price
+	}
+	
+	return prices, nil
+}
+
+// fetchFeedPrices returns metal prices per gram in the given currency from the
+// oracle quorum, or from the reference table when no quorum is configured
+func fetchFeedPrices(ctx contractapi.TransactionContextInterface, currency string) (map[string]float64, error) {
+	quorum, err := getOracleQuorum(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(quorum.Oracles) > 0 {
+		return fetchQuorumPrices(ctx, quorum, currency)
+	}
+	
+	prices := map[string]float64{}
+	quoted, ok := metalPricesByCurrency[currency]
+	rate := 1.0
+	if !ok {
+		var err error
+		rate, err = fetchFXRate(ctx, BASE_CURRENCY, currency)
+		if err != nil {
+			return nil, err
+		}
+		quoted = metalPricesByCurrency[BASE_CURRENCY]
+	}
+	
+	// Key prices by canonical code so lookups never miss on naming
+	for metal, price := range quoted {
+		canonical, err := normalizeMetal(metal)
+		if err != nil {
+			return nil, err
+		}
+		prices[canonical] = price * rate
+	}
+	
+	return prices, nil
+}
+
+// fetchQuorumPrices asks every configured oracle for metal prices and takes the median
+// of each metal. Oracles that fail or return an incomplete price set count as not
+// having responded; any response further than the tolerance from the median is rejected.
+func fetchQuorumPrices(ctx contractapi.TransactionContextInterface, quorum *OracleQuorum, currency string) (map[string]float64, error) {
+	config, err := getMetalChaincodeConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	quotes := map[string][]float64{}
+	responded := 0
+	for _, oracle := range quorum.Oracles {
+		args := [][]byte{[]byte("getMetalPrices"), []byte(currency)}
+		response := ctx.GetStub().InvokeChaincode(oracle, args, config.Channel)
+		if response.Status != shim.OK {
+			log.Printf("Warning: oracle %s did not respond: %s", oracle, response.Message)
+			continue
+		}
+		
+		var quoted map[string]float64
+		err = json.Unmarshal(response.Payload, &quoted)
+		if err != nil {
+			log.Printf("Warning: invalid prices from oracle %s: %v", oracle, err)
+			continue
+		}
+		
+		prices, err := canonicalOraclePrices(quoted)
+		if err != nil {
+			log.Printf("Warning: invalid prices from oracle %s: %v", oracle, err)
+			continue
+		}
+		
+		for metal, price := range prices {
+			quotes[metal] = append(quotes[metal], price)
+		}
+		responded++
+	}
+	
+	if responded < quorum.Quorum {
+		return nil, fmt.Errorf("oracle quorum not met: %d of %d responded, %d required", 
+			responded, len(quorum.Oracles), quorum.Quorum)
+	}
+	
+	prices := map[string]float64{}
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		values := quotes[metal]
+		sort.Float64s(values)
+		middle := len(values) / 2
+		median := values[middle]
+		if len(values)%2 == 0 {
+			median = (values[middle-1] + values[middle]) / 2
+		}
+		
+		spread := (values[len(values)-1] - values[0]) / median * 100
+		if values[0] < median*(1-quorum.TolerancePercent/100) || 
+			values[len(values)-1] > median*(1+quorum.TolerancePercent/100) {
+			return nil, fmt.Errorf("oracles disagree on %s price: spread %.2f%% exceeds tolerance %.2f%%", 
+				metal, spread, quorum.TolerancePercent)
+		}
+		prices[metal] = median
+	}
+	
+	return prices, nil
+}
+
+// canonicalOraclePrices keys an oracle's prices by metal code and checks that every
+// basket metal has a positive price
+func canonicalOraclePrices(quoted map[string]float64) (map[string]float64, error) {
+	prices := map[string]float64{}
+	for metal, price := range quoted {
+		canonical, err := normalizeMetal(metal)
+		if err != nil {
+			return nil, err
+		}
+		prices[canonical] = price
+	}
+	
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		if prices[metal] <= 0 {
+			return nil, fmt.Errorf("missing or invalid %s price", metal)
+		}
+	}
+	
+	return prices, nil
+}
+
+// getOracleQuorum reads the oracle quorum; none is configured by default
+func getOracleQuorum(ctx contractapi.TransactionContextInterface) (*OracleQuorum, error) {
+	quorumJSON, err := ctx.GetStub().GetState("ORACLE_QUORUM")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oracle quorum: %v", err)
+	}
+	
+	if quorumJSON == nil {
+		return &OracleQuorum{}, nil
+	}
+	
+	var quorum OracleQuorum
+	err = json.Unmarshal(quorumJSON, &quorum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal oracle quorum: %v", err)
+	}
+	
+	return &quorum, nil
+}
+
+// GetOracleQuorum returns the configured oracle quorum
+func (c *MBTBasketContract) GetOracleQuorum(ctx contractapi.TransactionContextInterface) (*OracleQuorum, error) {
+	return getOracleQuorum(ctx)
+}
+
+// SetOracleQuorum stores the oracles metal prices are taken from (admin only). An
+// empty oracle list reverts to the reference price table.
+func (c *MBTBasketContract) SetOracleQuorum(ctx contractapi.TransactionContextInterface, quorumJSON string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	var quorum OracleQuorum
+	err = json.Unmarshal([]byte(quorumJSON), &quorum)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal oracle quorum: %v", err)
+	}
+	
+	if len(quorum.Oracles) > 0 {
+		if quorum.Quorum < 1 || quorum.Quorum > len(quorum.Oracles) {
+			return fmt.Errorf("quorum must be between 1 and %d", len(quorum.Oracles))
+		}
+		if quorum.TolerancePercent <= 0 {
+			return fmt.Errorf("tolerance percent must be positive")
+		}
+	}
+	
+	storedJSON, err := json.Marshal(quorum)
+	if err != nil {
+		return fmt.Errorf("failed to marshal oracle quorum: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState("ORACLE_QUORUM", storedJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store oracle quorum: %v", err)
+	}
+	
+	return nil
+}
+
+// getManualPrice returns a metal's manual price, or nil if none is set or it has expired
+func getManualPrice(ctx contractapi.TransactionContextInterface, metal string) (*ManualPrice, error) {
+	priceKey, err := ctx.GetStub().CreateCompositeKey("ManualPrice", []string{metal})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manual price key: %v", err)
+	}
+	
+	priceJSON, err := ctx.GetStub().GetState(priceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manual price: %v", err)
+	}
+	if priceJSON == nil {
+		return nil, nil
+	}
+	
+	var manual ManualPrice
+	err = json.Unmarshal(priceJSON, &manual)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manual price: %v", err)
+	}
+	
+	expiresAt, err := time.Parse(time.RFC3339, manual.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiry on manual %s price: %v", metal, err)
+	}
+	
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(expiresAt) {
+		return nil, nil
+	}
+	
+	return &manual, nil
+}
+
+// SetManualPrice overrides a metal's feed price with a fixed price per gram in the
+// basket currency until expiresAt, an RFC3339 time (admin only). Use it when the
+// oracles are down or the market is halted.
+func (c *MBTBasketContract) SetManualPrice(ctx contractapi.TransactionContextInterface, 
+	metalCode string, price float64, expiresAt string) error {
+	
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	metal, err := normalizeMetal(metalCode)
+	if err != nil {
+		return err
+	}
+	
+	if math.IsNaN(price) || math.IsInf(price, 0) || price <= 0 {
+		return fmt.Errorf("manual price must be positive, got %v", price)
+	}
+	
+	expiry, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return fmt.Errorf("invalid expiry %q: %v", expiresAt, err)
+	}
+	
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !expiry.After(now) {
+		return fmt.Errorf("manual price expiry %s is not in the future", expiresAt)
+	}
+	
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return err
+	}
+	currency := holdings.Currency
+	if currency == "" {
+		currency = BASE_CURRENCY
+	}
+	
+	setBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	
+	priceKey, err := ctx.GetStub().CreateCompositeKey("ManualPrice", []string{metal})
+	if err != nil {
+		return fmt.Errorf("failed to create manual price key: %v", err)
+	}
+	
+	priceJSON, err := json.Marshal(ManualPrice{
+		Metal:     metal,
+		Price:     price,
+		Currency:  currency,
+		ExpiresAt: expiry.UTC().Format(time.RFC3339),
+		SetBy:     setBy,
+		SetAt:     now.Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal manual price: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(priceKey, priceJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store manual price: %v", err)
+	}
+	
+	log.Printf("Manual %s price set to %.2f %s until %s", metal, price, currency, expiresAt)
+	return nil
+}
+
+// ClearManualPrice removes a metal's manual price so the feed applies again (admin only)
+func (c *MBTBasketContract) ClearManualPrice(ctx contractapi.TransactionContextInterface, metalCode string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	metal, err := normalizeMetal(metalCode)
+	if err != nil {
+		return err
+	}
+	
+	priceKey, err := ctx.GetStub().CreateCompositeKey("ManualPrice", []string{metal})
+	if err != nil {
+		return fmt.Errorf("failed to create manual price key: %v", err)
+	}
+	
+	priceJSON, err := ctx.GetStub().GetState(priceKey)
+	if err != nil {
+		return fmt.Errorf("failed to read manual price: %v", err)
+	}
+	if priceJSON == nil {
+		return fmt.Errorf("manual %s price %w", metal, ErrNotFound)
+	}
+	
+	err = ctx.GetStub().DelState(priceKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete manual price: %v", err)
+	}
+	
+	log.Printf("Manual %s price cleared", metal)
+	return nil
+}
+
+// GetBasketCompositionTargets returns the target weight of each metal, keyed by metal
+// code. Targets come from the rebalancing policy when a rebalancing chaincode is
+// configured, so changing them needs no redeploy; the default composition applies otherwise.
+func (c *MBTBasketContract) GetBasketCompositionTargets(ctx contractapi.TransactionContextInterface) (map[string]float64, error) {
+	config, err := getMetalChaincodeConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	if config.RebalancingChaincode == "" {
+		return map[string]float64{"BGT": GOLD_ALLOCATION, "BST": SILVER_ALLOCATION, "BPT": PLATINUM_ALLOCATION}, nil
+	}
+	
+	args := [][]byte{[]byte("GetBasketCompositionTargets")}
+	response := ctx.GetStub().InvokeChaincode(config.RebalancingChaincode, args, config.Channel)
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to get composition targets: %s", response.Message)
+	}
+	
+	var policyTargets map[string]float64
+	err = json.Unmarshal(response.Payload, &policyTargets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid composition targets from %s: %v", config.RebalancingChaincode, err)
+	}
+	
+	return map[string]float64{
+		"BGT": policyTargets["gold"],
+		"BST": policyTargets["silver"],
+		"BPT": policyTargets["platinum"],
+	}, nil
+}
+
+// cashBufferPercent returns the fraction of each mint held as cash rather than
+// metal. It comes from the rebalancing policy when a rebalancing chaincode is
+// configured; otherwise no buffer is held.
+func cashBufferPercent(ctx contractapi.TransactionContextInterface) (float64, error) {
+	config, err := getMetalChaincodeConfig(ctx)
+	if err != nil {
+		return 0, err
+	}
+	
+	if config.RebalancingChaincode == "" {
+		return 0, nil
+	}
+	
+	args := [][]byte{[]byte("GetCashBufferPercent")}
+	response := ctx.GetStub().InvokeChaincode(config.RebalancingChaincode, args, config.Channel)
+	if response.Status != shim.OK {
+		return 0, fmt.Errorf("failed to get cash buffer: %s", response.Message)
+	}
+	
+	buffer, err := strconv.ParseFloat(string(response.Payload), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cash buffer from %s: %v", config.RebalancingChaincode, err)
+	}
+	
+	return buffer, nil
+}
+
+// compositionTolerance returns how far, as a fraction of value, a metal's weight may
+// sit from its target and still count as on target. It comes from the rebalancing
+// policy when a rebalancing chaincode is configured.
+func compositionTolerance(ctx contractapi.TransactionContextInterface) (float64, error) {
+	config, err := getMetalChaincodeConfig(ctx)
+	if err != nil {
+		return 0, err
+	}
+	
+	if config.RebalancingChaincode == "" {
+		return COMPOSITION_TOLERANCE_PERCENT, nil
+	}
+	
+	args := [][]byte{[]byte("GetCompositionTolerance")}
+	response := ctx.GetStub().InvokeChaincode(config.RebalancingChaincode, args, config.Channel)
+	if response.Status != shim.OK {
+		return 0, fmt.Errorf("failed to get composition tolerance: %s", response.Message)
+	}
+	
+	tolerance, err := strconv.ParseFloat(string(response.Payload), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid composition tolerance from %s: %v", config.RebalancingChaincode, err)
+	}
+	
+	return tolerance, nil
+}
+
+// checkBasketNotBusy rejects user flows while the rebalancing chaincode reports an
+// approved rebalance awaiting execution. Skipped if no rebalancing chaincode is configured.
+func checkBasketNotBusy(ctx contractapi.TransactionContextInterface) error {
+	config, err := getMetalChaincodeConfig(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if config.RebalancingChaincode == "" {
+		return nil
+	}
+	
+	args := [][]byte{[]byte("IsBasketBusy"), []byte("MBT_BASKET")}
+	response := ctx.GetStub().InvokeChaincode(config.RebalancingChaincode, args, config.Channel)
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to check rebalance status: %s", response.Message)
+	}
+	
+	busy, err := strconv.ParseBool(string(response.Payload))
+	if err != nil {
+		return fmt.Errorf("invalid rebalance status from %s: %v", config.RebalancingChaincode, err)
+	}
+	
+	if busy {
+		return fmt.Errorf("basket busy: a rebalance is in progress, retry shortly")
+	}
+	
+	return nil
+}
+
+// fetchFXRate gets the rate converting one unit of from into to from the oracle chaincode
+func fetchFXRate(ctx contractapi.TransactionContextInterface, from, to string) (float64, error) {
+	if from == to {
+		return 1.0, nil
+	}
+	
+	config, err := getMetalChaincodeConfig(ctx)
+	if err != nil {
+		return 0, err
+	}
+	
+	args := [][]byte{[]byte("getFXRate"), []byte(from), []byte(to)}
+	response := ctx.GetStub().InvokeChaincode(config.OracleChaincode, args, config.Channel)
+	if response.Status != shim.OK {
+		return 0, fmt.Errorf("failed to fetch %s/%s rate: %s", from, to, response.Message)
+	}
+	
+	rate, err := strconv.ParseFloat(string(response.Payload), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s/%s rate from oracle: %v", from, to, err)
+	}
+	if rate <= 0 {
+		return 0, fmt.Errorf("invalid %s/%s rate from oracle: %f", from, to, rate)
+	}
+	
+	return rate, nil
+}
+
+// GetPhysicalBacking sums the grams of each metal held by the basket and values
+// them at current prices
+func (c *MBTBasketContract) GetPhysicalBacking(ctx contractapi.TransactionContextInterface) (*PhysicalBacking, error) {
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	backing := &PhysicalBacking{
+		BGTGrams: holdings.TotalBGTGrams,
+		BSTGrams: holdings.TotalBSTGrams,
+		BPTGrams: holdings.TotalBPTGrams,
+		BGTValue: holdings.TotalBGTGrams * prices["BGT"],
+		BSTValue: holdings.TotalBSTGrams * prices["BST"],
+		BPTValue: holdings.TotalBPTGrams * prices["BPT"],
+	}
+	backing.TotalValue = backing.BGTValue + backing.BSTValue + backing.BPTValue
+	
+	return backing, nil
+}
+
+// GetBasketBackingRatio reports whether the MBT in issue is fully backed: the metals
+// at current prices plus the cash buffer, over the supply's face value. A ratio below
+// 1 is flagged as under-collateralized. Each metal is also measured against its
+// target weight of the supply not held as cash.
+func (c *MBTBasketContract) GetBasketBackingRatio(ctx contractapi.TransactionContextInterface) (*BackingRatio, error) {
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	targets, err := c.GetBasketCompositionTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	cashBuffer, err := cashBufferPercent(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	values := basketMetalValues(holdings, prices)
+	grams := map[string]float64{
+		"BGT": holdings.TotalBGTGrams,
+		"BST": holdings.TotalBSTGrams,
+		"BPT": holdings.TotalBPTGrams,
+	}
+	
+	// The cash buffer's share of the supply is backed by cash, not metal
+	metalNotional := holdings.TotalMBTSupply * (1 - cashBuffer)
+	
+	backing := &BackingRatio{
+		Cash:           holdings.TotalCashValue,
+		SupplyNotional: holdings.TotalMBTSupply,
+		Currency:       holdings.Currency,
+		Metals:         []MetalBacking{},
+	}
+	
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		metalBacking := MetalBacking{
+			Metal:    metal,
+			Grams:    grams[metal],
+			Price:    prices[metal],
+			Value:    values[metal],
+			Required: targets[metal] * metalNotional,
+		}
+		if metalBacking.Required > 0 {
+			metalBacking.Ratio, err = safeDivide(metalBacking.Value, metalBacking.Required)
+			if err != nil {
+				return nil, fmt.Errorf("failed to calculate %s backing: %v", metal, err)
+			}
+		}
+		backing.MetalValue += metalBacking.Value
+		backing.Metals = append(backing.Metals, metalBacking)
+	}
+	backing.TotalBacking = backing.MetalValue + backing.Cash
+	
+	if holdings.TotalMBTSupply > 0 {
+		backing.Ratio, err = safeDivide(backing.TotalBacking, holdings.TotalMBTSupply)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate backing ratio: %v", err)
+		}
+		backing.UnderCollateralized = backing.Ratio < 1
+	}
+	
+	if backing.UnderCollateralized {
+		log.Printf("Basket under-collateralized: backing %.2f against supply %.2f (ratio %.4f)", 
+			backing.TotalBacking, backing.SupplyNotional, backing.Ratio)
+	}
+	
+	return backing, nil
+}
+
+// GetUserMBTTokens gets all MBT tokens owned by a user via the OwnerToken index,
+// which works on LevelDB peers as well as CouchDB
+func (c *MBTBasketContract) GetUserMBTTokens(ctx contractapi.TransactionContextInterface, userID string) ([]*MBTToken, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("OwnerToken", []string{userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query owner index: %v", err)
+	}
+	defer iterator.Close()
+	
+	tokens := []*MBTToken{}
+	
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read owner index: %v", err)
+		}
+		
+		_, attributes, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil || len(attributes) != 2 {
+			continue // Skip malformed entries
+		}
+		
+		token, err := c.GetMBTToken(ctx, attributes[1])
+		if err != nil {
+			return nil, err
+		}
+		
+		tokens = append(tokens, token)
+	}
+	
+	return tokens, nil
+}
+
+// queryTokens runs a CouchDB selector restricted to MBT token records
+func queryTokens(ctx contractapi.TransactionContextInterface, selector map[string]interface{}) ([]*MBTToken, error) {
+	selector["_id"] = map[string]string{"$regex": "^MBT-"}
+	
+	queryJSON, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token query: %v", err)
+	}
+	
+	iterator, err := ctx.GetStub().GetQueryResult(string(queryJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %v", err)
+	}
+	defer iterator.Close()
+	
+	tokens := []*MBTToken{}
+	
+	for iterator.HasNext() {
+		tokenJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token: %v", err)
+		}
+		
+		var token MBTToken
+		err = json.Unmarshal(tokenJSON.Value, &token)
+		if err != nil {
+			continue // Skip invalid tokens
+		}
+		
+		tokens = append(tokens, &token)
+	}
+	
+	return tokens, nil
+}
+
+// GetOwnershipDistribution ranks holders by units held and reports the topN with
+// a Herfindahl index over all holders (compliance officer or admin only)
+func (c *MBTBasketContract) GetOwnershipDistribution(ctx contractapi.TransactionContextInterface, topN int) (*OwnershipDistribution, error) {
+	err := requireComplianceOrAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	if topN <= 0 || topN > MAX_BATCH_SIZE {
+		return nil, fmt.Errorf("top N must be between 1 and %d", MAX_BATCH_SIZE)
+	}
+	
+	tokens, err := queryTokens(ctx, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	
+	byOwner := map[string]*HolderShare{}
+	for _, token := range tokens {
+		holder, ok := byOwner[token.Owner]
+		if !ok {
+			holder = &HolderShare{Owner: token.Owner}
+			byOwner[token.Owner] = holder
+		}
+		holder.TokenCount++
+		holder.Units += token.TotalValue
+	}
+	
+	// Largest first, ties by owner, so the ranking and float sums are deterministic
+	holders := make([]*HolderShare, 0, len(byOwner))
+	for _, holder := range byOwner {
+		holders = append(holders, holder)
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		if holders[i].Units != holders[j].Units {
+			return holders[i].Units > holders[j].Units
+		}
+		return holders[i].Owner < holders[j].Owner
+	})
+	
+	distribution := &OwnershipDistribution{
+		HolderCount: len(holders),
+		TopHolders:  []*HolderShare{},
+	}
+	
+	for _, holder := range holders {
+		distribution.TotalUnits += holder.Units
+	}
+	
+	if distribution.TotalUnits == 0 {
+		return distribution, nil
+	}
+	
+	for i, holder := range holders {
+		holder.PercentSupply = holder.Units / distribution.TotalUnits * 100
+		distribution.HerfindahlIndex += holder.PercentSupply * holder.PercentSupply
+		if i < topN {
+			distribution.TopHolders = append(distribution.TopHolders, holder)
+			distribution.TopHoldersShare += holder.PercentSupply
+		}
+	}
+	
+	return distribution, nil
+}
+
+// GetMetalExposureForUser aggregates a user's metal holdings across all their tokens
+func (c *MBTBasketContract) GetMetalExposureForUser(ctx contractapi.TransactionContextInterface, userID string) (*UserMetalExposure, error) {
+	tokens, err := c.GetUserMBTTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	grams := map[string]float64{}
+	for _, token := range tokens {
+		grams["BGT"] += token.BGTGrams
+		grams["BST"] += token.BSTGrams
+		grams["BPT"] += token.BPTGrams
+	}
+	
+	exposure := &UserMetalExposure{UserID: userID}
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		value := grams[metal] * prices[metal]
+		exposure.TotalValue += value
+		exposure.Metals = append(exposure.Metals, MetalExposure{
+			Metal: metal,
+			Grams: grams[metal],
+			Value: value,
+		})
+	}
+	
+	if exposure.TotalValue > 0 {
+		for i := range exposure.Metals {
+			exposure.Metals[i].Percent = exposure.Metals[i].Value / exposure.TotalValue * 100
+		}
+	}
+	
+	return exposure, nil
+}
+
+// GetUserAllocation compares the metal mix of a user's tokens, which can drift from
+// the basket's as tokens minted at different times are held, with the current basket
+// target. Deviations are measured in the basket's deviation mode; a user with no
+// metal value has none.
+func (c *MBTBasketContract) GetUserAllocation(ctx contractapi.TransactionContextInterface, userID string) (*UserAllocation, error) {
+	exposure, err := c.GetMetalExposureForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	
+	targets, err := c.GetBasketCompositionTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	mode, err := c.GetDeviationMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	allocation := &UserAllocation{
+		UserID:        userID,
+		TotalValue:    exposure.TotalValue,
+		DeviationMode: mode,
+		Metals:        []UserMetalAllocation{},
+	}
+	
+	for _, metal := range exposure.Metals {
+		entry := UserMetalAllocation{
+			Metal:         metal.Metal,
+			Value:         metal.Value,
+			Percent:       metal.Percent,
+			TargetPercent: targets[metal.Metal] * 100,
+		}
+		if exposure.TotalValue > 0 {
+			entry.Deviation = allocationDeviation(metal.Percent/100, targets[metal.Metal], mode)
+			if abs(entry.Deviation) > allocation.MaxDeviation {
+				allocation.MaxDeviation = abs(entry.Deviation)
+			}
+		}
+		allocation.Metals = append(allocation.Metals, entry)
+	}
+	
+	return allocation, nil
+}
+
+// CalculateMBTNAV calculates Net Asset Value of MBT basket
+func (c *MBTBasketContract) CalculateMBTNAV(ctx contractapi.TransactionContextInterface) (float64, error) {
+	quote, err := c.GetMBTNAV(ctx)
+	if err != nil {
+		return 0, err
+	}
+	
+	return quote.NAV, nil
+}
+
+// GetMBTNAV calculates the NAV together with the currency it is denominated in
+func (c *MBTBasketContract) GetMBTNAV(ctx contractapi.TransactionContextInterface) (*NAVQuote, error) {
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Calculate total basket value from physical holdings at current prices, plus the cash buffer
+	values := basketMetalValues(holdings, prices)
+	totalValue := values["BGT"] + values["BST"] + values["BPT"] + holdings.TotalCashValue
+	
+	quote := &NAVQuote{
+		TotalValue: totalValue,
+		Supply:     holdings.TotalMBTSupply,
+		Currency:   holdings.Currency,
+	}
+	
+	if holdings.TotalMBTSupply == 0 {
+		return quote, nil
+	}
+	
+	// Calculate NAV per MBT token
+	nav, err := safeDivide(totalValue, holdings.TotalMBTSupply)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate NAV: %v", err)
+	}
+	quote.NAV = nav
+	
+	log.Printf("Calculated MBT NAV: %.2f %s (Total Value: %.2f, Supply: %.2f)", 
+		quote.NAV, quote.Currency, totalValue, holdings.TotalMBTSupply)
+	return quote, nil
+}
+
+// GetNAVBreakdown reports the NAV with each metal's value and share of the total
+func (c *MBTBasketContract) GetNAVBreakdown(ctx contractapi.TransactionContextInterface) (*NAVBreakdown, error) {
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	values := basketMetalValues(holdings, prices)
+	grams := map[string]float64{
+		"BGT": holdings.TotalBGTGrams,
+		"BST": holdings.TotalBSTGrams,
+		"BPT": holdings.TotalBPTGrams,
+	}
+	
+	breakdown := &NAVBreakdown{
+		TotalValue: values["BGT"] + values["BST"] + values["BPT"] + holdings.TotalCashValue,
+		Supply:     holdings.TotalMBTSupply,
+		Currency:   holdings.Currency,
+		Cash:       holdings.TotalCashValue,
+		Metals:     []MetalNAVContribution{},
+	}
+	
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		contribution := MetalNAVContribution{
+			Metal: metal,
+			Grams: grams[metal],
+			Price: prices[metal],
+			Value: values[metal],
+		}
+		if breakdown.TotalValue > 0 {
+			contribution.PercentOfNAV = values[metal] / breakdown.TotalValue * 100
+		}
+		breakdown.Metals = append(breakdown.Metals, contribution)
+	}
+	
+	if holdings.TotalMBTSupply > 0 {
+		breakdown.NAV, err = safeDivide(breakdown.TotalValue, holdings.TotalMBTSupply)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate NAV: %v", err)
+		}
+	}
+	
+	return breakdown, nil
+}
+
+// GetBasketValueAtPrices values the basket at hypothetical per-gram prices, given as
+// a metal→price JSON object covering every basket metal, without writing state
+func (c *MBTBasketContract) GetBasketValueAtPrices(ctx contractapi.TransactionContextInterface, pricesJSON string) (*NAVQuote, error) {
+	var input map[string]float64
+	err := json.Unmarshal([]byte(pricesJSON), &input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal prices: %v", err)
+	}
+	
+	prices := map[string]float64{}
+	for code, price := range input {
+		metal, err := normalizeMetal(code)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := prices[metal]; exists {
+			return nil, fmt.Errorf("duplicate price for %s", metal)
+		}
+		if price <= 0 {
+			return nil, fmt.Errorf("price for %s must be positive", metal)
+		}
+		prices[metal] = price
+	}
+	
+	for _, metal := range []string{"BGT", "BST", "BPT"} {
+		if _, ok := prices[metal]; !ok {
+			return nil, fmt.Errorf("missing price for %s", metal)
+		}
+	}
+	
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	values := basketMetalValues(holdings, prices)
+	quote := &NAVQuote{
+		TotalValue: values["BGT"] + values["BST"] + values["BPT"] + holdings.TotalCashValue,
+		Supply:     holdings.TotalMBTSupply,
+		Currency:   holdings.Currency,
+	}
+	
+	if holdings.TotalMBTSupply > 0 {
+		quote.NAV, err = safeDivide(quote.TotalValue, holdings.TotalMBTSupply)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate NAV: %v", err)
+		}
+	}
+	
+	return quote, nil
+}
+
+// RecordNAVSnapshot stores the current NAV keyed by transaction time (admin only).
+// Expected to be called at least daily, e.g. at market close.
+func (c *MBTBasketContract) RecordNAVSnapshot(ctx contractapi.TransactionContextInterface) (*NAVSnapshot, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	breakdown, err := c.GetNAVBreakdown(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	targets, err := c.GetBasketCompositionTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	snapshot := &NAVSnapshot{
+		NAV:        breakdown.NAV,
+		TotalValue: breakdown.TotalValue,
+		Supply:     breakdown.Supply,
+		Currency:   breakdown.Currency,
+		Timestamp:  timestamp,
+		Allocation: map[string]float64{},
+		Targets:    targets,
+	}
+	// Allocation is over the metals alone, as the targets are; the cash buffer is excluded
+	metalValue := breakdown.TotalValue - breakdown.Cash
+	for _, contribution := range breakdown.Metals {
+		if metalValue > 0 {
+			snapshot.Allocation[contribution.Metal] = contribution.Value / metalValue
+		}
+	}
+	
+	err = checkFinite("NAV snapshot",
+		numericField{"NAV", snapshot.NAV},
+		numericField{"TotalValue", snapshot.TotalValue},
+		numericField{"Supply", snapshot.Supply},
+	)
+	if err != nil {
+		return nil, err
+	}
+	
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot: %v", err)
+	}
+	
+	snapshotKey, err := ctx.GetStub().CreateCompositeKey("NAVSnapshot", []string{timestamp})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot key: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(snapshotKey, snapshotJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store snapshot: %v", err)
+	}
+	
+	return snapshot, nil
+}
+
+// GetDailyNAVChange compares the current NAV with the most recent snapshot taken
+// before the current UTC day
+func (c *MBTBasketContract) GetDailyNAVChange(ctx contractapi.TransactionContextInterface) (*DailyNAVChange, error) {
+	quote, err := c.GetMBTNAV(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	change := &DailyNAVChange{
+		CurrentNAV:       quote.NAV,
+		CurrentTimestamp: now.Format(time.RFC3339),
+		Currency:         quote.Currency,
+	}
+	
+	// Snapshot keys sort by timestamp; keep the last one before today
+	startOfDay := now.UTC().Truncate(24 * time.Hour).Format("2006-01-02T15:04:05.000000000Z")
+	
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("NAVSnapshot", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshots: %v", err)
+	}
+	defer iterator.Close()
+	
+	var reference *NAVSnapshot
+	for iterator.HasNext() {
+		snapshotJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %v", err)
+		}
+		
+		var snapshot NAVSnapshot
+		err = json.Unmarshal(snapshotJSON.Value, &snapshot)
+		if err != nil {
+			continue // Skip invalid entries
+		}
+		
+		if snapshot.Timestamp >= startOfDay {
+			break
+		}
+		reference = &snapshot
+	}
+	
+	if reference == nil {
+		log.Println("No NAV snapshot before today; daily change unavailable")
+		return change, nil
+	}
+	
+	change.HasPriorSnapshot = true
+	change.ReferenceNAV = reference.NAV
+	change.ReferenceTimestamp = reference.Timestamp
+	change.Change = quote.NAV - reference.NAV
+	if reference.NAV > 0 {
+		change.ChangePercent = change.Change / reference.NAV * 100
+	}
+	
+	return change, nil
+}
+
+// GetDriftSeries returns the largest allocation deviation of each NAV snapshot taken
+// between fromTS and toTS (RFC3339, inclusive). Snapshots recorded before allocations
+// were stored are skipped; at least two usable snapshots are required.
+func (c *MBTBasketContract) GetDriftSeries(ctx contractapi.TransactionContextInterface, fromTS string, toTS string) ([]DriftPoint, error) {
+	from, err := time.Parse(time.RFC3339, fromTS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from timestamp: %v", err)
+	}
+	to, err := time.Parse(time.RFC3339, toTS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to timestamp: %v", err)
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("to timestamp must not be before from timestamp")
+	}
+	
+	mode, err := c.GetDeviationMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Snapshot keys use the fixed-width txTimestamp format, so they compare as strings
+	start := from.UTC().Format("2006-01-02T15:04:05.000000000Z")
+	end := to.UTC().Format("2006-01-02T15:04:05.000000000Z")
+	
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("NAVSnapshot", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshots: %v", err)
+	}
+	defer iterator.Close()
+	
+	series := []DriftPoint{}
+	for iterator.HasNext() {
+		snapshotJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %v", err)
+		}
+		
+		var snapshot NAVSnapshot
+		err = json.Unmarshal(snapshotJSON.Value, &snapshot)
+		if err != nil {
+			continue // Skip invalid entries
+		}
+		
+		if snapshot.Timestamp < start {
+			continue
+		}
+		if snapshot.Timestamp > end {
+			break
+		}
+		if len(snapshot.Allocation) == 0 {
+			continue
+		}
+		
+		point := DriftPoint{Timestamp: snapshot.Timestamp}
+		for _, metal := range []string{"BGT", "BST", "BPT"} {
+			deviation := abs(allocationDeviation(snapshot.Allocation[metal], snapshot.Targets[metal], mode))
+			if point.Metal == "" || deviation > point.MaxDeviation {
+				point.Metal = metal
+				point.MaxDeviation = deviation
+			}
+		}
+		series = append(series, point)
+	}
+	
+	if len(series) < 2 {
+		return nil, fmt.Errorf("at least two snapshots with allocations are required in range, found %d", len(series))
+	}
+	
+	return series, nil
+}
+
+// RecordIncome records income earned by the basket (admin only). The income is held
+// as cash in the basket, so it raises NAV, and is added to TOTAL_INCOME.
+func (c *MBTBasketContract) RecordIncome(ctx contractapi.TransactionContextInterface, amount float64, source string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	
+	if amount <= 0 {
+		return fmt.Errorf("income amount must be positive")
+	}
+	if source == "" {
+		return fmt.Errorf("income source is required")
+	}
+	
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	
+	record := IncomeRecord{
+		Amount:    amount,
+		Source:    source,
+		Timestamp: timestamp,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+	
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal income record: %v", err)
+	}
+	
+	recordKey, err := ctx.GetStub().CreateCompositeKey("Income", []string{timestamp, record.TxID})
+	if err != nil {
+		return fmt.Errorf("failed to create income record key: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(recordKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store income record: %v", err)
+	}
+	
+	total, err := c.GetTotalIncome(ctx)
+	if err != nil {
+		return err
+	}
+	
+	err = putFloatState(ctx, "TOTAL_INCOME", total+amount)
+	if err != nil {
+		return fmt.Errorf("failed to store total income: %v", err)
+	}
+	
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return err
+	}
+	
+	holdings.TotalCashValue += amount
+	err = c.putBasketHoldings(ctx, holdings)
+	if err != nil {
+		return err
+	}
+	
+	log.Printf("Recorded income of %.2f from %s", amount, source)
+	return nil
+}
+
+// GetTotalIncome returns all income recorded by the basket so far
+func (c *MBTBasketContract) GetTotalIncome(ctx contractapi.TransactionContextInterface) (float64, error) {
+	totalBytes, err := ctx.GetStub().GetState("TOTAL_INCOME")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read total income: %v", err)
+	}
+	
+	if totalBytes == nil {
+		return 0, nil
+	}
+	
+	total, err := strconv.ParseFloat(string(totalBytes), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid total income: %v", err)
+	}
+	
+	return total, nil
+}
+
+// GetBasketYield annualizes the income recorded between two inclusive dates against
+// the average total value of the NAV snapshots taken in that period. Without
+// snapshots in the period, the current total value stands in for the average.
+func (c *MBTBasketContract) GetBasketYield(ctx contractapi.TransactionContextInterface, 
+	fromDate, toDate string) (*BasketYield, error) {
+	
+	fromTS, toTS, err := feeDateRange(fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	
+	from, _ := time.Parse("2006-01-02", fromDate)
+	to, _ := time.Parse("2006-01-02", toDate)
+	
+	result := &BasketYield{
+		FromDate: fromDate,
+		ToDate:   toDate,
+		Days:     int(to.Sub(from).Hours()/24) + 1,
+	}
+	
+	incomeIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("Income", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query income records: %v", err)
+	}
+	defer incomeIterator.Close()
+	
+	for incomeIterator.HasNext() {
+		recordJSON, err := incomeIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read income record: %v", err)
+		}
+		
+		var record IncomeRecord
+		err = json.Unmarshal(recordJSON.Value, &record)
+		if err != nil {
+			continue // Skip invalid records
+		}
+		
+		if record.Timestamp < fromTS {
+			continue
+		}
+		if record.Timestamp > toTS {
+			break // Records are in time order
+		}
+		result.TotalIncome += record.Amount
 	}
 	
-	return &token, nil
-}
-
-// GetBasketHoldings retrieves current basket holdings
-func (c *MBTBasketContract) GetBasketHoldings(ctx contractapi.TransactionContextInterface) (*BasketHolding, error) {
-	holdingsJSON, err := ctx.GetStub().GetState("BASKET_HOLDINGS")
+	snapshotIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("NAVSnapshot", []string{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read holdings data: %v", err)
+		return nil, fmt.Errorf("failed to query snapshots: %v", err)
 	}
+	defer snapshotIterator.Close()
 	
-	if holdingsJSON == nil {
-		// Initialize basket holdings
-		holdings := BasketHolding{
-			TotalMBTSupply: 0,
-			TotalBGTValue:  0,
-			TotalBSTValue:  0,
-			TotalBPTValue:  0,
-			RebalanceNeeded: false,
-			LastRebalance: time.Now().Format(time.RFC3339),
+	totalAUM := 0.0
+	for snapshotIterator.HasNext() {
+		snapshotJSON, err := snapshotIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %v", err)
 		}
 		
-		return &holdings, nil
+		var snapshot NAVSnapshot
+		err = json.Unmarshal(snapshotJSON.Value, &snapshot)
+		if err != nil {
+			continue // Skip invalid entries
+		}
+		
+		if snapshot.Timestamp < fromTS {
+			continue
+		}
+		if snapshot.Timestamp > toTS {
+			break
+		}
+		totalAUM += snapshot.TotalValue
+		result.AUMSamples++
+		result.Currency = snapshot.Currency
 	}
 	
-	var holdings BasketHolding
-	err = json.Unmarshal(holdingsJSON, &holdings)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal holdings: %v", err)
+	if result.AUMSamples > 0 {
+		result.AverageAUM = totalAUM / float64(result.AUMSamples)
+	} else {
+		quote, err := c.GetMBTNAV(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result.AverageAUM = quote.TotalValue
+		result.Currency = quote.Currency
 	}
 	
-	return &holdings, nil
+	if result.AverageAUM > 0 {
+		result.AnnualizedYield = result.TotalIncome / result.AverageAUM * 365 / float64(result.Days)
+	}
+	
+	return result, nil
 }
 
-// UpdateBasketHoldings updates the basket aggregate holdings
-func (c *MBTBasketContract) UpdateBasketHoldings(ctx contractapi.TransactionContextInterface, 
-	mbtAmount, bgtValue, bstValue, bptValue float64, isMint bool) error {
-	
-	holdings, err := c.GetBasketHoldings(ctx)
+// GetTokenValuation values a token at current prices against what was paid for it
+// (token owner or admin only)
+func (c *MBTBasketContract) GetTokenValuation(ctx contractapi.TransactionContextInterface, tokenID string) (*TokenValuation, error) {
+	token, err := c.GetMBTToken(ctx, tokenID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
-	if isMint {
-		holdings.TotalMBTSupply += mbtAmount
-		holdings.TotalBGTValue += bgtValue
-		holdings.TotalBSTValue += bstValue
-		holdings.TotalBPTValue += bptValue
-	} else {
-		holdings.TotalMBTSupply -= mbtAmount
-		holdings.TotalBGTValue -= bgtValue
-		holdings.TotalBSTValue -= bstValue
-		holdings.TotalBPTValue -= bptValue
+	callerID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
 	}
 	
-	// Check if rebalancing is needed
-	holdings.RebalanceNeeded = c.CheckRebalanceNeeded(holdings)
+	if token.Owner != callerID {
+		err = requireAdmin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unauthorized: caller does not own this token")
+		}
+	}
 	
-	holdingsJSON, err := json.Marshal(holdings)
+	holdings, err := c.GetBasketHoldings(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to marshal holdings: %v", err)
+		return nil, err
 	}
 	
-	err = ctx.GetStub().PutState("BASKET_HOLDINGS", holdingsJSON)
+	prices, err := c.GetMBTPrices(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to store holdings: %v", err)
+		return nil, err
 	}
 	
-	return nil
-}
-
-// CheckRebalanceNeeded determines if portfolio rebalancing is required
-func (c *MBTBasketContract) CheckRebalanceNeeded(holdings *BasketHolding) bool {
-	if holdings.TotalMBTSupply == 0 {
-		return false
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
 	}
 	
-	totalValue := holdings.TotalBGTValue + holdings.TotalBSTValue + holdings.TotalBPTValue
-	if totalValue == 0 {
-		return false
+	valuation := &TokenValuation{
+		TokenID:            tokenID,
+		Owner:              token.Owner,
+		CostBasis:          token.CostBasis,
+		CostBasisAvailable: token.CostBasis > 0,
+		MarketValue:        tokenMarketValue(token, prices),
+		Currency:           holdings.Currency,
+		ValuedAt:           now.Format(time.RFC3339),
 	}
 	
-	// Calculate current allocations
-	currentGoldPct := holdings.TotalBGTValue / totalValue
-	currentSilverPct := holdings.TotalBSTValue / totalValue
-	currentPlatinumPct := holdings.TotalBPTValue / totalValue
+	if valuation.CostBasisAvailable {
+		valuation.UnrealizedPnL = valuation.MarketValue - token.CostBasis
+		valuation.UnrealizedPnLPct = valuation.UnrealizedPnL / token.CostBasis * 100
+	}
 	
-	// Check deviations from target allocations
-	goldDeviation := abs(currentGoldPct - GOLD_ALLOCATION)
-	silverDeviation := abs(currentSilverPct - SILVER_ALLOCATION)
-	platinumDeviation := abs(currentPlatinumPct - PLATINUM_ALLOCATION)
+	created, err := time.Parse(time.RFC3339, token.CreationTime)
+	if err != nil {
+		log.Printf("Warning: token %s has unparseable creation time %q", tokenID, token.CreationTime)
+	} else {
+		valuation.HoldingPeriodDays = now.Sub(created).Hours() / 24
+	}
 	
-	// Trigger rebalancing if any allocation deviates by more than threshold
-	if goldDeviation > MAX_DEVIATION_PERCENT || 
-		silverDeviation > MAX_DEVIATION_PERCENT || 
-		platinumDeviation > MAX_DEVIATION_PERCENT {
-		return true
+	return valuation, nil
+}
+
+// GetUnrealizedPnLForUser sums market value less cost basis over a user's tokens
+func (c *MBTBasketContract) GetUnrealizedPnLForUser(ctx contractapi.TransactionContextInterface, userID string) (*UserPnL, error) {
+	tokens, err := c.GetUserMBTTokens(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 	
-	// Check time-based rebalancing
-	lastRebalance, err := time.Parse(time.RFC3339, holdings.LastRebalance)
+	prices, err := c.GetMBTPrices(ctx)
 	if err != nil {
-		return true // If we can't parse the date, trigger rebalance
+		return nil, err
 	}
 	
-	daysSinceRebalance := time.Since(lastRebalance).Hours() / 24
-	if daysSinceRebalance >= REBALANCE_INTERVAL_DAYS {
-		return true
+	pnl := &UserPnL{UserID: userID}
+	for _, token := range tokens {
+		if token.CostBasis <= 0 {
+			pnl.ExcludedTokens++ // Minted before cost tracking
+			continue
+		}
+		pnl.TokenCount++
+		pnl.TotalCost += token.CostBasis
+		pnl.TotalMarketValue += tokenMarketValue(token, prices)
 	}
 	
-	return false
-}
-
-// abs returns absolute value of a float64
-func abs(x float64) float64 {
-	if x < 0 {
-		return -x
+	pnl.UnrealizedPnL = pnl.TotalMarketValue - pnl.TotalCost
+	if pnl.TotalCost > 0 {
+		pnl.ReturnPercent = pnl.UnrealizedPnL / pnl.TotalCost * 100
 	}
-	return x
+	
+	return pnl, nil
 }
 
-// RedeemMBT redeems MBT tokens for underlying metals
-func (c *MBTBasketContract) RedeemMBT(ctx contractapi.TransactionContextInterface, 
-	tokenID string, amount float64, userID string) error {
-	
-	log.Printf("Redeeming MBT tokens: TokenID=%s, Amount=%.2f, UserID=%s", tokenID, amount, userID)
-	
-	// Get MBT token
-	token, err := c.GetMBTToken(ctx, tokenID)
+// GetMaxRedeemable reports how much a user could redeem right now: the value of each
+// token they own that is neither locked nor frozen, less redemptions of it already
+// queued. Token value and queued amounts are both in the basket currency. The basket
+// has no minimum holding period or redemption rate limit, so nothing is deducted for
+// either. A blacklisted user can redeem nothing.
+func (c *MBTBasketContract) GetMaxRedeemable(ctx contractapi.TransactionContextInterface, userID string) (*MaxRedeemable, error) {
+	tokens, err := c.GetUserMBTTokens(ctx, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
-	// Verify ownership
-	if token.Owner != userID {
-		return fmt.Errorf("unauthorized: user does not own this token")
+	queue, err := c.GetRedemptionQueue(ctx)
+	if err != nil {
+		return nil, err
 	}
 	
-	if amount > token.TotalValue {
-		return fmt.Errorf("insufficient token balance: requested %.2f, available %.2f", amount, token.TotalValue)
+	queued := map[string]float64{}
+	for _, request := range queue {
+		queued[request.TokenID] += request.Amount
 	}
 	
-	// Calculate redemption amounts based on current composition
-	redemptionRatio := amount / token.TotalValue
-	redemptionBGT := token.BGTAmount * redemptionRatio
-	redemptionBST := token.BSTAmount * redemptionRatio
-	redemptionBPT := token.BPTAmount * redemptionRatio
+	result := &MaxRedeemable{UserID: userID, Tokens: []*RedeemableToken{}}
 	
-	// Process redemption (in real implementation, would interact with metal token chaincodes)
-	err = c.ProcessMetalRedemption(ctx, userID, redemptionBGT, redemptionBST, redemptionBPT)
+	err = checkNotBlacklisted(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to process metal redemption: %v", err)
+		result.Reason = err.Error()
 	}
 	
-	// Update token amount or delete if fully redeemed
-	if amount == token.TotalValue {
-		err = ctx.GetStub().DelState(tokenID)
-		if err != nil {
-			return fmt.Errorf("failed to delete token: %v", err)
+	for _, token := range tokens {
+		entry := &RedeemableToken{
+			TokenID:    token.TokenID,
+			TotalValue: token.TotalValue,
+			Queued:     queued[token.TokenID],
 		}
-	} else {
-		token.TotalValue -= amount
-		token.BGTAmount -= redemptionBGT
-		token.BSTAmount -= redemptionBST
-		token.BPTAmount -= redemptionBPT
-		token.LastRebalance = time.Now().Format(time.RFC3339)
 		
-		tokenJSON, err := json.Marshal(token)
-		if err != nil {
-			return fmt.Errorf("failed to marshal updated token: %v", err)
+		switch {
+		case result.Reason != "":
+			entry.Reason = result.Reason
+		case token.Locked:
+			entry.Reason = "token is locked"
+		case token.Frozen:
+			entry.Reason = "token is frozen: " + token.FreezeReason
+		case entry.Queued >= token.TotalValue:
+			entry.Reason = "token value is fully queued for redemption"
+		default:
+			entry.Redeemable = token.TotalValue - entry.Queued
+			result.Total += entry.Redeemable
 		}
 		
-		err = ctx.GetStub().PutState(tokenID, tokenJSON)
-		if err != nil {
-			return fmt.Errorf("failed to store updated token: %v", err)
-		}
-	}
-	
-	// Update basket holdings
-	err = c.UpdateBasketHoldings(ctx, amount, redemptionBGT, redemptionBST, redemptionBPT, false)
-	if err != nil {
-		return fmt.Errorf("failed to update basket holdings: %v", err)
+		result.Tokens = append(result.Tokens, entry)
 	}
 	
-	log.Printf("Successfully redeemed MBT token: %s", tokenID)
-	return nil
+	return result, nil
 }
 
-// ProcessMetalRedemption processes redemption of underlying metal tokens
-func (c *MBTBasketContract) ProcessMetalRedemption(ctx contractapi.TransactionContextInterface, 
-	userID string, bgtAmount, bstAmount, bptAmount float64) error {
-	
-	log.Printf("Processing metal redemption for user %s: BGT=%.2f, BST=%.2f, BPT=%.2f", 
-		userID, bgtAmount, bstAmount, bptAmount)
+// SetAlertPreference stores a user's alert thresholds from JSON such as
+// {"portfolioDropPercent":0.05,"portfolioBelow":10000}. Drops are measured from the
+// portfolio's value now. Only the user or an admin may set them.
+func (c *MBTBasketContract) SetAlertPreference(ctx contractapi.TransactionContextInterface, userID, prefsJSON string) error {
+	callerID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if callerID != userID && requireAdmin(ctx) != nil {
+		return fmt.Errorf("unauthorized: only the user or an admin can set alert preferences")
+	}
 	
-	// In real implementation, would interact with BGT, BST, BPT chaincodes
-	return nil
-}
-
-// GetUserBalance gets user account balance (simulation)
-func (c *MBTBasketContract) GetUserBalance(ctx contractapi.TransactionContextInterface, userID string, amount float64) (float64, error) {
-	// In real implementation, would query user account balance
-	return 1000000.0, nil // Simulate sufficient balance
-}
-
-// DeductUserBalance deducts amount from user balance (simulation)
-func (c *MBTBasketContract) DeductUserBalance(ctx contractapi.TransactionContextInterface, userID string, amount float64) error {
-	// In real implementation, would deduct from user account
-	log.Printf("Deducting %.2f from user %s balance", amount, userID)
-	return nil
-}
-
-// RebalanceBasket performs portfolio rebalancing
-func (c *MBTBasketContract) RebalanceBasket(ctx contractapi.TransactionContextInterface) error {
-	log.Println("Starting basket rebalancing process")
+	var preference AlertPreference
+	err = json.Unmarshal([]byte(prefsJSON), &preference)
+	if err != nil {
+		return fmt.Errorf("invalid alert preferences JSON: %v", err)
+	}
 	
-	holdings, err := c.GetBasketHoldings(ctx)
+	err = checkFinite("alert preference", 
+		numericField{"portfolioDropPercent", preference.PortfolioDropPercent}, 
+		numericField{"portfolioBelow", preference.PortfolioBelow})
 	if err != nil {
 		return err
 	}
+	if preference.PortfolioDropPercent < 0 || preference.PortfolioDropPercent >= 1 {
+		return fmt.Errorf("portfolio drop percent must be in [0, 1), got %v", preference.PortfolioDropPercent)
+	}
+	if preference.PortfolioBelow < 0 {
+		return fmt.Errorf("portfolio threshold must not be negative, got %v", preference.PortfolioBelow)
+	}
 	
-	if !holdings.RebalanceNeeded {
-		log.Println("Rebalancing not needed at this time")
-		return nil
+	prices, err := c.GetMBTPrices(ctx)
+	if err != nil {
+		return err
 	}
 	
-	totalValue := holdings.TotalBGTValue + holdings.TotalBSTValue + holdings.TotalBPTValue
-	if totalValue == 0 {
-		log.Println("No holdings to rebalance")
-		return nil
+	value, err := c.userPortfolioValue(ctx, userID, prices)
+	if err != nil {
+		return err
 	}
 	
-	// Calculate target allocations
-	targetBGT := totalValue * GOLD_ALLOCATION
-	targetBST := totalValue * SILVER_ALLOCATION
-	targetBPT := totalValue * PLATINUM_ALLOCATION
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
 	
-	// Calculate rebalancing needs
-	rebalanceBGT := targetBGT - holdings.TotalBGTValue
-	rebalanceBST := targetBST - holdings.TotalBSTValue
-	rebalanceBPT := targetBPT - holdings.TotalBPTValue
+	preference.UserID = userID
+	preference.ReferenceValue = value
+	preference.BelowAlerted = false
+	preference.UpdatedAt = timestamp
+	preference.LastAlertAt = ""
 	
-	log.Printf("Rebalancing requirements: BGT=%.2f, BST=%.2f, BPT=%.2f", 
-		rebalanceBGT, rebalanceBST, rebalanceBPT)
+	return putAlertPreference(ctx, &preference)
+}
+
+// GetAlertPreference returns a user's alert thresholds. Only the user or an admin may read them.
+func (c *MBTBasketContract) GetAlertPreference(ctx contractapi.TransactionContextInterface, userID string) (*AlertPreference, error) {
+	callerID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if callerID != userID && requireAdmin(ctx) != nil {
+		return nil, fmt.Errorf("unauthorized: only the user or an admin can read alert preferences")
+	}
 	
-	// In real implementation, would execute rebalancing trades
-	// For now, just update the holdings to reflect the rebalancing
-	holdings.TotalBGTValue = targetBGT
-	holdings.TotalBSTValue = targetBST
-	holdings.TotalBPTValue = targetBPT
-	holdings.RebalanceNeeded = false
-	holdings.LastRebalance = time.Now().Format(time.RFC3339)
+	key, err := ctx.GetStub().CreateCompositeKey("AlertPref", []string{userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create alert preference key: %v", err)
+	}
 	
-	holdingsJSON, err := json.Marshal(holdings)
+	preferenceJSON, err := ctx.GetStub().GetState(key)
 	if err != nil {
-		return fmt.Errorf("failed to marshal holdings: %v", err)
+		return nil, fmt.Errorf("failed to read alert preference: %v", err)
+	}
+	if preferenceJSON == nil {
+		return nil, fmt.Errorf("no alert preference for user %s: %w", userID, ErrNotFound)
 	}
 	
-	err = ctx.GetStub().PutState("BASKET_HOLDINGS", holdingsJSON)
+	var preference AlertPreference
+	err = json.Unmarshal(preferenceJSON, &preference)
 	if err != nil {
-		return fmt.Errorf("failed to store holdings: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal alert preference: %v", err)
 	}
 	
-	log.Println("Basket rebalancing completed successfully")
-	return nil
+	return &preference, nil
 }
 
-// GetMBTPrices retrieves current prices for metals (simulation)
-func (c *MBTBasketContract) GetMBTPrices(ctx contractapi.TransactionContextInterface) (map[string]float64, error) {
-	prices := map[string]float64{
-		"BGT": 5800.0,  // Gold price per gram in INR
-		"BST": 75.0,    // Silver price per gram in INR
-		"BPT": 3200.0,  // Platinum price per gram in INR
+// putAlertPreference stores a user's alert preference under AlertPref~userID
+func putAlertPreference(ctx contractapi.TransactionContextInterface, preference *AlertPreference) error {
+	key, err := ctx.GetStub().CreateCompositeKey("AlertPref", []string{preference.UserID})
+	if err != nil {
+		return fmt.Errorf("failed to create alert preference key: %v", err)
 	}
 	
-	return prices, nil
-}
-
-// GetUserMBTTokens gets all MBT tokens owned by a user
-func (c *MBTBasketContract) GetUserMBTTokens(ctx contractapi.TransactionContextInterface, userID string) ([]*MBTToken, error) {
-	// Query iterator for all tokens owned by user
-	// In real implementation, would use CouchDB query
-	return []*MBTToken{}, nil
+	preferenceJSON, err := json.Marshal(preference)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert preference: %v", err)
+	}
+	
+	err = ctx.GetStub().PutState(key, preferenceJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store alert preference: %v", err)
+	}
+	
+	return nil
 }
 
-// CalculateMBTNAV calculates Net Asset Value of MBT basket
-func (c *MBTBasketContract) CalculateMBTNAV(ctx contractapi.TransactionContextInterface) (float64, error) {
-	holdings, err := c.GetBasketHoldings(ctx)
+// CheckAndEmitAlerts evaluates every stored alert preference against current
+// portfolio values (admin only) and emits one AlertTriggered event listing the
+// alerts raised. A drop alert re-arms from the value it fired at; a below-threshold
+// alert fires again only after the value has recovered above the threshold.
+func (c *MBTBasketContract) CheckAndEmitAlerts(ctx contractapi.TransactionContextInterface) ([]*UserAlert, error) {
+	err := requireAdmin(ctx)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	
 	prices, err := c.GetMBTPrices(ctx)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	
-	// Calculate total basket value
-	totalValue := holdings.TotalBGTValue*prices["BGT"] + 
-		holdings.TotalBSTValue*prices["BST"] + 
-		holdings.TotalBPTValue*prices["BPT"]
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
 	
-	if holdings.TotalMBTSupply == 0 {
-		return 0, nil
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("AlertPref", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert preferences: %v", err)
 	}
+	defer iterator.Close()
 	
-	// Calculate NAV per MBT token
-	nav := totalValue / holdings.TotalMBTSupply
+	alerts := []*UserAlert{}
+	for iterator.HasNext() {
+		preferenceJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read alert preference: %v", err)
+		}
+		
+		var preference AlertPreference
+		err = json.Unmarshal(preferenceJSON.Value, &preference)
+		if err != nil {
+			continue // Skip invalid preferences
+		}
+		
+		value, err := c.userPortfolioValue(ctx, preference.UserID, prices)
+		if err != nil {
+			return nil, err
+		}
+		
+		changed := false
+		if preference.PortfolioDropPercent > 0 && preference.ReferenceValue > 0 && 
+			value <= preference.ReferenceValue*(1-preference.PortfolioDropPercent) {
+			alerts = append(alerts, &UserAlert{
+				UserID:         preference.UserID,
+				Kind:           "PORTFOLIO_DROP",
+				Threshold:      preference.PortfolioDropPercent,
+				Value:          value,
+				ReferenceValue: preference.ReferenceValue,
+			})
+			preference.ReferenceValue = value
+			preference.LastAlertAt = timestamp
+			changed = true
+		}
+		
+		if preference.PortfolioBelow > 0 {
+			below := value < preference.PortfolioBelow
+			if below && !preference.BelowAlerted {
+				alerts = append(alerts, &UserAlert{
+					UserID:    preference.UserID,
+					Kind:      "PORTFOLIO_BELOW",
+					Threshold: preference.PortfolioBelow,
+					Value:     value,
+				})
+				preference.LastAlertAt = timestamp
+			}
+			if below != preference.BelowAlerted {
+				preference.BelowAlerted = below
+				changed = true
+			}
+		}
+		
+		if changed {
+			err = putAlertPreference(ctx, &preference)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	
+	if len(alerts) == 0 {
+		return alerts, nil
+	}
 	
-	log.Printf("Calculated MBT NAV: %.2f (Total Value: %.2f, Supply: %.2f)", nav, totalValue, holdings.TotalMBTSupply)
-	return nav, nil
+	err = emitEvent(ctx, "AlertTriggered", &AlertTriggeredEvent{
+		Alerts:    alerts,
+		Timestamp: timestamp,
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	log.Printf("Raised %d alerts", len(alerts))
+	return alerts, nil
 }
 
-func main() {
-	chaincode, err := contractapi.NewChaincode(new(MBTBasketContract))
+// setEventSeq implements sequencedEvent
+func (e *AlertTriggeredEvent) setEventSeq(seq uint64) { e.EventSeq = seq }
+
+// userPortfolioValue is the market value of every token a user owns
+func (c *MBTBasketContract) userPortfolioValue(ctx contractapi.TransactionContextInterface, 
+	userID string, prices map[string]float64) (float64, error) {
+	
+	tokens, err := c.GetUserMBTTokens(ctx, userID)
 	if err != nil {
-		log.Panicf("Error creating MBT basket chaincode: %v", err)
+		return 0, err
+	}
+	
+	value := 0.0
+	for _, token := range tokens {
+		value += tokenMarketValue(token, prices)
 	}
+	return value, nil
+}
+
+// tokenMarketValue values a token's backing grams at the given prices, plus its cash
+func tokenMarketValue(token *MBTToken, prices map[string]float64) float64 {
+	return token.BGTGrams*prices["BGT"] + token.BSTGrams*prices["BST"] + token.BPTGrams*prices["BPT"] + 
+		token.CashAmount
+}
 
-	if err := chaincode.Start(); err != nil {
-		log.Panicf("Error starting MBT basket chaincode: %v", err)
+// basketMetalValues values the basket's physical holdings at the given prices, keyed by metal code
+func basketMetalValues(holdings *BasketHolding, prices map[string]float64) map[string]float64 {
+	return map[string]float64{
+		"BGT": holdings.TotalBGTGrams * prices["BGT"],
+		"BST": holdings.TotalBSTGrams * prices["BST"],
+		"BPT": holdings.TotalBPTGrams * prices["BPT"],
 	}
-}
\ No newline at end of file
+}
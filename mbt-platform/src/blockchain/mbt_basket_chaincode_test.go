@@ -0,0 +1,3622 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// newBasketStub returns a stub whose metal token chaincodes accept every credit and debit
+func newBasketStub() *mockStub {
+	stub := newMockStub()
+	accept := func(args [][]byte) peer.Response { return peer.Response{Status: shim.OK} }
+	for _, chaincode := range []string{"bgt", "bst", "bpt"} {
+		stub.invoke[chaincode] = map[string]func(args [][]byte) peer.Response{
+			"credit": accept,
+			"debit":  accept,
+		}
+	}
+	return stub
+}
+
+// getTestToken reads a token back from state
+func getTestToken(t *testing.T, stub *mockStub, tokenID string) *MBTToken {
+	t.Helper()
+	token, err := (&MBTBasketContract{}).GetMBTToken(asAdmin(stub), tokenID)
+	if err != nil {
+		t.Fatalf("GetMBTToken(%s): %v", tokenID, err)
+	}
+	return token
+}
+
+// approxEqual compares currency amounts to a thousandth of a paisa
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-5
+}
+
+// metalDebits counts the debit calls made to the metal token chaincodes
+func metalDebits(stub *mockStub) int {
+	count := 0
+	for _, invocation := range stub.invocations {
+		if strings.HasSuffix(invocation, ".debit") {
+			count++
+		}
+	}
+	return count
+}
+
+// putTestToken stores a token directly, bypassing the mint flow
+func putTestToken(t *testing.T, stub *mockStub, token MBTToken) {
+	t.Helper()
+	tokenJSON, err := json.Marshal(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.state[token.TokenID] = tokenJSON
+}
+
+func TestAdminOnlyTransactionsRejectOtherCallers(t *testing.T) {
+	contract := &MBTBasketContract{}
+	calls := map[string]func(ctx *mockContext) error{
+		"SetMetalChaincodeConfig": func(ctx *mockContext) error {
+			return contract.SetMetalChaincodeConfig(ctx, `{"bgtChaincode":"bgt","bstChaincode":"bst","bptChaincode":"bpt"}`)
+		},
+		"SetMintFeePercent": func(ctx *mockContext) error {
+			return contract.SetMintFeePercent(ctx, 0.01)
+		},
+		"AddToBlacklist": func(ctx *mockContext) error {
+			return contract.AddToBlacklist(ctx, "mallory")
+		},
+		"ApplyRebalanceAdjustment": func(ctx *mockContext) error {
+			return contract.ApplyRebalanceAdjustment(ctx, `{"values":{},"grams":{}}`)
+		},
+	}
+
+	for name, call := range calls {
+		stub := newMockStub()
+		err := call(asUser(stub, "alice"))
+		if err == nil || !strings.Contains(err.Error(), "unauthorized") {
+			t.Errorf("%s by a non-admin: got %v, want unauthorized", name, err)
+		}
+		if len(stub.state) != 0 {
+			t.Errorf("%s by a non-admin wrote state: %d keys", name, len(stub.state))
+		}
+	}
+}
+
+func TestBlacklistedUserCannotMintOrTopUp(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newMockStub()
+
+	err := contract.AddToBlacklist(asAdmin(stub), "mallory")
+	if err != nil {
+		t.Fatalf("AddToBlacklist: %v", err)
+	}
+
+	putTestToken(t, stub, MBTToken{TokenID: "MBT-1", Owner: "mallory", TotalValue: 1000, CostBasis: 1000})
+
+	stub.nextTx("tx2")
+	err = contract.MintMBT(asUser(stub, "mallory"), "mallory", 1000, "mallory")
+	if err == nil || !strings.Contains(err.Error(), "blacklisted") {
+		t.Errorf("MintMBT by a blacklisted user: got %v, want blacklisted", err)
+	}
+
+	err = contract.AddToMBT(asUser(stub, "mallory"), "MBT-1", 500, "mallory")
+	if err == nil || !strings.Contains(err.Error(), "blacklisted") {
+		t.Errorf("AddToMBT by a blacklisted user: got %v, want blacklisted", err)
+	}
+
+	stub.nextTx("tx3")
+	err = contract.RemoveFromBlacklist(asAdmin(stub), "mallory")
+	if err != nil {
+		t.Fatalf("RemoveFromBlacklist: %v", err)
+	}
+
+	blacklisted, err := contract.IsBlacklisted(asUser(stub, "mallory"), "mallory")
+	if err != nil || blacklisted {
+		t.Errorf("IsBlacklisted after removal: got %v, %v", blacklisted, err)
+	}
+}
+
+func TestGetAllTokensPagesWithBookmarks(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newMockStub()
+
+	for i := 1; i <= 5; i++ {
+		putTestToken(t, stub, MBTToken{TokenID: fmt.Sprintf("MBT-%d", i), Owner: "alice", TotalValue: 100})
+	}
+	// Keys outside the MBT- range must not appear in any page
+	stub.state["BASKET_HOLDINGS"] = []byte(`{}`)
+
+	_, err := contract.GetAllTokens(asUser(stub, "alice"), 2, "")
+	if err == nil {
+		t.Error("GetAllTokens by a non-admin succeeded")
+	}
+
+	var seen []string
+	bookmark := ""
+	for pages := 1; ; pages++ {
+		page, err := contract.GetAllTokens(asAdmin(stub), 2, bookmark)
+		if err != nil {
+			t.Fatalf("GetAllTokens page %d: %v", pages, err)
+		}
+		for _, token := range page.Tokens {
+			seen = append(seen, token.TokenID)
+		}
+		if page.Bookmark == "" {
+			if pages != 3 {
+				t.Errorf("got %d pages, want 3", pages)
+			}
+			break
+		}
+		if pages > 5 {
+			t.Fatal("bookmark never cleared")
+		}
+		bookmark = page.Bookmark
+	}
+
+	want := "MBT-1,MBT-2,MBT-3,MBT-4,MBT-5"
+	if got := strings.Join(seen, ","); got != want {
+		t.Errorf("tokens across pages: got %s, want %s", got, want)
+	}
+}
+
+func TestMintQuoteMatchesActualMint(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	err := contract.SetMintFeePercent(asAdmin(stub), 0.01)
+	if err != nil {
+		t.Fatalf("SetMintFeePercent: %v", err)
+	}
+
+	// Quote and mint twice: once into an empty basket and once after gold has moved,
+	// when the market NAV is no longer 1
+	for _, txID := range []string{"mint1", "mint2"} {
+		if txID == "mint2" {
+			err = contract.SetManualPrice(asAdmin(stub), "BGT", 6380, "2026-02-01T00:00:00Z")
+			if err != nil {
+				t.Fatalf("SetManualPrice: %v", err)
+			}
+		}
+		stub.nextTx(txID)
+		before, err := contract.GetBasketHoldings(asUser(stub, "alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		quote, err := contract.GetMintQuote(asUser(stub, "alice"), 10000)
+		if err != nil {
+			t.Fatalf("GetMintQuote: %v", err)
+		}
+		if quote.Fee != 100 || quote.Units != 9900 || quote.EffectiveNAV != 1 {
+			t.Errorf("%s quote: fee %v, units %v, NAV %v; want 100, 9900, 1", txID, quote.Fee, quote.Units, quote.EffectiveNAV)
+		}
+
+		err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+		if err != nil {
+			t.Fatalf("MintMBT: %v", err)
+		}
+
+		token := getTestToken(t, stub, "MBT-"+txID)
+		if !approxEqual(token.TotalValue, quote.Units) {
+			t.Errorf("%s TotalValue %v, quoted units %v", txID, token.TotalValue, quote.Units)
+		}
+		if !approxEqual(token.CashAmount, quote.Cash) {
+			t.Errorf("%s cash %v, quoted %v", txID, token.CashAmount, quote.Cash)
+		}
+		if token.CostBasis != 10000 {
+			t.Errorf("%s cost basis %v, want the gross 10000", txID, token.CostBasis)
+		}
+
+		minted := map[string][2]float64{
+			"BGT": {token.BGTAmount, token.BGTGrams},
+			"BST": {token.BSTAmount, token.BSTGrams},
+			"BPT": {token.BPTAmount, token.BPTGrams},
+		}
+		for _, allocation := range quote.Allocations {
+			got := minted[allocation.Metal]
+			if !approxEqual(got[0], allocation.Amount) || !approxEqual(got[1], allocation.Grams) {
+				t.Errorf("%s %s minted %v / %vg, quoted %v / %vg", txID, allocation.Metal,
+					got[0], got[1], allocation.Amount, allocation.Grams)
+			}
+		}
+
+		// The token's value is in currency: its metal amounts and cash add up to it
+		parts := token.BGTAmount + token.BSTAmount + token.BPTAmount + token.CashAmount
+		if !approxEqual(parts, token.TotalValue) {
+			t.Errorf("%s metal and cash %v, TotalValue %v", txID, parts, token.TotalValue)
+		}
+
+		after, err := contract.GetBasketHoldings(asUser(stub, "alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !approxEqual(after.TotalMBTSupply-before.TotalMBTSupply, quote.Units) {
+			t.Errorf("%s supply grew by %v, quoted units %v", txID, after.TotalMBTSupply-before.TotalMBTSupply, quote.Units)
+		}
+	}
+
+	// A token minted with a fee redeems in full
+	stub.nextTx("redeem")
+	token := getTestToken(t, stub, "MBT-mint2")
+	err = contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint2", token.TotalValue, "alice")
+	if err != nil {
+		t.Fatalf("full redemption: %v", err)
+	}
+}
+
+func TestUserActionsRequireTheUsersIdentity(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	putTestToken(t, stub, MBTToken{TokenID: "MBT-1", Owner: "alice", TotalValue: 1000, BGTAmount: 1000, BGTGrams: 1})
+
+	// Mallory names alice as the acting user but signs as herself
+	mallory := asUser(stub, "mallory")
+	calls := map[string]func() error{
+		"TransferMBT":     func() error { return contract.TransferMBT(mallory, "MBT-1", 1000, "alice", "mallory") },
+		"RedeemMBT":       func() error { return contract.RedeemMBT(mallory, "MBT-1", 1000, "alice") },
+		"AddToMBT":        func() error { return contract.AddToMBT(mallory, "MBT-1", 1000, "alice") },
+		"EmergencyRedeem": func() error { return contract.EmergencyRedeem(mallory, "MBT-1", "alice") },
+		"MintMBT":         func() error { return contract.MintMBT(mallory, "mallory", 1000, "alice") },
+	}
+	for name, call := range calls {
+		err := call()
+		if err == nil || !strings.Contains(err.Error(), "unauthorized") {
+			t.Errorf("%s for another user: got %v, want unauthorized", name, err)
+		}
+	}
+	if token := getTestToken(t, stub, "MBT-1"); token.Owner != "alice" || token.TotalValue != 1000 {
+		t.Errorf("token after rejected calls: owner %s, value %v", token.Owner, token.TotalValue)
+	}
+
+	stub.nextTx("tx2")
+	err := contract.TransferMBT(asUser(stub, "alice"), "MBT-1", 400, "alice", "bob")
+	if err != nil {
+		t.Fatalf("TransferMBT by the owner: %v", err)
+	}
+
+	stub.nextTx("tx3")
+	err = contract.TransferMBT(asAdmin(stub), "MBT-1", 600, "alice", "bob")
+	if err != nil {
+		t.Fatalf("TransferMBT by an admin: %v", err)
+	}
+	if token := getTestToken(t, stub, "MBT-1"); token.Owner != "bob" {
+		t.Errorf("after transferring the rest: owner %s, want bob", token.Owner)
+	}
+}
+
+func TestRebuildOwnerIndexInBatches(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	// Tokens stored before the owner index existed
+	owners := []string{"alice", "bob", "alice", "carol", "alice"}
+	for i, owner := range owners {
+		putTestToken(t, stub, MBTToken{TokenID: fmt.Sprintf("MBT-%d", i+1), Owner: owner, TotalValue: 100})
+	}
+
+	_, err := contract.RebuildOwnerIndex(asUser(stub, "alice"), 2, "")
+	if err == nil {
+		t.Error("RebuildOwnerIndex by a non-admin succeeded")
+	}
+
+	startKey := ""
+	for batches := 1; ; batches++ {
+		stub.nextTx(fmt.Sprintf("rebuild%d", batches))
+		startKey, err = contract.RebuildOwnerIndex(asAdmin(stub), 2, startKey)
+		if err != nil {
+			t.Fatalf("RebuildOwnerIndex batch %d: %v", batches, err)
+		}
+		if startKey == "" {
+			if batches != 3 {
+				t.Errorf("got %d batches, want 3", batches)
+			}
+			break
+		}
+		if batches > 5 {
+			t.Fatal("start key never cleared")
+		}
+	}
+
+	for owner, want := range map[string]string{"alice": "MBT-1,MBT-3,MBT-5", "bob": "MBT-2", "carol": "MBT-4"} {
+		tokens, err := contract.GetUserMBTTokens(asUser(stub, owner), owner)
+		if err != nil {
+			t.Fatalf("GetUserMBTTokens(%s): %v", owner, err)
+		}
+		var ids []string
+		for _, token := range tokens {
+			ids = append(ids, token.TokenID)
+		}
+		if got := strings.Join(ids, ","); got != want {
+			t.Errorf("%s's tokens: got %s, want %s", owner, got, want)
+		}
+	}
+
+	_, err = contract.RebuildOwnerIndex(asAdmin(stub), 2, "BASKET_HOLDINGS")
+	if err == nil {
+		t.Error("RebuildOwnerIndex from a non-token key succeeded")
+	}
+}
+
+// tokensCreatedIn returns the IDs of tokens created between from and to, across every
+// page, read in a transaction of its own
+func tokensCreatedIn(t *testing.T, stub *mockStub, from, to string) string {
+	t.Helper()
+	contract := &MBTBasketContract{}
+	stub.nextTx("query")
+	var ids []string
+	bookmark := ""
+	for pages := 0; pages < 10; pages++ {
+		page, err := contract.GetTokensCreatedInRange(asAdmin(stub), from, to, 2, bookmark)
+		if err != nil {
+			t.Fatalf("GetTokensCreatedInRange: %v", err)
+		}
+		for _, token := range page.Tokens {
+			ids = append(ids, token.TokenID)
+		}
+		if page.Bookmark == "" {
+			return strings.Join(ids, ",")
+		}
+		bookmark = page.Bookmark
+	}
+	t.Fatal("bookmark never cleared")
+	return ""
+}
+
+func TestRebuildTokenDateIndexAndIndexSplits(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	// Tokens minted either side of midnight before the date index existed
+	created := map[string]string{
+		"MBT-1": "2026-01-13T23:59:59Z",
+		"MBT-2": "2026-01-14T00:00:00Z",
+		"MBT-3": "2026-01-14T12:00:00Z",
+	}
+	for tokenID, creationTime := range created {
+		putTestToken(t, stub, MBTToken{TokenID: tokenID, Owner: "alice", TotalValue: 100, BGTAmount: 100,
+			BGTGrams: 1, CreationTime: creationTime})
+	}
+
+	startKey := ""
+	for batches := 1; batches < 5; batches++ {
+		var err error
+		stub.nextTx(fmt.Sprintf("rebuild%d", batches))
+		startKey, err = contract.RebuildTokenDateIndex(asAdmin(stub), 2, startKey)
+		if err != nil {
+			t.Fatalf("RebuildTokenDateIndex batch %d: %v", batches, err)
+		}
+		if startKey == "" {
+			break
+		}
+	}
+
+	if got := tokensCreatedIn(t, stub, "2026-01-13T00:00:00Z", "2026-01-13T23:59:59Z"); got != "MBT-1" {
+		t.Errorf("tokens created on the 13th: got %s, want MBT-1", got)
+	}
+	if got := tokensCreatedIn(t, stub, "2026-01-14T00:00:00Z", "2026-01-14T23:59:59Z"); got != "MBT-2,MBT-3" {
+		t.Errorf("tokens created on the 14th: got %s, want MBT-2,MBT-3", got)
+	}
+
+	// A partial transfer on the 15th creates a split token dated the 15th
+	stub.nextTx("transfer")
+	err := contract.TransferMBT(asUser(stub, "alice"), "MBT-1", 40, "alice", "bob")
+	if err != nil {
+		t.Fatalf("TransferMBT: %v", err)
+	}
+	if got := tokensCreatedIn(t, stub, "2026-01-15T00:00:00Z", "2026-01-15T23:59:59Z"); got != "MBT-transfer-SPLIT" {
+		t.Errorf("tokens created on the 15th: got %s, want MBT-transfer-SPLIT", got)
+	}
+}
+
+func TestMintInKindChecksCompositionAndFlagsRebalance(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 100000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	// 5g of gold, 232g of silver and 3.625g of platinum are worth 58,000, split 50/30/20
+	stub.nextTx("inkind1")
+	err = contract.MintMBTInKind(asUser(stub, "alice"), "alice", 5, 232, 3.625, "alice", false)
+	if err != nil {
+		t.Fatalf("in-spec deposit: %v", err)
+	}
+	token := getTestToken(t, stub, "MBT-inkind1")
+	if !approxEqual(token.TotalValue, 58000) || !approxEqual(token.BGTGrams, 5) {
+		t.Errorf("in-spec token: value %v, gold %vg; want 58000, 5g", token.TotalValue, token.BGTGrams)
+	}
+	holdings, err := contract.GetBasketHoldings(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holdings.RebalanceNeeded {
+		t.Error("in-spec deposit flagged the basket for rebalance")
+	}
+
+	// 1g of gold alone is all gold
+	stub.nextTx("inkind2")
+	err = contract.MintMBTInKind(asUser(stub, "alice"), "alice", 1, 0, 0, "alice", false)
+	if err == nil || !strings.Contains(err.Error(), "off-composition") {
+		t.Errorf("off-spec deposit: got %v, want off-composition", err)
+	}
+
+	// With rebalanceAfter it is accepted and the basket is flagged, though adding
+	// 5,800 of gold leaves the basket itself within its deviation band
+	err = contract.MintMBTInKind(asUser(stub, "alice"), "alice", 1, 0, 0, "alice", true)
+	if err != nil {
+		t.Fatalf("off-spec deposit with rebalanceAfter: %v", err)
+	}
+	token = getTestToken(t, stub, "MBT-inkind2")
+	if !approxEqual(token.TotalValue, 5800) || token.Composition.Gold != 100 {
+		t.Errorf("off-spec token: value %v, gold %v%%; want 5800, 100%%", token.TotalValue, token.Composition.Gold)
+	}
+	holdings, err = contract.GetBasketHoldings(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !holdings.RebalanceNeeded {
+		t.Error("off-spec deposit with rebalanceAfter left the basket unflagged")
+	}
+}
+
+func TestRebalanceAdjustmentCannotDriveHoldingsNegative(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newMockStub()
+	holdingsJSON, err := json.Marshal(BasketHolding{
+		TotalMBTSupply: 100000,
+		TotalBGTValue:  60000,
+		TotalBSTValue:  25000,
+		TotalBPTValue:  15000,
+		TotalBGTGrams:  10,
+		TotalBSTGrams:  300,
+		TotalBPTGrams:  5,
+		Currency:       BASE_CURRENCY,
+		Initialized:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.state["BASKET_HOLDINGS"] = holdingsJSON
+
+	adjustments := map[string]string{
+		// Selling more gold value than is held, though the grams cover it
+		"value": `{"values":{"BGT":-70000,"BST":70000},"grams":{"BGT":-5,"BST":900}}`,
+		"grams": `{"values":{"BPT":-5000},"grams":{"BPT":-6}}`,
+	}
+	for name, adjustment := range adjustments {
+		err := contract.ApplyRebalanceAdjustment(asAdmin(stub), adjustment)
+		if err == nil || !strings.Contains(err.Error(), "negative") {
+			t.Errorf("%s overdraw: got %v, want a negative holdings error", name, err)
+		}
+		if string(stub.state["BASKET_HOLDINGS"]) != string(holdingsJSON) {
+			t.Errorf("%s overdraw changed the holdings", name)
+		}
+	}
+
+	err = contract.ApplyRebalanceAdjustment(asAdmin(stub), `{"values":{"BGT":-60000,"BST":60000},"grams":{"BGT":-10,"BST":800}}`)
+	if err != nil {
+		t.Errorf("selling all gold: %v", err)
+	}
+}
+
+func TestMaxRedeemableSkipsLockedFrozenAndQueuedValue(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	for _, txID := range []string{"mint1", "mint2", "mint3", "mint4"} {
+		stub.nextTx(txID)
+		err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+		if err != nil {
+			t.Fatalf("MintMBT: %v", err)
+		}
+	}
+
+	stub.nextTx("lock")
+	err := contract.LockToken(asAdmin(stub), "MBT-mint1")
+	if err != nil {
+		t.Fatalf("LockToken: %v", err)
+	}
+	stub.nextTx("freeze")
+	err = contract.FreezeToken(asAdmin(stub), "MBT-mint2", "under review")
+	if err != nil {
+		t.Fatalf("FreezeToken: %v", err)
+	}
+	stub.nextTx("mode")
+	err = contract.SetRedemptionMode(asAdmin(stub), REDEMPTION_MODE_QUEUED)
+	if err != nil {
+		t.Fatalf("SetRedemptionMode: %v", err)
+	}
+	stub.nextTx("queue")
+	err = contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint3", 4000, "alice")
+	if err != nil {
+		t.Fatalf("queued RedeemMBT: %v", err)
+	}
+
+	value := getTestToken(t, stub, "MBT-mint4").TotalValue
+	result, err := contract.GetMaxRedeemable(asUser(stub, "alice"), "alice")
+	if err != nil {
+		t.Fatalf("GetMaxRedeemable: %v", err)
+	}
+
+	want := map[string]float64{"MBT-mint1": 0, "MBT-mint2": 0, "MBT-mint3": value - 4000, "MBT-mint4": value}
+	if len(result.Tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(result.Tokens), len(want))
+	}
+	for _, entry := range result.Tokens {
+		if !approxEqual(entry.Redeemable, want[entry.TokenID]) {
+			t.Errorf("%s redeemable %v, want %v (reason %q)", entry.TokenID, entry.Redeemable, want[entry.TokenID], entry.Reason)
+		}
+		if (entry.Redeemable == 0) != (entry.Reason != "") {
+			t.Errorf("%s redeemable %v with reason %q", entry.TokenID, entry.Redeemable, entry.Reason)
+		}
+	}
+	if !approxEqual(result.Total, 2*value-4000) {
+		t.Errorf("total %v, want %v", result.Total, 2*value-4000)
+	}
+}
+
+func TestMintCreditsConfiguredMetalChaincodes(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newMockStub()
+
+	err := contract.SetMetalChaincodeConfig(asAdmin(stub),
+		`{"bgtChaincode":"gold-cc","bstChaincode":"silver-cc","bptChaincode":"platinum-cc","channel":"metals"}`)
+	if err != nil {
+		t.Fatalf("SetMetalChaincodeConfig: %v", err)
+	}
+
+	// Each handler records "user amount" per chaincode and function; silver credits
+	// fail while failSilver is set
+	calls := map[string][]string{}
+	failSilver := false
+	for _, chaincode := range []string{"gold-cc", "silver-cc", "platinum-cc"} {
+		chaincode := chaincode
+		stub.invoke[chaincode] = map[string]func(args [][]byte) peer.Response{}
+		for _, function := range []string{"credit", "debit"} {
+			name := chaincode + "." + function
+			stub.invoke[chaincode][function] = func(args [][]byte) peer.Response {
+				if failSilver && name == "silver-cc.credit" {
+					return peer.Response{Status: shim.ERROR, Message: "ledger unavailable"}
+				}
+				calls[name] = append(calls[name], string(args[0])+" "+string(args[1]))
+				return peer.Response{Status: shim.OK}
+			}
+		}
+	}
+
+	stub.nextTx("mint1")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	token := getTestToken(t, stub, "MBT-mint1")
+	want := map[string]float64{
+		"gold-cc.credit":     token.BGTAmount,
+		"silver-cc.credit":   token.BSTAmount,
+		"platinum-cc.credit": token.BPTAmount,
+	}
+	for name, amount := range want {
+		if len(calls[name]) != 1 || calls[name][0] != "alice "+strconv.FormatFloat(amount, 'f', -1, 64) {
+			t.Errorf("%s calls %v, want one credit of %v to alice", name, calls[name], amount)
+		}
+	}
+
+	// A failed silver credit reverses the gold credit and fails the mint
+	failSilver = true
+	calls = map[string][]string{}
+	stub.nextTx("mint2")
+	before := stateSnapshot(stub)
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err == nil || !strings.Contains(err.Error(), "ledger unavailable") {
+		t.Fatalf("mint with a failing silver ledger: got %v", err)
+	}
+	if len(calls["gold-cc.credit"]) != 1 || len(calls["gold-cc.debit"]) != 1 || len(calls["platinum-cc.credit"]) != 0 {
+		t.Errorf("failed mint calls %v, want a gold credit reversed by a debit and no platinum credit", calls)
+	}
+	if _, ok := stub.state["MBT-mint2"]; ok {
+		t.Error("failed mint stored its token")
+	}
+	if string(stub.state["BASKET_HOLDINGS"]) != before["BASKET_HOLDINGS"] {
+		t.Error("failed mint changed the basket holdings")
+	}
+}
+
+func TestPhysicalBackingGramsIgnorePriceMoves(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	token := getTestToken(t, stub, "MBT-mint1")
+	if !approxEqual(token.BGTGrams, token.BGTAmount/5800) || !approxEqual(token.BPTGrams, token.BPTAmount/3200) {
+		t.Errorf("minted %vg gold for %v and %vg platinum for %v", token.BGTGrams, token.BGTAmount,
+			token.BPTGrams, token.BPTAmount)
+	}
+
+	before, err := contract.GetPhysicalBacking(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetPhysicalBacking: %v", err)
+	}
+	if !approxEqual(before.BGTGrams, token.BGTGrams) || !approxEqual(before.BSTGrams, token.BSTGrams) ||
+		!approxEqual(before.BPTGrams, token.BPTGrams) {
+		t.Errorf("backing %+v, want the token's grams", *before)
+	}
+
+	// Gold rises 10%: the grams held stay put and only their value moves
+	stub.nextTx("price")
+	err = contract.SetManualPrice(asAdmin(stub), "BGT", 6380, "2026-02-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("SetManualPrice: %v", err)
+	}
+	after, err := contract.GetPhysicalBacking(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetPhysicalBacking: %v", err)
+	}
+	if after.BGTGrams != before.BGTGrams || after.BSTGrams != before.BSTGrams || after.BPTGrams != before.BPTGrams {
+		t.Errorf("grams moved with the price: before %+v, after %+v", *before, *after)
+	}
+	if !approxEqual(after.BGTValue, before.BGTValue*1.1) || after.BSTValue != before.BSTValue {
+		t.Errorf("gold revalued from %v to %v, silver from %v to %v", before.BGTValue, after.BGTValue,
+			before.BSTValue, after.BSTValue)
+	}
+	if getTestToken(t, stub, "MBT-mint1").BGTGrams != token.BGTGrams {
+		t.Error("token grams moved with the price")
+	}
+
+	// Redeeming half the token releases half its grams
+	stub.nextTx("redeem")
+	err = contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", token.TotalValue/2, "alice")
+	if err != nil {
+		t.Fatalf("RedeemMBT: %v", err)
+	}
+	redeemed, err := contract.GetPhysicalBacking(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetPhysicalBacking: %v", err)
+	}
+	if !approxEqual(redeemed.BGTGrams, before.BGTGrams/2) || !approxEqual(redeemed.BSTGrams, before.BSTGrams/2) {
+		t.Errorf("after redeeming half: %+v, want half of %+v", *redeemed, *before)
+	}
+}
+
+func TestAddToMBTGrowsTheToken(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	err := contract.SetMintFeePercent(asAdmin(stub), 0.01)
+	if err != nil {
+		t.Fatalf("SetMintFeePercent: %v", err)
+	}
+
+	stub.nextTx("mint1")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	before := getTestToken(t, stub, "MBT-mint1")
+	holdings, err := contract.GetBasketHoldings(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	supply := holdings.TotalMBTSupply
+
+	stub.nextTx("topup")
+	err = contract.AddToMBT(asUser(stub, "bob"), "MBT-mint1", 5000, "bob")
+	if err == nil || !strings.Contains(err.Error(), "does not own") {
+		t.Errorf("top-up by a non-owner: got %v, want an ownership error", err)
+	}
+	err = contract.AddToMBT(asUser(stub, "alice"), "MBT-mint1", 5000, "alice")
+	if err != nil {
+		t.Fatalf("AddToMBT: %v", err)
+	}
+
+	// 5,000 less the 1% fee grows the token by 4,950, split as the token already is
+	after := getTestToken(t, stub, "MBT-mint1")
+	growth := (before.TotalValue + 4950) / before.TotalValue
+	if !approxEqual(after.TotalValue, before.TotalValue+4950) || after.CostBasis != 15000 {
+		t.Errorf("after top-up: value %v, cost basis %v; want %v, 15000", after.TotalValue, after.CostBasis,
+			before.TotalValue+4950)
+	}
+	grown := map[string][2]float64{
+		"BGT":        {after.BGTAmount, before.BGTAmount * growth},
+		"BST":        {after.BSTAmount, before.BSTAmount * growth},
+		"BPT":        {after.BPTAmount, before.BPTAmount * growth},
+		"cash":       {after.CashAmount, before.CashAmount * growth},
+		"gold grams": {after.BGTGrams, before.BGTGrams * growth},
+	}
+	for name, amounts := range grown {
+		if !approxEqual(amounts[0], amounts[1]) {
+			t.Errorf("%s after top-up %v, want %v", name, amounts[0], amounts[1])
+		}
+	}
+	if after.Composition != before.Composition {
+		t.Errorf("composition changed from %+v to %+v", before.Composition, after.Composition)
+	}
+
+	holdings, err = contract.GetBasketHoldings(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approxEqual(holdings.TotalMBTSupply, supply+4950) {
+		t.Errorf("supply %v after top-up, want %v", holdings.TotalMBTSupply, supply+4950)
+	}
+}
+
+func TestEmergencyRedeemOnlyInWindDown(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	token := getTestToken(t, stub, "MBT-mint1")
+
+	// Redemptions are queued, which the emergency path skips
+	stub.nextTx("mode")
+	err = contract.SetRedemptionMode(asAdmin(stub), REDEMPTION_MODE_QUEUED)
+	if err != nil {
+		t.Fatalf("SetRedemptionMode: %v", err)
+	}
+
+	stub.nextTx("redeem1")
+	before := stateSnapshot(stub)
+	err = contract.EmergencyRedeem(asUser(stub, "alice"), "MBT-mint1", "alice")
+	if err == nil || !strings.Contains(err.Error(), MODE_WINDDOWN) {
+		t.Errorf("emergency redemption while active: got %v, want a wind-down error", err)
+	}
+	if !reflect.DeepEqual(stateSnapshot(stub), before) {
+		t.Error("rejected emergency redemption wrote state")
+	}
+
+	stub.nextTx("winddown")
+	err = contract.SetContractMode(asAdmin(stub), MODE_WINDDOWN)
+	if err != nil {
+		t.Fatalf("SetContractMode: %v", err)
+	}
+	stub.nextTx("redeem2")
+	err = contract.EmergencyRedeem(asUser(stub, "alice"), "MBT-mint1", "alice")
+	if err != nil {
+		t.Fatalf("EmergencyRedeem in wind-down: %v", err)
+	}
+
+	if _, ok := stub.state["MBT-mint1"]; ok {
+		t.Error("emergency redemption left the token in place")
+	}
+	queue, err := contract.GetRedemptionQueue(asAdmin(stub))
+	if err != nil || len(queue) != 0 {
+		t.Errorf("redemption queue: %d requests, %v; want the redemption settled, not queued", len(queue), err)
+	}
+	holdings, err := contract.GetBasketHoldings(asUser(stub, "alice"))
+	if err != nil || holdings.TotalMBTSupply != 0 {
+		t.Errorf("supply after emergency redemption: %v, %v", holdings.TotalMBTSupply, err)
+	}
+
+	var record EmergencyRedemption
+	err = json.Unmarshal(stub.state["\x00EmergencyRedemption\x00MBT-mint1\x00"], &record)
+	if err != nil || record.Owner != "alice" || record.Amount != token.TotalValue {
+		t.Errorf("emergency redemption record %+v, %v; want alice redeeming %v", record, err, token.TotalValue)
+	}
+}
+
+func TestMetalExposureAcrossDifferentlyComposedTokens(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	// One token at the basket split and one of gold alone
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	stub.nextTx("mint2")
+	err = contract.MintMBTInKind(asUser(stub, "alice"), "alice", 1, 0, 0, "alice", true)
+	if err != nil {
+		t.Fatalf("MintMBTInKind: %v", err)
+	}
+	mixed := getTestToken(t, stub, "MBT-mint1")
+
+	exposure, err := contract.GetMetalExposureForUser(asUser(stub, "alice"), "alice")
+	if err != nil {
+		t.Fatalf("GetMetalExposureForUser: %v", err)
+	}
+	want := map[string]struct{ grams, price float64 }{
+		"BGT": {mixed.BGTGrams + 1, 5800},
+		"BST": {mixed.BSTGrams, 75},
+		"BPT": {mixed.BPTGrams, 3200},
+	}
+	total := 0.0
+	for _, metal := range want {
+		total += metal.grams * metal.price
+	}
+	if len(exposure.Metals) != 3 || !approxEqual(exposure.TotalValue, total) {
+		t.Fatalf("exposure %+v, want three metals worth %v", *exposure, total)
+	}
+	percents := 0.0
+	for _, metal := range exposure.Metals {
+		expected := want[metal.Metal]
+		value := expected.grams * expected.price
+		if !approxEqual(metal.Grams, expected.grams) || !approxEqual(metal.Value, value) ||
+			!approxEqual(metal.Percent, value/total*100) {
+			t.Errorf("%s exposure %+v, want %vg worth %v", metal.Metal, metal, expected.grams, value)
+		}
+		percents += metal.Percent
+	}
+	if !approxEqual(percents, 100) {
+		t.Errorf("percentages sum to %v", percents)
+	}
+
+	empty, err := contract.GetMetalExposureForUser(asUser(stub, "bob"), "bob")
+	if err != nil {
+		t.Fatalf("GetMetalExposureForUser for a user without tokens: %v", err)
+	}
+	for _, metal := range empty.Metals {
+		if metal.Grams != 0 || metal.Value != 0 || metal.Percent != 0 {
+			t.Errorf("empty exposure %+v", metal)
+		}
+	}
+}
+
+func TestUSDBasketNAV(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	rate := "0.012"
+	stub.invoke["price-oracle"] = map[string]func(args [][]byte) peer.Response{
+		"getFXRate": func(args [][]byte) peer.Response {
+			if string(args[0]) != "INR" || string(args[1]) != "USD" {
+				return peer.Response{Status: shim.ERROR, Message: "unexpected pair"}
+			}
+			return peer.Response{Status: shim.OK, Payload: []byte(rate)}
+		},
+	}
+
+	err := contract.SetBasketCurrency(asAdmin(stub), "USD")
+	if err != nil {
+		t.Fatalf("SetBasketCurrency: %v", err)
+	}
+
+	stub.nextTx("mint1")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 1000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	// Gold at 5,800 INR a gram is 69.60 USD
+	token := getTestToken(t, stub, "MBT-mint1")
+	if !approxEqual(token.BGTGrams, token.BGTAmount/69.6) {
+		t.Errorf("gold %vg for %v USD, want priced at 69.60", token.BGTGrams, token.BGTAmount)
+	}
+	nav, err := contract.GetMBTNAV(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetMBTNAV: %v", err)
+	}
+	if nav.Currency != "USD" || !approxEqual(nav.NAV, 1) || !approxEqual(nav.TotalValue, 1000) {
+		t.Errorf("NAV %+v, want 1 USD on 1000 USD", *nav)
+	}
+
+	// The rupee strengthens 25% against the dollar: the metals are worth 25% more
+	// in dollars, the cash buffer is not
+	rate = "0.015"
+	nav, err = contract.GetMBTNAV(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetMBTNAV: %v", err)
+	}
+	metals := token.BGTAmount + token.BSTAmount + token.BPTAmount
+	want := (metals*1.25 + token.CashAmount) / token.TotalValue
+	if nav.Currency != "USD" || !approxEqual(nav.NAV, want) {
+		t.Errorf("NAV after the rate move %v %s, want %v USD", nav.NAV, nav.Currency, want)
+	}
+
+	stub.nextTx("currency")
+	err = contract.SetBasketCurrency(asAdmin(stub), "EUR")
+	if err == nil {
+		t.Error("changed the currency of a basket in circulation")
+	}
+}
+
+func TestTokenCompositionDriftsWithPrices(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	target := MetalComposition{Gold: 50, Silver: 30, Platinum: 20}
+
+	composition, err := contract.GetTokenComposition(asUser(stub, "alice"), "MBT-mint1")
+	if err != nil {
+		t.Fatalf("GetTokenComposition: %v", err)
+	}
+	if !approxEqual(composition.Current.Gold, 50) || !approxEqual(composition.Current.Silver, 30) ||
+		composition.Target != target {
+		t.Errorf("at mint prices: current %+v, target %+v; want both %+v", composition.Current, composition.Target, target)
+	}
+
+	// Gold doubles: a 50/30/20 split becomes 100/30/20 of 150
+	stub.nextTx("price")
+	err = contract.SetManualPrice(asAdmin(stub), "BGT", 11600, "2026-02-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("SetManualPrice: %v", err)
+	}
+	composition, err = contract.GetTokenComposition(asUser(stub, "alice"), "MBT-mint1")
+	if err != nil {
+		t.Fatalf("GetTokenComposition: %v", err)
+	}
+	want := MetalComposition{Gold: 100.0 / 1.5, Silver: 20, Platinum: 40.0 / 3}
+	if !approxEqual(composition.Current.Gold, want.Gold) || !approxEqual(composition.Current.Silver, want.Silver) ||
+		!approxEqual(composition.Current.Platinum, want.Platinum) {
+		t.Errorf("after gold doubled: current %+v, want %+v", composition.Current, want)
+	}
+	if composition.Target != target {
+		t.Errorf("target moved with prices: %+v", composition.Target)
+	}
+	token := getTestToken(t, stub, "MBT-mint1")
+	if metals := token.BGTAmount*2 + token.BSTAmount + token.BPTAmount; !approxEqual(composition.CurrentValue, metals) {
+		t.Errorf("current value %v, want %v", composition.CurrentValue, metals)
+	}
+}
+
+func TestNormalizeMetal(t *testing.T) {
+	valid := map[string]string{
+		"gold":     "BGT",
+		"BGT":      "BGT",
+		" Silver ": "BST",
+		"bst":      "BST",
+		"PLATINUM": "BPT",
+		"bpt":      "BPT",
+	}
+	for code, want := range valid {
+		got, err := normalizeMetal(code)
+		if err != nil || got != want {
+			t.Errorf("normalizeMetal(%q) = %q, %v; want %q", code, got, err, want)
+		}
+	}
+	for _, code := range []string{"", "copper", "BGTX", "go ld"} {
+		got, err := normalizeMetal(code)
+		if err == nil {
+			t.Errorf("normalizeMetal(%q) = %q, want an error", code, got)
+		}
+	}
+
+	for code, want := range map[string]string{"BGT": "gold", "silver": "silver", "bpt": "platinum"} {
+		got, err := metalName(code)
+		if err != nil || got != want {
+			t.Errorf("metalName(%q) = %q, %v; want %q", code, got, err, want)
+		}
+	}
+	if _, err := metalName("copper"); err == nil {
+		t.Error("metalName accepted copper")
+	}
+}
+
+func TestTokenBatchReportsMissingIDs(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newMockStub()
+	for _, tokenID := range []string{"MBT-1", "MBT-2"} {
+		putTestToken(t, stub, MBTToken{TokenID: tokenID, Owner: "alice", TotalValue: 1000})
+	}
+
+	batch, err := contract.GetMBTTokensBatch(asUser(stub, "alice"), `["MBT-1","MBT-9","MBT-2","MBT-8"]`)
+	if err != nil {
+		t.Fatalf("GetMBTTokensBatch: %v", err)
+	}
+	if len(batch.Tokens) != 2 || batch.Tokens["MBT-1"] == nil || batch.Tokens["MBT-2"].TokenID != "MBT-2" {
+		t.Errorf("found tokens %v, want MBT-1 and MBT-2", batch.Tokens)
+	}
+	if !reflect.DeepEqual(batch.NotFound, []string{"MBT-9", "MBT-8"}) {
+		t.Errorf("not found %v, want [MBT-9 MBT-8]", batch.NotFound)
+	}
+
+	tokenIDs := make([]string, MAX_BATCH_SIZE+1)
+	for i := range tokenIDs {
+		tokenIDs[i] = fmt.Sprintf("MBT-%d", i)
+	}
+	for _, size := range []int{MAX_BATCH_SIZE, MAX_BATCH_SIZE + 1} {
+		batchJSON, err := json.Marshal(tokenIDs[:size])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = contract.GetMBTTokensBatch(asUser(stub, "alice"), string(batchJSON))
+		if (err == nil) != (size <= MAX_BATCH_SIZE) {
+			t.Errorf("a batch of %d tokens: %v", size, err)
+		}
+	}
+}
+
+func TestStaleHoldingsWriteIsRejected(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	err := contract.UpdateBasketHoldings(asAdmin(stub), 100, 50, 30, 20, 0, 1, 10, 1, true)
+	if err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+
+	stub.nextTx("tx2")
+	stale, err := contract.GetBasketHoldings(asAdmin(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale.Version != 1 {
+		t.Fatalf("version after one write: %d, want 1", stale.Version)
+	}
+
+	err = contract.UpdateBasketHoldings(asAdmin(stub), 100, 50, 30, 20, 0, 1, 10, 1, true)
+	if err != nil {
+		t.Fatalf("second update: %v", err)
+	}
+
+	stub.nextTx("tx3")
+	stale.TotalMBTSupply += 1
+	err = contract.putBasketHoldings(asAdmin(stub), stale)
+	if !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("writing holdings read at version 1 over version 2: got %v, want ErrConcurrentModification", err)
+	}
+
+	holdings, err := contract.GetBasketHoldings(asAdmin(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holdings.Version != 2 || holdings.TotalMBTSupply != 200 {
+		t.Errorf("after the rejected write: version %d, supply %.2f, want 2 and 200", holdings.Version, holdings.TotalMBTSupply)
+	}
+}
+
+func TestTokenMetadataSurvivesSplits(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint-bad")
+	err := contract.MintMBTWithMetadata(asUser(stub, "alice"), "alice", 10000, "alice", `{"a.b": "x"}`)
+	if err == nil {
+		t.Error("metadata with a dotted key was accepted")
+	}
+
+	stub.nextTx("mint1")
+	err = contract.MintMBTWithMetadata(asUser(stub, "alice"), "alice", 10000, "alice", `{"account": "client-123"}`)
+	if err != nil {
+		t.Fatalf("MintMBTWithMetadata: %v", err)
+	}
+	if got := getTestToken(t, stub, "MBT-mint1").Metadata; !reflect.DeepEqual(got, map[string]string{"account": "client-123"}) {
+		t.Errorf("minted metadata %v", got)
+	}
+
+	stub.nextTx("tag-bob")
+	err = contract.SetTokenMetadata(asUser(stub, "bob"), "MBT-mint1", `{"account": "bob"}`)
+	if err == nil {
+		t.Error("a non-owner set the token's metadata")
+	}
+
+	stub.nextTx("tag-alice")
+	err = contract.SetTokenMetadata(asUser(stub, "alice"), "MBT-mint1", `{"account": "client-123", "plan": "SIP-A"}`)
+	if err != nil {
+		t.Fatalf("SetTokenMetadata: %v", err)
+	}
+
+	stub.nextTx("split")
+	err = contract.TransferMBT(asUser(stub, "alice"), "MBT-mint1", 1000, "alice", "bob")
+	if err != nil {
+		t.Fatalf("TransferMBT: %v", err)
+	}
+
+	want := map[string]string{"account": "client-123", "plan": "SIP-A"}
+	split := getTestToken(t, stub, "MBT-split-SPLIT")
+	if !reflect.DeepEqual(split.Metadata, want) {
+		t.Errorf("split token metadata %v, want %v", split.Metadata, want)
+	}
+
+	// The copies are independent: retagging the original leaves the split alone
+	stub.nextTx("retag")
+	err = contract.SetTokenMetadata(asUser(stub, "alice"), "MBT-mint1", "")
+	if err != nil {
+		t.Fatalf("clearing metadata: %v", err)
+	}
+	if got := getTestToken(t, stub, "MBT-mint1").Metadata; got != nil {
+		t.Errorf("cleared metadata %v", got)
+	}
+	if got := getTestToken(t, stub, "MBT-split-SPLIT").Metadata; !reflect.DeepEqual(got, want) {
+		t.Errorf("split token metadata after retagging the original: %v", got)
+	}
+}
+
+func TestLastRebalanceIsStableAcrossReads(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	holdings, err := contract.GetBasketHoldings(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holdings.Initialized || holdings.LastRebalance != "" {
+		t.Errorf("before initialization: initialized %v, last rebalance %q", holdings.Initialized, holdings.LastRebalance)
+	}
+	if len(stub.state) != 0 {
+		t.Errorf("reading uninitialized holdings wrote %d keys", len(stub.state))
+	}
+
+	stub.nextTx("init-user")
+	err = contract.InitializeBasket(asUser(stub, "alice"))
+	if err == nil {
+		t.Error("a non-admin initialized the basket")
+	}
+
+	stub.nextTx("init")
+	err = contract.InitializeBasket(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("InitializeBasket: %v", err)
+	}
+	initializedAt := stub.txTime.Format(time.RFC3339)
+
+	for _, txID := range []string{"read1", "read2"} {
+		stub.nextTx(txID)
+		holdings, err := contract.GetBasketHoldings(asUser(stub, "alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !holdings.Initialized || holdings.LastRebalance != initializedAt {
+			t.Errorf("%s: initialized %v, last rebalance %q, want %s", txID, holdings.Initialized,
+				holdings.LastRebalance, initializedAt)
+		}
+	}
+
+	stub.nextTx("init-again")
+	err = contract.InitializeBasket(asAdmin(stub))
+	if err == nil || !strings.Contains(err.Error(), "already initialized") {
+		t.Errorf("second initialization: %v", err)
+	}
+}
+
+func TestNAVBreakdownSharesSumToTheWhole(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	breakdown, err := contract.GetNAVBreakdown(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetNAVBreakdown with no supply: %v", err)
+	}
+	if breakdown.NAV != 0 || breakdown.TotalValue != 0 || len(breakdown.Metals) != 3 {
+		t.Errorf("empty basket breakdown %+v", breakdown)
+	}
+
+	stub.nextTx("mint1")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	stub.nextTx("read")
+	breakdown, err = contract.GetNAVBreakdown(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetNAVBreakdown: %v", err)
+	}
+	nav, err := contract.CalculateMBTNAV(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("CalculateMBTNAV: %v", err)
+	}
+	if !approxEqual(breakdown.NAV, nav) {
+		t.Errorf("breakdown NAV %v, CalculateMBTNAV %v", breakdown.NAV, nav)
+	}
+
+	percent := breakdown.Cash / breakdown.TotalValue * 100
+	value := breakdown.Cash
+	for _, metal := range breakdown.Metals {
+		if !approxEqual(metal.Value, metal.Grams*metal.Price) {
+			t.Errorf("%s value %v, want %v grams at %v", metal.Metal, metal.Value, metal.Grams, metal.Price)
+		}
+		percent += metal.PercentOfNAV
+		value += metal.Value
+	}
+	if !approxEqual(percent, 100) || !approxEqual(value, breakdown.TotalValue) {
+		t.Errorf("shares sum to %v%% and %v, want 100%% and %v", percent, value, breakdown.TotalValue)
+	}
+}
+
+func TestFailedAllocationReversesEarlierMetals(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	stub.invoke["bst"]["credit"] = func(args [][]byte) peer.Response {
+		return peer.Response{Status: shim.ERROR, Message: "silver vault unavailable"}
+	}
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err == nil || !strings.Contains(err.Error(), "silver vault unavailable") {
+		t.Fatalf("mint with a failing silver credit: got %v", err)
+	}
+
+	want := []string{"bgt.credit", "bst.credit", "bgt.debit"}
+	if !reflect.DeepEqual(stub.invocations, want) {
+		t.Errorf("invocations %v, want %v", stub.invocations, want)
+	}
+	if stub.state["MBT-mint1"] != nil {
+		t.Error("the token was stored despite the failed allocation")
+	}
+
+	// A reversal that fails too is reported alongside the original error
+	stub.invocations = nil
+	stub.invoke["bgt"]["debit"] = func(args [][]byte) peer.Response {
+		return peer.Response{Status: shim.ERROR, Message: "gold ledger unavailable"}
+	}
+	stub.nextTx("mint2")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err == nil || !strings.Contains(err.Error(), "rollback also failed") {
+		t.Errorf("mint with a failing reversal: got %v", err)
+	}
+}
+
+func TestUserHistoryAcrossActionTypes(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	steps := []struct {
+		txID string
+		run  func() error
+	}{
+		{"mint1", func() error { return contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice") }},
+		{"topup", func() error { return contract.AddToMBT(asUser(stub, "alice"), "MBT-mint1", 2000, "alice") }},
+		{"xfer", func() error { return contract.TransferMBT(asUser(stub, "alice"), "MBT-mint1", 1000, "alice", "bob") }},
+		{"redeem", func() error { return contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", 500, "alice") }},
+	}
+	for _, step := range steps {
+		stub.nextTx(step.txID)
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.txID, err)
+		}
+	}
+
+	var records []*UserTxRecord
+	bookmark := ""
+	for {
+		stub.nextTx("read-" + strconv.Itoa(len(records)))
+		page, err := contract.GetUserTransactionHistory(asUser(stub, "alice"), "alice", "", "", 3, bookmark)
+		if err != nil {
+			t.Fatalf("GetUserTransactionHistory: %v", err)
+		}
+		records = append(records, page.Records...)
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+
+	wantTypes := []string{USER_TX_MINT, USER_TX_TOPUP, USER_TX_TRANSFER_OUT, USER_TX_REDEEM}
+	if len(records) != len(wantTypes) {
+		t.Fatalf("got %d records, want %d", len(records), len(wantTypes))
+	}
+	for i, record := range records {
+		if record.Type != wantTypes[i] || record.TxID != steps[i].txID {
+			t.Errorf("record %d: %s in %s, want %s in %s", i, record.Type, record.TxID, wantTypes[i], steps[i].txID)
+		}
+	}
+	if records[2].Counterparty != "bob" || records[2].Amount != 1000 {
+		t.Errorf("transfer out: counterparty %q, amount %v", records[2].Counterparty, records[2].Amount)
+	}
+
+	// The range is inclusive at both ends
+	page, err := contract.GetUserTransactionHistory(asUser(stub, "alice"), "alice",
+		records[1].Timestamp, records[2].Timestamp, 10, "")
+	if err != nil || len(page.Records) != 2 || page.Records[0].TxID != "topup" || page.Records[1].TxID != "xfer" {
+		t.Errorf("history between the top-up and the transfer: %v, %v", page, err)
+	}
+
+	page, err = contract.GetUserTransactionHistory(asUser(stub, "bob"), "bob", "", "", 10, "")
+	if err != nil || len(page.Records) != 1 {
+		t.Fatalf("bob's history: %v, %v", page, err)
+	}
+	if in := page.Records[0]; in.Type != USER_TX_TRANSFER_IN || in.Counterparty != "alice" || in.TokenID != "MBT-xfer-SPLIT" {
+		t.Errorf("transfer in %+v", in)
+	}
+}
+
+func TestLockedTokensLeaveCirculation(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	for _, txID := range []string{"mint1", "mint2"} {
+		stub.nextTx(txID)
+		err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+		if err != nil {
+			t.Fatalf("MintMBT: %v", err)
+		}
+	}
+	locked := getTestToken(t, stub, "MBT-mint1")
+
+	stub.nextTx("read")
+	total, err := contract.GetCirculatingSupply(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetCirculatingSupply: %v", err)
+	}
+
+	stub.nextTx("lock-user")
+	err = contract.LockToken(asUser(stub, "alice"), "MBT-mint1")
+	if err == nil {
+		t.Error("a non-admin locked a token")
+	}
+
+	stub.nextTx("lock")
+	err = contract.LockToken(asAdmin(stub), "MBT-mint1")
+	if err != nil {
+		t.Fatalf("LockToken: %v", err)
+	}
+
+	stub.nextTx("read-locked")
+	circulating, err := contract.GetCirculatingSupply(asUser(stub, "alice"))
+	if err != nil || !approxEqual(circulating, total-locked.TotalValue) {
+		t.Errorf("circulating supply with a locked token: got %v, %v, want %v", circulating, err, total-locked.TotalValue)
+	}
+
+	stub.nextTx("redeem-locked")
+	err = contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", 1000, "alice")
+	if err == nil {
+		t.Error("a locked token was redeemed")
+	}
+
+	stub.nextTx("unlock")
+	err = contract.UnlockToken(asAdmin(stub), "MBT-mint1")
+	if err != nil {
+		t.Fatalf("UnlockToken: %v", err)
+	}
+
+	stub.nextTx("read-unlocked")
+	circulating, err = contract.GetCirculatingSupply(asUser(stub, "alice"))
+	if err != nil || !approxEqual(circulating, total) {
+		t.Errorf("circulating supply after unlocking: got %v, %v, want %v", circulating, err, total)
+	}
+}
+
+func TestRelativeDeviationFlagsPlatinumFirst(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	targets := map[string]float64{"BGT": 0.5, "BST": 0.3, "BPT": 0.2}
+	holdings := &BasketHolding{TotalMBTSupply: 100000, TotalBGTValue: 52000, TotalBSTValue: 31000, TotalBPTValue: 17000}
+
+	for mode, want := range map[string]bool{DEVIATION_ABSOLUTE: false, DEVIATION_RELATIVE: true} {
+		needed, err := contract.CheckRebalanceNeeded(asUser(stub, "alice"), holdings, targets, mode)
+		if err != nil || needed != want {
+			t.Errorf("%s: rebalance needed %v, %v, want %v", mode, needed, err, want)
+		}
+	}
+
+	mode, err := contract.GetDeviationMode(asUser(stub, "alice"))
+	if err != nil || mode != DEVIATION_ABSOLUTE {
+		t.Errorf("default deviation mode %q, %v, want %s", mode, err, DEVIATION_ABSOLUTE)
+	}
+	err = contract.SetDeviationMode(asAdmin(stub), "PERCENT")
+	if err == nil {
+		t.Error("an unknown deviation mode was accepted")
+	}
+}
+
+func TestStaleRedemptionIsRejected(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	stale := getTestToken(t, stub, "MBT-mint1")
+
+	stub.nextTx("redeem1")
+	err = contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", 1000, "alice")
+	if err != nil {
+		t.Fatalf("RedeemMBT: %v", err)
+	}
+	redeemed := getTestToken(t, stub, "MBT-mint1")
+	if redeemed.Version != stale.Version+1 {
+		t.Errorf("version after redemption %d, want %d", redeemed.Version, stale.Version+1)
+	}
+
+	// A second redemption computed from the pre-redemption token must not land
+	stub.nextTx("redeem2")
+	stale.TotalValue -= 1000
+	err = contract.putMBTToken(asUser(stub, "alice"), stale)
+	if !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("writing a token read before the redemption: got %v, want ErrConcurrentModification", err)
+	}
+	if got := getTestToken(t, stub, "MBT-mint1"); got.TotalValue != redeemed.TotalValue || got.Version != redeemed.Version {
+		t.Errorf("after the rejected write: value %v at version %d, want %v at %d", got.TotalValue, got.Version,
+			redeemed.TotalValue, redeemed.Version)
+	}
+
+	// A new token must start at version zero
+	copied := *redeemed
+	copied.TokenID = "MBT-copy"
+	err = contract.putMBTToken(asUser(stub, "alice"), &copied)
+	if !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("creating a token with a non-zero version: got %v", err)
+	}
+}
+
+func TestBasketValueAtShockedPrices(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	stub.nextTx("read")
+	current, err := contract.GetMBTNAV(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prices, err := contract.GetMBTPrices(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	holdings, err := contract.GetBasketHoldings(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := stateSnapshot(stub)
+
+	atCurrent, err := contract.GetBasketValueAtPrices(asUser(stub, "alice"),
+		fmt.Sprintf(`{"BGT": %v, "silver": %v, "BPT": %v}`, prices["BGT"], prices["BST"], prices["BPT"]))
+	if err != nil {
+		t.Fatalf("GetBasketValueAtPrices at current prices: %v", err)
+	}
+	if !approxEqual(atCurrent.TotalValue, current.TotalValue) || !approxEqual(atCurrent.NAV, current.NAV) {
+		t.Errorf("at current prices: %+v, want %+v", atCurrent, current)
+	}
+
+	// A 10% fall in gold costs a tenth of the gold held
+	shocked, err := contract.GetBasketValueAtPrices(asUser(stub, "alice"),
+		fmt.Sprintf(`{"BGT": %v, "BST": %v, "BPT": %v}`, prices["BGT"]*0.9, prices["BST"], prices["BPT"]))
+	if err != nil {
+		t.Fatalf("GetBasketValueAtPrices at shocked prices: %v", err)
+	}
+	if want := current.TotalValue - holdings.TotalBGTGrams*prices["BGT"]*0.1; !approxEqual(shocked.TotalValue, want) {
+		t.Errorf("value with gold down 10%%: %v, want %v", shocked.TotalValue, want)
+	}
+
+	invalid := []string{
+		`{"BGT": 5800, "BST": 75}`,
+		`{"BGT": 5800, "BST": 75, "BPT": -1}`,
+		`{"BGT": 5800, "gold": 5800, "BST": 75, "BPT": 3200}`,
+		`{"BGT": 5800, "BST": 75, "BPT": 3200, "copper": 1}`,
+	}
+	for _, pricesJSON := range invalid {
+		if _, err := contract.GetBasketValueAtPrices(asUser(stub, "alice"), pricesJSON); err == nil {
+			t.Errorf("prices %s were accepted", pricesJSON)
+		}
+	}
+
+	if !reflect.DeepEqual(stateSnapshot(stub), before) {
+		t.Error("valuing at hypothetical prices wrote state")
+	}
+}
+
+func TestMetalPriceLookup(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	timestamp, err := txTimestamp(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, code := range []string{"BGT", "gold"} {
+		price, err := contract.GetMetalPrice(asUser(stub, "alice"), code)
+		if err != nil {
+			t.Fatalf("GetMetalPrice(%s): %v", code, err)
+		}
+		want := MetalPrice{Metal: "BGT", Price: 5800, Currency: "INR", Source: "fallback", Timestamp: timestamp}
+		if *price != want {
+			t.Errorf("GetMetalPrice(%s) = %+v, want %+v", code, *price, want)
+		}
+	}
+
+	for _, code := range []string{"copper", ""} {
+		_, err := contract.GetMetalPrice(asUser(stub, "alice"), code)
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetMetalPrice(%q): got %v, want ErrNotFound", code, err)
+		}
+	}
+
+	stub.nextTx("override")
+	err = contract.SetManualPrice(asAdmin(stub), "silver", 80, stub.txTime.Add(time.Hour).Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("SetManualPrice: %v", err)
+	}
+	price, err := contract.GetMetalPrice(asUser(stub, "alice"), "BST")
+	if err != nil || price.Price != 80 || price.Source != "manual" {
+		t.Errorf("overridden silver price: %+v, %v", price, err)
+	}
+}
+
+func TestMintsStopAtBasketCapacity(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	capacity, err := contract.GetRemainingCapacity(asUser(stub, "alice"))
+	if err != nil || !capacity.Unlimited {
+		t.Fatalf("default capacity %+v, %v, want unlimited", capacity, err)
+	}
+
+	err = contract.SetBasketLimits(asUser(stub, "alice"), `{"maxBasketAum": 25000}`)
+	if err == nil {
+		t.Error("a non-admin set the basket limits")
+	}
+	err = contract.SetBasketLimits(asAdmin(stub), `{"maxBasketAum": -1}`)
+	if err == nil {
+		t.Error("a negative cap was accepted")
+	}
+	err = contract.SetBasketLimits(asAdmin(stub), `{"maxBasketAum": 25000, "minMintRemaining": 1000}`)
+	if err != nil {
+		t.Fatalf("SetBasketLimits: %v", err)
+	}
+
+	stub.nextTx("mint1")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	stub.nextTx("read")
+	capacity, err = contract.GetRemainingCapacity(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capacity.Unlimited || !approxEqual(capacity.Remaining, 25000-capacity.CurrentAUM) {
+		t.Fatalf("capacity after one mint %+v", capacity)
+	}
+
+	stub.nextTx("mint-over")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", capacity.Remaining+1, "alice")
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%.2f remaining", capacity.Remaining)) {
+		t.Errorf("mint over the cap: got %v, want the remaining capacity", err)
+	}
+
+	// Filling to within MinMintRemaining of the cap leaves the basket full
+	stub.nextTx("mint-fill")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", capacity.Remaining-500, "alice")
+	if err != nil {
+		t.Fatalf("mint to near the cap: %v", err)
+	}
+
+	stub.nextTx("read-full")
+	capacity, err = contract.GetRemainingCapacity(asUser(stub, "alice"))
+	if err != nil || capacity.Remaining != 0 {
+		t.Errorf("capacity of a nearly full basket: %+v, %v, want none remaining", capacity, err)
+	}
+	stub.nextTx("mint-full")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 100, "alice")
+	if err == nil {
+		t.Error("a mint into a full basket succeeded")
+	}
+}
+
+func TestQueuedRedemptionsSettleFIFO(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	for _, user := range []string{"alice", "bob", "carol"} {
+		stub.nextTx("mint-" + user)
+		err := contract.MintMBT(asUser(stub, user), user, 10000, user)
+		if err != nil {
+			t.Fatalf("MintMBT for %s: %v", user, err)
+		}
+	}
+	minted := map[string]float64{}
+	for _, user := range []string{"alice", "bob", "carol"} {
+		minted[user] = getTestToken(t, stub, "MBT-mint-"+user).TotalValue
+	}
+
+	stub.nextTx("queue-mode")
+	err := contract.SetRedemptionMode(asAdmin(stub), REDEMPTION_MODE_QUEUED)
+	if err != nil {
+		t.Fatalf("SetRedemptionMode: %v", err)
+	}
+
+	redemptions := []struct {
+		txID, user string
+		amount     float64
+	}{
+		{"q1", "alice", 1000},
+		{"q2", "bob", 2000},
+		{"q3", "alice", 500},
+		{"q4", "carol", 300},
+	}
+	for _, redemption := range redemptions {
+		stub.nextTx(redemption.txID)
+		err := contract.RedeemMBT(asUser(stub, redemption.user), "MBT-mint-"+redemption.user, redemption.amount, redemption.user)
+		if err != nil {
+			t.Fatalf("queueing %s: %v", redemption.txID, err)
+		}
+	}
+	if got := getTestToken(t, stub, "MBT-mint-alice").TotalValue; got != minted["alice"] {
+		t.Errorf("queueing settled immediately: alice's token holds %v, want %v", got, minted["alice"])
+	}
+
+	queuedIDs := func() []string {
+		queue, err := contract.GetRedemptionQueue(asAdmin(stub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, request := range queue {
+			ids = append(ids, request.RequestID)
+		}
+		return ids
+	}
+	if got := queuedIDs(); !reflect.DeepEqual(got, []string{"q1", "q2", "q3", "q4"}) {
+		t.Fatalf("queue %v, want q1 to q4 in order", got)
+	}
+
+	stub.nextTx("process-user")
+	_, err = contract.ProcessRedemptionQueue(asUser(stub, "alice"), 10)
+	if err == nil {
+		t.Error("a non-admin processed the queue")
+	}
+
+	// The run stops at alice's second redemption, which waits for the next run
+	stub.nextTx("process1")
+	processed, err := contract.ProcessRedemptionQueue(asAdmin(stub), 10)
+	if err != nil || processed != 2 {
+		t.Fatalf("first run: processed %d, %v, want 2", processed, err)
+	}
+	if got := queuedIDs(); !reflect.DeepEqual(got, []string{"q3", "q4"}) {
+		t.Errorf("queue after the first run %v, want q3 and q4", got)
+	}
+
+	stub.nextTx("process2")
+	processed, err = contract.ProcessRedemptionQueue(asAdmin(stub), 10)
+	if err != nil || processed != 2 {
+		t.Fatalf("second run: processed %d, %v, want 2", processed, err)
+	}
+	if got := queuedIDs(); len(got) != 0 {
+		t.Errorf("queue after the second run %v, want empty", got)
+	}
+
+	redeemed := map[string]float64{"alice": 1500, "bob": 2000, "carol": 300}
+	for user, amount := range redeemed {
+		if got := getTestToken(t, stub, "MBT-mint-"+user).TotalValue; !approxEqual(got, minted[user]-amount) {
+			t.Errorf("%s's token holds %v, want %v", user, got, minted[user]-amount)
+		}
+	}
+}
+
+func TestRedemptionResidualConservesValue(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	// Sum the metal value the redemption releases from the metal chaincodes
+	cash := getTestToken(t, stub, "MBT-mint1").CashAmount
+	delivered := 0.0
+	for _, chaincode := range []string{"bgt", "bst", "bpt"} {
+		stub.invoke[chaincode]["debit"] = func(args [][]byte) peer.Response {
+			amount, err := strconv.ParseFloat(string(args[1]), 64)
+			if err != nil {
+				return peer.Response{Status: shim.ERROR, Message: err.Error()}
+			}
+			delivered += amount
+			return peer.Response{Status: shim.OK}
+		}
+	}
+
+	const redeemed = 1234.5678
+	stub.nextTx("redeem1")
+	err = contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", redeemed, "alice")
+	if err != nil {
+		t.Fatalf("RedeemMBT: %v", err)
+	}
+
+	key, err := stub.CreateCompositeKey("Residual", []string{"MBT-mint1", "redeem1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record ResidualRecord
+	err = json.Unmarshal(stub.state[key], &record)
+	if err != nil {
+		t.Fatalf("residual record: %v", err)
+	}
+
+	if record.Redeemed != redeemed || record.Credited+record.Residual != redeemed {
+		t.Errorf("credited %v + residual %v != redeemed %v", record.Credited, record.Residual, record.Redeemed)
+	}
+	// Each of the three metal credits is rounded down by under a paisa
+	if record.Residual < 0 || record.Residual >= 0.03 {
+		t.Errorf("residual %v, want in [0, 0.03)", record.Residual)
+	}
+	if paid := delivered + math.Min(redeemed, cash); !approxEqual(paid, record.Credited) {
+		t.Errorf("paid %v in metal and cash, residual record credits %v", paid, record.Credited)
+	}
+
+	treasury, err := getTreasuryBalance(asAdmin(stub))
+	if err != nil || treasury != record.Residual {
+		t.Errorf("treasury balance %v, %v, want the residual %v", treasury, err, record.Residual)
+	}
+}
+
+func TestGetAllTokensPageBounds(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newMockStub()
+	for i := 1; i <= 4; i++ {
+		putTestToken(t, stub, MBTToken{TokenID: fmt.Sprintf("MBT-%d", i), Owner: "alice", TotalValue: 100})
+	}
+
+	for _, pageSize := range []int32{0, -1, MAX_BATCH_SIZE + 1} {
+		stub.nextTx("bad-page")
+		if _, err := contract.GetAllTokens(asAdmin(stub), pageSize, ""); err == nil {
+			t.Errorf("page size %d was accepted", pageSize)
+		}
+	}
+
+	// Pages that divide the tokens exactly end without repeating any
+	seen := map[string]int{}
+	bookmark := ""
+	for pages := 1; pages <= 5; pages++ {
+		stub.nextTx("page-" + strconv.Itoa(pages))
+		page, err := contract.GetAllTokens(asAdmin(stub), 2, bookmark)
+		if err != nil {
+			t.Fatalf("page %d: %v", pages, err)
+		}
+		if int(page.FetchedCount) != len(page.Tokens) {
+			t.Errorf("page %d: fetched count %d for %d tokens", pages, page.FetchedCount, len(page.Tokens))
+		}
+		for _, token := range page.Tokens {
+			seen[token.TokenID]++
+		}
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+	if len(seen) != 4 {
+		t.Errorf("saw %d distinct tokens, want 4", len(seen))
+	}
+	for tokenID, count := range seen {
+		if count != 1 {
+			t.Errorf("%s returned %d times", tokenID, count)
+		}
+	}
+}
+
+func TestFrozenTokenCannotMove(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	stub.nextTx("freeze-user")
+	err = contract.FreezeToken(asUser(stub, "alice"), "MBT-mint1", "investigation")
+	if err == nil {
+		t.Error("a non-admin froze a token")
+	}
+	err = contract.FreezeToken(asAdmin(stub), "MBT-mint1", "")
+	if err == nil {
+		t.Error("a token was frozen without a reason")
+	}
+
+	stub.nextTx("freeze")
+	err = contract.FreezeToken(asAdmin(stub), "MBT-mint1", "investigation 42")
+	if err != nil {
+		t.Fatalf("FreezeToken: %v", err)
+	}
+	var event TokenFreezeEvent
+	err = json.Unmarshal(stub.events["TokenFrozen"], &event)
+	if err != nil || event.TokenID != "MBT-mint1" || !event.Frozen || event.Reason != "investigation 42" {
+		t.Errorf("TokenFrozen event %+v, %v", event, err)
+	}
+
+	blocked := map[string]func() error{
+		"RedeemMBT":   func() error { return contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", 1000, "alice") },
+		"TransferMBT": func() error { return contract.TransferMBT(asUser(stub, "alice"), "MBT-mint1", 1000, "alice", "bob") },
+	}
+	for name, call := range blocked {
+		stub.nextTx("frozen-" + name)
+		err := call()
+		if err == nil || !strings.Contains(err.Error(), "frozen: investigation 42") {
+			t.Errorf("%s on a frozen token: got %v", name, err)
+		}
+	}
+
+	stub.nextTx("unfreeze")
+	err = contract.UnfreezeToken(asAdmin(stub), "MBT-mint1")
+	if err != nil {
+		t.Fatalf("UnfreezeToken: %v", err)
+	}
+	if _, ok := stub.events["TokenUnfrozen"]; !ok {
+		t.Error("no TokenUnfrozen event")
+	}
+	if token := getTestToken(t, stub, "MBT-mint1"); token.Frozen || token.FreezeReason != "" {
+		t.Errorf("after unfreezing: frozen %v, reason %q", token.Frozen, token.FreezeReason)
+	}
+
+	stub.nextTx("transfer")
+	err = contract.TransferMBT(asUser(stub, "alice"), "MBT-mint1", 1000, "alice", "bob")
+	if err != nil {
+		t.Errorf("transfer after unfreezing: %v", err)
+	}
+}
+
+// withRebalancingContract configures the basket on stub to consult a real rebalancing
+// contract, with the default policy, over a stub of its own, which it returns
+func withRebalancingContract(t *testing.T, stub *mockStub) *mockStub {
+	t.Helper()
+	rebalancing := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	rebalancingStub := newRebalancingStub(t, &adjustments)
+
+	respond := func(payload []byte, err error) peer.Response {
+		if err != nil {
+			return peer.Response{Status: shim.ERROR, Message: err.Error()}
+		}
+		return peer.Response{Status: shim.OK, Payload: payload}
+	}
+	formatFloat := func(value float64, err error) ([]byte, error) {
+		return []byte(strconv.FormatFloat(value, 'f', -1, 64)), err
+	}
+	caller := asUser(rebalancingStub, "mbt-basket")
+	stub.invoke["mbt-rebalancing"] = map[string]func(args [][]byte) peer.Response{
+		"IsBasketBusy": func(args [][]byte) peer.Response {
+			busy, err := rebalancing.IsBasketBusy(caller, string(args[0]))
+			return respond([]byte(strconv.FormatBool(busy)), err)
+		},
+		"GetBasketCompositionTargets": func(args [][]byte) peer.Response {
+			targets, err := rebalancing.GetBasketCompositionTargets(caller)
+			if err != nil {
+				return respond(nil, err)
+			}
+			return respond(json.Marshal(targets))
+		},
+		"GetCashBufferPercent": func(args [][]byte) peer.Response {
+			return respond(formatFloat(rebalancing.GetCashBufferPercent(caller)))
+		},
+		"GetCompositionTolerance": func(args [][]byte) peer.Response {
+			return respond(formatFloat(rebalancing.GetCompositionTolerance(caller)))
+		},
+	}
+
+	err := (&MBTBasketContract{}).SetMetalChaincodeConfig(asAdmin(stub),
+		`{"bgtChaincode":"bgt","bstChaincode":"bst","bptChaincode":"bpt","rebalancingChaincode":"mbt-rebalancing"}`)
+	if err != nil {
+		t.Fatalf("SetMetalChaincodeConfig: %v", err)
+	}
+	return rebalancingStub
+}
+
+func TestUserFlowsWaitForAnApprovedRebalance(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	rebalancingStub := withRebalancingContract(t, stub)
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	putRequest(t, rebalancingStub, RebalanceRequest{RequestID: "REBAL-1", BasketID: "MBT_BASKET",
+		Status: STATUS_APPROVED, CreatedAt: rebalancingStub.txTime.Format(time.RFC3339)})
+
+	flows := map[string]func() error{
+		"MintMBT":   func() error { return contract.MintMBT(asUser(stub, "alice"), "alice", 1000, "alice") },
+		"RedeemMBT": func() error { return contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", 1000, "alice") },
+	}
+
+	// Blocking is off by default
+	for name, flow := range flows {
+		stub.nextTx("unblocked-" + name)
+		if err := flow(); err != nil {
+			t.Errorf("%s with blocking off: %v", name, err)
+		}
+	}
+
+	rebalancingStub.nextTx("block")
+	updateTestPolicy(t, rebalancingStub, func(policy *RebalancePolicy) { policy.BlockDuringRebalance = true })
+	for name, flow := range flows {
+		stub.nextTx("blocked-" + name)
+		err := flow()
+		if err == nil || !strings.Contains(err.Error(), "basket busy") {
+			t.Errorf("%s during an approved rebalance: got %v, want basket busy", name, err)
+		}
+	}
+
+	// Once the rebalance has executed the basket is free again
+	putRequest(t, rebalancingStub, RebalanceRequest{RequestID: "REBAL-1", BasketID: "MBT_BASKET",
+		Status: STATUS_EXECUTED, CreatedAt: rebalancingStub.txTime.Format(time.RFC3339)})
+	for name, flow := range flows {
+		stub.nextTx("after-" + name)
+		if err := flow(); err != nil {
+			t.Errorf("%s after the rebalance: %v", name, err)
+		}
+	}
+}
+
+func TestComplianceReportCoversEveryCategory(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newMockStub()
+	officer := newMockContext(stub, "officer", map[string]string{"compliance": "true"})
+
+	putTestToken(t, stub, MBTToken{TokenID: "MBT-1", Owner: "alice", TotalValue: 100, Frozen: true,
+		FreezeReason: "investigation"})
+	putTestToken(t, stub, MBTToken{TokenID: "MBT-2", Owner: "bob", TotalValue: 200, Locked: true})
+	putTestToken(t, stub, MBTToken{TokenID: "MBT-3", Owner: "carol", TotalValue: 300})
+	err := contract.AddToBlacklist(asAdmin(stub), "mallory")
+	if err != nil {
+		t.Fatalf("AddToBlacklist: %v", err)
+	}
+
+	stub.nextTx("report-user")
+	_, err = contract.GetComplianceReport(asUser(stub, "alice"))
+	if err == nil {
+		t.Error("an ordinary user read the compliance report")
+	}
+
+	report, err := contract.GetComplianceReport(officer)
+	if err != nil {
+		t.Fatalf("GetComplianceReport: %v", err)
+	}
+	if len(report.Blacklist) != 1 || report.Blacklist[0].UserID != "mallory" {
+		t.Errorf("blacklist %+v, want mallory", report.Blacklist)
+	}
+	if len(report.FrozenTokens) != 1 || report.FrozenTokens[0].TokenID != "MBT-1" ||
+		report.FrozenTokens[0].FreezeReason != "investigation" {
+		t.Errorf("frozen tokens %+v, want MBT-1 with its reason", report.FrozenTokens)
+	}
+	if len(report.LockedTokens) != 1 || report.LockedTokens[0].TokenID != "MBT-2" {
+		t.Errorf("locked tokens %+v, want MBT-2", report.LockedTokens)
+	}
+	if report.FlaggedOperations != nil {
+		t.Errorf("flagged operations %s without a rebalancing chaincode, want null", report.FlaggedOperations)
+	}
+
+	flagged := `[{"operationId":"OP-1","flagged":true}]`
+	stub.invoke["mbt-rebalancing"] = map[string]func(args [][]byte) peer.Response{
+		"GetFlaggedOperations": func(args [][]byte) peer.Response {
+			return peer.Response{Status: shim.OK, Payload: []byte(flagged)}
+		},
+	}
+	err = contract.SetMetalChaincodeConfig(asAdmin(stub),
+		`{"bgtChaincode":"bgt","bstChaincode":"bst","bptChaincode":"bpt","rebalancingChaincode":"mbt-rebalancing"}`)
+	if err != nil {
+		t.Fatalf("SetMetalChaincodeConfig: %v", err)
+	}
+
+	stub.nextTx("report-flagged")
+	report, err = contract.GetComplianceReport(officer)
+	if err != nil || string(report.FlaggedOperations) != flagged {
+		t.Errorf("flagged operations %s, %v, want %s", report.FlaggedOperations, err, flagged)
+	}
+}
+
+func TestMintByMetalWeightHoldsTheRequestedGrams(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	err := contract.SetMintFeePercent(asAdmin(stub), 0.01)
+	if err != nil {
+		t.Fatalf("SetMintFeePercent: %v", err)
+	}
+
+	tests := []struct {
+		txID, metal string
+		grams       float64
+		held        func(token *MBTToken) float64
+	}{
+		{"gold", "gold", 10, func(token *MBTToken) float64 { return token.BGTGrams }},
+		{"silver", "BST", 250, func(token *MBTToken) float64 { return token.BSTGrams }},
+		{"platinum", "platinum", 2.5, func(token *MBTToken) float64 { return token.BPTGrams }},
+	}
+	for _, test := range tests {
+		stub.nextTx(test.txID)
+		err := contract.MintMBTByMetalWeight(asUser(stub, "alice"), "alice", test.metal, test.grams, "alice")
+		if err != nil {
+			t.Fatalf("MintMBTByMetalWeight(%s, %v): %v", test.metal, test.grams, err)
+		}
+		// The fee is rounded up to the paisa, which costs a sliver of metal
+		if held := test.held(getTestToken(t, stub, "MBT-"+test.txID)); math.Abs(held-test.grams) > 1e-4 {
+			t.Errorf("minting %v g of %s: token holds %v g", test.grams, test.metal, held)
+		}
+	}
+
+	invalid := []struct {
+		metal string
+		grams float64
+	}{
+		{"copper", 10},
+		{"gold", 0},
+		{"gold", -1},
+	}
+	for _, test := range invalid {
+		stub.nextTx("invalid")
+		if err := contract.MintMBTByMetalWeight(asUser(stub, "alice"), "alice", test.metal, test.grams, "alice"); err == nil {
+			t.Errorf("minting %v g of %s succeeded", test.grams, test.metal)
+		}
+	}
+}
+
+func TestEventsAreNumberedSequentially(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newMockStub()
+	putTestToken(t, stub, MBTToken{TokenID: "MBT-1", Owner: "alice", TotalValue: 100})
+
+	steps := []struct {
+		txID, event string
+		run         func() error
+	}{
+		{"freeze1", "TokenFrozen", func() error { return contract.FreezeToken(asAdmin(stub), "MBT-1", "review") }},
+		{"unfreeze", "TokenUnfrozen", func() error { return contract.UnfreezeToken(asAdmin(stub), "MBT-1") }},
+		{"freeze2", "TokenFrozen", func() error { return contract.FreezeToken(asAdmin(stub), "MBT-1", "second review") }},
+	}
+	for i, step := range steps {
+		stub.nextTx(step.txID)
+		stub.events = map[string][]byte{}
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.txID, err)
+		}
+
+		var event TokenFreezeEvent
+		err := json.Unmarshal(stub.events[step.event], &event)
+		if err != nil {
+			t.Fatalf("%s: %s event: %v", step.txID, step.event, err)
+		}
+		if event.EventSeq != uint64(i+1) {
+			t.Errorf("%s: event sequence %d, want %d", step.txID, event.EventSeq, i+1)
+		}
+		if got := string(stub.state["EVENT_SEQ"]); got != strconv.Itoa(i+1) {
+			t.Errorf("%s: stored sequence %s, want %d", step.txID, got, i+1)
+		}
+
+		// A rejected call emits nothing and leaves no gap
+		stub.nextTx("repeat-" + step.txID)
+		stub.events = map[string][]byte{}
+		if err := step.run(); err == nil {
+			t.Fatalf("repeating %s succeeded", step.txID)
+		}
+		if len(stub.events) != 0 || string(stub.state["EVENT_SEQ"]) != strconv.Itoa(i+1) {
+			t.Errorf("repeating %s: events %v, sequence %s", step.txID, stub.events, stub.state["EVENT_SEQ"])
+		}
+	}
+}
+
+func TestPolicyTargetsDriveMintAllocation(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	rebalancingStub := withRebalancingContract(t, stub)
+
+	mintWeights := func(txID string) map[string]float64 {
+		t.Helper()
+		stub.nextTx(txID)
+		err := contract.MintMBT(asUser(stub, "alice"), "alice", 100000, "alice")
+		if err != nil {
+			t.Fatalf("MintMBT: %v", err)
+		}
+		token := getTestToken(t, stub, "MBT-"+txID)
+		metals := token.BGTAmount + token.BSTAmount + token.BPTAmount
+		return map[string]float64{
+			"gold":     token.BGTAmount / metals,
+			"silver":   token.BSTAmount / metals,
+			"platinum": token.BPTAmount / metals,
+		}
+	}
+
+	checkWeights := func(label string, got, want map[string]float64) {
+		t.Helper()
+		for metal, target := range want {
+			if math.Abs(got[metal]-target) > 1e-3 {
+				t.Errorf("%s: %s weight %v, want %v", label, metal, got[metal], target)
+			}
+		}
+	}
+
+	checkWeights("default policy", mintWeights("mint1"),
+		map[string]float64{"gold": 0.5, "silver": 0.3, "platinum": 0.2})
+
+	// A policy change takes effect on the next mint without redeploying the basket
+	rebalancingStub.nextTx("retarget")
+	updateTestPolicy(t, rebalancingStub, func(policy *RebalancePolicy) {
+		policy.GoldAllocation, policy.SilverAllocation, policy.PlatinumAllocation = 0.7, 0.2, 0.1
+	})
+	checkWeights("updated policy", mintWeights("mint2"),
+		map[string]float64{"gold": 0.7, "silver": 0.2, "platinum": 0.1})
+}
+
+func TestTokenValuationAgainstCostBasis(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	created := stub.txTime.Add(-10 * 24 * time.Hour).Format(time.RFC3339)
+
+	// 1 g gold, 20 g silver and 0.5 g platinum at the default prices, plus cash
+	marketValue := 5800 + 20*75 + 0.5*3200 + 100.0
+	putTestToken(t, stub, MBTToken{TokenID: "MBT-1", Owner: "alice", CreationTime: created,
+		BGTGrams: 1, BSTGrams: 20, BPTGrams: 0.5, CashAmount: 100, CostBasis: 8000})
+	putTestToken(t, stub, MBTToken{TokenID: "MBT-legacy", Owner: "alice", CreationTime: created,
+		BGTGrams: 1})
+
+	valuation, err := contract.GetTokenValuation(asUser(stub, "alice"), "MBT-1")
+	if err != nil {
+		t.Fatalf("GetTokenValuation: %v", err)
+	}
+	if !valuation.CostBasisAvailable || !approxEqual(valuation.MarketValue, marketValue) ||
+		!approxEqual(valuation.UnrealizedPnL, marketValue-8000) ||
+		!approxEqual(valuation.UnrealizedPnLPct, (marketValue-8000)/8000*100) ||
+		!approxEqual(valuation.HoldingPeriodDays, 10) {
+		t.Errorf("valuation = %+v, want market value %v against a cost of 8000 over 10 days", valuation, marketValue)
+	}
+
+	// Tokens minted before cost tracking still value, without P&L
+	valuation, err = contract.GetTokenValuation(asUser(stub, "alice"), "MBT-legacy")
+	if err != nil {
+		t.Fatalf("GetTokenValuation without a cost basis: %v", err)
+	}
+	if valuation.CostBasisAvailable || valuation.UnrealizedPnL != 0 || !approxEqual(valuation.MarketValue, 5800) {
+		t.Errorf("valuation without a cost basis = %+v", valuation)
+	}
+
+	if _, err := contract.GetTokenValuation(asAdmin(stub), "MBT-1"); err != nil {
+		t.Errorf("admin valuation: %v", err)
+	}
+	if _, err := contract.GetTokenValuation(asUser(stub, "bob"), "MBT-1"); err == nil {
+		t.Error("bob valued alice's token")
+	}
+}
+
+func TestImportTokenBeforeActivation(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	legacy := MBTToken{TokenID: "MBT-legacy-1", Owner: "alice", TotalValue: 10000,
+		BGTAmount: 5000, BSTAmount: 3000, BPTAmount: 2000, BGTGrams: 0.862, BSTGrams: 40, BPTGrams: 0.625,
+		Composition:  MetalComposition{Gold: 50, Silver: 30, Platinum: 20},
+		CreationTime: stub.txTime.AddDate(-1, 0, 0).Format(time.RFC3339)}
+	importJSON := func(token MBTToken) string {
+		tokenJSON, err := json.Marshal(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(tokenJSON)
+	}
+
+	inconsistent := map[string]func(token *MBTToken){
+		"amounts off total":    func(token *MBTToken) { token.BGTAmount = 4000 },
+		"composition off 100%": func(token *MBTToken) { token.Composition.Gold = 40 },
+		"negative grams":       func(token *MBTToken) { token.BSTGrams = -1 },
+		"missing owner":        func(token *MBTToken) { token.Owner = "" },
+		"non-MBT token ID":     func(token *MBTToken) { token.TokenID = "legacy-1" },
+		"non-positive total": func(token *MBTToken) {
+			token.TotalValue, token.BGTAmount, token.BSTAmount, token.BPTAmount = 0, 0, 0, 0
+		},
+	}
+	for name, corrupt := range inconsistent {
+		token := legacy
+		corrupt(&token)
+		stub.nextTx("bad-" + name)
+		if err := contract.ImportToken(asAdmin(stub), importJSON(token)); err == nil {
+			t.Errorf("importing a token with %s succeeded", name)
+		}
+	}
+
+	stub.nextTx("import-user")
+	if err := contract.ImportToken(asUser(stub, "alice"), importJSON(legacy)); err == nil {
+		t.Error("a non-admin imported a token")
+	}
+
+	stub.nextTx("import")
+	err := contract.ImportToken(asAdmin(stub), importJSON(legacy))
+	if err != nil {
+		t.Fatalf("ImportToken: %v", err)
+	}
+	imported := getTestToken(t, stub, "MBT-legacy-1")
+	if imported.Owner != "alice" || imported.TotalValue != 10000 || imported.BSTGrams != 40 {
+		t.Errorf("imported token = %+v", imported)
+	}
+	holdings, err := contract.GetBasketHoldings(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approxEqual(holdings.TotalBGTValue, 5000) || !approxEqual(holdings.TotalBSTGrams, 40) ||
+		!approxEqual(holdings.TotalBPTGrams, 0.625) {
+		t.Errorf("holdings after import = %+v", holdings)
+	}
+
+	stub.nextTx("reimport")
+	if err := contract.ImportToken(asAdmin(stub), importJSON(legacy)); err == nil {
+		t.Error("importing the same token twice succeeded")
+	}
+
+	stub.nextTx("activate")
+	err = contract.ActivateBasket(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("ActivateBasket: %v", err)
+	}
+	second := legacy
+	second.TokenID = "MBT-legacy-2"
+	stub.nextTx("late-import")
+	err = contract.ImportToken(asAdmin(stub), importJSON(second))
+	if err == nil || !strings.Contains(err.Error(), "activated") {
+		t.Errorf("import after activation: got %v, want imports closed", err)
+	}
+}
+
+func TestDailyNAVChangeAgainstYesterdaysSnapshot(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 100000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	stub.nextTx("no-snapshot")
+	change, err := contract.GetDailyNAVChange(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetDailyNAVChange: %v", err)
+	}
+	if change.HasPriorSnapshot || change.Change != 0 || change.CurrentNAV <= 0 {
+		t.Errorf("change without a snapshot = %+v", change)
+	}
+
+	stub.nextTx("snapshot-day1")
+	yesterday, err := contract.RecordNAVSnapshot(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("RecordNAVSnapshot: %v", err)
+	}
+
+	// A snapshot taken today is not a prior-day reference
+	stub.nextTx("same-day")
+	change, err = contract.GetDailyNAVChange(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetDailyNAVChange: %v", err)
+	}
+	if change.HasPriorSnapshot {
+		t.Errorf("same-day snapshot used as the reference: %+v", change)
+	}
+
+	// Next day gold rises, and the day's own snapshot is again ignored
+	stub.txTime = stub.txTime.Add(24 * time.Hour)
+	stub.nextTx("price")
+	err = contract.SetManualPrice(asAdmin(stub), "BGT", 6380, "2026-02-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("SetManualPrice: %v", err)
+	}
+	stub.nextTx("snapshot-day2")
+	today, err := contract.RecordNAVSnapshot(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("RecordNAVSnapshot: %v", err)
+	}
+	if today.NAV <= yesterday.NAV {
+		t.Fatalf("NAV did not rise with gold: %v to %v", yesterday.NAV, today.NAV)
+	}
+
+	stub.nextTx("day2")
+	change, err = contract.GetDailyNAVChange(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetDailyNAVChange: %v", err)
+	}
+	if !change.HasPriorSnapshot || change.ReferenceTimestamp != yesterday.Timestamp ||
+		!approxEqual(change.ReferenceNAV, yesterday.NAV) || !approxEqual(change.CurrentNAV, today.NAV) ||
+		!approxEqual(change.Change, today.NAV-yesterday.NAV) ||
+		!approxEqual(change.ChangePercent, (today.NAV-yesterday.NAV)/yesterday.NAV*100) {
+		t.Errorf("change = %+v, want %v against yesterday's %v", change, today.NAV, yesterday.NAV)
+	}
+}
+
+func TestOwnershipDistributionOfASkewedBasket(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	for tokenID, token := range map[string]struct {
+		owner string
+		value float64
+	}{
+		"MBT-1": {"alice", 6000}, "MBT-2": {"alice", 1000}, "MBT-3": {"alice", 1000},
+		"MBT-4": {"bob", 1500}, "MBT-5": {"carol", 500},
+	} {
+		putTestToken(t, stub, MBTToken{TokenID: tokenID, Owner: token.owner, TotalValue: token.value})
+	}
+
+	distribution, err := contract.GetOwnershipDistribution(asAdmin(stub), 2)
+	if err != nil {
+		t.Fatalf("GetOwnershipDistribution: %v", err)
+	}
+	if distribution.HolderCount != 3 || !approxEqual(distribution.TotalUnits, 10000) ||
+		!approxEqual(distribution.TopHoldersShare, 95) || !approxEqual(distribution.HerfindahlIndex, 80*80+15*15+5*5) {
+		t.Errorf("distribution = %+v", distribution)
+	}
+	want := []HolderShare{
+		{Owner: "alice", TokenCount: 3, Units: 8000, PercentSupply: 80},
+		{Owner: "bob", TokenCount: 1, Units: 1500, PercentSupply: 15},
+	}
+	if len(distribution.TopHolders) != len(want) {
+		t.Fatalf("top holders = %d, want %d", len(distribution.TopHolders), len(want))
+	}
+	for i, holder := range distribution.TopHolders {
+		if holder.Owner != want[i].Owner || holder.TokenCount != want[i].TokenCount ||
+			!approxEqual(holder.Units, want[i].Units) || !approxEqual(holder.PercentSupply, want[i].PercentSupply) {
+			t.Errorf("top holder %d = %+v, want %+v", i, *holder, want[i])
+		}
+	}
+
+	for _, topN := range []int{0, MAX_BATCH_SIZE + 1} {
+		if _, err := contract.GetOwnershipDistribution(asAdmin(stub), topN); err == nil {
+			t.Errorf("GetOwnershipDistribution(%d) succeeded", topN)
+		}
+	}
+	if _, err := contract.GetOwnershipDistribution(asUser(stub, "alice"), 2); err == nil {
+		t.Error("a holder read the ownership distribution")
+	}
+}
+
+func TestUnrealizedPnLNetsGainsAndLosses(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	for _, token := range []MBTToken{
+		{TokenID: "MBT-gain", Owner: "alice", BGTGrams: 1, CostBasis: 5000},  // Worth 5800
+		{TokenID: "MBT-loss", Owner: "alice", BSTGrams: 20, CostBasis: 2000}, // Worth 1500
+		{TokenID: "MBT-legacy", Owner: "alice", BPTGrams: 1},                 // No cost basis
+		{TokenID: "MBT-bob", Owner: "bob", BGTGrams: 10, CostBasis: 1000},
+	} {
+		putTestToken(t, stub, token)
+		if err := putOwnerIndex(asAdmin(stub), token.Owner, token.TokenID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pnl, err := contract.GetUnrealizedPnLForUser(asUser(stub, "alice"), "alice")
+	if err != nil {
+		t.Fatalf("GetUnrealizedPnLForUser: %v", err)
+	}
+	if pnl.TokenCount != 2 || pnl.ExcludedTokens != 1 || !approxEqual(pnl.TotalCost, 7000) ||
+		!approxEqual(pnl.TotalMarketValue, 7300) || !approxEqual(pnl.UnrealizedPnL, 300) ||
+		!approxEqual(pnl.ReturnPercent, 300.0/7000*100) {
+		t.Errorf("alice's P&L = %+v, want 7300 against a cost of 7000", pnl)
+	}
+
+	pnl, err = contract.GetUnrealizedPnLForUser(asUser(stub, "carol"), "carol")
+	if err != nil {
+		t.Fatalf("GetUnrealizedPnLForUser with no holdings: %v", err)
+	}
+	if *pnl != (UserPnL{UserID: "carol"}) {
+		t.Errorf("P&L with no holdings = %+v, want zeros", pnl)
+	}
+}
+
+func TestRedemptionsSettleAfterTheDelay(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	err := contract.SetSettlementDelayHours(asAdmin(stub), 24)
+	if err != nil {
+		t.Fatalf("SetSettlementDelayHours: %v", err)
+	}
+	stub.nextTx("mint1")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	stub.nextTx("redeem")
+	err = contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", 5000, "alice")
+	if err != nil {
+		t.Fatalf("RedeemMBT: %v", err)
+	}
+	if metalDebits(stub) != 0 {
+		t.Errorf("metals delivered at redemption: %v", stub.invocations)
+	}
+	pending, err := contract.GetPendingSettlements(asUser(stub, "alice"), "alice")
+	if err != nil {
+		t.Fatalf("GetPendingSettlements: %v", err)
+	}
+	due := stub.txTime.Add(24 * time.Hour).Format("2006-01-02T15:04:05.000000000Z")
+	if len(pending) != 1 || pending[0].SettlementID != "redeem-MBT-mint1" || pending[0].DueAt != due ||
+		pending[0].BGTAmount <= 0 || pending[0].BSTAmount <= 0 || pending[0].BPTAmount <= 0 {
+		t.Fatalf("pending settlements = %+v, want one due %s", pending, due)
+	}
+
+	// Just before the due time nothing settles
+	stub.txTime = stub.txTime.Add(23 * time.Hour)
+	stub.nextTx("early")
+	settled, err := contract.SettlePendingRedemptions(asAdmin(stub))
+	if err != nil || settled != 0 || metalDebits(stub) != 0 {
+		t.Errorf("before due: settled %d, %v, %d debits", settled, err, metalDebits(stub))
+	}
+
+	stub.txTime = stub.txTime.Add(time.Hour)
+	stub.nextTx("due")
+	settled, err = contract.SettlePendingRedemptions(asAdmin(stub))
+	if err != nil || settled != 1 || metalDebits(stub) != 3 {
+		t.Errorf("after due: settled %d, %v, %d debits", settled, err, metalDebits(stub))
+	}
+	pending, err = contract.GetPendingSettlements(asUser(stub, "alice"), "alice")
+	if err != nil || len(pending) != 0 {
+		t.Errorf("pending after settling: %+v, %v", pending, err)
+	}
+
+	stub.nextTx("again")
+	settled, err = contract.SettlePendingRedemptions(asAdmin(stub))
+	if err != nil || settled != 0 || metalDebits(stub) != 3 {
+		t.Errorf("settling again: settled %d, %v, %d debits", settled, err, metalDebits(stub))
+	}
+}
+
+func TestFeeRevenueOverADateRange(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	days := [][]struct {
+		feeType string
+		amount  float64
+	}{
+		{{FEE_MINT, 10}, {FEE_REDEEM, 5}},    // 2026-01-15
+		{{FEE_CONVERSION, 3}, {FEE_MINT, 7}}, // 2026-01-16
+		{{FEE_MINT, 100}},                    // 2026-01-17
+	}
+	for day, fees := range days {
+		for i, fee := range fees {
+			stub.nextTx(fmt.Sprintf("fee-%d-%d", day, i))
+			if err := recordFee(asUser(stub, "alice"), fee.feeType, fee.amount, "alice"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stub.txTime = stub.txTime.Add(24 * time.Hour)
+	}
+
+	stub.nextTx("report")
+	revenue, err := contract.GetFeeRevenue(asAdmin(stub), "2026-01-15", "2026-01-16")
+	if err != nil {
+		t.Fatalf("GetFeeRevenue: %v", err)
+	}
+	want := map[string]float64{FEE_MINT: 17, FEE_REDEEM: 5, FEE_CONVERSION: 3}
+	if !reflect.DeepEqual(revenue.ByType, want) || revenue.Total != 25 || revenue.RecordCount != 4 {
+		t.Errorf("revenue = %+v, want %v totalling 25 over 4 records", revenue, want)
+	}
+
+	// Paging through the same range skips the later day's record
+	var amounts []float64
+	bookmark := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("fee records did not finish paging")
+		}
+		stub.nextTx(fmt.Sprintf("page-%d", pages))
+		page, err := contract.GetFeeRecords(asAdmin(stub), "2026-01-15", "2026-01-16", 2, bookmark)
+		if err != nil {
+			t.Fatalf("GetFeeRecords: %v", err)
+		}
+		for _, record := range page.Records {
+			amounts = append(amounts, record.Amount)
+		}
+		if bookmark = page.Bookmark; bookmark == "" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(amounts, []float64{10, 5, 3, 7}) {
+		t.Errorf("paged fee amounts %v, want 10, 5, 3, 7 in time order", amounts)
+	}
+
+	if _, err := contract.GetFeeRevenue(asUser(stub, "alice"), "2026-01-15", "2026-01-16"); err == nil {
+		t.Error("a user read fee revenue")
+	}
+	if _, err := contract.GetFeeRevenue(asAdmin(stub), "2026-01-16", "2026-01-15"); err == nil {
+		t.Error("a reversed date range was accepted")
+	}
+}
+
+func TestTreasuryWithdrawsOnlyToApprovedDestinations(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	if err := putFloatState(asAdmin(stub), "TREASURY_BALANCE", 1000); err != nil {
+		t.Fatal(err)
+	}
+	balance := func() float64 {
+		t.Helper()
+		treasury, err := getTreasuryBalance(asAdmin(stub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return treasury
+	}
+
+	stub.nextTx("add")
+	err := contract.AddTreasuryDestination(asAdmin(stub), "ops-account")
+	if err != nil {
+		t.Fatalf("AddTreasuryDestination: %v", err)
+	}
+	stub.nextTx("add-user")
+	if err := contract.AddTreasuryDestination(asUser(stub, "alice"), "alice-account"); err == nil {
+		t.Error("a user approved a treasury destination")
+	}
+	destinations, err := contract.GetTreasuryDestinations(asAdmin(stub))
+	if err != nil || len(destinations) != 1 || destinations[0].Destination != "ops-account" {
+		t.Fatalf("destinations = %+v, %v; want ops-account alone", destinations, err)
+	}
+
+	stub.nextTx("withdraw-unlisted")
+	err = contract.WithdrawTreasury(asAdmin(stub), "alice-account", 100)
+	if err == nil || !strings.Contains(err.Error(), "not an approved treasury destination") {
+		t.Errorf("withdrawal to an unlisted destination: got %v", err)
+	}
+	stub.nextTx("withdraw")
+	err = contract.WithdrawTreasury(asAdmin(stub), "ops-account", 400)
+	if err != nil {
+		t.Fatalf("WithdrawTreasury: %v", err)
+	}
+	if got := balance(); got != 600 {
+		t.Errorf("treasury %v after withdrawing 400 of 1000, want 600", got)
+	}
+
+	// A removed destination is no longer paid
+	stub.nextTx("remove")
+	err = contract.RemoveTreasuryDestination(asAdmin(stub), "ops-account")
+	if err != nil {
+		t.Fatalf("RemoveTreasuryDestination: %v", err)
+	}
+	stub.nextTx("withdraw-removed")
+	if err := contract.WithdrawTreasury(asAdmin(stub), "ops-account", 100); err == nil {
+		t.Error("withdrew to a removed destination")
+	}
+	if got := balance(); got != 600 {
+		t.Errorf("treasury %v after rejected withdrawals, want 600", got)
+	}
+}
+
+func TestTokensByValueRangeSegmentsHoldings(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	values := map[string]float64{"MBT-1": 500, "MBT-2": 1000, "MBT-3": 2500, "MBT-4": 50000, "MBT-5": 100000, "MBT-6": 999}
+	for tokenID, value := range values {
+		putTestToken(t, stub, MBTToken{TokenID: tokenID, Owner: "alice", TotalValue: value})
+	}
+
+	tokensInRange := func(minValue, maxValue float64) []string {
+		t.Helper()
+		var tokenIDs []string
+		bookmark := ""
+		for pages := 0; ; pages++ {
+			if pages > len(values) {
+				t.Fatal("tokens did not finish paging")
+			}
+			stub.nextTx(fmt.Sprintf("page-%d", pages))
+			page, err := contract.GetTokensByValueRange(asAdmin(stub), minValue, maxValue, 2, bookmark)
+			if err != nil {
+				t.Fatalf("GetTokensByValueRange(%v, %v): %v", minValue, maxValue, err)
+			}
+			for _, token := range page.Tokens {
+				tokenIDs = append(tokenIDs, token.TokenID)
+			}
+			if bookmark = page.Bookmark; bookmark == "" {
+				return tokenIDs
+			}
+		}
+	}
+
+	// Bounds are inclusive at both ends
+	if got := tokensInRange(0, 1000); !reflect.DeepEqual(got, []string{"MBT-1", "MBT-2", "MBT-6"}) {
+		t.Errorf("small tokens = %v", got)
+	}
+	if got := tokensInRange(1000.01, 1e9); !reflect.DeepEqual(got, []string{"MBT-3", "MBT-4", "MBT-5"}) {
+		t.Errorf("large tokens = %v", got)
+	}
+	if got := tokensInRange(200000, 300000); got != nil {
+		t.Errorf("tokens above every holding = %v", got)
+	}
+
+	if _, err := contract.GetTokensByValueRange(asAdmin(stub), 1000, 500, 2, ""); err == nil {
+		t.Error("min above max was accepted")
+	}
+	if _, err := contract.GetTokensByValueRange(asUser(stub, "alice"), 0, 1000, 2, ""); err == nil {
+		t.Error("a user segmented the holdings")
+	}
+}
+
+func TestFeeRoundingConservesTheAmount(t *testing.T) {
+	examples := []struct {
+		amount, feePercent float64
+		wantNet, wantFee   int64
+	}{
+		{1000, 0.001, 99900, 100},    // Exact: no rounding
+		{1000.01, 0.001, 99900, 101}, // 100.001 paise of fee rounds up
+		{0.01, 0.001, 0, 1},          // Any fee on a paise is a whole paise
+		{1000, 0, 100000, 0},         // No fee configured
+		{0, 0.001, 0, 0},
+	}
+	for _, example := range examples {
+		net, fee := splitFee(example.amount, example.feePercent)
+		if net != example.wantNet || fee != example.wantFee {
+			t.Errorf("splitFee(%v, %v) = %d, %d paise; want %d, %d",
+				example.amount, example.feePercent, net, fee, example.wantNet, example.wantFee)
+		}
+	}
+
+	for _, feePercent := range []float64{0.0005, 0.001, 0.0025, 0.003, 0.01, 0.015} {
+		for amountPaise := int64(1); amountPaise <= 200000; amountPaise += 7 {
+			amount := float64(amountPaise) / 100
+			net, fee := splitFee(amount, feePercent)
+			if net+fee != amountPaise {
+				t.Fatalf("splitFee(%v, %v): net %d + fee %d != %d paise", amount, feePercent, net, fee, amountPaise)
+			}
+			// The fee is the exact fee rounded up, never more than a paise over
+			exact := float64(amountPaise) * feePercent
+			if float64(fee) < exact-1e-6 || float64(fee) >= exact+1 {
+				t.Fatalf("splitFee(%v, %v): fee %d paise, exact %v", amount, feePercent, fee, exact)
+			}
+		}
+	}
+}
+
+func TestDriftSeriesFromSnapshots(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	rfc := func(at time.Time) string { return at.Format(time.RFC3339) }
+	start := stub.txTime
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 100000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	stub.nextTx("snapshot1")
+	onTarget, err := contract.RecordNAVSnapshot(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("RecordNAVSnapshot: %v", err)
+	}
+
+	// A snapshot recorded before allocations were stored is skipped
+	legacyKey, _ := stub.CreateCompositeKey("NAVSnapshot", []string{"2026-01-15T10:02:30.000000000Z"})
+	stub.state[legacyKey] = []byte(`{"nav":1,"timestamp":"2026-01-15T10:02:30.000000000Z"}`)
+
+	stub.nextTx("price")
+	err = contract.SetManualPrice(asAdmin(stub), "BGT", 8700, "2026-02-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("SetManualPrice: %v", err)
+	}
+	stub.nextTx("snapshot2")
+	drifted, err := contract.RecordNAVSnapshot(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("RecordNAVSnapshot: %v", err)
+	}
+	end := stub.txTime
+
+	stub.nextTx("snapshot3") // After the range
+	if _, err := contract.RecordNAVSnapshot(asAdmin(stub)); err != nil {
+		t.Fatalf("RecordNAVSnapshot: %v", err)
+	}
+
+	stub.nextTx("series")
+	series, err := contract.GetDriftSeries(asUser(stub, "alice"), rfc(start), rfc(end))
+	if err != nil {
+		t.Fatalf("GetDriftSeries: %v", err)
+	}
+	gold := drifted.Allocation["BGT"] - drifted.Targets["BGT"]
+	if len(series) != 2 || series[0].Timestamp != onTarget.Timestamp || series[0].MaxDeviation > 1e-3 ||
+		series[1].Timestamp != drifted.Timestamp || series[1].Metal != "BGT" || !approxEqual(series[1].MaxDeviation, gold) {
+		t.Errorf("series = %+v, want on target then gold %v over", series, gold)
+	}
+	if gold < 0.05 {
+		t.Errorf("gold at 1.5x price only drifted %v", gold)
+	}
+
+	// One usable snapshot is not a series
+	if _, err := contract.GetDriftSeries(asUser(stub, "alice"), rfc(start), rfc(start.Add(150*time.Second))); err == nil {
+		t.Error("a single-snapshot series was returned")
+	}
+	if _, err := contract.GetDriftSeries(asUser(stub, "alice"), rfc(end), rfc(start)); err == nil {
+		t.Error("a reversed range was accepted")
+	}
+}
+
+func TestOracleQuorumTakesTheMedian(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	serveOracle := func(oracle, pricesJSON string) {
+		stub.invoke[oracle] = map[string]func(args [][]byte) peer.Response{
+			"getMetalPrices": func(args [][]byte) peer.Response {
+				if pricesJSON == "" {
+					return peer.Response{Status: shim.ERROR, Message: "oracle down"}
+				}
+				return peer.Response{Status: shim.OK, Payload: []byte(pricesJSON)}
+			},
+		}
+	}
+
+	err := contract.SetOracleQuorum(asAdmin(stub), `{"oracles":["oracle1","oracle2","oracle3"],"quorum":2,"tolerancePercent":2}`)
+	if err != nil {
+		t.Fatalf("SetOracleQuorum: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		oracles []string // One price set per oracle; empty for no response
+		want    map[string]float64
+		wantErr string
+	}{
+		{"agreeing", []string{
+			`{"gold":5800,"silver":75,"platinum":3200}`,
+			`{"BGT":5850,"BST":76,"BPT":3210}`,
+			`{"gold":5790,"silver":74.5,"platinum":3190}`,
+		}, map[string]float64{"BGT": 5800, "BST": 75, "BPT": 3200}, ""},
+		{"one down", []string{
+			`{"gold":5800,"silver":75,"platinum":3200}`,
+			"",
+			`{"gold":5900,"silver":76,"platinum":3220}`,
+		}, map[string]float64{"BGT": 5850, "BST": 75.5, "BPT": 3210}, ""},
+		{"disagreeing", []string{
+			`{"gold":5800,"silver":75,"platinum":3200}`,
+			`{"gold":7000,"silver":75,"platinum":3200}`,
+			`{"gold":5810,"silver":75,"platinum":3200}`,
+		}, nil, "oracles disagree on BGT"},
+		{"insufficient quorum", []string{
+			`{"gold":5800,"silver":75,"platinum":3200}`,
+			"",
+			`{"gold":5800,"silver":75}`, // Incomplete, so not counted
+		}, nil, "oracle quorum not met: 1 of 3 responded, 2 required"},
+	}
+	for _, test := range cases {
+		for i, pricesJSON := range test.oracles {
+			serveOracle(fmt.Sprintf("oracle%d", i+1), pricesJSON)
+		}
+		stub.nextTx(test.name)
+		prices, err := contract.GetMBTPrices(asUser(stub, "alice"))
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: got %v, %v; want error %q", test.name, prices, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for metal, want := range test.want {
+			if !approxEqual(prices[metal], want) {
+				t.Errorf("%s: %s at %v, want the median %v", test.name, metal, prices[metal], want)
+			}
+		}
+	}
+
+	for _, quorumJSON := range []string{
+		`{"oracles":["oracle1","oracle2"],"quorum":3,"tolerancePercent":2}`,
+		`{"oracles":["oracle1","oracle2"],"quorum":0,"tolerancePercent":2}`,
+		`{"oracles":["oracle1","oracle2"],"quorum":2,"tolerancePercent":0}`,
+	} {
+		if err := contract.SetOracleQuorum(asAdmin(stub), quorumJSON); err == nil {
+			t.Errorf("SetOracleQuorum(%s) succeeded", quorumJSON)
+		}
+	}
+}
+
+func TestTokenRedemptionHistoryAcrossPartialRedemptions(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	redemptions := []struct {
+		txID   string
+		amount float64
+	}{{"redeem1", 3000}, {"redeem2", 2000}}
+	for _, redemption := range redemptions {
+		stub.nextTx(redemption.txID)
+		err = contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", redemption.amount, "alice")
+		if err != nil {
+			t.Fatalf("RedeemMBT %v: %v", redemption.amount, err)
+		}
+	}
+
+	history, err := contract.GetTokenRedemptionHistory(asUser(stub, "alice"), "MBT-mint1")
+	if err != nil {
+		t.Fatalf("GetTokenRedemptionHistory: %v", err)
+	}
+	if len(history) != len(redemptions) {
+		t.Fatalf("got %d redemption records, want %d", len(history), len(redemptions))
+	}
+	// Oldest first, each with the metals, fee and NAV of its redemption
+	for i, record := range history {
+		if record.TxID != redemptions[i].txID || record.Amount != redemptions[i].amount {
+			t.Errorf("record %d is %s for %v, want %s for %v", i, record.TxID, record.Amount,
+				redemptions[i].txID, redemptions[i].amount)
+		}
+		if record.TokenID != "MBT-mint1" || record.UserID != "alice" || record.NAV <= 0 ||
+			record.BGTAmount <= 0 || record.BSTAmount <= 0 || record.BPTAmount <= 0 ||
+			record.BGTGrams <= 0 || record.BSTGrams <= 0 || record.BPTGrams <= 0 {
+			t.Errorf("incomplete redemption record %+v", *record)
+		}
+	}
+
+	admin, err := contract.GetTokenRedemptionHistory(asAdmin(stub), "MBT-mint1")
+	if err != nil || len(admin) != 2 {
+		t.Errorf("admin history: %d records, %v", len(admin), err)
+	}
+	other, err := contract.GetTokenRedemptionHistory(asUser(stub, "bob"), "MBT-mint1")
+	if err != nil || len(other) != 0 {
+		t.Errorf("bob sees %d of alice's redemptions, %v", len(other), err)
+	}
+}
+
+func TestInKindMintsAtTheCompositionTolerance(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	rebalancingStub := withRebalancingContract(t, stub)
+	rebalancingStub.nextTx("tolerance")
+	updateTestPolicy(t, rebalancingStub, func(policy *RebalancePolicy) { policy.CompositionTolerancePercent = 0.02 })
+
+	// Deposits worth 10000 whose gold share sits just inside and just outside two
+	// points of its 50% target
+	deposit := func(gold, silver, platinum float64) (float64, float64, float64) {
+		return gold * 10000 / 5800, silver * 10000 / 75, platinum * 10000 / 3200
+	}
+	cases := []struct {
+		name                   string
+		gold, silver, platinum float64
+		rebalanceAfter         bool
+		wantErr                bool
+	}{
+		{"on target", 0.5, 0.3, 0.2, false, false},
+		{"inside tolerance", 0.519, 0.2905, 0.1905, false, false},
+		{"outside tolerance", 0.521, 0.2895, 0.1895, false, true},
+		{"outside, rebalanced after", 0.521, 0.2895, 0.1895, true, false},
+	}
+	for _, test := range cases {
+		bgt, bst, bpt := deposit(test.gold, test.silver, test.platinum)
+		stub.nextTx(test.name)
+		err := contract.MintMBTInKind(asUser(stub, "alice"), "alice", bgt, bst, bpt, "alice", test.rebalanceAfter)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+
+	// The same deposit is accepted once the policy widens the tolerance
+	rebalancingStub.nextTx("widen")
+	updateTestPolicy(t, rebalancingStub, func(policy *RebalancePolicy) { policy.CompositionTolerancePercent = 0.03 })
+	bgt, bst, bpt := deposit(0.521, 0.2895, 0.1895)
+	stub.nextTx("widened")
+	if err := contract.MintMBTInKind(asUser(stub, "alice"), "alice", bgt, bst, bpt, "alice", false); err != nil {
+		t.Errorf("deposit within the widened tolerance: %v", err)
+	}
+}
+
+func TestStateSizeCountsEachCategory(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	for _, tokenID := range []string{"MBT-1", "MBT-2", "MBT-3"} {
+		putTestToken(t, stub, MBTToken{TokenID: tokenID, Owner: "alice", TotalValue: 100})
+	}
+	seed := func(objectType string, count int) {
+		for i := 0; i < count; i++ {
+			key, _ := stub.CreateCompositeKey(objectType, []string{fmt.Sprintf("%06d", i)})
+			stub.state[key] = []byte(`{}`)
+		}
+	}
+	seed("NAVSnapshot", 2)
+	seed("Fee", 4)
+	seed("Transfer", MAX_STATE_SCAN_KEYS+1)
+	stub.state["BASKET_HOLDINGS"] = []byte(`{}`) // Uncategorized
+
+	size, err := contract.GetStateSize(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("GetStateSize: %v", err)
+	}
+	want := []StateCategorySize{
+		{Category: "tokens", Count: 3},
+		{Category: "snapshots", Count: 2},
+		{Category: "redemptions"},
+		{Category: "settlements"},
+		{Category: "fees", Count: 4},
+		{Category: "transfers", Count: MAX_STATE_SCAN_KEYS, Capped: true},
+		{Category: "alertPreferences"},
+	}
+	if !reflect.DeepEqual(size.Categories, want) {
+		t.Errorf("state size = %+v, want %+v", size.Categories, want)
+	}
+
+	if _, err := contract.GetStateSize(asUser(stub, "alice")); err == nil {
+		t.Error("a user read the state size")
+	}
+}
+
+func TestCashBufferServesSmallRedemptions(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	rebalancingStub := withRebalancingContract(t, stub)
+	rebalancingStub.nextTx("buffer")
+	updateTestPolicy(t, rebalancingStub, func(policy *RebalancePolicy) { policy.CashBufferPercent = 0.1 })
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	token := getTestToken(t, stub, "MBT-mint1")
+	if !approxEqual(token.CashAmount, token.TotalValue*0.1) {
+		t.Errorf("token holds %v cash of %v, want 10%%", token.CashAmount, token.TotalValue)
+	}
+	holdings, err := contract.GetBasketHoldings(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approxEqual(holdings.TotalCashValue, token.CashAmount) {
+		t.Errorf("basket holds %v cash, token %v", holdings.TotalCashValue, token.CashAmount)
+	}
+
+	// NAV counts the cash alongside the metals
+	nav, err := contract.GetMBTNAV(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetMBTNAV: %v", err)
+	}
+	metals := holdings.TotalBGTGrams*5800 + holdings.TotalBSTGrams*75 + holdings.TotalBPTGrams*3200
+	if !approxEqual(nav.TotalValue, metals+holdings.TotalCashValue) {
+		t.Errorf("NAV total %v, want metals %v plus cash %v", nav.TotalValue, metals, holdings.TotalCashValue)
+	}
+
+	// A redemption within the buffer is paid in cash without touching the metals
+	small := token.CashAmount / 2
+	stub.nextTx("redeem-small")
+	err = contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", small, "alice")
+	if err != nil {
+		t.Fatalf("RedeemMBT: %v", err)
+	}
+	redeemed := getTestToken(t, stub, "MBT-mint1")
+	if metalDebits(stub) != 0 || redeemed.BGTGrams != token.BGTGrams || !approxEqual(redeemed.CashAmount, token.CashAmount-small) {
+		t.Errorf("small redemption traded metals: %d debits, grams %v to %v, cash %v to %v", metalDebits(stub),
+			token.BGTGrams, redeemed.BGTGrams, token.CashAmount, redeemed.CashAmount)
+	}
+
+	// Beyond the buffer the rest comes from the metals
+	stub.nextTx("redeem-large")
+	err = contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint1", token.CashAmount, "alice")
+	if err != nil {
+		t.Fatalf("RedeemMBT: %v", err)
+	}
+	if metalDebits(stub) != 3 {
+		t.Errorf("redemption beyond the buffer made %d metal debits, want 3", metalDebits(stub))
+	}
+	if cash := getTestToken(t, stub, "MBT-mint1").CashAmount; cash > 1e-6 {
+		t.Errorf("token kept %v cash after redeeming past the buffer", cash)
+	}
+}
+
+func TestBasketYieldFromRecordedIncome(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 100000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	before, err := contract.GetMBTNAV(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetMBTNAV: %v", err)
+	}
+	stub.nextTx("snapshot1")
+	first, err := contract.RecordNAVSnapshot(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("RecordNAVSnapshot: %v", err)
+	}
+
+	stub.nextTx("income-user")
+	if contract.RecordIncome(asUser(stub, "alice"), 500, "lending") == nil {
+		t.Error("non-admin recorded income")
+	}
+	stub.nextTx("income-zero")
+	if contract.RecordIncome(asAdmin(stub), 0, "lending") == nil {
+		t.Error("zero income was recorded")
+	}
+
+	// Income is held as cash, so NAV rises by the amount
+	stub.nextTx("income1")
+	err = contract.RecordIncome(asAdmin(stub), 500, "lending")
+	if err != nil {
+		t.Fatalf("RecordIncome: %v", err)
+	}
+	after, err := contract.GetMBTNAV(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetMBTNAV: %v", err)
+	}
+	if !approxEqual(after.TotalValue, before.TotalValue+500) || after.NAV <= before.NAV {
+		t.Errorf("NAV after income: total %v to %v, NAV %v to %v", before.TotalValue, after.TotalValue, before.NAV, after.NAV)
+	}
+	stub.nextTx("snapshot2")
+	second, err := contract.RecordNAVSnapshot(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("RecordNAVSnapshot: %v", err)
+	}
+
+	// Income on the next day falls outside a one-day period
+	stub.txTime = stub.txTime.Add(24 * time.Hour)
+	stub.nextTx("income2")
+	err = contract.RecordIncome(asAdmin(stub), 300, "lending")
+	if err != nil {
+		t.Fatalf("RecordIncome: %v", err)
+	}
+	total, err := contract.GetTotalIncome(asUser(stub, "alice"))
+	if err != nil || !approxEqual(total, 800) {
+		t.Errorf("total income = %v, %v; want 800", total, err)
+	}
+
+	yield, err := contract.GetBasketYield(asUser(stub, "alice"), "2026-01-15", "2026-01-15")
+	if err != nil {
+		t.Fatalf("GetBasketYield: %v", err)
+	}
+	average := (first.TotalValue + second.TotalValue) / 2
+	if yield.Days != 1 || !approxEqual(yield.TotalIncome, 500) || yield.AUMSamples != 2 ||
+		!approxEqual(yield.AverageAUM, average) || !approxEqual(yield.AnnualizedYield, 500/average*365) {
+		t.Errorf("one-day yield = %+v, want 500 over %v for a year", yield, average)
+	}
+
+	// Without snapshots in the period the current value stands in
+	yield, err = contract.GetBasketYield(asUser(stub, "alice"), "2026-01-16", "2026-01-25")
+	if err != nil {
+		t.Fatalf("GetBasketYield: %v", err)
+	}
+	current, err := contract.GetMBTNAV(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetMBTNAV: %v", err)
+	}
+	if yield.Days != 10 || !approxEqual(yield.TotalIncome, 300) || yield.AUMSamples != 0 ||
+		!approxEqual(yield.AverageAUM, current.TotalValue) ||
+		!approxEqual(yield.AnnualizedYield, 300/current.TotalValue*365/10) {
+		t.Errorf("ten-day yield = %+v, want 300 over %v", yield, current.TotalValue)
+	}
+}
+
+func TestSafeDivideRejectsZeroAndOverflow(t *testing.T) {
+	tests := []struct {
+		name                   string
+		numerator, denominator float64
+		want                   float64
+		wantErr                bool
+	}{
+		{"ordinary", 1, 4, 0.25, false},
+		{"denormal quotient", 5e-324, 2, 0, false},
+		{"zero numerator", 0, 3, 0, false},
+		{"zero denominator", 1, 0, 0, true},
+		{"zero by zero", 0, 0, 0, true},
+		{"denormal denominator", 1e308, 5e-324, 0, true},
+		{"NaN numerator", math.NaN(), 2, 0, true},
+	}
+	for _, test := range tests {
+		got, err := safeDivide(test.numerator, test.denominator)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("%s: safeDivide(%g, %g) = %v, %v", test.name, test.numerator, test.denominator, got, err)
+		}
+	}
+}
+
+func TestNonFiniteValuesNeverReachState(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	targets := map[string]float64{"BGT": 0.6, "BST": 0.25, "BPT": 0.15}
+
+	// A zero or denormal price cannot be converted to grams
+	for _, price := range []float64{0, 5e-324} {
+		prices := map[string]float64{"BGT": 5800, "BST": price, "BPT": 3200}
+		_, _, _, err := mintAllocation(100000, 0, prices, targets)
+		if err == nil {
+			t.Errorf("allocation at a silver price of %g succeeded", price)
+		}
+	}
+
+	// An empty basket has no NAV rather than a NaN one
+	nav, err := contract.GetMBTNAV(asUser(stub, "alice"))
+	if err != nil || nav.NAV != 0 || nav.Supply != 0 {
+		t.Errorf("empty basket NAV = %+v, %v", nav, err)
+	}
+
+	stub.nextTx("mint1")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	stub.nextTx("nan-holdings")
+	ctx := asAdmin(stub)
+	holdings, err := contract.GetBasketHoldings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	supply := holdings.TotalMBTSupply
+	holdings.TotalMBTSupply = math.NaN()
+	if contract.putBasketHoldings(ctx, holdings) == nil {
+		t.Error("holdings with a NaN supply were stored")
+	}
+	stored, err := contract.GetBasketHoldings(ctx)
+	if err != nil || stored.TotalMBTSupply != supply {
+		t.Errorf("stored supply = %v, %v; want %v", stored.TotalMBTSupply, err, supply)
+	}
+
+	token := getTestToken(t, stub, "MBT-mint1")
+	token.TotalValue = math.Inf(1)
+	if contract.putMBTToken(ctx, token) == nil {
+		t.Error("token with an infinite value was stored")
+	}
+	if getTestToken(t, stub, "MBT-mint1").TotalValue != 10000 {
+		t.Error("infinite token value reached state")
+	}
+
+	if putFloatState(ctx, "TOTAL_INCOME", math.Inf(-1)) == nil || stub.state["TOTAL_INCOME"] != nil {
+		t.Error("infinite total income was stored")
+	}
+}
+
+func TestPortfolioDropTriggersAnAlert(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	stub.nextTx("prefs-other")
+	if contract.SetAlertPreference(asUser(stub, "bob"), "alice", `{"portfolioDropPercent":0.05}`) == nil {
+		t.Error("bob set alice's alert preference")
+	}
+	for _, prefs := range []string{`{"portfolioDropPercent":1}`, `{"portfolioBelow":-1}`, `not json`} {
+		if contract.SetAlertPreference(asUser(stub, "alice"), "alice", prefs) == nil {
+			t.Errorf("preference %s was accepted", prefs)
+		}
+	}
+	stub.nextTx("prefs")
+	err = contract.SetAlertPreference(asUser(stub, "alice"), "alice", `{"portfolioDropPercent":0.05,"portfolioBelow":9000}`)
+	if err != nil {
+		t.Fatalf("SetAlertPreference: %v", err)
+	}
+	preference, err := contract.GetAlertPreference(asUser(stub, "alice"), "alice")
+	if err != nil || !approxEqual(preference.ReferenceValue, 10000) {
+		t.Fatalf("preference = %+v, %v; want a reference of 10000", preference, err)
+	}
+
+	stub.nextTx("check-quiet")
+	if _, err := contract.CheckAndEmitAlerts(asUser(stub, "alice")); err == nil {
+		t.Error("non-admin checked alerts")
+	}
+	alerts, err := contract.CheckAndEmitAlerts(asAdmin(stub))
+	if err != nil || len(alerts) != 0 || stub.events["AlertTriggered"] != nil {
+		t.Fatalf("alerts before any move = %v, %v", alerts, err)
+	}
+
+	// Gold falls by two fifths, taking the portfolio under 9000
+	stub.nextTx("price")
+	err = contract.SetManualPrice(asAdmin(stub), "BGT", 3480, "2026-02-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("SetManualPrice: %v", err)
+	}
+	stub.nextTx("check-drop")
+	alerts, err = contract.CheckAndEmitAlerts(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("CheckAndEmitAlerts: %v", err)
+	}
+	if len(alerts) != 2 || alerts[0].Kind != "PORTFOLIO_DROP" || alerts[1].Kind != "PORTFOLIO_BELOW" {
+		t.Fatalf("alerts after the drop = %+v", alerts)
+	}
+	if alerts[0].UserID != "alice" || !approxEqual(alerts[0].ReferenceValue, 10000) || alerts[0].Value >= 9500 {
+		t.Errorf("drop alert = %+v", alerts[0])
+	}
+
+	var event AlertTriggeredEvent
+	err = json.Unmarshal(stub.events["AlertTriggered"], &event)
+	if err != nil || len(event.Alerts) != 2 || event.Alerts[0].UserID != "alice" {
+		t.Errorf("AlertTriggered event = %s, %v", stub.events["AlertTriggered"], err)
+	}
+
+	// Alerts do not repeat until the portfolio moves again
+	delete(stub.events, "AlertTriggered")
+	stub.nextTx("check-again")
+	alerts, err = contract.CheckAndEmitAlerts(asAdmin(stub))
+	if err != nil || len(alerts) != 0 || stub.events["AlertTriggered"] != nil {
+		t.Errorf("repeated alerts = %+v, %v", alerts, err)
+	}
+}
+
+func TestReverseTransferWithinTheWindow(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint1")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	holdingValue := func(userID string) float64 {
+		t.Helper()
+		tokens, err := contract.GetUserMBTTokens(asAdmin(stub), userID)
+		if err != nil {
+			t.Fatalf("GetUserMBTTokens: %v", err)
+		}
+		total := 0.0
+		for _, token := range tokens {
+			total += token.TotalValue
+		}
+		return total
+	}
+	transfer := func(txID, tokenID, from, to string, amount float64) *TransferRecord {
+		t.Helper()
+		stub.nextTx(txID)
+		err := contract.TransferMBT(asUser(stub, from), tokenID, amount, from, to)
+		if err != nil {
+			t.Fatalf("TransferMBT %s: %v", txID, err)
+		}
+		record, err := contract.GetTransferRecord(asAdmin(stub), txID)
+		if err != nil {
+			t.Fatalf("GetTransferRecord %s: %v", txID, err)
+		}
+		return record
+	}
+
+	mistaken := transfer("xfer1", "MBT-mint1", "alice", "bob", 1000)
+	stub.nextTx("reverse-user")
+	if contract.ReverseTransfer(asUser(stub, "alice"), "xfer1") == nil {
+		t.Error("non-admin reversed a transfer")
+	}
+	stub.nextTx("reverse1")
+	err = contract.ReverseTransfer(asAdmin(stub), "xfer1")
+	if err != nil {
+		t.Fatalf("ReverseTransfer in window: %v", err)
+	}
+	if !approxEqual(holdingValue("alice"), 10000) || holdingValue("bob") != 0 {
+		t.Errorf("after reversal alice holds %v, bob %v", holdingValue("alice"), holdingValue("bob"))
+	}
+	record, err := contract.GetTransferRecord(asAdmin(stub), "xfer1")
+	if err != nil || record.ReversedBy != "reverse1" || record.ReversedAt == "" {
+		t.Errorf("reversed record = %+v, %v", record, err)
+	}
+	reversal, err := contract.GetTransferRecord(asAdmin(stub), "reverse1")
+	if err != nil || reversal.ReversalOf != "xfer1" || reversal.FromUserID != "bob" ||
+		reversal.ToUserID != "alice" || reversal.FromTokenID != mistaken.ToTokenID || !approxEqual(reversal.Amount, 1000) {
+		t.Errorf("reversal record = %+v, %v", reversal, err)
+	}
+	stub.nextTx("reverse-again")
+	if contract.ReverseTransfer(asAdmin(stub), "xfer1") == nil {
+		t.Error("a transfer was reversed twice")
+	}
+	if contract.ReverseTransfer(asAdmin(stub), "reverse1") == nil {
+		t.Error("a reversal was reversed")
+	}
+
+	// Once the recipient passes the value on, it cannot be pulled back
+	passedOn := transfer("xfer2", "MBT-mint1", "alice", "bob", 1000)
+	transfer("xfer3", passedOn.ToTokenID, "bob", "carol", 1000)
+	stub.nextTx("reverse2")
+	if contract.ReverseTransfer(asAdmin(stub), "xfer2") == nil {
+		t.Error("reversed a transfer whose value moved on")
+	}
+
+	// Past the window the transfer stands
+	transfer("xfer4", "MBT-mint1", "alice", "bob", 1000)
+	stub.txTime = stub.txTime.Add(DEFAULT_REVERSAL_WINDOW_HOURS * time.Hour)
+	stub.nextTx("reverse4")
+	if contract.ReverseTransfer(asAdmin(stub), "xfer4") == nil {
+		t.Error("reversed a transfer outside the window")
+	}
+	if !approxEqual(holdingValue("bob"), 1000) {
+		t.Errorf("bob holds %v after the rejected reversal, want 1000", holdingValue("bob"))
+	}
+
+	// A longer window brings it back in reach
+	stub.nextTx("window")
+	err = contract.SetReversalWindowHours(asAdmin(stub), 48)
+	if err != nil {
+		t.Fatalf("SetReversalWindowHours: %v", err)
+	}
+	stub.nextTx("reverse4-wider")
+	err = contract.ReverseTransfer(asAdmin(stub), "xfer4")
+	if err != nil {
+		t.Errorf("ReverseTransfer in the wider window: %v", err)
+	}
+	if holdingValue("bob") != 0 {
+		t.Errorf("bob holds %v after the reversal, want 0", holdingValue("bob"))
+	}
+}
+
+func TestBackingRatioFlagsUnderCollateralization(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	backing, err := contract.GetBasketBackingRatio(asUser(stub, "auditor"))
+	if err != nil || backing.Ratio != 0 || backing.UnderCollateralized {
+		t.Errorf("empty basket backing = %+v, %v", backing, err)
+	}
+
+	stub.nextTx("mint1")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	backing, err = contract.GetBasketBackingRatio(asUser(stub, "auditor"))
+	if err != nil {
+		t.Fatalf("GetBasketBackingRatio: %v", err)
+	}
+	if !approxEqual(backing.Ratio, 1) || backing.UnderCollateralized ||
+		!approxEqual(backing.TotalBacking, backing.MetalValue+backing.Cash) || len(backing.Metals) != 3 {
+		t.Errorf("fully backed basket = %+v", backing)
+	}
+	for _, metal := range backing.Metals {
+		if !approxEqual(metal.Ratio, 1) || !approxEqual(metal.Value, metal.Grams*metal.Price) {
+			t.Errorf("%s backing at mint = %+v", metal.Metal, metal)
+		}
+	}
+
+	// Platinum halves: the basket is short by half the platinum share
+	stub.nextTx("price")
+	err = contract.SetManualPrice(asAdmin(stub), "BPT", 1600, "2026-02-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("SetManualPrice: %v", err)
+	}
+	under, err := contract.GetBasketBackingRatio(asUser(stub, "auditor"))
+	if err != nil {
+		t.Fatalf("GetBasketBackingRatio: %v", err)
+	}
+	platinum := backing.Metals[2]
+	if !under.UnderCollateralized || !approxEqual(under.SupplyNotional, backing.SupplyNotional) ||
+		!approxEqual(under.Ratio, (backing.TotalBacking-platinum.Value/2)/backing.SupplyNotional) {
+		t.Errorf("under-backed basket = %+v", under)
+	}
+	if under.Metals[2].Metal != "BPT" || !approxEqual(under.Metals[2].Ratio, 0.5) || !approxEqual(under.Metals[0].Ratio, 1) {
+		t.Errorf("per-metal backing after the fall = %+v", under.Metals)
+	}
+}
+
+func TestManualPriceOverridesTheFeedUntilExpiry(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	oraclePrices := `{"gold":5900,"silver":76,"platinum":3250}`
+	stub.invoke["oracle1"] = map[string]func(args [][]byte) peer.Response{
+		"getMetalPrices": func(args [][]byte) peer.Response {
+			if oraclePrices == "" {
+				return peer.Response{Status: shim.ERROR, Message: "oracle down"}
+			}
+			return peer.Response{Status: shim.OK, Payload: []byte(oraclePrices)}
+		},
+	}
+	err := contract.SetOracleQuorum(asAdmin(stub), `{"oracles":["oracle1"],"quorum":1,"tolerancePercent":2}`)
+	if err != nil {
+		t.Fatalf("SetOracleQuorum: %v", err)
+	}
+	expectPrices := func(when string, want map[string]float64) {
+		t.Helper()
+		prices, err := contract.GetMBTPrices(asUser(stub, "alice"))
+		if err != nil {
+			t.Fatalf("%s: GetMBTPrices: %v", when, err)
+		}
+		if !reflect.DeepEqual(prices, want) {
+			t.Errorf("%s: prices = %v, want %v", when, prices, want)
+		}
+	}
+
+	inAnHour := stub.txTime.Add(time.Hour).Format(time.RFC3339)
+	stub.nextTx("manual-rejected")
+	if contract.SetManualPrice(asUser(stub, "alice"), "BGT", 6000, inAnHour) == nil {
+		t.Error("non-admin set a manual price")
+	}
+	if contract.SetManualPrice(asAdmin(stub), "BGT", 0, inAnHour) == nil {
+		t.Error("zero manual price accepted")
+	}
+	if contract.SetManualPrice(asAdmin(stub), "BGT", 6000, stub.txTime.Format(time.RFC3339)) == nil {
+		t.Error("manual price expiring now accepted")
+	}
+
+	stub.nextTx("manual-gold")
+	err = contract.SetManualPrice(asAdmin(stub), "gold", 6000, inAnHour)
+	if err != nil {
+		t.Fatalf("SetManualPrice: %v", err)
+	}
+	expectPrices("override", map[string]float64{"BGT": 6000, "BST": 76, "BPT": 3250})
+	price, err := contract.GetMetalPrice(asUser(stub, "alice"), "BGT")
+	if err != nil || price.Price != 6000 || price.Source != "manual" {
+		t.Errorf("gold price = %+v, %v; want 6000 from manual", price, err)
+	}
+
+	// With every metal overridden the feed is not needed at all
+	for _, metal := range []string{"BST", "BPT"} {
+		stub.nextTx("manual-" + metal)
+		err = contract.SetManualPrice(asAdmin(stub), metal, 100, inAnHour)
+		if err != nil {
+			t.Fatalf("SetManualPrice %s: %v", metal, err)
+		}
+	}
+	oraclePrices = ""
+	expectPrices("feed down", map[string]float64{"BGT": 6000, "BST": 100, "BPT": 100})
+
+	stub.nextTx("clear")
+	if contract.ClearManualPrice(asUser(stub, "alice"), "BST") == nil {
+		t.Error("non-admin cleared a manual price")
+	}
+	err = contract.ClearManualPrice(asAdmin(stub), "BST")
+	if err != nil {
+		t.Fatalf("ClearManualPrice: %v", err)
+	}
+	if err := contract.ClearManualPrice(asAdmin(stub), "BST"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("clearing again: got %v, want ErrNotFound", err)
+	}
+	oraclePrices = `{"gold":5900,"silver":76,"platinum":3250}`
+	expectPrices("cleared", map[string]float64{"BGT": 6000, "BST": 76, "BPT": 100})
+
+	// Once expired, the overrides give way to the feed
+	stub.txTime = stub.txTime.Add(time.Hour)
+	stub.nextTx("expired")
+	expectPrices("expired", map[string]float64{"BGT": 5900, "BST": 76, "BPT": 3250})
+	price, err = contract.GetMetalPrice(asUser(stub, "alice"), "BGT")
+	if err != nil || price.Price != 5900 || price.Source != "quorum" {
+		t.Errorf("gold price after expiry = %+v, %v; want 5900 from the quorum", price, err)
+	}
+}
+
+func TestUserAllocationOfDriftedTokens(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+	targets, err := contract.GetBasketCompositionTargets(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetBasketCompositionTargets: %v", err)
+	}
+
+	stub.nextTx("mint1")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	allocation, err := contract.GetUserAllocation(asUser(stub, "alice"), "alice")
+	if err != nil {
+		t.Fatalf("GetUserAllocation: %v", err)
+	}
+	if allocation.MaxDeviation > 1e-9 {
+		t.Errorf("freshly minted allocation deviates: %+v", allocation)
+	}
+
+	// Gold doubles, so the first token drifts gold-heavy while a new mint is on target
+	stub.nextTx("price")
+	err = contract.SetManualPrice(asAdmin(stub), "BGT", 11600, "2026-02-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("SetManualPrice: %v", err)
+	}
+	stub.nextTx("mint2")
+	err = contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+	first, second := getTestToken(t, stub, "MBT-mint1"), getTestToken(t, stub, "MBT-mint2")
+	values := map[string]float64{
+		"BGT": (first.BGTGrams + second.BGTGrams) * 11600,
+		"BST": (first.BSTGrams + second.BSTGrams) * 75,
+		"BPT": (first.BPTGrams + second.BPTGrams) * 3200,
+	}
+	total := values["BGT"] + values["BST"] + values["BPT"]
+
+	for _, mode := range []string{DEVIATION_ABSOLUTE, DEVIATION_RELATIVE} {
+		stub.nextTx("mode-" + mode)
+		err = contract.SetDeviationMode(asAdmin(stub), mode)
+		if err != nil {
+			t.Fatalf("SetDeviationMode: %v", err)
+		}
+		allocation, err = contract.GetUserAllocation(asUser(stub, "alice"), "alice")
+		if err != nil {
+			t.Fatalf("GetUserAllocation: %v", err)
+		}
+		if allocation.DeviationMode != mode || !approxEqual(allocation.TotalValue, total) || len(allocation.Metals) != 3 {
+			t.Fatalf("%s allocation = %+v, want %v across three metals", mode, allocation, total)
+		}
+		maxDeviation := 0.0
+		for _, metal := range allocation.Metals {
+			share, target := values[metal.Metal]/total, targets[metal.Metal]
+			deviation := share - target
+			if mode == DEVIATION_RELATIVE {
+				deviation /= target
+			}
+			maxDeviation = math.Max(maxDeviation, math.Abs(deviation))
+			if !approxEqual(metal.Percent, share*100) || !approxEqual(metal.TargetPercent, target*100) ||
+				!approxEqual(metal.Deviation, deviation) {
+				t.Errorf("%s %s = %+v, want %v%% against %v%%, deviation %v", mode, metal.Metal, metal,
+					share*100, target*100, deviation)
+			}
+		}
+		if allocation.Metals[0].Deviation <= 0 || !approxEqual(allocation.MaxDeviation, maxDeviation) {
+			t.Errorf("%s: gold deviation %v, max %v, want gold overweight and max %v", mode,
+				allocation.Metals[0].Deviation, allocation.MaxDeviation, maxDeviation)
+		}
+	}
+
+	empty, err := contract.GetUserAllocation(asUser(stub, "bob"), "bob")
+	if err != nil || empty.TotalValue != 0 || empty.MaxDeviation != 0 {
+		t.Errorf("allocation without tokens = %+v, %v", empty, err)
+	}
+}
+
+func TestOperationsPauseIndependently(t *testing.T) {
+	contract := &MBTBasketContract{}
+	stub := newBasketStub()
+
+	stub.nextTx("mint0")
+	err := contract.MintMBT(asUser(stub, "alice"), "alice", 10000, "alice")
+	if err != nil {
+		t.Fatalf("MintMBT: %v", err)
+	}
+
+	attempts := 0
+	operations := map[string]func() error{
+		PAUSE_MINT: func() error { return contract.MintMBT(asUser(stub, "alice"), "alice", 1000, "alice") },
+		PAUSE_REDEEM: func() error {
+			return contract.RedeemMBT(asUser(stub, "alice"), "MBT-mint0", 10, "alice")
+		},
+		PAUSE_REBALANCE: func() error { return contract.RebalanceBasket(asAdmin(stub)) },
+		PAUSE_TRANSFER: func() error {
+			return contract.TransferMBT(asUser(stub, "alice"), "MBT-mint0", 10, "alice", "bob")
+		},
+	}
+	expectPaused := func(when string, paused map[string]bool) {
+		t.Helper()
+		for operation, attempt := range operations {
+			attempts++
+			stub.nextTx(fmt.Sprintf("attempt%d", attempts))
+			err := attempt()
+			blocked := err != nil && strings.Contains(err.Error(), "paused")
+			if blocked != paused[operation] || (err != nil && !blocked) {
+				t.Errorf("%s: %s got %v, paused %v", when, operation, err, paused[operation])
+			}
+		}
+	}
+	setPaused := func(operation string, paused bool) {
+		t.Helper()
+		stub.nextTx("pause-" + operation)
+		err := contract.SetOperationPaused(asAdmin(stub), operation, paused)
+		if err != nil {
+			t.Fatalf("SetOperationPaused(%s, %v): %v", operation, paused, err)
+		}
+	}
+
+	stub.nextTx("pause-rejected")
+	if contract.SetOperationPaused(asUser(stub, "alice"), PAUSE_MINT, true) == nil {
+		t.Error("non-admin paused minting")
+	}
+	if contract.SetOperationPaused(asAdmin(stub), "BURN", true) == nil {
+		t.Error("an unknown operation was paused")
+	}
+	expectPaused("nothing paused", nil)
+
+	for operation := range operations {
+		setPaused(strings.ToLower(operation), true)
+		flags, err := contract.GetPauseFlags(asUser(stub, "alice"))
+		if err != nil {
+			t.Fatalf("GetPauseFlags: %v", err)
+		}
+		set := map[string]bool{PAUSE_MINT: flags.MintPaused, PAUSE_REDEEM: flags.RedeemPaused,
+			PAUSE_REBALANCE: flags.RebalancePaused, PAUSE_TRANSFER: flags.TransferPaused}
+		if !reflect.DeepEqual(set, map[string]bool{PAUSE_MINT: false, PAUSE_REDEEM: false,
+			PAUSE_REBALANCE: false, PAUSE_TRANSFER: false, operation: true}) {
+			t.Errorf("flags with %s paused = %+v", operation, flags)
+		}
+		expectPaused(operation+" paused", map[string]bool{operation: true})
+		setPaused(operation, false)
+	}
+
+	// The global pause sets and clears every flag
+	stub.nextTx("pause-all")
+	err = contract.SetPaused(asAdmin(stub), true)
+	if err != nil {
+		t.Fatalf("SetPaused: %v", err)
+	}
+	expectPaused("all paused", map[string]bool{PAUSE_MINT: true, PAUSE_REDEEM: true, PAUSE_REBALANCE: true, PAUSE_TRANSFER: true})
+	setPaused(PAUSE_ALL, false)
+	expectPaused("all resumed", nil)
+}
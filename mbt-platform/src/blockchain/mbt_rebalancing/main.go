@@ -0,0 +1,22 @@
+// MBT Rebalancing Chaincode entry point
+
+package main
+
+import (
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"github.com/jitenkr2030/Metal-Basket-Tokens-MBT/mbt-platform/src/blockchain"
+)
+
+func main() {
+	chaincode, err := contractapi.NewChaincode(new(blockchain.MBTRebalancingContract))
+	if err != nil {
+		log.Panicf("Error creating MBT rebalancing chaincode: %v", err)
+	}
+
+	if err := chaincode.Start(); err != nil {
+		log.Panicf("Error starting MBT rebalancing chaincode: %v", err)
+	}
+}
@@ -1,15 +1,18 @@
 // MBT Rebalancing Chaincode - Automated portfolio rebalancing
 // Handles time-based and deviation-based rebalancing of metal basket tokens
 
-package main
+package blockchain
 
 import (
 	"encoding/json"
 	"fmt"
 	"log"
 	"math"
+	"sort"
+	"strconv"
 	"time"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
@@ -22,10 +25,158 @@ type RebalanceRequest struct {
 	CurrentAlloc  map[string]float64 `json:"currentAllocation"` // Current percentages
 	TargetAlloc   map[string]float64 `json:"targetAllocation"` // Target percentages
 	Deviations    map[string]float64 `json:"deviations"`       // Deviations from target
-	Status        string    `json:"status"`         // "PENDING", "APPROVED", "EXECUTED", "FAILED"
+	Status        RequestStatus `json:"status"`
 	CreatedAt     string    `json:"createdAt"`
+	ApprovedAt    string    `json:"approvedAt"`
+	ApprovedBy    string    `json:"approvedBy"` // Verified identity of the final approver
+	Approvals     []RequestApproval `json:"approvals"` // Multi-signature approvals collected so far
 	ExecutedAt    string    `json:"executedAt"`
 	ApprovalRequired bool   `json:"approvalRequired"`
+	BasketValue   float64   `json:"basketValue"` // Total metal value when the request was created
+	SupersededReason string `json:"supersededReason,omitempty"` // Why execution was skipped as no longer needed
+	CompletionFraction float64 `json:"completionFraction,omitempty"` // Share of each trade executed so far
+}
+
+// RequestStatus is the lifecycle state of a rebalance request
+type RequestStatus string
+
+// Rebalance request statuses; see canTransition for the allowed changes
+const (
+	STATUS_PENDING  RequestStatus = "PENDING"
+	STATUS_APPROVED RequestStatus = "APPROVED"
+	STATUS_EXECUTED RequestStatus = "EXECUTED"
+	STATUS_FAILED   RequestStatus = "FAILED"
+	STATUS_EXPIRED  RequestStatus = "EXPIRED"
+	STATUS_SUPERSEDED RequestStatus = "SUPERSEDED" // Deviation back within band before execution
+	STATUS_PARTIAL  RequestStatus = "PARTIALLY_EXECUTED" // Some tranches executed, the rest still to run
+)
+
+// requestTransitions lists the statuses each status may move to. EXECUTED, EXPIRED
+// and SUPERSEDED are final; a PARTIALLY_EXECUTED request runs further tranches, and
+// a FAILED request can still complete via ResumeRebalance.
+var requestTransitions = map[RequestStatus][]RequestStatus{
+	STATUS_PENDING:  {STATUS_APPROVED, STATUS_EXECUTED, STATUS_PARTIAL, STATUS_FAILED, STATUS_EXPIRED, STATUS_SUPERSEDED},
+	STATUS_APPROVED: {STATUS_EXECUTED, STATUS_PARTIAL, STATUS_FAILED, STATUS_EXPIRED, STATUS_SUPERSEDED},
+	STATUS_PARTIAL:  {STATUS_PARTIAL, STATUS_EXECUTED, STATUS_FAILED, STATUS_SUPERSEDED},
+	STATUS_FAILED:   {STATUS_EXECUTED},
+}
+
+// canTransition reports whether a request may move from one status to another
+func canTransition(from, to RequestStatus) bool {
+	for _, allowed := range requestTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// setRequestStatus changes a request's status, rejecting illegal transitions, and
+// notes the move in counts. All status changes go through here; the caller stores
+// the request and the counts.
+func setRequestStatus(request *RebalanceRequest, status RequestStatus, counts requestCounts) error {
+	if !canTransition(request.Status, status) {
+		return fmt.Errorf("illegal status transition for request %s: %s to %s", 
+			request.RequestID, request.Status, status)
+	}
+	counts[request.Status]--
+	counts[status]++
+	request.Status = status
+	return nil
+}
+
+// requestCounts accumulates one transaction's changes to the per-status request
+// counters, so each counter is written once however many requests move
+type requestCounts map[RequestStatus]int
+
+// requestStatuses lists every status in a fixed order for iterating the counters
+var requestStatuses = []RequestStatus{STATUS_PENDING, STATUS_APPROVED, STATUS_EXECUTED, STATUS_FAILED, STATUS_EXPIRED, 
+	STATUS_SUPERSEDED, STATUS_PARTIAL}
+
+// store adds the accumulated changes to the REQUEST_COUNT_<status> counters
+func (counts requestCounts) store(ctx contractapi.TransactionContextInterface) error {
+	for _, status := range requestStatuses {
+		if counts[status] == 0 {
+			continue
+		}
+
+		count, err := getRequestCount(ctx, status)
+		if err != nil {
+			return err
+		}
+
+		err = putRequestCount(ctx, status, count+counts[status])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getRequestCount reads the number of requests in a status
+func getRequestCount(ctx contractapi.TransactionContextInterface, status RequestStatus) (int, error) {
+	countBytes, err := ctx.GetStub().GetState("REQUEST_COUNT_" + string(status))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s request count: %v", status, err)
+	}
+
+	if countBytes == nil {
+		return 0, nil
+	}
+
+	count, err := strconv.Atoi(string(countBytes))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s request count: %v", status, err)
+	}
+
+	return count, nil
+}
+
+// putRequestCount stores the number of requests in a status
+func putRequestCount(ctx contractapi.TransactionContextInterface, status RequestStatus, count int) error {
+	err := ctx.GetStub().PutState("REQUEST_COUNT_"+string(status), []byte(strconv.Itoa(count)))
+	if err != nil {
+		return fmt.Errorf("failed to store %s request count: %v", status, err)
+	}
+	return nil
+}
+
+// RequestStatusCounts is the number of rebalance requests in each status
+type RequestStatusCounts struct {
+	Counts map[RequestStatus]int `json:"counts"`
+	Total  int                   `json:"total"`
+}
+
+// ApprovalStatus is a request's progress toward its approval threshold
+type ApprovalStatus struct {
+	RequestID         string        `json:"requestId"`
+	Status            RequestStatus `json:"status"`
+	RequiredApprovals int           `json:"requiredApprovals"` // Zero when no approval is required
+	Approvers         []string      `json:"approvers"`
+	Remaining         int           `json:"remaining"`
+	RequiredWeight    float64       `json:"requiredWeight"`  // Zero unless the policy weights approvals
+	CollectedWeight   float64       `json:"collectedWeight"`
+	ReadyToExecute    bool          `json:"readyToExecute"`
+}
+
+// RebalanceRequestCreatedEvent is the payload of the RebalanceRequestCreated event
+type RebalanceRequestCreatedEvent struct {
+	EventSeq         uint64  `json:"eventSeq"`
+	RequestID        string  `json:"requestId"`
+	TriggerType      string  `json:"triggerType"`
+	ApprovalRequired bool    `json:"approvalRequired"`
+	MaxTradeAmount   float64 `json:"maxTradeAmount"`
+}
+
+// setEventSeq implements sequencedEvent
+func (e *RebalanceRequestCreatedEvent) setEventSeq(seq uint64) { e.EventSeq = seq }
+
+// RequestApproval records one approver's signature on a rebalance request
+type RequestApproval struct {
+	Approver   string  `json:"approver"`
+	ApprovedAt string  `json:"approvedAt"`
+	Role       string  `json:"role,omitempty"`
+	Weight     float64 `json:"weight"`
 }
 
 // RebalanceOperation represents a specific metal allocation operation
@@ -38,8 +189,23 @@ type RebalanceOperation struct {
 	CurrentPrice  float64 `json:"currentPrice"`
 	EstimatedCost float64 `json:"estimatedCost"`
 	Timestamp     string  `json:"timestamp"`
+	Flagged       bool    `json:"flagged"`    // Marked for manual review
+	FlagReason    string  `json:"flagReason"`
+	FlaggedAt     string  `json:"flaggedAt"`
+	Status        string  `json:"status"`     // OPERATION_PENDING, OPERATION_EXECUTED or OPERATION_FAILED
+	ExecutedAt    string  `json:"executedAt"`
+	ExecutedAmount float64 `json:"executedAmount,omitempty"` // Traded so far when executed in tranches
+	Error         string  `json:"error,omitempty"` // Why the last execution attempt failed
+	SubstitutedFor string `json:"substitutedFor,omitempty"` // Unavailable metal this buy stands in for
 }
 
+// Rebalance operation execution statuses
+const (
+	OPERATION_PENDING  = "PENDING"
+	OPERATION_EXECUTED = "EXECUTED"
+	OPERATION_FAILED   = "FAILED"
+)
+
 // RebalancePolicy defines the rebalancing rules
 type RebalancePolicy struct {
 	PolicyID              string  `json:"policyId"`
@@ -51,6 +217,208 @@ type RebalancePolicy struct {
 	RebalanceIntervalDays int     `json:"rebalanceIntervalDays"` // 30
 	MinTradeAmount        float64 `json:"minTradeAmount"`        // Minimum trade threshold
 	ApprovalThreshold     float64 `json:"approvalThreshold"`     // Amount requiring approval
+	ApprovalThresholdPercent float64 `json:"approvalThresholdPercent"` // Fraction of AUM requiring approval; zero disables
+	TradeRoundingDecimals int     `json:"tradeRoundingDecimals"` // Decimals kept on trade amounts
+	ApprovalExpirySeconds int64   `json:"approvalExpirySeconds"` // Zero disables expiry
+	ApproverMSPs          []string `json:"approverMsps"`         // MSPs whose members may approve
+	TradingFeePercent     float64 `json:"tradingFeePercent"`     // Broker fee per trade
+	SlippageBufferPercent float64 `json:"slippageBufferPercent"` // Buffer for price movement on execution
+	Currency              string  `json:"currency"`              // Denomination of trade amounts and prices
+	RequiredApprovals     int     `json:"requiredApprovals"`     // Signatures needed to approve a request
+	GlidePath             []GlidePathPoint `json:"glidePath,omitempty"` // Dated targets; overrides the static allocations
+	FeeTiers              []FeeTier `json:"feeTiers,omitempty"`  // Volume discounts; overrides TradingFeePercent
+	MinBenefitRatio       float64 `json:"minBenefitRatio"`       // Skip trades whose fee exceeds this times their benefit; zero disables
+	DeviationMode         string  `json:"deviationMode"`         // DEVIATION_ABSOLUTE or DEVIATION_RELATIVE
+	BlockDuringRebalance  bool    `json:"blockDuringRebalance"`  // Reject mints and redemptions while a rebalance is approved
+	UnavailableMetals     []string `json:"unavailableMetals,omitempty"`         // Metals that cannot currently be traded
+	SubstitutionRules     map[string]string `json:"substitutionRules,omitempty"` // Metal -> metal bought in its place while unavailable
+	AtomicRebalance       bool    `json:"atomicRebalance"`       // Execute all of a request's operations or none
+	MaxOperationsPerRebalance int `json:"maxOperationsPerRebalance"` // Cap on operations in one request; zero is unlimited
+	ApprovalWeightByRole  map[string]float64 `json:"approvalWeightByRole,omitempty"` // "approverRole" attribute -> weight; others weigh 1
+	RequiredApprovalWeight float64 `json:"requiredApprovalWeight"` // Weight needed to approve; zero counts RequiredApprovals instead
+	CompositionTolerancePercent float64 `json:"compositionTolerancePercent"` // Gap from a target weight still counted as on target; zero uses the default
+	CashBufferPercent     float64 `json:"cashBufferPercent"`     // Share of each mint held as cash; redemptions draw on it first
+}
+
+// BasketChaincodeConfig names the basket chaincode whose holdings are rebalanced
+type BasketChaincodeConfig struct {
+	Chaincode string `json:"chaincode"`
+	Channel   string `json:"channel"` // Empty for the channel this chaincode runs on
+}
+
+// FeeTier is the fee charged on trades of at least MinAmount
+type FeeTier struct {
+	MinAmount  float64 `json:"minAmount"`
+	FeePercent float64 `json:"feePercent"`
+}
+
+// GlidePathPoint is a target composition that applies from its effective date
+type GlidePathPoint struct {
+	EffectiveDate string             `json:"effectiveDate"` // YYYY-MM-DD
+	Composition   map[string]float64 `json:"composition"`   // Metal weights summing to 1.0
+}
+
+// RebalancePolicyVersion is a historical snapshot of the rebalancing policy
+type RebalancePolicyVersion struct {
+	Timestamp string          `json:"timestamp"`
+	UpdatedBy string          `json:"updatedBy"`
+	Policy    RebalancePolicy `json:"policy"`
+}
+
+// MetalDeviation describes one metal's weight against a target
+type MetalDeviation struct {
+	Metal         string  `json:"metal"`
+	CurrentWeight float64 `json:"currentWeight"`
+	TargetWeight  float64 `json:"targetWeight"`
+	Deviation     float64 `json:"deviation"` // Current minus target
+}
+
+// DeviationReport compares the basket against a set of target weights
+type DeviationReport struct {
+	TotalValue   float64          `json:"totalValue"`
+	Metals       []MetalDeviation `json:"metals"`
+	MaxDeviation float64          `json:"maxDeviation"`
+}
+
+// OperationsSummary aggregates the operations of a rebalance request
+type OperationsSummary struct {
+	OperationCount     int     `json:"operationCount"`
+	BuyCount           int     `json:"buyCount"`
+	SellCount          int     `json:"sellCount"`
+	TotalTradeAmount   float64 `json:"totalTradeAmount"`
+	TotalBuyCost       float64 `json:"totalBuyCost"`
+	TotalSellCost      float64 `json:"totalSellCost"`
+	TotalEstimatedCost float64 `json:"totalEstimatedCost"`
+}
+
+// RebalanceCostEstimate is the all-in cost of executing a rebalance request
+type RebalanceCostEstimate struct {
+	RequestID      string  `json:"requestId"`
+	Currency       string  `json:"currency"`
+	GrossCost      float64 `json:"grossCost"`      // Sum of operation traded amounts
+	TradingFees    float64 `json:"tradingFees"`
+	SlippageBuffer float64 `json:"slippageBuffer"`
+	NetCost        float64 `json:"netCost"`        // Gross cost plus fees and slippage
+	CashRequired   float64 `json:"cashRequired"`   // Buys less sells plus fees and slippage
+}
+
+// RebalanceSimulation is the projected basket allocation after a request's operations
+type RebalanceSimulation struct {
+	RequestID       string             `json:"requestId"`
+	ProjectedValues map[string]float64 `json:"projectedValues"`
+	ProjectedAlloc  map[string]float64 `json:"projectedAllocation"`
+	TargetAlloc     map[string]float64 `json:"targetAllocation"`
+	MaxDeviation    float64            `json:"maxDeviation"`
+	ExceedsBand     bool               `json:"exceedsBand"` // Plan would leave the basket out of band
+}
+
+// ProjectedDrift is the basket allocation after a hypothetical move in metal prices
+type ProjectedDrift struct {
+	PriceChanges      map[string]float64 `json:"priceChanges"`
+	ProjectedValues   map[string]float64 `json:"projectedValues"`
+	ProjectedAlloc    map[string]float64 `json:"projectedAllocation"`
+	TargetAlloc       map[string]float64 `json:"targetAllocation"`
+	MaxDeviation      float64            `json:"maxDeviation"`
+	BreachesThreshold bool               `json:"breachesThreshold"` // Move alone would trigger a rebalance
+}
+
+// ScheduledRebalanceResult reports what a scheduled rebalance run did
+type ScheduledRebalanceResult struct {
+	RunDate   string `json:"runDate"`
+	Due       bool   `json:"due"`
+	RequestID string `json:"requestId"`
+	Executed  bool   `json:"executed"`
+	Message   string `json:"message"`
+}
+
+// RebalanceStatistics summarizes executed rebalances over a period
+type RebalanceStatistics struct {
+	FromDate            string  `json:"fromDate"`
+	ToDate              string  `json:"toDate"`
+	RebalanceCount      int     `json:"rebalanceCount"`
+	AverageMaxDeviation float64 `json:"averageMaxDeviation"` // Max deviation at trigger, averaged
+	TotalTradedValue    float64 `json:"totalTradedValue"`
+	TotalFees           float64 `json:"totalFees"`
+	TimeTriggered       int     `json:"timeTriggered"`
+	DeviationTriggered  int     `json:"deviationTriggered"`
+}
+
+// RequestSavings compares one executed rebalance with a full reversion to target
+type RequestSavings struct {
+	RequestID          string  `json:"requestId"`
+	TradedValue        float64 `json:"tradedValue"`        // Executed operations
+	FullReversionValue float64 `json:"fullReversionValue"` // Every deviation traded back to target
+	Fees               float64 `json:"fees"`
+	FullReversionFees  float64 `json:"fullReversionFees"`
+	FeeSavings         float64 `json:"feeSavings"`
+}
+
+// RebalanceSavings totals the fees the policy's trade filters saved over a period
+type RebalanceSavings struct {
+	FromDate           string            `json:"fromDate"`
+	ToDate             string            `json:"toDate"`
+	RebalanceCount     int               `json:"rebalanceCount"`
+	TradedValue        float64           `json:"tradedValue"`
+	FullReversionValue float64           `json:"fullReversionValue"`
+	Fees               float64           `json:"fees"`
+	FullReversionFees  float64           `json:"fullReversionFees"`
+	FeeSavings         float64           `json:"feeSavings"`
+	ExcludedRequests   int               `json:"excludedRequests"` // Executed before the basket value was recorded
+	Requests           []*RequestSavings `json:"requests"`
+}
+
+// SelfTestCheck is the outcome of one readiness check
+type SelfTestCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+// SelfTestReport is the result of a chaincode readiness probe
+type SelfTestReport struct {
+	Healthy bool            `json:"healthy"` // All checks passed
+	Checks  []SelfTestCheck `json:"checks"`
+}
+
+// RebalanceEfficiency scores how much allocation error a rebalance removed for its cost
+type RebalanceEfficiency struct {
+	RequestID          string             `json:"requestId"`
+	PreMaxDeviation    float64            `json:"preMaxDeviation"`
+	PostMaxDeviation   float64            `json:"postMaxDeviation"`
+	PostTradeAlloc     map[string]float64 `json:"postTradeAllocation"`
+	DeviationReduction float64            `json:"deviationReduction"` // Pre minus post; negative if the trades made drift worse
+	TotalCost          float64            `json:"totalCost"`          // Trading fees on executed operations
+	Score              float64            `json:"score"`              // Value of deviation removed per unit of cost; zero without cost
+}
+
+// RebalanceRequestDetail is a request together with its operations and their totals
+type RebalanceRequestDetail struct {
+	Request    *RebalanceRequest     `json:"request"`
+	Operations []*RebalanceOperation `json:"operations"`
+	Summary    OperationsSummary     `json:"summary"`
+}
+
+// RequestAuditTrail gathers every record of one rebalance request for audit export
+type RequestAuditTrail struct {
+	Request           *RebalanceRequest     `json:"request"`
+	Approvals         []RequestApproval     `json:"approvals"`
+	ApprovalStatus    *ApprovalStatus       `json:"approvalStatus"`
+	Operations        []*RebalanceOperation `json:"operations"` // With execution status, time and error
+	Summary           OperationsSummary     `json:"summary"`
+	FlaggedOperations []*RebalanceOperation `json:"flaggedOperations"`
+	FailedOperations  []*RebalanceOperation `json:"failedOperations"`
+}
+
+// TradeLedgerEntry is one executed trade, flattened for CSV export
+type TradeLedgerEntry struct {
+	RequestID     string  `json:"requestId"`
+	OperationID   string  `json:"operationId"`
+	Metal         string  `json:"metal"`
+	Side          string  `json:"side"` // "BUY" or "SELL"
+	Amount        float64 `json:"amount"`
+	ExecutedPrice float64 `json:"executedPrice"` // Per gram
+	Cost          float64 `json:"cost"`          // Traded value in the policy currency
+	ExecutedAt    string  `json:"executedAt"`
 }
 
 // MBTRebalancingContract handles automated rebalancing operations
@@ -70,8 +438,117 @@ func (c *MBTRebalancingContract) InitializePolicy(ctx contractapi.TransactionCon
 		RebalanceIntervalDays: 30,
 		MinTradeAmount:       1000.0, // Minimum 1000 INR trade
 		ApprovalThreshold:    100000.0, // Requires approval for trades > 100k INR
+		TradeRoundingDecimals: 2,       // Round trades to the paise
+		ApprovalExpirySeconds: 86400,   // Approvals are valid for one day
+		TradingFeePercent:     0.001,   // 0.1% broker fee
+		SlippageBufferPercent: 0.005,   // 0.5% slippage buffer
+		Currency:              BASE_CURRENCY,
+		RequiredApprovals:     1,
+		DeviationMode:         DEVIATION_ABSOLUTE,
+		CompositionTolerancePercent: COMPOSITION_TOLERANCE_PERCENT,
+	}
+
+	err := c.putRebalancePolicy(ctx, &policy)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Initialized MBT rebalancing policy")
+	return nil
+}
+
+// UpdateRebalancePolicy replaces the active rebalancing policy (admin only)
+func (c *MBTRebalancingContract) UpdateRebalancePolicy(ctx contractapi.TransactionContextInterface, policyJSON string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	var policy RebalancePolicy
+	err = json.Unmarshal([]byte(policyJSON), &policy)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal policy: %v", err)
+	}
+
+	totalAllocation := policy.GoldAllocation + policy.SilverAllocation + policy.PlatinumAllocation
+	if math.Abs(totalAllocation-1.0) > 1e-9 {
+		return fmt.Errorf("allocations must sum to 1.0, got %.4f", totalAllocation)
+	}
+
+	if policy.GoldAllocation < 0 || policy.SilverAllocation < 0 || policy.PlatinumAllocation < 0 {
+		return fmt.Errorf("allocations must not be negative")
+	}
+
+	if policy.MaxDeviationPercent <= 0 {
+		return fmt.Errorf("max deviation percent must be positive")
+	}
+
+	if policy.MinTradeAmount < 0 || policy.ApprovalThreshold < 0 {
+		return fmt.Errorf("trade thresholds must not be negative")
+	}
+
+	if policy.ApprovalThresholdPercent < 0 || policy.ApprovalThresholdPercent > 1 {
+		return fmt.Errorf("approval threshold percent must be in [0, 1]")
+	}
+
+	if policy.MinBenefitRatio < 0 {
+		return fmt.Errorf("min benefit ratio must not be negative")
+	}
+
+	if policy.MaxOperationsPerRebalance < 0 {
+		return fmt.Errorf("max operations per rebalance must not be negative")
+	}
+
+	if policy.CashBufferPercent < 0 || policy.CashBufferPercent >= 1 {
+		return fmt.Errorf("cash buffer percent must be in [0, 1)")
+	}
+
+	if policy.CompositionTolerancePercent < 0 || policy.CompositionTolerancePercent > 1 {
+		return fmt.Errorf("composition tolerance percent must be in [0, 1]")
+	}
+
+	if policy.RequiredApprovalWeight < 0 {
+		return fmt.Errorf("required approval weight must not be negative")
 	}
+	for role, weight := range policy.ApprovalWeightByRole {
+		if weight <= 0 {
+			return fmt.Errorf("approval weight for role %s must be positive", role)
+		}
+	}
+
+	if policy.DeviationMode == "" {
+		policy.DeviationMode = DEVIATION_ABSOLUTE
+	}
+	if policy.DeviationMode != DEVIATION_ABSOLUTE && policy.DeviationMode != DEVIATION_RELATIVE {
+		return fmt.Errorf("unknown deviation mode %s", policy.DeviationMode)
+	}
+
+	err = validateGlidePath(policy.GlidePath)
+	if err != nil {
+		return err
+	}
+
+	err = validateFeeTiers(policy.FeeTiers)
+	if err != nil {
+		return err
+	}
+
+	err = validateSubstitutions(&policy)
+	if err != nil {
+		return err
+	}
+
+	err = c.putRebalancePolicy(ctx, &policy)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Updated rebalancing policy: %s", policy.PolicyID)
+	return nil
+}
 
+// putRebalancePolicy stores the active policy and records it in the version history
+func (c *MBTRebalancingContract) putRebalancePolicy(ctx contractapi.TransactionContextInterface, policy *RebalancePolicy) error {
 	policyJSON, err := json.Marshal(policy)
 	if err != nil {
 		return fmt.Errorf("failed to marshal policy: %v", err)
@@ -82,10 +559,68 @@ func (c *MBTRebalancingContract) InitializePolicy(ctx contractapi.TransactionCon
 		return fmt.Errorf("failed to store policy: %v", err)
 	}
 
-	log.Println("Initialized MBT rebalancing policy")
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	updatedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	version := RebalancePolicyVersion{
+		Timestamp: timestamp,
+		UpdatedBy: updatedBy,
+		Policy:    *policy,
+	}
+
+	versionJSON, err := json.Marshal(version)
+	if err != nil {
+		return fmt.Errorf("failed to marshal policy version: %v", err)
+	}
+
+	versionKey, err := ctx.GetStub().CreateCompositeKey("PolicyVersion", []string{timestamp})
+	if err != nil {
+		return fmt.Errorf("failed to create policy version key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(versionKey, versionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store policy version: %v", err)
+	}
+
 	return nil
 }
 
+// GetRebalancePolicyHistory gets all policy versions in chronological order
+func (c *MBTRebalancingContract) GetRebalancePolicyHistory(ctx contractapi.TransactionContextInterface) ([]*RebalancePolicyVersion, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("PolicyVersion", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy history: %v", err)
+	}
+	defer iterator.Close()
+
+	var versions []*RebalancePolicyVersion
+
+	for iterator.HasNext() {
+		versionJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy version: %v", err)
+		}
+
+		var version RebalancePolicyVersion
+		err = json.Unmarshal(versionJSON.Value, &version)
+		if err != nil {
+			continue // Skip invalid versions
+		}
+
+		versions = append(versions, &version)
+	}
+
+	return versions, nil
+}
+
 // GetRebalancePolicy retrieves the current rebalancing policy
 func (c *MBTRebalancingContract) GetRebalancePolicy(ctx contractapi.TransactionContextInterface) (*RebalancePolicy, error) {
 	policyJSON, err := ctx.GetStub().GetState("REBALANCE_POLICY")
@@ -133,34 +668,22 @@ func (c *MBTRebalancingContract) EvaluateRebalanceNeed(ctx contractapi.Transacti
 		return nil
 	}
 
-	// Calculate current allocations as percentages
-	currentAlloc := map[string]float64{
-		"gold":     holdings.TotalBGTValue / totalValue,
-		"silver":   holdings.TotalBSTValue / totalValue,
-		"platinum": holdings.TotalBPTValue / totalValue,
-	}
-
-	// Define target allocations
-	targetAlloc := map[string]float64{
-		"gold":     policy.GoldAllocation,
-		"silver":   policy.SilverAllocation,
-		"platinum": policy.PlatinumAllocation,
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
 	}
 
-	// Calculate deviations
-	deviations := map[string]float64{
-		"gold":     currentAlloc["gold"] - targetAlloc["gold"],
-		"silver":   currentAlloc["silver"] - targetAlloc["silver"],
-		"platinum": currentAlloc["platinum"] - targetAlloc["platinum"],
-	}
+	currentAlloc, targetAlloc, deviations := calculateAllocations(holdings, policy, now)
 
 	// Check for significant deviations
 	maxDeviation := 0.0
 	triggerType := ""
 	triggerReason := ""
 
-	for metal, deviation := range deviations {
-		absDeviation := math.Abs(deviation)
+	// Trigger on the policy's deviation measure; the absolute deviations are
+	// kept for sizing trades
+	for _, metal := range sortedMetals(deviations) {
+		absDeviation := math.Abs(allocationDeviation(currentAlloc[metal], targetAlloc[metal], policy.DeviationMode))
 		if absDeviation > maxDeviation {
 			maxDeviation = absDeviation
 			triggerType = "DEVIATION"
@@ -172,10 +695,10 @@ func (c *MBTRebalancingContract) EvaluateRebalanceNeed(ctx contractapi.Transacti
 	lastRebalance, err := time.Parse(time.RFC3339, holdings.LastRebalance)
 	if err != nil {
 		log.Printf("Warning: Could not parse last rebalance time: %v", err)
-		lastRebalance = time.Now().Add(-24 * time.Hour) // Assume recent rebalance
+		lastRebalance = now.Add(-24 * time.Hour) // Assume recent rebalance
 	}
 
-	daysSinceRebalance := time.Since(lastRebalance).Hours() / 24
+	daysSinceRebalance := now.Sub(lastRebalance).Hours() / 24
 	if daysSinceRebalance >= float64(policy.RebalanceIntervalDays) {
 		if maxDeviation < policy.MaxDeviationPercent {
 			// Time-based trigger
@@ -198,174 +721,556 @@ func (c *MBTRebalancingContract) EvaluateRebalanceNeed(ctx contractapi.Transacti
 	return nil
 }
 
-// CreateRebalanceRequest creates a new rebalancing request
-func (c *MBTRebalancingContract) CreateRebalanceRequest(ctx contractapi.TransactionContextInterface, 
-	currentAlloc, targetAlloc, deviations map[string]float64, requestType, reason string) error {
-
-	requestID := fmt.Sprintf("REBAL-%d", time.Now().UnixNano())
+// calculateAllocations returns the current and target allocations as fractions
+// of total value, and the deviation (current minus target) for each metal
+func calculateAllocations(holdings *BasketHolding, policy *RebalancePolicy, now time.Time) (currentAlloc, targetAlloc, deviations map[string]float64) {
+	totalValue := holdings.TotalBGTValue + holdings.TotalBSTValue + holdings.TotalBPTValue
 
-	request := RebalanceRequest{
-		RequestID:       requestID,
-		BasketID:        "MBT_BASKET",
-		RequestType:     requestType,
-		TriggerReason:   reason,
-		CurrentAlloc:    currentAlloc,
-		TargetAlloc:     targetAlloc,
-		Deviations:      deviations,
-		Status:          "PENDING",
-		CreatedAt:       time.Now().Format(time.RFC3339),
-		ApprovalRequired: true,
+	// Calculate current allocations as percentages
+	currentAlloc = map[string]float64{"gold": 0, "silver": 0, "platinum": 0}
+	if totalValue > 0 {
+		currentAlloc["gold"] = holdings.TotalBGTValue / totalValue
+		currentAlloc["silver"] = holdings.TotalBSTValue / totalValue
+		currentAlloc["platinum"] = holdings.TotalBPTValue / totalValue
 	}
 
-	// Determine if approval is required based on policy
-	policy, err := c.GetRebalancePolicy(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get policy: %v", err)
-	}
+	// Define target allocations
+	targetAlloc = targetAllocation(policy, now)
 
-	// Calculate estimated trade amounts to determine approval requirement
-	holdings, err := c.GetBasketHoldings(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get holdings: %v", err)
+	// Calculate deviations
+	deviations = map[string]float64{}
+	for metal := range targetAlloc {
+		deviations[metal] = currentAlloc[metal] - targetAlloc[metal]
 	}
 
-	totalValue := holdings.TotalBGTValue + holdings.TotalBSTValue + holdings.TotalBPTValue
-	maxTradeAmount := 0.0
+	return currentAlloc, targetAlloc, deviations
+}
 
-	for metal, deviation := range deviations {
-		if deviation != 0 {
-			metalValue := totalValue * math.Abs(deviation)
-			if metalValue > maxTradeAmount {
-				maxTradeAmount = metalValue
-			}
-		}
+// targetAllocation returns the policy's target weights in effect at the given time.
+// Between two glide-path points the weights are interpolated linearly; before the
+// first point and after the last the nearest point applies.
+func targetAllocation(policy *RebalancePolicy, now time.Time) map[string]float64 {
+	static := map[string]float64{
+		"gold":     policy.GoldAllocation,
+		"silver":   policy.SilverAllocation,
+		"platinum": policy.PlatinumAllocation,
+	}
+	if len(policy.GlidePath) == 0 {
+		return static
 	}
 
-	request.ApprovalRequired = maxTradeAmount >= policy.ApprovalThreshold
-
-	requestJSON, err := json.Marshal(request)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %v", err)
+	dates := make([]time.Time, len(policy.GlidePath))
+	for i, point := range policy.GlidePath {
+		date, err := time.Parse("2006-01-02", point.EffectiveDate)
+		if err != nil {
+			return static // Validated on update; only reachable with a corrupt policy
+		}
+		dates[i] = date
 	}
 
-	err = ctx.GetStub().PutState(requestID, requestJSON)
-	if err != nil {
-		return fmt.Errorf("failed to store request: %v", err)
+	last := len(policy.GlidePath) - 1
+	if !now.After(dates[0]) {
+		return glidePathTargets(policy.GlidePath[0].Composition, nil, 0)
+	}
+	if !now.Before(dates[last]) {
+		return glidePathTargets(policy.GlidePath[last].Composition, nil, 0)
 	}
 
-	log.Printf("Created rebalance request: %s (Type: %s, Approval Required: %t)", 
-		requestID, requestType, request.ApprovalRequired)
+	next := sort.Search(len(dates), func(i int) bool { return dates[i].After(now) })
+	from, to := policy.GlidePath[next-1], policy.GlidePath[next]
+	fraction := now.Sub(dates[next-1]).Seconds() / dates[next].Sub(dates[next-1]).Seconds()
 
-	// Generate specific rebalancing operations
-	err = c.GenerateRebalanceOperations(ctx, requestID, deviations, holdings, totalValue)
-	if err != nil {
-		return fmt.Errorf("failed to generate rebalance operations: %v", err)
+	return glidePathTargets(from.Composition, to.Composition, fraction)
+}
+
+// glidePathTargets blends two compositions, moving fraction of the way from one to the other
+func glidePathTargets(from, to map[string]float64, fraction float64) map[string]float64 {
+	targets := map[string]float64{"gold": 0, "silver": 0, "platinum": 0}
+	for metal := range targets {
+		targets[metal] = from[metal] + (to[metal]-from[metal])*fraction
 	}
+	return targets
+}
 
+// validateFeeTiers checks that tiers have non-negative bounds and fees below 100%
+// and are sorted by strictly increasing MinAmount, so no two tiers overlap
+func validateFeeTiers(tiers []FeeTier) error {
+	for i, tier := range tiers {
+		if tier.MinAmount < 0 {
+			return fmt.Errorf("fee tier %d: minimum amount must not be negative", i)
+		}
+		if tier.FeePercent < 0 || tier.FeePercent >= 1 {
+			return fmt.Errorf("fee tier %d: fee percent must be in [0, 1)", i)
+		}
+		if i > 0 && tier.MinAmount <= tiers[i-1].MinAmount {
+			return fmt.Errorf("fee tier %d: minimum amounts must be strictly increasing", i)
+		}
+	}
 	return nil
 }
 
-// GenerateRebalanceOperations creates specific trade operations for rebalancing
-func (c *MBTRebalancingContract) GenerateRebalanceOperations(ctx contractapi.TransactionContextInterface, 
-	requestID string, deviations map[string]float64, holdings *BasketHolding, totalValue float64) error {
+// feePercentFor returns the fee rate for a trade of the given amount: the tier with
+// the highest MinAmount not exceeding it, or the flat TradingFeePercent otherwise
+func feePercentFor(policy *RebalancePolicy, amount float64) float64 {
+	feePercent := policy.TradingFeePercent
+	for _, tier := range policy.FeeTiers {
+		if tier.MinAmount > amount {
+			break
+		}
+		feePercent = tier.FeePercent
+	}
+	return feePercent
+}
+
+// tradingFee returns the fee charged on a single trade of the given amount,
+// rounded up to the paise as splitFee does for every fee
+func tradingFee(policy *RebalancePolicy, amount float64) float64 {
+	_, feePaise := splitFee(amount, feePercentFor(policy, amount))
+	return float64(feePaise) / 100
+}
+
+// approvalThreshold returns the trade amount at which a request needs approval: the
+// absolute threshold, or the percentage of AUM if that is set and stricter
+func approvalThreshold(policy *RebalancePolicy, totalValue float64) float64 {
+	threshold := policy.ApprovalThreshold
+	if policy.ApprovalThresholdPercent > 0 {
+		threshold = math.Min(threshold, policy.ApprovalThresholdPercent*totalValue)
+	}
+	return threshold
+}
+
+// validateSubstitutions normalizes the unavailable metals and substitution rules to
+// metal names and checks that no metal substitutes for itself or for an unavailable metal
+func validateSubstitutions(policy *RebalancePolicy) error {
+	for i, metal := range policy.UnavailableMetals {
+		name, err := metalName(metal)
+		if err != nil {
+			return fmt.Errorf("unavailable metals: %v", err)
+		}
+		policy.UnavailableMetals[i] = name
+	}
+
+	rules := map[string]string{}
+	for metal, substitute := range policy.SubstitutionRules {
+		from, err := metalName(metal)
+		if err != nil {
+			return fmt.Errorf("substitution rules: %v", err)
+		}
+		to, err := metalName(substitute)
+		if err != nil {
+			return fmt.Errorf("substitution rules: %v", err)
+		}
+		if from == to {
+			return fmt.Errorf("substitution rules: %s cannot substitute for itself", from)
+		}
+		if isMetalUnavailable(policy, to) {
+			return fmt.Errorf("substitution rules: substitute %s is itself unavailable", to)
+		}
+		rules[from] = to
+	}
+	policy.SubstitutionRules = rules
+
+	return nil
+}
+
+// isMetalUnavailable reports whether the policy marks a metal, by name, as untradeable
+func isMetalUnavailable(policy *RebalancePolicy, metal string) bool {
+	for _, unavailable := range policy.UnavailableMetals {
+		if unavailable == metal {
+			return true
+		}
+	}
+	return false
+}
+
+// validateGlidePath checks each point's date and composition and that the dates
+// strictly increase. Compositions are normalized to friendly metal names in place.
+func validateGlidePath(glidePath []GlidePathPoint) error {
+	var previous time.Time
+	for i := range glidePath {
+		date, err := time.Parse("2006-01-02", glidePath[i].EffectiveDate)
+		if err != nil {
+			return fmt.Errorf("glide path point %d: invalid effective date %q", i, glidePath[i].EffectiveDate)
+		}
+		if i > 0 && !date.After(previous) {
+			return fmt.Errorf("glide path point %d: effective dates must be strictly increasing", i)
+		}
+		previous = date
+
+		composition, err := validateComposition(glidePath[i].Composition)
+		if err != nil {
+			return fmt.Errorf("glide path point %d: %v", i, err)
+		}
+		glidePath[i].Composition = composition
+	}
+	return nil
+}
+
+// CreateRebalanceRequest creates a new rebalancing request
+func (c *MBTRebalancingContract) CreateRebalanceRequest(ctx contractapi.TransactionContextInterface, 
+	currentAlloc, targetAlloc, deviations map[string]float64, requestType, reason string) error {
+
+	counts := requestCounts{}
+	_, _, err := c.createRebalanceRequest(ctx, counts, currentAlloc, targetAlloc, deviations, requestType, reason)
+	if err != nil {
+		return err
+	}
+
+	return counts.store(ctx)
+}
+
+// createRebalanceRequest stores a new request and its operations and returns both,
+// since state written in this transaction cannot be read back until it commits
+func (c *MBTRebalancingContract) createRebalanceRequest(ctx contractapi.TransactionContextInterface, counts requestCounts, 
+	currentAlloc, targetAlloc, deviations map[string]float64, requestType, reason string) (*RebalanceRequest, []*RebalanceOperation, error) {
+
+	// Derive the ID and creation time from the transaction so every endorsing
+	// peer writes the same request
+	requestID := "REBAL-" + ctx.GetStub().GetTxID()
+	createdAt, err := txTime(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request := RebalanceRequest{
+		RequestID:       requestID,
+		BasketID:        "MBT_BASKET",
+		RequestType:     requestType,
+		TriggerReason:   reason,
+		CurrentAlloc:    currentAlloc,
+		TargetAlloc:     targetAlloc,
+		Deviations:      deviations,
+		Status:          STATUS_PENDING,
+		CreatedAt:       createdAt.Format(time.RFC3339),
+		ApprovalRequired: true,
+	}
+
+	// Determine if approval is required based on policy
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	// Calculate estimated trade amounts to determine approval requirement
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get holdings: %v", err)
+	}
+
+	totalValue := holdings.TotalBGTValue + holdings.TotalBSTValue + holdings.TotalBPTValue
+	request.BasketValue = totalValue
+	maxTradeAmount := 0.0
+
+	for _, metal := range sortedMetals(deviations) {
+		deviation := deviations[metal]
+		if deviation != 0 {
+			metalValue := totalValue * math.Abs(deviation)
+			if metalValue > maxTradeAmount {
+				maxTradeAmount = metalValue
+			}
+		}
+	}
+
+	request.ApprovalRequired = maxTradeAmount >= approvalThreshold(policy, totalValue)
+	counts[STATUS_PENDING]++
+
+	fields := []numericField{{"BasketValue", request.BasketValue}}
+	for _, metal := range sortedMetals(deviations) {
+		fields = append(fields, numericField{metal + " current", currentAlloc[metal]}, 
+			numericField{metal + " target", targetAlloc[metal]}, numericField{metal + " deviation", deviations[metal]})
+	}
+	err = checkFinite("request "+requestID, fields...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(requestID, requestJSON)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to store request: %v", err)
+	}
+
+	// Index the request by creation date for period reporting
+	dateKey, err := ctx.GetStub().CreateCompositeKey("RequestByDate", []string{createdAt.Format("2006-01-02"), requestID})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create date index key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(dateKey, []byte{0x00})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to store date index: %v", err)
+	}
+
+	log.Printf("Created rebalance request: %s (Type: %s, Approval Required: %t)", 
+		requestID, requestType, request.ApprovalRequired)
+
+	// Generate specific rebalancing operations
+	operations, err := c.generateRebalanceOperations(ctx, requestID, deviations, holdings, totalValue, 1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate rebalance operations: %v", err)
+	}
+
+	// Announce the request only once it and its operations are written
+	err = emitEvent(ctx, "RebalanceRequestCreated", &RebalanceRequestCreatedEvent{
+		RequestID:        requestID,
+		TriggerType:      requestType,
+		ApprovalRequired: request.ApprovalRequired,
+		MaxTradeAmount:   maxTradeAmount,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &request, operations, nil
+}
+
+// GenerateRebalanceOperations creates specific trade operations for rebalancing.
+// completionFraction scales every trade so a rebalance can be done in tranches;
+// 0 means the full distance to target.
+func (c *MBTRebalancingContract) GenerateRebalanceOperations(ctx contractapi.TransactionContextInterface, 
+	requestID string, deviations map[string]float64, holdings *BasketHolding, totalValue float64, completionFraction float64) error {
+
+	fraction, err := normalizeCompletionFraction(completionFraction)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.generateRebalanceOperations(ctx, requestID, deviations, holdings, totalValue, fraction)
+	return err
+}
+
+// normalizeCompletionFraction validates a tranche fraction, mapping 0 to 1
+func normalizeCompletionFraction(fraction float64) (float64, error) {
+	if fraction == 0 {
+		return 1, nil
+	}
+	if math.IsNaN(fraction) || fraction < 0 || fraction > 1 {
+		return 0, fmt.Errorf("completion fraction must be between 0 and 1, got %v", fraction)
+	}
+	return fraction, nil
+}
+
+// generateRebalanceOperations stores the trade operations for a request and returns
+// them, each sized to the given fraction of the distance to target
+func (c *MBTRebalancingContract) generateRebalanceOperations(ctx contractapi.TransactionContextInterface, 
+	requestID string, deviations map[string]float64, holdings *BasketHolding, totalValue float64, 
+	completionFraction float64) ([]*RebalanceOperation, error) {
 
 	prices, err := c.GetCurrentMetalPrices(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get current prices: %v", err)
+		return nil, fmt.Errorf("failed to get current prices: %v", err)
 	}
 
 	policy, err := c.GetRebalancePolicy(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get policy: %v", err)
+		return nil, fmt.Errorf("failed to get policy: %v", err)
 	}
 
-	// Define metal mapping
-	metalMapping := map[string]string{
-		"gold":     "BGT",
-		"silver":   "BST",
-		"platinum": "BPT",
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	for metal, deviation := range deviations {
+	// Iterate in a fixed order, largest deviation first, and derive IDs from the
+	// transaction so every endorsing peer writes identical operations
+	var operations []*RebalanceOperation
+	operationSeq := 0
+	for _, metal := range metalsByDeviation(deviations) {
+		deviation := deviations[metal]
 		if math.Abs(deviation) < 0.001 { // Skip very small deviations
 			continue
 		}
 
-		metalType := metalMapping[metal]
-		operationType := "BUY"
-		if deviation < 0 {
-			operationType = "SELL"
+		metalType, err := normalizeMetal(metal)
+		if err != nil {
+			return nil, err
+		}
+
+		operationType, _ := rebalanceTrade(deviation)
+
+		// An untradeable metal's buys go to its substitute, if the policy names one
+		substitutedFor := ""
+		if isMetalUnavailable(policy, metal) {
+			substitute, ok := policy.SubstitutionRules[metal]
+			if operationType != "BUY" || !ok {
+				log.Printf("Skipping %s operation for unavailable metal %s", operationType, metal)
+				continue
+			}
+			metalType, err = normalizeMetal(substitute)
+			if err != nil {
+				return nil, err
+			}
+			substitutedFor = metal
 		}
 
-		// Calculate trade amount
-		tradeAmount := math.Abs(deviation) * totalValue
+		// Calculate trade amount, rounded before the minimum check so a
+		// rounded-down trade is dropped rather than sent below the minimum
+		tradeAmount := roundHalfEven(math.Abs(deviation)*totalValue*completionFraction, policy.TradeRoundingDecimals)
 		if tradeAmount < policy.MinTradeAmount {
 			log.Printf("Skipping rebalancing operation for %s: amount %.2f below minimum %.2f", 
 				metal, tradeAmount, policy.MinTradeAmount)
 			continue
 		}
 
-		// Calculate estimated cost
-		unitPrice := 1.0 // Simplified - would use actual metal price
-		if metal == "gold" {
-			unitPrice = prices["BGT"]
-		} else if metal == "silver" {
-			unitPrice = prices["BST"]
-		} else if metal == "platinum" {
-			unitPrice = prices["BPT"]
+		// Skip trades that cost more in fees than they recover in tracking error,
+		// valued as the traded amount weighted by the deviation it removes
+		if policy.MinBenefitRatio > 0 {
+			fee := tradingFee(policy, tradeAmount)
+			benefit := tradeAmount * math.Abs(deviation)
+			if fee > policy.MinBenefitRatio*benefit {
+				log.Printf("Skipping cost-ineffective operation for %s: fee %.2f exceeds %.2f x benefit %.2f", 
+					metal, fee, policy.MinBenefitRatio, benefit)
+				continue
+			}
+		}
+
+		// Calculate estimated cost; a missing price aborts generation rather
+		// than recording a trade at a made-up price
+		unitPrice, ok := prices[metalType]
+		if !ok {
+			log.Printf("No price available for %s, aborting operation generation", metalType)
+			return nil, fmt.Errorf("no price available for metal %s", metalType)
+		}
+
+		// Failing the transaction discards the operations already written
+		if policy.MaxOperationsPerRebalance > 0 && operationSeq >= policy.MaxOperationsPerRebalance {
+			return nil, fmt.Errorf("rebalance needs more than the policy maximum of %d operations", 
+				policy.MaxOperationsPerRebalance)
 		}
 
 		operation := RebalanceOperation{
-			OperationID:   fmt.Sprintf("OP-%d", time.Now().UnixNano()),
+			OperationID:   fmt.Sprintf("OP-%s-%03d", ctx.GetStub().GetTxID(), operationSeq),
 			RequestID:     requestID,
 			MetalType:     metalType,
 			OperationType: operationType,
 			Amount:        tradeAmount,
 			CurrentPrice:  unitPrice,
-			EstimatedCost: tradeAmount * unitPrice,
-			Timestamp:     time.Now().Format(time.RFC3339),
+			EstimatedCost: roundHalfEven(tradeAmount*unitPrice, policy.TradeRoundingDecimals),
+			Timestamp:     now.Format(time.RFC3339),
+			Status:        OPERATION_PENDING,
+			SubstitutedFor: substitutedFor,
+		}
+
+		err = checkFinite("operation "+operation.OperationID,
+			numericField{"Amount", operation.Amount},
+			numericField{"CurrentPrice", operation.CurrentPrice},
+			numericField{"EstimatedCost", operation.EstimatedCost},
+		)
+		if err != nil {
+			return nil, err
 		}
 
 		operationJSON, err := json.Marshal(operation)
 		if err != nil {
-			return fmt.Errorf("failed to marshal operation: %v", err)
+			return nil, fmt.Errorf("failed to marshal operation: %v", err)
 		}
 
 		err = ctx.GetStub().PutState(operation.OperationID, operationJSON)
 		if err != nil {
-			return fmt.Errorf("failed to store operation: %v", err)
+			return nil, fmt.Errorf("failed to store operation: %v", err)
+		}
+
+		// Index the operation under its request so execution need not scan every operation
+		indexKey, err := ctx.GetStub().CreateCompositeKey("RequestOperation", []string{requestID, operation.OperationID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create operation index key: %v", err)
+		}
+
+		err = ctx.GetStub().PutState(indexKey, []byte{0x00})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store operation index: %v", err)
 		}
 
 		log.Printf("Generated operation: %s - %s %.2f %s at %.2f INR", 
 			operation.OperationID, operationType, tradeAmount, metalType, unitPrice)
+		operations = append(operations, &operation)
+		operationSeq++
 	}
 
-	return nil
+	return operations, nil
+}
+
+// sortedMetals returns the metals of an allocation map in a fixed sorted order.
+// Ranging over a map is randomized, so state-writing logic must iterate this instead.
+func sortedMetals(allocations map[string]float64) []string {
+	metals := make([]string, 0, len(allocations))
+	for metal := range allocations {
+		metals = append(metals, metal)
+	}
+	sort.Strings(metals)
+	return metals
+}
+
+// metalsByDeviation orders metals by absolute deviation, largest first, breaking
+// ties by name so the order is deterministic
+func metalsByDeviation(deviations map[string]float64) []string {
+	metals := sortedMetals(deviations)
+	sort.SliceStable(metals, func(i, j int) bool {
+		return math.Abs(deviations[metals[i]]) > math.Abs(deviations[metals[j]])
+	})
+	return metals
+}
+
+// rebalanceTrade gives the trade that closes a deviation (current minus target): a
+// BUY when the metal is under target and a SELL when over, with the change in its
+// share, target minus current
+func rebalanceTrade(deviation float64) (string, float64) {
+	if deviation < 0 {
+		return "BUY", -deviation
+	}
+	return "SELL", -deviation
+}
+
+// tradeValueChange is the change an operation makes to its metal's value
+func tradeValueChange(operation *RebalanceOperation) float64 {
+	if operation.OperationType == "BUY" {
+		return operation.Amount
+	}
+	return -operation.Amount
+}
+
+// roundHalfEven rounds value to the given number of decimals using banker's rounding
+func roundHalfEven(value float64, decimals int) float64 {
+	if decimals < 0 {
+		return value
+	}
+	scale := math.Pow(10, float64(decimals))
+	return math.RoundToEven(value*scale) / scale
 }
 
 // GetCurrentMetalPrices gets current market prices for metals
 func (c *MBTRebalancingContract) GetCurrentMetalPrices(ctx contractapi.TransactionContextInterface) (map[string]float64, error) {
-	// In real implementation, would query external price feeds
-	prices := map[string]float64{
-		"BGT":     5800.0,  // Gold per gram in INR
-		"BST":     75.0,    // Silver per gram in INR  
-		"BPT":     3200.0,  // Platinum per gram in INR
+	currency := BASE_CURRENCY
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err == nil && policy.Currency != "" {
+		currency = policy.Currency
 	}
 
-	return prices, nil
+	// In real implementation, would query external price feeds
+	return fetchMetalPrices(ctx, currency)
 }
 
-// ApproveRebalanceRequest approves a pending rebalance request
+// ApproveRebalanceRequest approves a pending rebalance request. The approverID
+// argument is kept for compatibility; the caller's verified identity is recorded instead.
 func (c *MBTRebalancingContract) ApproveRebalanceRequest(ctx contractapi.TransactionContextInterface, 
 	requestID, approverID string) error {
 
+	verifiedApprover, err := c.verifyApprover(ctx)
+	if err != nil {
+		return err
+	}
+
 	requestJSON, err := ctx.GetStub().GetState(requestID)
 	if err != nil {
 		return fmt.Errorf("failed to read request: %v", err)
 	}
 
 	if requestJSON == nil {
-		return fmt.Errorf("request %s not found", requestID)
+		return fmt.Errorf("request %s %w", requestID, ErrNotFound)
 	}
 
 	var request RebalanceRequest
@@ -374,7 +1279,7 @@ func (c *MBTRebalancingContract) ApproveRebalanceRequest(ctx contractapi.Transac
 		return fmt.Errorf("failed to unmarshal request: %v", err)
 	}
 
-	if request.Status != "PENDING" {
+	if request.Status != STATUS_PENDING {
 		return fmt.Errorf("request is not in PENDING status")
 	}
 
@@ -382,9 +1287,42 @@ func (c *MBTRebalancingContract) ApproveRebalanceRequest(ctx contractapi.Transac
 		return fmt.Errorf("request does not require approval")
 	}
 
-	// Update status
-	request.Status = "APPROVED"
-	request.ExecutedAt = time.Now().Format(time.RFC3339)
+	if hasApproved(&request, verifiedApprover) {
+		return fmt.Errorf("request %s already approved by %s", requestID, verifiedApprover)
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	approvedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	role, weight, err := approverWeight(ctx, policy)
+	if err != nil {
+		return err
+	}
+
+	request.Approvals = append(request.Approvals, RequestApproval{
+		Approver:   verifiedApprover,
+		ApprovedAt: approvedAt.Format(time.RFC3339),
+		Role:       role,
+		Weight:     weight,
+	})
+
+	// Update status once enough approvers, or enough approval weight, have signed
+	counts := requestCounts{}
+	if approvalComplete(&request, policy) {
+		err = setRequestStatus(&request, STATUS_APPROVED, counts)
+		if err != nil {
+			return err
+		}
+		request.ApprovedAt = approvedAt.Format(time.RFC3339)
+		request.ApprovedBy = verifiedApprover
+	}
 
 	requestJSON, err = json.Marshal(request)
 	if err != nil {
@@ -396,216 +1334,2254 @@ func (c *MBTRebalancingContract) ApproveRebalanceRequest(ctx contractapi.Transac
 		return fmt.Errorf("failed to store request: %v", err)
 	}
 
-	log.Printf("Approved rebalance request: %s by %s", requestID, approverID)
+	err = counts.store(ctx)
+	if err != nil {
+		return err
+	}
+
+	if policy.RequiredApprovalWeight > 0 {
+		log.Printf("Approved rebalance request: %s by %s (weight %.2f of %.2f)", 
+			requestID, verifiedApprover, approvedWeight(&request), policy.RequiredApprovalWeight)
+		return nil
+	}
+
+	log.Printf("Approved rebalance request: %s by %s (%d of %d)", 
+		requestID, verifiedApprover, len(request.Approvals), requiredApprovals(policy))
 	return nil
 }
 
-// ExecuteRebalance executes approved rebalancing operations
-func (c *MBTRebalancingContract) ExecuteRebalance(ctx contractapi.TransactionContextInterface, requestID string) error {
-	requestJSON, err := ctx.GetStub().GetState(requestID)
+// GetPendingApprovalsForApprover gets PENDING requests awaiting approval that the
+// calling approver has not yet signed
+func (c *MBTRebalancingContract) GetPendingApprovalsForApprover(ctx contractapi.TransactionContextInterface) ([]*RebalanceRequest, error) {
+	approver, err := c.verifyApprover(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to read request: %v", err)
+		return nil, err
 	}
 
-	var request RebalanceRequest
-	err = json.Unmarshal(requestJSON, &request)
+	requests, err := c.GetRebalanceRequests(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal request: %v", err)
+		return nil, err
 	}
 
-	if request.Status != "APPROVED" && !(request.Status == "PENDING" && !request.ApprovalRequired) {
-		return fmt.Errorf("request is not ready for execution")
+	pending := []*RebalanceRequest{}
+	for _, request := range requests {
+		if request.Status != STATUS_PENDING || !request.ApprovalRequired {
+			continue
+		}
+		if hasApproved(request, approver) {
+			continue
+		}
+		pending = append(pending, request)
 	}
 
-	log.Printf("Executing rebalance request: %s", requestID)
+	return pending, nil
+}
 
-	// Get all operations for this request
-	iterator, err := ctx.GetStub().GetStateByRange("", "")
+// GetRebalanceApprovalStatus reports a request's progress toward its approval threshold
+func (c *MBTRebalancingContract) GetRebalanceApprovalStatus(ctx contractapi.TransactionContextInterface, requestID string) (*ApprovalStatus, error) {
+	request, err := c.getRebalanceRequest(ctx, requestID)
 	if err != nil {
-		return fmt.Errorf("failed to get state iterator: %v", err)
+		return nil, err
 	}
-	defer iterator.Close()
 
-	var executedOperations []string
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %v", err)
+	}
 
-	for iterator.HasNext() {
-		operationJSON, err := iterator.Next()
-		if err != nil {
-			return fmt.Errorf("failed to read operation: %v", err)
-		}
+	status := &ApprovalStatus{
+		RequestID: requestID,
+		Status:    request.Status,
+		Approvers: []string{},
+	}
+	if request.ApprovalRequired {
+		status.RequiredApprovals = requiredApprovals(policy)
+	}
 
-		var operation RebalanceOperation
-		err = json.Unmarshal(operationJSON.Value, &operation)
-		if err != nil {
-			continue // Skip invalid operations
-		}
+	for _, approval := range request.Approvals {
+		status.Approvers = append(status.Approvers, approval.Approver)
+	}
 
-		if operation.RequestID == requestID {
-			// Execute the operation (in real implementation, would interact with trading APIs)
-			err = c.ExecuteOperation(ctx, operation)
-			if err != nil {
-				log.Printf("Failed to execute operation %s: %v", operation.OperationID, err)
-				request.Status = "FAILED"
-				break
-			}
+	status.Remaining = status.RequiredApprovals - len(status.Approvers)
+	if status.Remaining < 0 {
+		status.Remaining = 0
+	}
 
-			executedOperations = append(executedOperations, operation.OperationID)
-			log.Printf("Executed operation: %s", operation.OperationID)
-		}
+	status.CollectedWeight = approvedWeight(request)
+	if request.ApprovalRequired && policy.RequiredApprovalWeight > 0 {
+		// Weighted approval replaces the signature count
+		status.RequiredApprovals = 0
+		status.Remaining = 0
+		status.RequiredWeight = policy.RequiredApprovalWeight
 	}
 
-	if request.Status != "FAILED" {
-		request.Status = "EXECUTED"
-		request.ExecutedAt = time.Now().Format(time.RFC3339)
+	status.ReadyToExecute = request.Status == STATUS_APPROVED || request.Status == STATUS_PARTIAL ||
+		(request.Status == STATUS_PENDING && !request.ApprovalRequired)
 
-		// Update basket holdings to reflect new allocations
-		err = c.UpdateBasketAfterRebalance(ctx, request.Deviations)
-		if err != nil {
-			log.Printf("Warning: Failed to update basket holdings: %v", err)
+	return status, nil
+}
+
+// hasApproved reports whether the approver has already signed the request
+func hasApproved(request *RebalanceRequest, approver string) bool {
+	for _, approval := range request.Approvals {
+		if approval.Approver == approver {
+			return true
 		}
 	}
+	return false
+}
 
-	requestJSON, err = json.Marshal(request)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %v", err)
+// requiredApprovals returns the number of signatures a request needs, at least one
+func requiredApprovals(policy *RebalancePolicy) int {
+	if policy.RequiredApprovals < 1 {
+		return 1
 	}
+	return policy.RequiredApprovals
+}
 
-	err = ctx.GetStub().PutState(requestID, requestJSON)
+// approverWeight returns the caller's "approverRole" attribute and the weight the
+// policy gives it. Callers without a role, or with a role the policy does not list,
+// weigh 1.
+func approverWeight(ctx contractapi.TransactionContextInterface, policy *RebalancePolicy) (string, float64, error) {
+	role, found, err := ctx.GetClientIdentity().GetAttributeValue("approverRole")
 	if err != nil {
-		return fmt.Errorf("failed to store request: %v", err)
+		return "", 0, fmt.Errorf("failed to read approver role attribute: %v", err)
+	}
+	if !found {
+		return "", 1, nil
 	}
 
-	log.Printf("Rebalance execution completed. Status: %s, Operations executed: %d", 
-		request.Status, len(executedOperations))
+	if weight, ok := policy.ApprovalWeightByRole[role]; ok {
+		return role, weight, nil
+	}
+	return role, 1, nil
+}
 
-	return nil
+// approvedWeight sums the weight of a request's approvals. Approvals recorded
+// before weighting existed count as 1.
+func approvedWeight(request *RebalanceRequest) float64 {
+	total := 0.0
+	for _, approval := range request.Approvals {
+		if approval.Weight == 0 {
+			total++
+			continue
+		}
+		total += approval.Weight
+	}
+	return total
 }
 
-// ExecuteOperation executes a specific rebalancing operation
-func (c *MBTRebalancingContract) ExecuteOperation(ctx contractapi.TransactionContextInterface, operation RebalanceOperation) error {
-	log.Printf("Executing %s operation for %s: %.2f at %.2f INR", 
-		operation.OperationType, operation.MetalType, operation.Amount, operation.CurrentPrice)
+// approvalComplete reports whether a request has collected the approval weight the
+// policy requires or, without weighting, the required number of signatures
+func approvalComplete(request *RebalanceRequest, policy *RebalancePolicy) bool {
+	if policy.RequiredApprovalWeight > 0 {
+		return approvedWeight(request) >= policy.RequiredApprovalWeight
+	}
+	return len(request.Approvals) >= requiredApprovals(policy)
+}
 
-	// In real implementation, would:
-	// 1. Interact with trading APIs
-	// 2. Execute buy/sell orders
-	// 3. Update token allocations
-	// 4. Record transaction details
+// verifyApprover checks that the caller holds the "approver" attribute or belongs
+// to an approver MSP, returning the caller's identity
+func (c *MBTRebalancingContract) verifyApprover(ctx contractapi.TransactionContextInterface) (string, error) {
+	identity := ctx.GetClientIdentity()
 
-	return nil
+	clientID, err := identity.GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	value, found, err := identity.GetAttributeValue("approver")
+	if err != nil {
+		return "", fmt.Errorf("failed to read approver attribute: %v", err)
+	}
+	if found && value == "true" {
+		return clientID, nil
+	}
+
+	mspID, err := identity.GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client MSP: %v", err)
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	for _, approverMSP := range policy.ApproverMSPs {
+		if mspID == approverMSP {
+			return clientID, nil
+		}
+	}
+
+	return "", fmt.Errorf("unauthorized: caller is not an approver")
 }
 
-// UpdateBasketAfterRebalance updates basket holdings after successful rebalancing
-func (c *MBTRebalancingContract) UpdateBasketAfterRebalance(ctx contractapi.TransactionContextInterface, deviations map[string]float64) error {
-	holdings, err := c.GetBasketHoldings(ctx)
+// ExecuteRebalance executes approved rebalancing operations. A deviation-triggered
+// request whose deviation has since returned within the policy band is marked
+// SUPERSEDED instead, unless force is set. A completionFraction below 1 executes
+// that share of each trade as a tranche and leaves the request PARTIALLY_EXECUTED
+// until later calls trade the rest; 0 executes whatever remains.
+func (c *MBTRebalancingContract) ExecuteRebalance(ctx contractapi.TransactionContextInterface, 
+	requestID string, force bool, completionFraction float64) error {
+
+	err := c.checkRebalanceAllowed(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get holdings: %v", err)
+		return err
 	}
 
-	totalValue := holdings.TotalBGTValue + holdings.TotalBSTValue + holdings.TotalBPTValue
-	if totalValue == 0 {
-		return nil
+	fraction, err := normalizeCompletionFraction(completionFraction)
+	if err != nil {
+		return err
 	}
 
-	// Apply deviations to achieve target allocations
-	holdings.TotalBGTValue += deviations["gold"] * totalValue
-	holdings.TotalBSTValue += deviations["silver"] * totalValue
-	holdings.TotalBPTValue += deviations["platinum"] * totalValue
-	holdings.RebalanceNeeded = false
-	holdings.LastRebalance = time.Now().Format(time.RFC3339)
+	request, err := c.getRebalanceRequest(ctx, requestID)
+	if err != nil {
+		return err
+	}
 
-	holdingsJSON, err := json.Marshal(holdings)
+	// Get all operations for this request
+	operations, err := c.GetRebalanceOperations(ctx, requestID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal holdings: %v", err)
+		return err
 	}
 
-	err = ctx.GetStub().PutState("BASKET_HOLDINGS", holdingsJSON)
+	counts := requestCounts{}
+	err = c.executeRebalance(ctx, request, operations, force, fraction, counts)
 	if err != nil {
-		return fmt.Errorf("failed to store holdings: %v", err)
+		return err
 	}
 
-	return nil
+	return counts.store(ctx)
 }
 
-// GetBasketHoldings gets current basket holdings (simplified for rebalance contract)
-func (c *MBTRebalancingContract) GetBasketHoldings(ctx contractapi.TransactionContextInterface) (*BasketHolding, error) {
-	// In real implementation, would call the main MBT basket contract
-	// For now, return mock data
-	return &BasketHolding{
-		TotalMBTSupply: 10000.0,
-		TotalBGTValue:  5000.0,
-		TotalBSTValue:  3000.0,
-		TotalBPTValue:  2000.0,
-		RebalanceNeeded: false,
-		LastRebalance: time.Now().Add(-35 * 24 * time.Hour).Format(time.RFC3339), // 35 days ago
-	}, nil
-}
+// executeRebalance executes the given fraction of a request's operations and stores
+// the resulting status. Unless force is set, a deviation-triggered request no
+// longer needed is superseded.
+func (c *MBTRebalancingContract) executeRebalance(ctx contractapi.TransactionContextInterface, 
+	request *RebalanceRequest, operations []*RebalanceOperation, force bool, fraction float64, counts requestCounts) error {
 
-// GetRebalanceRequests gets all rebalance requests
-func (c *MBTRebalancingContract) GetRebalanceRequests(ctx contractapi.TransactionContextInterface) ([]*RebalanceRequest, error) {
-	iterator, err := ctx.GetStub().GetStateByRange("REBAL-", "REBEL")
+	requestID := request.RequestID
+
+	if request.Status != STATUS_APPROVED && request.Status != STATUS_PARTIAL && 
+		!(request.Status == STATUS_PENDING && !request.ApprovalRequired) {
+		return fmt.Errorf("request is not ready for execution")
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get requests: %v", err)
+		return fmt.Errorf("failed to get policy: %v", err)
 	}
-	defer iterator.Close()
 
-	var requests []*RebalanceRequest
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
 
-	for iterator.HasNext() {
-		requestJSON, err := iterator.Next()
+	// A stale request is marked EXPIRED instead of executed; the status change
+	// is committed, so no error is returned
+	if isRequestExpired(request, policy, now) {
+		err = setRequestStatus(request, STATUS_EXPIRED, counts)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read request: %v", err)
+			return err
 		}
 
-		var request RebalanceRequest
-		err = json.Unmarshal(requestJSON.Value, &request)
+		requestJSON, err := json.Marshal(request)
 		if err != nil {
-			continue // Skip invalid requests
+			return fmt.Errorf("failed to marshal request: %v", err)
 		}
 
-		requests = append(requests, &request)
+		err = ctx.GetStub().PutState(requestID, requestJSON)
+		if err != nil {
+			return fmt.Errorf("failed to store request: %v", err)
+		}
+
+		log.Printf("Rebalance request %s expired before execution", requestID)
+		return nil
 	}
 
-	return requests, nil
+	// Likewise, a request whose deviation has resolved is superseded, not executed
+	if request.RequestType == "DEVIATION" && !force {
+		reason, err := c.rebalanceNoLongerNeeded(ctx, policy, now)
+		if err != nil {
+			return err
+		}
+
+		if reason != "" {
+			err = setRequestStatus(request, STATUS_SUPERSEDED, counts)
+			if err != nil {
+				return err
+			}
+			request.SupersededReason = reason
+
+			requestJSON, err := json.Marshal(request)
+			if err != nil {
+				return fmt.Errorf("failed to marshal request: %v", err)
+			}
+
+			err = ctx.GetStub().PutState(requestID, requestJSON)
+			if err != nil {
+				return fmt.Errorf("failed to store request: %v", err)
+			}
+
+			log.Printf("Rebalance request %s superseded: %s", requestID, reason)
+			return nil
+		}
+	}
+
+	log.Printf("Executing rebalance request: %s", requestID)
+
+	return c.runRebalanceOperations(ctx, request, operations, fraction, now, counts)
 }
 
-// GetRebalanceOperations gets operations for a specific request
-func (c *MBTRebalancingContract) GetRebalanceOperations(ctx contractapi.TransactionContextInterface, requestID string) ([]*RebalanceOperation, error) {
-	iterator, err := ctx.GetStub().GetStateByRange("OP-", "OPZ")
+// rebalanceNoLongerNeeded re-measures the basket's deviation under the policy and
+// returns why rebalancing is no longer warranted, or "" if it still is
+func (c *MBTRebalancingContract) rebalanceNoLongerNeeded(ctx contractapi.TransactionContextInterface, 
+	policy *RebalancePolicy, now time.Time) (string, error) {
+
+	holdings, err := c.GetBasketHoldings(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get operations: %v", err)
+		return "", fmt.Errorf("failed to get basket holdings: %v", err)
 	}
-	defer iterator.Close()
 
-	var operations []*RebalanceOperation
+	if holdings.TotalBGTValue+holdings.TotalBSTValue+holdings.TotalBPTValue == 0 {
+		return "basket holds no metal value", nil
+	}
 
-	for iterator.HasNext() {
-		operationJSON, err := iterator.Next()
+	currentAlloc, targetAlloc, _ := calculateAllocations(holdings, policy, now)
+	maxDeviation := 0.0
+	for _, metal := range sortedMetals(targetAlloc) {
+		deviation := math.Abs(allocationDeviation(currentAlloc[metal], targetAlloc[metal], policy.DeviationMode))
+		if deviation > maxDeviation {
+			maxDeviation = deviation
+		}
+	}
+
+	if maxDeviation > policy.MaxDeviationPercent {
+		return "", nil
+	}
+
+	return fmt.Sprintf("max deviation %.2f%% is now within the %.2f%% band", 
+		maxDeviation*100, policy.MaxDeviationPercent*100), nil
+}
+
+// ResumeRebalance re-runs the operations of a FAILED request that have not yet
+// executed. Operations that already completed are never executed again.
+func (c *MBTRebalancingContract) ResumeRebalance(ctx contractapi.TransactionContextInterface, requestID string) error {
+	err := c.checkRebalanceAllowed(ctx)
+	if err != nil {
+		return err
+	}
+
+	request, err := c.getRebalanceRequest(ctx, requestID)
+	if err != nil {
+		return err
+	}
+
+	if request.Status != STATUS_FAILED {
+		return fmt.Errorf("only FAILED requests can be resumed, request %s is %s", requestID, request.Status)
+	}
+
+	operations, err := c.GetRebalanceOperations(ctx, requestID)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Resuming rebalance request: %s", requestID)
+
+	counts := requestCounts{}
+	err = c.runRebalanceOperations(ctx, request, operations, 1, now, counts)
+	if err != nil {
+		return err
+	}
+
+	return counts.store(ctx)
+}
+
+// runRebalanceOperations trades the given fraction of every operation not yet
+// EXECUTED, capped at what remains, recording each operation's outcome; a failure
+// does not stop the rest. The request is stored as EXECUTED once all its operations
+// are, as FAILED if any failed, and as PARTIALLY_EXECUTED while trades remain.
+func (c *MBTRebalancingContract) runRebalanceOperations(ctx contractapi.TransactionContextInterface, 
+	request *RebalanceRequest, operations []*RebalanceOperation, fraction float64, now time.Time, counts requestCounts) error {
+
+	requestID := request.RequestID
+	executed, failed, remaining := 0, 0, 0
+	traded := []*RebalanceOperation{}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	if policy.AtomicRebalance {
+		err = c.preflightOperations(ctx, operations, policy)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read operation: %v", err)
+			return fmt.Errorf("atomic rebalance %s aborted: %v", requestID, err)
 		}
+	}
 
-		var operation RebalanceOperation
-		err = json.Unmarshal(operationJSON.Value, &operation)
+	for _, operation := range operations {
+		if operation.Status == OPERATION_EXECUTED {
+			continue // Completed in an earlier attempt
+		}
+
+		// Trade this pass's tranche of the operation
+		tranche := *operation
+		tranche.Amount = operationRemaining(operation, policy)
+		if fraction < 1 {
+			tranche.Amount = math.Min(roundHalfEven(operation.Amount*fraction, policy.TradeRoundingDecimals), tranche.Amount)
+		}
+		tranche.EstimatedCost = roundHalfEven(tranche.Amount*operation.CurrentPrice, policy.TradeRoundingDecimals)
+
+		// Execute the operation (in real implementation, would interact with trading APIs)
+		execErr := c.ExecuteOperation(ctx, tranche)
+		if execErr != nil && policy.AtomicRebalance {
+			// Failing the transaction discards the operations already executed in it
+			return fmt.Errorf("atomic rebalance %s aborted: operation %s: %v", requestID, operation.OperationID, execErr)
+		}
+		if execErr != nil {
+			log.Printf("Failed to execute operation %s: %v", operation.OperationID, execErr)
+			operation.Status = OPERATION_FAILED
+			operation.Error = execErr.Error()
+		} else {
+			operation.ExecutedAmount = roundHalfEven(operation.ExecutedAmount+tranche.Amount, policy.TradeRoundingDecimals)
+			operation.Status = OPERATION_PENDING
+			if operationRemaining(operation, policy) <= 0 {
+				operation.Status = OPERATION_EXECUTED
+				operation.ExecutedAt = now.Format(time.RFC3339)
+			}
+			operation.Error = ""
+		}
+
+		operationJSON, err := json.Marshal(operation)
 		if err != nil {
-			continue // Skip invalid operations
+			return fmt.Errorf("failed to marshal operation: %v", err)
 		}
 
-		if operation.RequestID == requestID {
-			operations = append(operations, &operation)
+		err = ctx.GetStub().PutState(operation.OperationID, operationJSON)
+		if err != nil {
+			return fmt.Errorf("failed to store operation: %v", err)
+		}
+
+		if execErr == nil && operation.Status == OPERATION_EXECUTED {
+			// Index by execution date for the trade ledger
+			execKey, err := ctx.GetStub().CreateCompositeKey("OperationByExecDate", 
+				[]string{now.Format("2006-01-02"), requestID, operation.OperationID})
+			if err != nil {
+				return fmt.Errorf("failed to create execution date index key: %v", err)
+			}
+			err = ctx.GetStub().PutState(execKey, []byte{0x00})
+			if err != nil {
+				return fmt.Errorf("failed to store execution date index: %v", err)
+			}
+		}
+
+		if execErr == nil {
+			executed++
+			traded = append(traded, &tranche)
+			log.Printf("Executed %.2f of operation: %s", tranche.Amount, operation.OperationID)
 		}
 	}
 
-	return operations, nil
+	// The outcome is decided by the recorded operation statuses, including those
+	// completed in earlier attempts, not by where the loop stopped
+	for _, operation := range operations {
+		switch operation.Status {
+		case OPERATION_EXECUTED:
+		case OPERATION_FAILED:
+			failed++
+		default:
+			remaining++
+		}
+	}
+
+	if failed > 0 && request.Status != STATUS_FAILED {
+		err = setRequestStatus(request, STATUS_FAILED, counts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed == 0 {
+		status := STATUS_EXECUTED
+		if remaining > 0 {
+			status = STATUS_PARTIAL
+		}
+		err = setRequestStatus(request, status, counts)
+		if err != nil {
+			return err
+		}
+		if status == STATUS_EXECUTED {
+			request.ExecutedAt = now.Format(time.RFC3339)
+		}
+
+		// A tranche completes its share of the request
+		share := math.Min(fraction, 1-request.CompletionFraction)
+		if status == STATUS_EXECUTED {
+			share = 1 - request.CompletionFraction
+		}
+		request.CompletionFraction += share
+	}
+
+	// Holdings move by what was traded in this pass, including trades made before
+	// another operation failed
+	if len(traded) > 0 {
+		err = c.updateBasketAfterRebalance(ctx, traded)
+		if err != nil {
+			return fmt.Errorf("failed to update basket holdings: %v", err)
+		}
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(requestID, requestJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store request: %v", err)
+	}
+
+	log.Printf("Rebalance execution completed. Status: %s, Operations executed: %d, not executed: %d", 
+		request.Status, executed, failed)
+
+	return nil
+}
+
+// operationRemaining is the part of an operation's amount not yet traded
+func operationRemaining(operation *RebalanceOperation, policy *RebalancePolicy) float64 {
+	return math.Max(roundHalfEven(operation.Amount-operation.ExecutedAmount, policy.TradeRoundingDecimals), 0)
+}
+
+// preflightOperations checks that every operation not yet executed can execute:
+// its metal has a current price within the slippage buffer of the quoted price, and
+// the basket holds enough of the metal to cover a sell
+func (c *MBTRebalancingContract) preflightOperations(ctx contractapi.TransactionContextInterface, 
+	operations []*RebalanceOperation, policy *RebalancePolicy) error {
+
+	prices, err := c.GetCurrentMetalPrices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get current prices: %v", err)
+	}
+
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get holdings: %v", err)
+	}
+
+	available := map[string]float64{
+		"BGT": holdings.TotalBGTValue,
+		"BST": holdings.TotalBSTValue,
+		"BPT": holdings.TotalBPTValue,
+	}
+
+	for _, operation := range operations {
+		if operation.Status == OPERATION_EXECUTED {
+			continue
+		}
+
+		price, ok := prices[operation.MetalType]
+		if !ok || price <= 0 {
+			return fmt.Errorf("operation %s: no current price for %s", operation.OperationID, operation.MetalType)
+		}
+
+		if operation.CurrentPrice > 0 {
+			move := math.Abs(price-operation.CurrentPrice) / operation.CurrentPrice
+			if move > policy.SlippageBufferPercent {
+				return fmt.Errorf("operation %s: %s price moved %.2f%%, beyond the %.2f%% slippage buffer", 
+					operation.OperationID, operation.MetalType, move*100, policy.SlippageBufferPercent*100)
+			}
+		}
+
+		if operation.OperationType == "SELL" {
+			amount := operationRemaining(operation, policy)
+			if amount > available[operation.MetalType] {
+				return fmt.Errorf("operation %s: sell of %.2f exceeds %.2f of %s held", 
+					operation.OperationID, amount, available[operation.MetalType], operation.MetalType)
+			}
+			available[operation.MetalType] -= amount
+		}
+	}
+
+	return nil
+}
+
+// ExecuteOperation executes a specific rebalancing operation
+func (c *MBTRebalancingContract) ExecuteOperation(ctx contractapi.TransactionContextInterface, operation RebalanceOperation) error {
+	log.Printf("Executing %s operation for %s: %.2f at %.2f INR", 
+		operation.OperationType, operation.MetalType, operation.Amount, operation.CurrentPrice)
+
+	// Without a price the trade cannot be placed or valued into holdings
+	if operation.CurrentPrice <= 0 {
+		return fmt.Errorf("operation %s has no price to trade at", operation.OperationID)
+	}
+
+	// In real implementation, would:
+	// 1. Interact with trading APIs
+	// 2. Execute buy/sell orders
+	// 3. Update token allocations
+	// 4. Record transaction details
+
+	return nil
+}
+
+// updateBasketAfterRebalance records executed trades in the basket holdings. Each
+// trade moves the metal it actually traded, which for a substitution is not the metal
+// that drifted, by the amount traded and by that amount in grams at its price.
+// Operations skipped as not worth trading, below the minimum or over the cap never
+// reach here.
+func (c *MBTRebalancingContract) updateBasketAfterRebalance(ctx contractapi.TransactionContextInterface, trades []*RebalanceOperation) error {
+	adjustment := RebalanceAdjustment{Values: map[string]float64{}, Grams: map[string]float64{}}
+	for _, trade := range trades {
+		metal, err := normalizeMetal(trade.MetalType)
+		if err != nil {
+			return err
+		}
+
+		change := tradeValueChange(trade)
+		grams, err := safeDivide(change, trade.CurrentPrice)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s trade to grams: %v", metal, err)
+		}
+
+		adjustment.Values[metal] += change
+		adjustment.Grams[metal] += grams
+	}
+
+	config, err := getBasketChaincodeConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	adjustmentJSON, err := json.Marshal(adjustment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rebalance adjustment: %v", err)
+	}
+
+	args := [][]byte{[]byte("ApplyRebalanceAdjustment"), adjustmentJSON}
+	response := ctx.GetStub().InvokeChaincode(config.Chaincode, args, config.Channel)
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to apply rebalance to %s: %s", config.Chaincode, response.Message)
+	}
+
+	return nil
+}
+
+// GetBasketHoldings gets the current holdings from the basket chaincode
+func (c *MBTRebalancingContract) GetBasketHoldings(ctx contractapi.TransactionContextInterface) (*BasketHolding, error) {
+	config, err := getBasketChaincodeConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	args := [][]byte{[]byte("GetBasketHoldings")}
+	response := ctx.GetStub().InvokeChaincode(config.Chaincode, args, config.Channel)
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to get holdings from %s: %s", config.Chaincode, response.Message)
+	}
+
+	var holdings BasketHolding
+	err = json.Unmarshal(response.Payload, &holdings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid holdings from %s: %v", config.Chaincode, err)
+	}
+
+	return &holdings, nil
 }
 
-func main() {
-	chaincode, err := contractapi.NewChaincode(new(MBTRebalancingContract))
+// checkRebalanceAllowed runs, before any state is written, the checks the basket
+// applies to a rebalance adjustment: the caller must be an admin and the basket's
+// rebalance operations must not be paused
+func (c *MBTRebalancingContract) checkRebalanceAllowed(ctx contractapi.TransactionContextInterface) error {
+	err := requireAdmin(ctx)
 	if err != nil {
-		log.Panicf("Error creating MBT rebalancing chaincode: %v", err)
+		return err
 	}
 
-	if err := chaincode.Start(); err != nil {
-		log.Panicf("Error starting MBT rebalancing chaincode: %v", err)
+	config, err := getBasketChaincodeConfig(ctx)
+	if err != nil {
+		return err
 	}
-}
\ No newline at end of file
+
+	args := [][]byte{[]byte("GetPauseFlags")}
+	response := ctx.GetStub().InvokeChaincode(config.Chaincode, args, config.Channel)
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to get pause flags from %s: %s", config.Chaincode, response.Message)
+	}
+
+	var flags PauseFlags
+	err = json.Unmarshal(response.Payload, &flags)
+	if err != nil {
+		return fmt.Errorf("invalid pause flags from %s: %v", config.Chaincode, err)
+	}
+
+	if flags.RebalancePaused {
+		return fmt.Errorf("rebalance operations are paused")
+	}
+
+	return nil
+}
+
+// getBasketChaincodeConfig reads which basket chaincode holdings come from
+func getBasketChaincodeConfig(ctx contractapi.TransactionContextInterface) (*BasketChaincodeConfig, error) {
+	configJSON, err := ctx.GetStub().GetState("BASKET_CHAINCODE_CONFIG")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read basket chaincode config: %v", err)
+	}
+	if configJSON == nil {
+		return nil, fmt.Errorf("basket chaincode config %w: call SetBasketChaincodeConfig", ErrNotFound)
+	}
+
+	var config BasketChaincodeConfig
+	err = json.Unmarshal(configJSON, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal basket chaincode config: %v", err)
+	}
+
+	return &config, nil
+}
+
+// GetBasketChaincodeConfig returns the basket chaincode holdings come from
+func (c *MBTRebalancingContract) GetBasketChaincodeConfig(ctx contractapi.TransactionContextInterface) (*BasketChaincodeConfig, error) {
+	return getBasketChaincodeConfig(ctx)
+}
+
+// SetBasketChaincodeConfig names the basket chaincode whose holdings are read and
+// rebalanced and whose pause flags gate execution (admin only)
+func (c *MBTRebalancingContract) SetBasketChaincodeConfig(ctx contractapi.TransactionContextInterface, chaincode, channel string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if chaincode == "" {
+		return fmt.Errorf("basket chaincode name is required")
+	}
+
+	configJSON, err := json.Marshal(BasketChaincodeConfig{Chaincode: chaincode, Channel: channel})
+	if err != nil {
+		return fmt.Errorf("failed to marshal basket chaincode config: %v", err)
+	}
+
+	err = ctx.GetStub().PutState("BASKET_CHAINCODE_CONFIG", configJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store basket chaincode config: %v", err)
+	}
+
+	log.Printf("Basket chaincode set to %s", chaincode)
+	return nil
+}
+
+// GetRebalanceRequests gets all rebalance requests
+func (c *MBTRebalancingContract) GetRebalanceRequests(ctx contractapi.TransactionContextInterface) ([]*RebalanceRequest, error) {
+	// "REBAL." is the first key past the "REBAL-" prefix, which keeps REBALANCE_POLICY out
+	iterator, err := ctx.GetStub().GetStateByRange("REBAL-", "REBAL.")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requests: %v", err)
+	}
+	defer iterator.Close()
+
+	var requests []*RebalanceRequest
+
+	for iterator.HasNext() {
+		requestJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request: %v", err)
+		}
+
+		var request RebalanceRequest
+		err = json.Unmarshal(requestJSON.Value, &request)
+		if err != nil {
+			continue // Skip invalid requests
+		}
+
+		requests = append(requests, &request)
+	}
+
+	return requests, nil
+}
+
+// MAX_REPORT_DAYS bounds the number of days a date-range query may scan
+const MAX_REPORT_DAYS = 366
+
+// getRequestsByDateRange gets the requests created between fromDate and toDate
+// (inclusive, YYYY-MM-DD) using the RequestByDate index
+func (c *MBTRebalancingContract) getRequestsByDateRange(ctx contractapi.TransactionContextInterface, 
+	fromDate, toDate string) ([]*RebalanceRequest, error) {
+
+	from, to, err := parseReportRange(fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []*RebalanceRequest
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("RequestByDate", []string{day.Format("2006-01-02")})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get date index: %v", err)
+		}
+
+		for iterator.HasNext() {
+			entry, err := iterator.Next()
+			if err != nil {
+				iterator.Close()
+				return nil, fmt.Errorf("failed to read date index: %v", err)
+			}
+
+			_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+			if err != nil || len(keyParts) != 2 {
+				continue // Skip malformed index entries
+			}
+
+			request, err := c.getRebalanceRequest(ctx, keyParts[1])
+			if err != nil {
+				continue // Request was removed after indexing
+			}
+
+			requests = append(requests, request)
+		}
+		iterator.Close()
+	}
+
+	return requests, nil
+}
+
+// GetRebalanceStatistics aggregates KPIs over executed rebalances created in a date range
+func (c *MBTRebalancingContract) GetRebalanceStatistics(ctx contractapi.TransactionContextInterface, 
+	fromDate, toDate string) (*RebalanceStatistics, error) {
+
+	requests, err := c.getRequestsByDateRange(ctx, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	stats := &RebalanceStatistics{FromDate: fromDate, ToDate: toDate}
+	totalMaxDeviation := 0.0
+
+	for _, request := range requests {
+		if request.Status != STATUS_EXECUTED {
+			continue
+		}
+
+		stats.RebalanceCount++
+		switch request.RequestType {
+		case "TIME":
+			stats.TimeTriggered++
+		case "DEVIATION":
+			stats.DeviationTriggered++
+		}
+
+		maxDeviation := 0.0
+		for _, deviation := range request.Deviations {
+			maxDeviation = math.Max(maxDeviation, math.Abs(deviation))
+		}
+		totalMaxDeviation += maxDeviation
+
+		operations, err := c.GetRebalanceOperations(ctx, request.RequestID)
+		if err != nil {
+			return nil, err
+		}
+
+		summary := summarizeOperations(operations)
+		stats.TotalTradedValue += summary.TotalTradeAmount
+		for _, operation := range operations {
+			stats.TotalFees += tradingFee(policy, operation.Amount)
+		}
+	}
+
+	if stats.RebalanceCount > 0 {
+		stats.AverageMaxDeviation = totalMaxDeviation / float64(stats.RebalanceCount)
+	}
+
+	return stats, nil
+}
+
+// GetRebalanceSavings estimates the fees saved by trading less than a full reversion
+// to target, over executed rebalances created in a date range. The hypothetical
+// trades revert every metal's deviation at the basket value recorded on the request;
+// the actual trades are the executed operations, which leave out deviations under
+// the trade minimums, cost-ineffective trades and the untraded part of a partial
+// rebalance. Both are charged at the current fee schedule.
+func (c *MBTRebalancingContract) GetRebalanceSavings(ctx contractapi.TransactionContextInterface, 
+	fromDate, toDate string) (*RebalanceSavings, error) {
+
+	requests, err := c.getRequestsByDateRange(ctx, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	savings := &RebalanceSavings{FromDate: fromDate, ToDate: toDate, Requests: []*RequestSavings{}}
+
+	for _, request := range requests {
+		if request.Status != STATUS_EXECUTED {
+			continue
+		}
+		if request.BasketValue <= 0 {
+			savings.ExcludedRequests++
+			continue
+		}
+
+		operations, err := c.GetRebalanceOperations(ctx, request.RequestID)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := &RequestSavings{RequestID: request.RequestID}
+		for _, operation := range operations {
+			if operation.Status != OPERATION_EXECUTED {
+				continue
+			}
+			entry.TradedValue += operation.Amount
+			entry.Fees += tradingFee(policy, operation.Amount)
+		}
+
+		for _, metal := range sortedMetals(request.Deviations) {
+			tradeAmount := roundHalfEven(math.Abs(request.Deviations[metal])*request.BasketValue, policy.TradeRoundingDecimals)
+			if tradeAmount == 0 {
+				continue
+			}
+			entry.FullReversionValue += tradeAmount
+			entry.FullReversionFees += tradingFee(policy, tradeAmount)
+		}
+		entry.FeeSavings = entry.FullReversionFees - entry.Fees
+
+		savings.RebalanceCount++
+		savings.TradedValue += entry.TradedValue
+		savings.FullReversionValue += entry.FullReversionValue
+		savings.Fees += entry.Fees
+		savings.FullReversionFees += entry.FullReversionFees
+		savings.Requests = append(savings.Requests, entry)
+	}
+	savings.FeeSavings = savings.FullReversionFees - savings.Fees
+
+	return savings, nil
+}
+
+// GetRebalanceOperations gets operations for a specific request, in generation order.
+// Operation IDs are read from the RequestOperation index and the iterator closed
+// before any operation is loaded; requests created before the index fall back to a scan.
+func (c *MBTRebalancingContract) GetRebalanceOperations(ctx contractapi.TransactionContextInterface, requestID string) ([]*RebalanceOperation, error) {
+	operationIDs, err := requestOperationIDs(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(operationIDs) == 0 {
+		return scanRebalanceOperations(ctx, requestID)
+	}
+
+	var operations []*RebalanceOperation
+	for _, operationID := range operationIDs {
+		operationJSON, err := ctx.GetStub().GetState(operationID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operation %s: %v", operationID, err)
+		}
+		if operationJSON == nil {
+			return nil, fmt.Errorf("operation %s is indexed but missing", operationID)
+		}
+
+		var operation RebalanceOperation
+		err = json.Unmarshal(operationJSON, &operation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal operation %s: %v", operationID, err)
+		}
+		operations = append(operations, &operation)
+	}
+
+	return operations, nil
+}
+
+// requestOperationIDs reads a request's operation IDs from the RequestOperation index
+func requestOperationIDs(ctx contractapi.TransactionContextInterface, requestID string) ([]string, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("RequestOperation", []string{requestID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query operation index: %v", err)
+	}
+	defer iterator.Close()
+
+	var operationIDs []string
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operation index: %v", err)
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil || len(keyParts) != 2 {
+			continue // Skip malformed index entries
+		}
+		operationIDs = append(operationIDs, keyParts[1])
+	}
+
+	return operationIDs, nil
+}
+
+// scanRebalanceOperations finds a request's operations by scanning every operation
+func scanRebalanceOperations(ctx contractapi.TransactionContextInterface, requestID string) ([]*RebalanceOperation, error) {
+	iterator, err := ctx.GetStub().GetStateByRange("OP-", "OPZ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operations: %v", err)
+	}
+	defer iterator.Close()
+
+	var operations []*RebalanceOperation
+
+	for iterator.HasNext() {
+		operationJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operation: %v", err)
+		}
+
+		var operation RebalanceOperation
+		err = json.Unmarshal(operationJSON.Value, &operation)
+		if err != nil {
+			continue // Skip invalid operations
+		}
+
+		if operation.RequestID == requestID {
+			operations = append(operations, &operation)
+		}
+	}
+
+	return operations, nil
+}
+
+// FlagOperation marks an operation for manual review without undoing its execution
+// (compliance or admin only)
+func (c *MBTRebalancingContract) FlagOperation(ctx contractapi.TransactionContextInterface,
+	requestID, operationID, reason string) error {
+
+	err := requireComplianceOrAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("flag reason must not be empty")
+	}
+
+	operationJSON, err := ctx.GetStub().GetState(operationID)
+	if err != nil {
+		return fmt.Errorf("failed to read operation: %v", err)
+	}
+
+	if operationJSON == nil {
+		return fmt.Errorf("operation %s not found", operationID)
+	}
+
+	var operation RebalanceOperation
+	err = json.Unmarshal(operationJSON, &operation)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal operation: %v", err)
+	}
+
+	if operation.RequestID != requestID {
+		return fmt.Errorf("operation %s does not belong to request %s", operationID, requestID)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	operation.Flagged = true
+	operation.FlagReason = reason
+	operation.FlaggedAt = now.Format(time.RFC3339)
+
+	operationJSON, err = json.Marshal(operation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal operation: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(operationID, operationJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store operation: %v", err)
+	}
+
+	log.Printf("Flagged operation %s of request %s: %s", operationID, requestID, reason)
+	return nil
+}
+
+// GetFlaggedOperations gets all flagged operations across requests
+func (c *MBTRebalancingContract) GetFlaggedOperations(ctx contractapi.TransactionContextInterface) ([]*RebalanceOperation, error) {
+	iterator, err := ctx.GetStub().GetStateByRange("OP-", "OPZ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operations: %v", err)
+	}
+	defer iterator.Close()
+
+	var operations []*RebalanceOperation
+
+	for iterator.HasNext() {
+		operationJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operation: %v", err)
+		}
+
+		var operation RebalanceOperation
+		err = json.Unmarshal(operationJSON.Value, &operation)
+		if err != nil {
+			continue // Skip invalid operations
+		}
+
+		if operation.Flagged {
+			operations = append(operations, &operation)
+		}
+	}
+
+	return operations, nil
+}
+
+// FindOrphanedOperations lists operations whose request no longer exists
+func (c *MBTRebalancingContract) FindOrphanedOperations(ctx contractapi.TransactionContextInterface) ([]*RebalanceOperation, error) {
+	iterator, err := ctx.GetStub().GetStateByRange("OP-", "OPZ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operations: %v", err)
+	}
+	defer iterator.Close()
+
+	operations := []*RebalanceOperation{}
+	requestExists := map[string]bool{}
+
+	for iterator.HasNext() {
+		operationJSON, err := iterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read operation: %v", err)
+		}
+
+		var operation RebalanceOperation
+		err = json.Unmarshal(operationJSON.Value, &operation)
+		if err != nil {
+			continue // Skip invalid operations
+		}
+
+		exists, checked := requestExists[operation.RequestID]
+		if !checked {
+			requestJSON, err := ctx.GetStub().GetState(operation.RequestID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read request: %v", err)
+			}
+			exists = requestJSON != nil
+			requestExists[operation.RequestID] = exists
+		}
+
+		if !exists {
+			operations = append(operations, &operation)
+		}
+	}
+
+	return operations, nil
+}
+
+// PurgeOrphanedOperations deletes operations whose request no longer exists, along
+// with their index entries, and returns how many were removed (admin only)
+func (c *MBTRebalancingContract) PurgeOrphanedOperations(ctx contractapi.TransactionContextInterface) (int, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	orphans, err := c.FindOrphanedOperations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, operation := range orphans {
+		err = ctx.GetStub().DelState(operation.OperationID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete operation %s: %v", operation.OperationID, err)
+		}
+
+		indexKey, err := ctx.GetStub().CreateCompositeKey("RequestOperation", []string{operation.RequestID, operation.OperationID})
+		if err != nil {
+			return 0, fmt.Errorf("failed to create index key: %v", err)
+		}
+		err = ctx.GetStub().DelState(indexKey)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete index for operation %s: %v", operation.OperationID, err)
+		}
+
+		executedAt, err := time.Parse(time.RFC3339, operation.ExecutedAt)
+		if err != nil {
+			continue // Never executed, so never indexed by execution date
+		}
+		execKey, err := ctx.GetStub().CreateCompositeKey("OperationByExecDate", 
+			[]string{executedAt.Format("2006-01-02"), operation.RequestID, operation.OperationID})
+		if err != nil {
+			return 0, fmt.Errorf("failed to create execution date index key: %v", err)
+		}
+		err = ctx.GetStub().DelState(execKey)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete execution date index for operation %s: %v", operation.OperationID, err)
+		}
+	}
+
+	log.Printf("Purged %d orphaned operations", len(orphans))
+	return len(orphans), nil
+}
+
+// GetDeviationReport compares current allocations against arbitrary target weights
+// without touching the stored policy
+func (c *MBTRebalancingContract) GetDeviationReport(ctx contractapi.TransactionContextInterface, targetsJSON string) (*DeviationReport, error) {
+	var targets map[string]float64
+	err := json.Unmarshal([]byte(targetsJSON), &targets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal targets: %v", err)
+	}
+
+	metals := []string{"gold", "silver", "platinum"}
+	targets, err = validateComposition(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get basket holdings: %v", err)
+	}
+
+	totalValue := holdings.TotalBGTValue + holdings.TotalBSTValue + holdings.TotalBPTValue
+	values := map[string]float64{
+		"gold":     holdings.TotalBGTValue,
+		"silver":   holdings.TotalBSTValue,
+		"platinum": holdings.TotalBPTValue,
+	}
+
+	report := &DeviationReport{TotalValue: totalValue}
+	for _, metal := range metals {
+		current := 0.0
+		if totalValue > 0 {
+			current = values[metal] / totalValue
+		}
+
+		deviation := current - targets[metal]
+		report.Metals = append(report.Metals, MetalDeviation{
+			Metal:         metal,
+			CurrentWeight: current,
+			TargetWeight:  targets[metal],
+			Deviation:     deviation,
+		})
+
+		if math.Abs(deviation) > report.MaxDeviation {
+			report.MaxDeviation = math.Abs(deviation)
+		}
+	}
+
+	return report, nil
+}
+
+// GetRebalanceRequestCountByStatus reads the per-status request counters, which
+// are maintained on every status change, so no requests are scanned
+func (c *MBTRebalancingContract) GetRebalanceRequestCountByStatus(ctx contractapi.TransactionContextInterface) (*RequestStatusCounts, error) {
+	result := &RequestStatusCounts{Counts: map[RequestStatus]int{}}
+
+	for _, status := range requestStatuses {
+		count, err := getRequestCount(ctx, status)
+		if err != nil {
+			return nil, err
+		}
+		result.Counts[status] = count
+		result.Total += count
+	}
+
+	return result, nil
+}
+
+// RecountRequestStatuses rebuilds the per-status counters from a scan of every
+// request (admin only). Needed once for requests created before the counters existed.
+func (c *MBTRebalancingContract) RecountRequestStatuses(ctx contractapi.TransactionContextInterface) (*RequestStatusCounts, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	requests, err := c.GetRebalanceRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RequestStatusCounts{Counts: map[RequestStatus]int{}}
+	for _, request := range requests {
+		result.Counts[request.Status]++
+		result.Total++
+	}
+
+	for _, status := range requestStatuses {
+		err = putRequestCount(ctx, status, result.Counts[status])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Recounted %d rebalance requests", result.Total)
+	return result, nil
+}
+
+// ExpireStaleRequests marks PENDING and APPROVED requests past the approval expiry as EXPIRED
+func (c *MBTRebalancingContract) ExpireStaleRequests(ctx contractapi.TransactionContextInterface) (int, error) {
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	requests, err := c.GetRebalanceRequests(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	counts := requestCounts{}
+	for _, request := range requests {
+		if !isRequestExpired(request, policy, now) {
+			continue
+		}
+
+		err = setRequestStatus(request, STATUS_EXPIRED, counts)
+		if err != nil {
+			return 0, err
+		}
+
+		requestJSON, err := json.Marshal(request)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal request: %v", err)
+		}
+
+		err = ctx.GetStub().PutState(request.RequestID, requestJSON)
+		if err != nil {
+			return 0, fmt.Errorf("failed to store request: %v", err)
+		}
+
+		expired++
+	}
+
+	err = counts.store(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("Expired %d stale rebalance requests", expired)
+	return expired, nil
+}
+
+// isRequestExpired reports whether a PENDING or APPROVED request is older than the
+// policy's approval expiry, measured from approval or, if unapproved, from creation
+func isRequestExpired(request *RebalanceRequest, policy *RebalancePolicy, now time.Time) bool {
+	if policy.ApprovalExpirySeconds <= 0 {
+		return false
+	}
+
+	since := ""
+	switch request.Status {
+	case STATUS_APPROVED:
+		since = request.ApprovedAt
+	case STATUS_PENDING:
+		since = request.CreatedAt
+	default:
+		return false
+	}
+
+	start, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return false
+	}
+
+	return now.Sub(start) > time.Duration(policy.ApprovalExpirySeconds)*time.Second
+}
+
+// validateComposition checks that a metal→weight map names at least one known
+// metal, once each, with non-negative weights summing to 1.0. Metals may be given
+// as friendly names or token codes; the result is keyed by friendly name.
+func validateComposition(composition map[string]float64) (map[string]float64, error) {
+	if len(composition) == 0 {
+		return nil, fmt.Errorf("composition must include at least one metal")
+	}
+
+	normalized := map[string]float64{}
+	totalWeight := 0.0
+	for _, code := range sortedMetals(composition) {
+		weight := composition[code]
+		metal, err := metalName(code)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := normalized[metal]; exists {
+			return nil, fmt.Errorf("duplicate weight for %s", metal)
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("weight for %s must not be negative", metal)
+		}
+		normalized[metal] = weight
+		totalWeight += weight
+	}
+
+	if math.Abs(totalWeight-1.0) > 1e-9 {
+		return nil, fmt.Errorf("weights must sum to 1.0, got %.4f", totalWeight)
+	}
+
+	return normalized, nil
+}
+
+// CreateBasket registers a new basket with its own policy, derived from the global
+// defaults with a custom composition (admin only)
+func (c *MBTRebalancingContract) CreateBasket(ctx contractapi.TransactionContextInterface, basketID, compositionJSON string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if basketID == "" {
+		return fmt.Errorf("basket ID must not be empty")
+	}
+
+	var composition map[string]float64
+	err = json.Unmarshal([]byte(compositionJSON), &composition)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal composition: %v", err)
+	}
+
+	composition, err = validateComposition(composition)
+	if err != nil {
+		return fmt.Errorf("invalid composition: %v", err)
+	}
+
+	policyKey, err := ctx.GetStub().CreateCompositeKey("BasketPolicy", []string{basketID})
+	if err != nil {
+		return fmt.Errorf("failed to create basket policy key: %v", err)
+	}
+
+	existing, err := ctx.GetStub().GetState(policyKey)
+	if err != nil {
+		return fmt.Errorf("failed to read basket policy: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("basket %s already exists", basketID)
+	}
+
+	defaults, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get default policy: %v", err)
+	}
+
+	policy := *defaults
+	policy.PolicyID = basketID + "_POLICY"
+	policy.Name = fmt.Sprintf("%s Rebalancing Policy", basketID)
+	policy.GoldAllocation = composition["gold"]
+	policy.SilverAllocation = composition["silver"]
+	policy.PlatinumAllocation = composition["platinum"]
+
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal basket policy: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(policyKey, policyJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store basket policy: %v", err)
+	}
+
+	log.Printf("Created basket %s (Gold: %.2f, Silver: %.2f, Platinum: %.2f)", 
+		basketID, policy.GoldAllocation, policy.SilverAllocation, policy.PlatinumAllocation)
+	return nil
+}
+
+// GetBasketPolicy retrieves the policy of a basket created with CreateBasket
+func (c *MBTRebalancingContract) GetBasketPolicy(ctx contractapi.TransactionContextInterface, basketID string) (*RebalancePolicy, error) {
+	policyKey, err := ctx.GetStub().CreateCompositeKey("BasketPolicy", []string{basketID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create basket policy key: %v", err)
+	}
+
+	policyJSON, err := ctx.GetStub().GetState(policyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read basket policy: %v", err)
+	}
+
+	if policyJSON == nil {
+		return nil, fmt.Errorf("basket %s does not exist", basketID)
+	}
+
+	var policy RebalancePolicy
+	err = json.Unmarshal(policyJSON, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal basket policy: %v", err)
+	}
+
+	return &policy, nil
+}
+
+// getRebalanceRequest reads a rebalance request from state
+func (c *MBTRebalancingContract) getRebalanceRequest(ctx contractapi.TransactionContextInterface, requestID string) (*RebalanceRequest, error) {
+	requestJSON, err := ctx.GetStub().GetState(requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request: %v", err)
+	}
+
+	if requestJSON == nil {
+		return nil, fmt.Errorf("request %s %w", requestID, ErrNotFound)
+	}
+
+	var request RebalanceRequest
+	err = json.Unmarshal(requestJSON, &request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %v", err)
+	}
+
+	return &request, nil
+}
+
+// GetRebalanceRequestDetail returns a request with its operations and a summary in one call
+func (c *MBTRebalancingContract) GetRebalanceRequestDetail(ctx contractapi.TransactionContextInterface, requestID string) (*RebalanceRequestDetail, error) {
+	request, err := c.getRebalanceRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	operations, err := c.GetRebalanceOperations(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if operations == nil {
+		operations = []*RebalanceOperation{}
+	}
+
+	return &RebalanceRequestDetail{
+		Request:    request,
+		Operations: operations,
+		Summary:    summarizeOperations(operations),
+	}, nil
+}
+
+// GetAuditTrailForRequest assembles a request with its approvals, its operations and
+// their execution outcomes, and any flagged or failed operations in one response.
+// An unknown request returns ErrNotFound.
+func (c *MBTRebalancingContract) GetAuditTrailForRequest(ctx contractapi.TransactionContextInterface, requestID string) (*RequestAuditTrail, error) {
+	detail, err := c.GetRebalanceRequestDetail(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	approvalStatus, err := c.GetRebalanceApprovalStatus(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	trail := &RequestAuditTrail{
+		Request:           detail.Request,
+		Approvals:         detail.Request.Approvals,
+		ApprovalStatus:    approvalStatus,
+		Operations:        detail.Operations,
+		Summary:           detail.Summary,
+		FlaggedOperations: []*RebalanceOperation{},
+		FailedOperations:  []*RebalanceOperation{},
+	}
+	if trail.Approvals == nil {
+		trail.Approvals = []RequestApproval{}
+	}
+
+	for _, operation := range detail.Operations {
+		if operation.Flagged {
+			trail.FlaggedOperations = append(trail.FlaggedOperations, operation)
+		}
+		if operation.Status == OPERATION_FAILED {
+			trail.FailedOperations = append(trail.FailedOperations, operation)
+		}
+	}
+
+	return trail, nil
+}
+
+// summarizeOperations totals counts and costs across operations
+func summarizeOperations(operations []*RebalanceOperation) OperationsSummary {
+	var summary OperationsSummary
+	for _, operation := range operations {
+		summary.OperationCount++
+		summary.TotalTradeAmount += operation.Amount
+		summary.TotalEstimatedCost += operation.EstimatedCost
+		if operation.OperationType == "BUY" {
+			summary.BuyCount++
+			summary.TotalBuyCost += operation.EstimatedCost
+		} else {
+			summary.SellCount++
+			summary.TotalSellCost += operation.EstimatedCost
+		}
+	}
+	return summary
+}
+
+// GetRebalanceEfficiencyScore compares an EXECUTED request's allocation before its
+// trades with the allocation its executed operations produce, and weighs the
+// reduction in max deviation against the trading fees paid
+func (c *MBTRebalancingContract) GetRebalanceEfficiencyScore(ctx contractapi.TransactionContextInterface, requestID string) (*RebalanceEfficiency, error) {
+	request, err := c.getRebalanceRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Status != STATUS_EXECUTED {
+		return nil, fmt.Errorf("request %s is %s; only EXECUTED requests can be scored", requestID, request.Status)
+	}
+
+	if request.BasketValue <= 0 {
+		return nil, fmt.Errorf("request %s has no recorded basket value to score against", requestID)
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	operations, err := c.GetRebalanceOperations(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	efficiency := &RebalanceEfficiency{
+		RequestID:      requestID,
+		PostTradeAlloc: map[string]float64{},
+	}
+
+	postValues := map[string]float64{}
+	for _, metal := range sortedMetals(request.TargetAlloc) {
+		postValues[metal] = request.CurrentAlloc[metal] * request.BasketValue
+
+		deviation := math.Abs(allocationDeviation(request.CurrentAlloc[metal], request.TargetAlloc[metal], policy.DeviationMode))
+		if deviation > efficiency.PreMaxDeviation {
+			efficiency.PreMaxDeviation = deviation
+		}
+	}
+
+	for _, operation := range operations {
+		if operation.Status != OPERATION_EXECUTED {
+			continue
+		}
+
+		metal, err := metalName(operation.MetalType)
+		if err != nil {
+			return nil, fmt.Errorf("operation %s: %v", operation.OperationID, err)
+		}
+		postValues[metal] += tradeValueChange(operation)
+		efficiency.TotalCost += tradingFee(policy, operation.Amount)
+	}
+
+	postTotal := 0.0
+	for _, metal := range sortedMetals(postValues) {
+		postTotal += postValues[metal]
+	}
+
+	for _, metal := range sortedMetals(postValues) {
+		if postTotal > 0 {
+			efficiency.PostTradeAlloc[metal] = postValues[metal] / postTotal
+		}
+		deviation := math.Abs(allocationDeviation(efficiency.PostTradeAlloc[metal], request.TargetAlloc[metal], policy.DeviationMode))
+		if deviation > efficiency.PostMaxDeviation {
+			efficiency.PostMaxDeviation = deviation
+		}
+	}
+
+	efficiency.DeviationReduction = efficiency.PreMaxDeviation - efficiency.PostMaxDeviation
+	if efficiency.TotalCost > 0 {
+		efficiency.Score = efficiency.DeviationReduction * request.BasketValue / efficiency.TotalCost
+	}
+
+	return efficiency, nil
+}
+
+// GetRebalanceCostEstimate estimates the all-in cost of a rebalance request,
+// including trading fees and a slippage buffer
+func (c *MBTRebalancingContract) GetRebalanceCostEstimate(ctx contractapi.TransactionContextInterface, requestID string) (*RebalanceCostEstimate, error) {
+	_, err := c.getRebalanceRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	operations, err := c.GetRebalanceOperations(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	estimate := &RebalanceCostEstimate{RequestID: requestID, Currency: policy.Currency}
+	if len(operations) == 0 {
+		return estimate, nil
+	}
+
+	// Operation amounts are currency values, so the figures are built from them
+	summary := summarizeOperations(operations)
+	estimate.GrossCost = summary.TotalTradeAmount
+	var buys, sells float64
+	for _, operation := range operations {
+		// Fees are charged on the traded amount, as in the efficiency and savings figures
+		estimate.TradingFees += tradingFee(policy, operation.Amount)
+		if operation.OperationType == "BUY" {
+			buys += operation.Amount
+		} else {
+			sells += operation.Amount
+		}
+	}
+	estimate.SlippageBuffer = estimate.GrossCost * policy.SlippageBufferPercent
+	estimate.NetCost = estimate.GrossCost + estimate.TradingFees + estimate.SlippageBuffer
+	estimate.CashRequired = math.Max(0, buys-sells+estimate.TradingFees+estimate.SlippageBuffer)
+
+	return estimate, nil
+}
+
+// SimulateRebalanceOutcome applies a request's planned operations to a copy of the
+// holdings and reports the projected allocation without writing state
+func (c *MBTRebalancingContract) SimulateRebalanceOutcome(ctx contractapi.TransactionContextInterface, requestID string) (*RebalanceSimulation, error) {
+	request, err := c.getRebalanceRequest(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get basket holdings: %v", err)
+	}
+
+	operations, err := c.GetRebalanceOperations(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	projected := map[string]float64{
+		"gold":     holdings.TotalBGTValue,
+		"silver":   holdings.TotalBSTValue,
+		"platinum": holdings.TotalBPTValue,
+	}
+	for _, operation := range operations {
+		metal, err := metalName(operation.MetalType)
+		if err != nil {
+			return nil, fmt.Errorf("operation %s: %v", operation.OperationID, err)
+		}
+		projected[metal] += tradeValueChange(operation)
+	}
+
+	simulation := &RebalanceSimulation{
+		RequestID:       requestID,
+		ProjectedValues: projected,
+		ProjectedAlloc:  map[string]float64{},
+		TargetAlloc:     request.TargetAlloc, // Targets the plan was generated for
+	}
+
+	totalValue := projected["gold"] + projected["silver"] + projected["platinum"]
+	for _, metal := range sortedMetals(projected) {
+		if totalValue > 0 {
+			simulation.ProjectedAlloc[metal] = projected[metal] / totalValue
+		}
+		deviation := math.Abs(allocationDeviation(simulation.ProjectedAlloc[metal], simulation.TargetAlloc[metal], policy.DeviationMode))
+		if deviation > simulation.MaxDeviation {
+			simulation.MaxDeviation = deviation
+		}
+	}
+
+	simulation.ExceedsBand = simulation.MaxDeviation >= policy.MaxDeviationPercent
+	if simulation.ExceedsBand {
+		log.Printf("Warning: request %s projects max deviation %.2f%% outside the %.2f%% band", 
+			requestID, simulation.MaxDeviation*100, policy.MaxDeviationPercent*100)
+	}
+
+	return simulation, nil
+}
+
+// GetProjectedDrift applies per-metal price changes, given as fractions keyed by
+// metal name (0.10 for a 10% rise), to the current holding values and reports the
+// resulting allocation against the policy targets. Metals not listed are unchanged.
+func (c *MBTRebalancingContract) GetProjectedDrift(ctx contractapi.TransactionContextInterface, priceChangesJSON string) (*ProjectedDrift, error) {
+	var priceChanges map[string]float64
+	err := json.Unmarshal([]byte(priceChangesJSON), &priceChanges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal price changes: %v", err)
+	}
+
+	for metal, change := range priceChanges {
+		if metal != "gold" && metal != "silver" && metal != "platinum" {
+			return nil, fmt.Errorf("unknown metal in price changes: %s", metal)
+		}
+		if change <= -1 {
+			return nil, fmt.Errorf("price change for %s must be greater than -100%%", metal)
+		}
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get basket holdings: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	projected := map[string]float64{
+		"gold":     holdings.TotalBGTValue * (1 + priceChanges["gold"]),
+		"silver":   holdings.TotalBSTValue * (1 + priceChanges["silver"]),
+		"platinum": holdings.TotalBPTValue * (1 + priceChanges["platinum"]),
+	}
+
+	drift := &ProjectedDrift{
+		PriceChanges:    priceChanges,
+		ProjectedValues: projected,
+		ProjectedAlloc:  map[string]float64{},
+		TargetAlloc:     targetAllocation(policy, now),
+	}
+
+	totalValue := projected["gold"] + projected["silver"] + projected["platinum"]
+	for _, metal := range sortedMetals(projected) {
+		if totalValue > 0 {
+			drift.ProjectedAlloc[metal] = projected[metal] / totalValue
+		}
+		deviation := math.Abs(allocationDeviation(drift.ProjectedAlloc[metal], drift.TargetAlloc[metal], policy.DeviationMode))
+		if deviation > drift.MaxDeviation {
+			drift.MaxDeviation = deviation
+		}
+	}
+
+	// Same trigger as EvaluateRebalanceNeed; an empty basket never drifts
+	drift.BreachesThreshold = totalValue > 0 && drift.MaxDeviation >= policy.MaxDeviationPercent
+
+	return drift, nil
+}
+
+// RunScheduledRebalance is invoked by an off-chain scheduler. When the rebalance
+// interval has elapsed it creates a TIME request and, if no approval is required,
+// executes it in the same call. Repeat calls on the same day do nothing.
+func (c *MBTRebalancingContract) RunScheduledRebalance(ctx contractapi.TransactionContextInterface) (*ScheduledRebalanceResult, error) {
+	err := c.checkRebalanceAllowed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScheduledRebalanceResult{RunDate: now.Format("2006-01-02")}
+
+	lastRun, err := ctx.GetStub().GetState("SCHEDULED_REBALANCE_LAST_RUN")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read last scheduled run: %v", err)
+	}
+	if string(lastRun) == result.RunDate {
+		result.Message = "Scheduled rebalance already ran today"
+		return result, nil
+	}
+
+	err = ctx.GetStub().PutState("SCHEDULED_REBALANCE_LAST_RUN", []byte(result.RunDate))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store last scheduled run: %v", err)
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rebalance policy: %v", err)
+	}
+
+	holdings, err := c.GetBasketHoldings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get basket holdings: %v", err)
+	}
+
+	lastRebalance, err := time.Parse(time.RFC3339, holdings.LastRebalance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse last rebalance time: %v", err)
+	}
+
+	daysSinceRebalance := now.Sub(lastRebalance).Hours() / 24
+	if daysSinceRebalance < float64(policy.RebalanceIntervalDays) {
+		result.Message = fmt.Sprintf("Rebalance not due: %.0f of %d days elapsed", 
+			daysSinceRebalance, policy.RebalanceIntervalDays)
+		return result, nil
+	}
+
+	result.Due = true
+	currentAlloc, targetAlloc, deviations := calculateAllocations(holdings, policy, now)
+	reason := fmt.Sprintf("Scheduled rebalancing after %.0f days", daysSinceRebalance)
+
+	counts := requestCounts{}
+	request, operations, err := c.createRebalanceRequest(ctx, counts, currentAlloc, targetAlloc, deviations, "TIME", reason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rebalance request: %v", err)
+	}
+	result.RequestID = request.RequestID
+
+	if request.ApprovalRequired {
+		err = counts.store(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result.Message = "Rebalance request created and awaiting approval"
+		return result, nil
+	}
+
+	err = c.executeRebalance(ctx, request, operations, false, 1, counts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute rebalance: %v", err)
+	}
+
+	err = counts.store(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Executed = request.Status == STATUS_EXECUTED
+	result.Message = fmt.Sprintf("Rebalance request created and executed with status %s", request.Status)
+	return result, nil
+}
+
+// GetActiveRebalanceRequest gets the in-flight (PENDING, APPROVED or PARTIALLY_EXECUTED)
+// request for a basket, or nil if there is none. If several exist the most recently
+// created is returned.
+func (c *MBTRebalancingContract) GetActiveRebalanceRequest(ctx contractapi.TransactionContextInterface, basketID string) (*RebalanceRequest, error) {
+	requests, err := c.GetRebalanceRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var active *RebalanceRequest
+	for _, request := range requests {
+		if request.BasketID != basketID {
+			continue
+		}
+		if request.Status != STATUS_PENDING && request.Status != STATUS_APPROVED && request.Status != STATUS_PARTIAL {
+			continue
+		}
+		if active == nil || createdAfter(request, active) {
+			active = request
+		}
+	}
+
+	return active, nil
+}
+
+// createdAfter reports whether request a was created after request b. Request IDs
+// come from transaction IDs, so their key order says nothing about age; they only
+// break ties between requests created at the same time.
+func createdAfter(a, b *RebalanceRequest) bool {
+	aCreated, aErr := time.Parse(time.RFC3339, a.CreatedAt)
+	bCreated, bErr := time.Parse(time.RFC3339, b.CreatedAt)
+	if aErr == nil && bErr == nil && !aCreated.Equal(bCreated) {
+		return aCreated.After(bCreated)
+	}
+	return a.RequestID > b.RequestID
+}
+
+// IsBasketBusy reports whether user mints and redemptions should wait: the policy
+// blocks them during rebalancing and an APPROVED or PARTIALLY_EXECUTED request for
+// the basket has not finished executing. The basket contract consults this before user flows.
+func (c *MBTRebalancingContract) IsBasketBusy(ctx contractapi.TransactionContextInterface, basketID string) (bool, error) {
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	if !policy.BlockDuringRebalance {
+		return false, nil
+	}
+
+	requests, err := c.GetRebalanceRequests(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, request := range requests {
+		if request.BasketID == basketID && (request.Status == STATUS_APPROVED || request.Status == STATUS_PARTIAL) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// GetBasketCompositionTargets returns the policy's target weights in effect at the
+// transaction time, keyed by metal name. The basket contract mints and checks drift
+// against these.
+func (c *MBTRebalancingContract) GetBasketCompositionTargets(ctx contractapi.TransactionContextInterface) (map[string]float64, error) {
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return targetAllocation(policy, now), nil
+}
+
+// policyCompositionTolerance returns the policy's composition tolerance, or the
+// default for policies stored before the field existed
+func policyCompositionTolerance(policy *RebalancePolicy) float64 {
+	if policy.CompositionTolerancePercent > 0 {
+		return policy.CompositionTolerancePercent
+	}
+	return COMPOSITION_TOLERANCE_PERCENT
+}
+
+// GetCompositionTolerance returns how far a metal's weight may sit from its target
+// and still count as on target. The basket chaincode uses it to accept in-kind mints.
+func (c *MBTRebalancingContract) GetCompositionTolerance(ctx contractapi.TransactionContextInterface) (float64, error) {
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	return policyCompositionTolerance(policy), nil
+}
+
+// GetCashBufferPercent returns the share of each mint the basket holds as cash. The
+// buffer sits outside the metal allocations, so rebalancing trades never touch it.
+func (c *MBTRebalancingContract) GetCashBufferPercent(ctx contractapi.TransactionContextInterface) (float64, error) {
+	policy, err := c.GetRebalancePolicy(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get policy: %v", err)
+	}
+
+	return policy.CashBufferPercent, nil
+}
+
+// GetTradeLedger exports the operations executed in a date range, whatever their
+// request's status, ordered by execution date, request, then operation. Execution
+// is simulated at the quoted price, so the executed price is the quoted price.
+func (c *MBTRebalancingContract) GetTradeLedger(ctx contractapi.TransactionContextInterface, 
+	fromDate, toDate string) ([]*TradeLedgerEntry, error) {
+
+	from, to, err := parseReportRange(fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := []*TradeLedgerEntry{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		iterator, err := ctx.GetStub().GetStateByPartialCompositeKey("OperationByExecDate", []string{day.Format("2006-01-02")})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get execution date index: %v", err)
+		}
+
+		for iterator.HasNext() {
+			entry, err := iterator.Next()
+			if err != nil {
+				iterator.Close()
+				return nil, fmt.Errorf("failed to read execution date index: %v", err)
+			}
+
+			_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+			if err != nil || len(keyParts) != 3 {
+				continue // Skip malformed index entries
+			}
+
+			operationJSON, err := ctx.GetStub().GetState(keyParts[2])
+			if err != nil {
+				iterator.Close()
+				return nil, fmt.Errorf("failed to read operation %s: %v", keyParts[2], err)
+			}
+			if operationJSON == nil {
+				continue // Operation was purged after indexing
+			}
+
+			var operation RebalanceOperation
+			err = json.Unmarshal(operationJSON, &operation)
+			if err != nil {
+				iterator.Close()
+				return nil, fmt.Errorf("failed to unmarshal operation %s: %v", keyParts[2], err)
+			}
+
+			if operation.Status != OPERATION_EXECUTED {
+				continue
+			}
+
+			ledger = append(ledger, &TradeLedgerEntry{
+				RequestID:     operation.RequestID,
+				OperationID:   operation.OperationID,
+				Metal:         operation.MetalType,
+				Side:          operation.OperationType,
+				Amount:        operation.Amount,
+				ExecutedPrice: operation.CurrentPrice,
+				Cost:          operation.Amount, // Amounts are currency values
+				ExecutedAt:    operation.ExecutedAt,
+			})
+		}
+		iterator.Close()
+	}
+
+	return ledger, nil
+}
+
+// parseReportRange parses an inclusive YYYY-MM-DD date range of at most MAX_REPORT_DAYS
+func parseReportRange(fromDate, toDate string) (time.Time, time.Time, error) {
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from date %s: %v", fromDate, err)
+	}
+
+	to, err := time.Parse("2006-01-02", toDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to date %s: %v", toDate, err)
+	}
+
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from date must not be after to date")
+	}
+
+	if to.Sub(from).Hours()/24 >= MAX_REPORT_DAYS {
+		return time.Time{}, time.Time{}, fmt.Errorf("date range exceeds %d days", MAX_REPORT_DAYS)
+	}
+
+	return from, to, nil
+}
+
+// checkComposition reports the first metal whose weight sits further from its
+// target than the policy's composition tolerance. An empty basket passes.
+func (c *MBTRebalancingContract) checkComposition(ctx contractapi.TransactionContextInterface, 
+	holdings *BasketHolding, policy *RebalancePolicy) error {
+
+	if holdings.TotalBGTValue+holdings.TotalBSTValue+holdings.TotalBPTValue == 0 {
+		return nil
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	tolerance := policyCompositionTolerance(policy)
+	currentAlloc, targetAlloc, _ := calculateAllocations(holdings, policy, now)
+	for _, metal := range sortedMetals(targetAlloc) {
+		gap := math.Abs(currentAlloc[metal] - targetAlloc[metal])
+		if gap > tolerance {
+			return fmt.Errorf("%s weight %.2f%% is %.2f points from target %.2f%%, tolerance %.2f", 
+				metal, currentAlloc[metal]*100, gap*100, targetAlloc[metal]*100, tolerance*100)
+		}
+	}
+
+	return nil
+}
+
+// GetStateSize counts the rebalancing chaincode's keys by category (admin only).
+// Values are not decoded, and each count stops at MAX_STATE_SCAN_KEYS.
+func (c *MBTRebalancingContract) GetStateSize(ctx contractapi.TransactionContextInterface) (*StateSize, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	size := &StateSize{Categories: []StateCategorySize{}, Timestamp: timestamp}
+
+	requests, err := countRangeKeys(ctx, "requests", "REBAL-", "REBAL.")
+	if err != nil {
+		return nil, err
+	}
+	size.Categories = append(size.Categories, requests)
+
+	operations, err := countRangeKeys(ctx, "operations", "OP-", "OPZ")
+	if err != nil {
+		return nil, err
+	}
+	size.Categories = append(size.Categories, operations)
+
+	policyVersions, err := countCompositeKeys(ctx, "policyVersions", "PolicyVersion")
+	if err != nil {
+		return nil, err
+	}
+	size.Categories = append(size.Categories, policyVersions)
+
+	return size, nil
+}
+
+// SelfTest runs read-only readiness checks for use as a deployment probe. Failed
+// checks are reported rather than returned as errors.
+func (c *MBTRebalancingContract) SelfTest(ctx contractapi.TransactionContextInterface) (*SelfTestReport, error) {
+	report := &SelfTestReport{Checks: []SelfTestCheck{}}
+	check := func(name string, err error, message string) {
+		result := SelfTestCheck{Name: name, Passed: err == nil, Message: message}
+		if err != nil {
+			result.Message = err.Error()
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	policy, err := c.GetRebalancePolicy(ctx)
+	check("policy", err, "rebalance policy is initialized")
+
+	if policy != nil {
+		total := policy.GoldAllocation + policy.SilverAllocation + policy.PlatinumAllocation
+		var allocErr error
+		if math.Abs(total-1.0) > 1e-9 {
+			allocErr = fmt.Errorf("allocations sum to %.4f, expected 1.0", total)
+		}
+		check("allocations", allocErr, "allocations sum to 1.0")
+	} else {
+		check("allocations", fmt.Errorf("skipped: no policy"), "")
+	}
+
+	holdings, err := c.GetBasketHoldings(ctx)
+	check("holdings", err, "basket holdings are readable")
+
+	if policy != nil && holdings != nil {
+		check("composition", c.checkComposition(ctx, holdings, policy), "composition is within tolerance of target")
+	} else {
+		check("composition", fmt.Errorf("skipped: no policy or holdings"), "")
+	}
+
+	prices, err := c.GetCurrentMetalPrices(ctx)
+	if err == nil {
+		for _, metal := range []string{"BGT", "BST", "BPT"} {
+			if prices[metal] <= 0 {
+				err = fmt.Errorf("no price available for %s", metal)
+				break
+			}
+		}
+	}
+	check("prices", err, "metal prices are available")
+
+	report.Healthy = true
+	for _, result := range report.Checks {
+		if !result.Passed {
+			report.Healthy = false
+		}
+	}
+
+	return report, nil
+}
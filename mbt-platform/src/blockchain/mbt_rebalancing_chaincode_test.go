@@ -0,0 +1,2545 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// testHoldings is a 100,000 basket overweight in gold against the default 50/30/20 policy
+var testHoldings = BasketHolding{
+	TotalMBTSupply: 100000,
+	TotalBGTValue:  60000,
+	TotalBSTValue:  25000,
+	TotalBPTValue:  15000,
+	TotalBGTGrams:  10,
+	TotalBSTGrams:  300,
+	TotalBPTGrams:  5,
+}
+
+// testDeviations are testHoldings' deviations from the default policy, current minus target
+var testDeviations = map[string]float64{"gold": 0.10, "silver": -0.05, "platinum": -0.05}
+
+// newRebalancingStub returns a stub with the default policy and a mock basket
+// chaincode serving testHoldings. Applied adjustments are appended to the slice.
+func newRebalancingStub(t *testing.T, adjustments *[]RebalanceAdjustment) *mockStub {
+	t.Helper()
+	contract := &MBTRebalancingContract{}
+	stub := newMockStub()
+
+	err := contract.InitializePolicy(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("InitializePolicy: %v", err)
+	}
+	err = contract.SetBasketChaincodeConfig(asAdmin(stub), "mbt-basket", "")
+	if err != nil {
+		t.Fatalf("SetBasketChaincodeConfig: %v", err)
+	}
+
+	stub.invoke["mbt-basket"] = map[string]func(args [][]byte) peer.Response{
+		"GetPauseFlags": func(args [][]byte) peer.Response {
+			return peer.Response{Status: shim.OK, Payload: []byte(`{}`)}
+		},
+		"ApplyRebalanceAdjustment": func(args [][]byte) peer.Response {
+			var adjustment RebalanceAdjustment
+			err := json.Unmarshal(args[0], &adjustment)
+			if err != nil {
+				return peer.Response{Status: shim.ERROR, Message: err.Error()}
+			}
+			*adjustments = append(*adjustments, adjustment)
+			return peer.Response{Status: shim.OK}
+		},
+	}
+	serveHoldings(t, stub, testHoldings)
+
+	return stub
+}
+
+// serveHoldings makes the mock basket chaincode report the given holdings
+func serveHoldings(t *testing.T, stub *mockStub, holdings BasketHolding) {
+	t.Helper()
+	holdingsJSON, err := json.Marshal(holdings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.invoke["mbt-basket"]["GetBasketHoldings"] = func(args [][]byte) peer.Response {
+		return peer.Response{Status: shim.OK, Payload: holdingsJSON}
+	}
+}
+
+// stateSnapshot copies the world state so a test can assert nothing was written
+func stateSnapshot(stub *mockStub) map[string]string {
+	snapshot := map[string]string{}
+	for key, value := range stub.state {
+		snapshot[key] = string(value)
+	}
+	return snapshot
+}
+
+// putRequest stores a request record directly
+func putRequest(t *testing.T, stub *mockStub, request RebalanceRequest) {
+	t.Helper()
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.state[request.RequestID] = requestJSON
+}
+
+// putApprovedRequest stores an APPROVED time-triggered request for testDeviations
+// with its operations, as createRebalanceRequest and approval would
+func putApprovedRequest(t *testing.T, stub *mockStub, requestID string) []*RebalanceOperation {
+	t.Helper()
+	contract := &MBTRebalancingContract{}
+	ctx := asAdmin(stub)
+
+	request := RebalanceRequest{
+		RequestID:   requestID,
+		RequestType: "TIME",
+		Deviations:  testDeviations,
+		Status:      STATUS_APPROVED,
+		CreatedAt:   stub.txTime.Format(time.RFC3339),
+		ApprovedAt:  stub.txTime.Format(time.RFC3339),
+		BasketValue: 100000,
+	}
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.state[requestID] = requestJSON
+	stub.state["REQUEST_COUNT_"+string(STATUS_APPROVED)] = []byte("1")
+
+	holdings := testHoldings
+	operations, err := contract.generateRebalanceOperations(ctx, requestID, testDeviations, &holdings, 100000, 1)
+	if err != nil {
+		t.Fatalf("generateRebalanceOperations: %v", err)
+	}
+	return operations
+}
+
+func TestRequestStatusTransitions(t *testing.T) {
+	allowed := []struct{ from, to RequestStatus }{
+		{STATUS_PENDING, STATUS_APPROVED},
+		{STATUS_PENDING, STATUS_PARTIAL},
+		{STATUS_APPROVED, STATUS_EXECUTED},
+		{STATUS_APPROVED, STATUS_PARTIAL},
+		{STATUS_PARTIAL, STATUS_PARTIAL},
+		{STATUS_PARTIAL, STATUS_EXECUTED},
+		{STATUS_PARTIAL, STATUS_FAILED},
+		{STATUS_FAILED, STATUS_EXECUTED},
+	}
+	for _, transition := range allowed {
+		if !canTransition(transition.from, transition.to) {
+			t.Errorf("%s to %s should be allowed", transition.from, transition.to)
+		}
+	}
+
+	rejected := []struct{ from, to RequestStatus }{
+		{STATUS_EXECUTED, STATUS_PENDING},
+		{STATUS_EXECUTED, STATUS_PARTIAL},
+		{STATUS_EXPIRED, STATUS_APPROVED},
+		{STATUS_SUPERSEDED, STATUS_EXECUTED},
+		{STATUS_PARTIAL, STATUS_APPROVED},
+		{STATUS_PARTIAL, STATUS_EXPIRED},
+		{STATUS_APPROVED, STATUS_PENDING},
+	}
+	for _, transition := range rejected {
+		if canTransition(transition.from, transition.to) {
+			t.Errorf("%s to %s should be rejected", transition.from, transition.to)
+		}
+	}
+
+	counts := requestCounts{}
+	request := &RebalanceRequest{RequestID: "REBAL-1", Status: STATUS_EXECUTED}
+	err := setRequestStatus(request, STATUS_PENDING, counts)
+	if err == nil || request.Status != STATUS_EXECUTED || len(counts) != 0 {
+		t.Errorf("illegal transition: got %v, status %s, counts %v", err, request.Status, counts)
+	}
+
+	request.Status = STATUS_APPROVED
+	err = setRequestStatus(request, STATUS_EXECUTED, counts)
+	if err != nil || counts[STATUS_APPROVED] != -1 || counts[STATUS_EXECUTED] != 1 {
+		t.Errorf("legal transition: got %v, counts %v", err, counts)
+	}
+}
+
+func TestRebalanceTradeDirection(t *testing.T) {
+	side, delta := rebalanceTrade(0.10) // Overweight
+	if side != "SELL" || delta != -0.10 {
+		t.Errorf("overweight: got %s %v, want SELL -0.1", side, delta)
+	}
+
+	side, delta = rebalanceTrade(-0.05) // Underweight
+	if side != "BUY" || delta != 0.05 {
+		t.Errorf("underweight: got %s %v, want BUY 0.05", side, delta)
+	}
+}
+
+func TestGeneratedOperationsTradeTowardTarget(t *testing.T) {
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	operations := putApprovedRequest(t, stub, "REBAL-1")
+
+	want := map[string]struct {
+		side   string
+		amount float64
+	}{
+		"BGT": {"SELL", 10000},
+		"BST": {"BUY", 5000},
+		"BPT": {"BUY", 5000},
+	}
+	if len(operations) != len(want) {
+		t.Fatalf("got %d operations, want %d", len(operations), len(want))
+	}
+	for _, operation := range operations {
+		expected := want[operation.MetalType]
+		if operation.OperationType != expected.side || operation.Amount != expected.amount {
+			t.Errorf("%s: got %s %.2f, want %s %.2f", operation.MetalType,
+				operation.OperationType, operation.Amount, expected.side, expected.amount)
+		}
+	}
+}
+
+func TestPartialExecutionStaysOpenUntilComplete(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	putApprovedRequest(t, stub, "REBAL-1")
+
+	stub.nextTx("tx2")
+	err := contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0.5)
+	if err != nil {
+		t.Fatalf("first tranche: %v", err)
+	}
+
+	request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Status != STATUS_PARTIAL {
+		t.Errorf("after half: status %s, want %s", request.Status, STATUS_PARTIAL)
+	}
+
+	operations, err := contract.GetRebalanceOperations(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, operation := range operations {
+		if operation.Status != OPERATION_PENDING || operation.ExecutedAmount != operation.Amount/2 {
+			t.Errorf("%s after half: status %s, executed %.2f of %.2f", operation.OperationID,
+				operation.Status, operation.ExecutedAmount, operation.Amount)
+		}
+	}
+
+	// Each tranche moves holdings toward target: gold is sold, silver and platinum bought
+	if len(adjustments) != 1 {
+		t.Fatalf("got %d adjustments after half, want 1", len(adjustments))
+	}
+	if got := adjustments[0].Values; math.Abs(got["BGT"]+5000) > 1e-6 || math.Abs(got["BST"]-2500) > 1e-6 {
+		t.Errorf("first tranche adjustment: got %v, want BGT -5000 and BST +2500", got)
+	}
+
+	stub.nextTx("tx3")
+	err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err != nil {
+		t.Fatalf("remaining tranche: %v", err)
+	}
+
+	request, err = contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Status != STATUS_EXECUTED || request.CompletionFraction != 1 {
+		t.Errorf("after rest: status %s, fraction %v", request.Status, request.CompletionFraction)
+	}
+
+	operations, err = contract.GetRebalanceOperations(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, operation := range operations {
+		if operation.Status != OPERATION_EXECUTED || operation.ExecutedAmount != operation.Amount {
+			t.Errorf("%s after rest: status %s, executed %.2f of %.2f", operation.OperationID,
+				operation.Status, operation.ExecutedAmount, operation.Amount)
+		}
+	}
+	if len(adjustments) != 2 || math.Abs(adjustments[1].Values["BGT"]+5000) > 1e-6 {
+		t.Errorf("second tranche adjustments: got %v", adjustments)
+	}
+
+	for status, want := range map[RequestStatus]int{STATUS_APPROVED: 0, STATUS_PARTIAL: 0, STATUS_EXECUTED: 1} {
+		count, err := getRequestCount(asAdmin(stub), status)
+		if err != nil || count != want {
+			t.Errorf("%s count: got %d, %v, want %d", status, count, err, want)
+		}
+	}
+
+	date := stub.txTime.Format("2006-01-02")
+	ledger, err := contract.GetTradeLedger(asAdmin(stub), date, date)
+	if err != nil || len(ledger) != 3 {
+		t.Errorf("trade ledger: got %d entries, %v, want 3", len(ledger), err)
+	}
+
+	err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err == nil {
+		t.Error("executing an EXECUTED request again succeeded")
+	}
+}
+
+func TestPurgeOrphanedOperationsRemovesIndexes(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	operations := putApprovedRequest(t, stub, "REBAL-1")
+
+	stub.nextTx("tx2")
+	err := contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+
+	// A second request that still exists keeps its operations
+	stub.nextTx("tx3")
+	kept := putApprovedRequest(t, stub, "REBAL-2")
+
+	delete(stub.state, "REBAL-1")
+
+	_, err = contract.PurgeOrphanedOperations(asUser(stub, "alice"))
+	if err == nil {
+		t.Error("PurgeOrphanedOperations by a non-admin succeeded")
+	}
+
+	purged, err := contract.PurgeOrphanedOperations(asAdmin(stub))
+	if err != nil || purged != len(operations) {
+		t.Fatalf("PurgeOrphanedOperations: got %d, %v, want %d", purged, err, len(operations))
+	}
+
+	for _, operation := range operations {
+		if stub.state[operation.OperationID] != nil {
+			t.Errorf("operation %s survived the purge", operation.OperationID)
+		}
+	}
+	for key := range stub.state {
+		if strings.Contains(key, "REBAL-1") {
+			t.Errorf("index key %q survived the purge", key)
+		}
+	}
+
+	remaining, err := contract.GetRebalanceOperations(asAdmin(stub), "REBAL-2")
+	if err != nil || len(remaining) != len(kept) {
+		t.Errorf("operations of REBAL-2: got %d, %v, want %d", len(remaining), err, len(kept))
+	}
+}
+
+func TestRebalancingGuardsRejectOtherCallers(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	operations := putApprovedRequest(t, stub, "REBAL-1")
+
+	err := contract.UpdateRebalancePolicy(asUser(stub, "alice"), `{}`)
+	if err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("UpdateRebalancePolicy by a non-admin: got %v", err)
+	}
+
+	err = contract.SetBasketChaincodeConfig(asUser(stub, "alice"), "other", "")
+	if err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("SetBasketChaincodeConfig by a non-admin: got %v", err)
+	}
+
+	err = contract.FlagOperation(asUser(stub, "alice"), "REBAL-1", operations[0].OperationID, "review")
+	if err == nil {
+		t.Error("FlagOperation by a caller without compliance or admin succeeded")
+	}
+
+	compliance := newMockContext(stub, "carol", map[string]string{"compliance": "true"})
+	err = contract.FlagOperation(compliance, "REBAL-1", operations[0].OperationID, "review")
+	if err != nil {
+		t.Errorf("FlagOperation by compliance: %v", err)
+	}
+}
+
+func TestRebalanceExecutionChecksCallerAndPauseFirst(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	putApprovedRequest(t, stub, "REBAL-1")
+	stub.nextTx("tx2")
+
+	calls := map[string]func(ctx *mockContext) error{
+		"ExecuteRebalance": func(ctx *mockContext) error {
+			return contract.ExecuteRebalance(ctx, "REBAL-1", false, 0)
+		},
+		"ResumeRebalance": func(ctx *mockContext) error {
+			return contract.ResumeRebalance(ctx, "REBAL-1")
+		},
+		"RunScheduledRebalance": func(ctx *mockContext) error {
+			_, err := contract.RunScheduledRebalance(ctx)
+			return err
+		},
+	}
+
+	before := stateSnapshot(stub)
+	for name, call := range calls {
+		err := call(asUser(stub, "alice"))
+		if err == nil || !strings.Contains(err.Error(), "unauthorized") {
+			t.Errorf("%s by a non-admin: got %v, want unauthorized", name, err)
+		}
+	}
+
+	stub.invoke["mbt-basket"]["GetPauseFlags"] = func(args [][]byte) peer.Response {
+		return peer.Response{Status: shim.OK, Payload: []byte(`{"rebalancePaused":true}`)}
+	}
+	for name, call := range calls {
+		err := call(asAdmin(stub))
+		if err == nil || !strings.Contains(err.Error(), "paused") {
+			t.Errorf("%s while paused: got %v, want paused", name, err)
+		}
+	}
+
+	if !reflect.DeepEqual(stateSnapshot(stub), before) || len(adjustments) != 0 {
+		t.Error("rejected rebalance calls wrote state or adjusted the basket")
+	}
+}
+
+func TestFailedBasketUpdateAbortsExecution(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	putApprovedRequest(t, stub, "REBAL-1")
+
+	stub.invoke["mbt-basket"]["ApplyRebalanceAdjustment"] = func(args [][]byte) peer.Response {
+		return peer.Response{Status: shim.ERROR, Message: "holdings would go negative"}
+	}
+
+	stub.nextTx("tx2")
+	err := contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err == nil || !strings.Contains(err.Error(), "holdings would go negative") {
+		t.Errorf("ExecuteRebalance with a failing basket update: got %v", err)
+	}
+}
+
+func TestResolvedDeviationSupersedesRequest(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+
+	for _, requestID := range []string{"REBAL-1", "REBAL-2"} {
+		putApprovedRequest(t, stub, requestID)
+		request, err := contract.getRebalanceRequest(asAdmin(stub), requestID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.RequestType = "DEVIATION"
+		requestJSON, err := json.Marshal(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.state[requestID] = requestJSON
+	}
+	stub.state["REQUEST_COUNT_"+string(STATUS_APPROVED)] = []byte("2")
+
+	// By execution time the basket has drifted back onto the 50/30/20 target
+	onTarget := testHoldings
+	onTarget.TotalBGTValue, onTarget.TotalBSTValue, onTarget.TotalBPTValue = 50000, 30000, 20000
+	serveHoldings(t, stub, onTarget)
+
+	stub.nextTx("tx2")
+	err := contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+
+	request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Status != STATUS_SUPERSEDED || request.SupersededReason == "" {
+		t.Errorf("resolved request: status %s, reason %q, want %s with a reason", request.Status,
+			request.SupersededReason, STATUS_SUPERSEDED)
+	}
+	operations, err := contract.GetRebalanceOperations(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, operation := range operations {
+		if operation.Status == OPERATION_EXECUTED || operation.ExecutedAmount != 0 {
+			t.Errorf("superseded request traded operation %s", operation.OperationID)
+		}
+	}
+	if len(adjustments) != 0 {
+		t.Errorf("superseded request adjusted the basket: %v", adjustments)
+	}
+
+	// force executes regardless
+	stub.nextTx("tx3")
+	err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-2", true, 0)
+	if err != nil {
+		t.Fatalf("forced ExecuteRebalance: %v", err)
+	}
+	request, err = contract.getRebalanceRequest(asAdmin(stub), "REBAL-2")
+	if err != nil || request.Status != STATUS_EXECUTED {
+		t.Errorf("forced request: got %v, %v, want %s", request.Status, err, STATUS_EXECUTED)
+	}
+}
+
+func TestActiveRequestIsTheMostRecentlyCreated(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	stub := newMockStub()
+
+	// Key order runs opposite to creation order, as it can with transaction IDs
+	putRequest(t, stub, RebalanceRequest{RequestID: "REBAL-a", BasketID: "MBT_BASKET", Status: STATUS_PENDING,
+		CreatedAt: "2026-01-15T12:00:00Z"})
+	putRequest(t, stub, RebalanceRequest{RequestID: "REBAL-z", BasketID: "MBT_BASKET", Status: STATUS_APPROVED,
+		CreatedAt: "2026-01-15T09:00:00Z"})
+	putRequest(t, stub, RebalanceRequest{RequestID: "REBAL-m", BasketID: "MBT_BASKET", Status: STATUS_EXECUTED,
+		CreatedAt: "2026-01-15T13:00:00Z"})
+	putRequest(t, stub, RebalanceRequest{RequestID: "REBAL-b", BasketID: "OTHER", Status: STATUS_PENDING,
+		CreatedAt: "2026-01-15T14:00:00Z"})
+
+	active, err := contract.GetActiveRebalanceRequest(asAdmin(stub), "MBT_BASKET")
+	if err != nil || active == nil || active.RequestID != "REBAL-a" {
+		t.Fatalf("active request: got %v, %v, want REBAL-a", active, err)
+	}
+
+	// Requests created at the same time fall back to the request ID
+	putRequest(t, stub, RebalanceRequest{RequestID: "REBAL-c", BasketID: "MBT_BASKET", Status: STATUS_PARTIAL,
+		CreatedAt: "2026-01-15T12:00:00Z"})
+	active, err = contract.GetActiveRebalanceRequest(asAdmin(stub), "MBT_BASKET")
+	if err != nil || active == nil || active.RequestID != "REBAL-c" {
+		t.Errorf("active request on a tie: got %v, %v, want REBAL-c", active, err)
+	}
+
+	active, err = contract.GetActiveRebalanceRequest(asAdmin(stub), "NONE")
+	if err != nil || active != nil {
+		t.Errorf("active request for a basket with none: got %v, %v", active, err)
+	}
+}
+
+func TestGeneratedOperationOrderIsStable(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+
+	var first []string
+	for run := 0; run < 20; run++ {
+		var adjustments []RebalanceAdjustment
+		stub := newRebalancingStub(t, &adjustments)
+		holdings := testHoldings
+		operations, err := contract.generateRebalanceOperations(asAdmin(stub), "REBAL-1", testDeviations, &holdings, 100000, 1)
+		if err != nil {
+			t.Fatalf("generateRebalanceOperations: %v", err)
+		}
+
+		var order []string
+		for _, operation := range operations {
+			order = append(order, operation.OperationID+":"+operation.MetalType+":"+operation.OperationType)
+		}
+		if run == 0 {
+			first = order
+			continue
+		}
+		if !reflect.DeepEqual(order, first) {
+			t.Fatalf("run %d generated %v, first run %v", run, order, first)
+		}
+	}
+}
+
+// updateTestPolicy applies a change to the active policy through UpdateRebalancePolicy
+func updateTestPolicy(t *testing.T, stub *mockStub, change func(policy *RebalancePolicy)) {
+	t.Helper()
+	contract := &MBTRebalancingContract{}
+	policy, err := contract.GetRebalancePolicy(asAdmin(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(policy)
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = contract.UpdateRebalancePolicy(asAdmin(stub), string(policyJSON))
+	if err != nil {
+		t.Fatalf("UpdateRebalancePolicy: %v", err)
+	}
+}
+
+func TestBasketAdjustmentFollowsExecutedTrades(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(policy *RebalancePolicy)
+		values map[string]float64
+	}{
+		{
+			// Platinum's buy goes to gold, so gold nets the sale and the substitute buy
+			name: "platinum substituted by gold",
+			change: func(policy *RebalancePolicy) {
+				policy.UnavailableMetals = []string{"platinum"}
+				policy.SubstitutionRules = map[string]string{"platinum": "gold"}
+			},
+			values: map[string]float64{"BGT": -5000, "BST": 5000},
+		},
+		{
+			// Both 5,000 buys fall under the minimum and are never traded
+			name: "small trades skipped",
+			change: func(policy *RebalancePolicy) {
+				policy.MinTradeAmount = 6000
+			},
+			values: map[string]float64{"BGT": -10000},
+		},
+	}
+
+	for _, tc := range cases {
+		contract := &MBTRebalancingContract{}
+		var adjustments []RebalanceAdjustment
+		stub := newRebalancingStub(t, &adjustments)
+		updateTestPolicy(t, stub, tc.change)
+		putApprovedRequest(t, stub, "REBAL-1")
+
+		stub.nextTx("tx2")
+		err := contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+		if err != nil {
+			t.Fatalf("%s: ExecuteRebalance: %v", tc.name, err)
+		}
+
+		if len(adjustments) != 1 {
+			t.Fatalf("%s: got %d adjustments, want 1", tc.name, len(adjustments))
+		}
+		prices := map[string]float64{"BGT": 5800, "BST": 75, "BPT": 3200}
+		for _, metal := range []string{"BGT", "BST", "BPT"} {
+			value, grams := adjustments[0].Values[metal], adjustments[0].Grams[metal]
+			if math.Abs(value-tc.values[metal]) > 1e-6 || math.Abs(grams-tc.values[metal]/prices[metal]) > 1e-9 {
+				t.Errorf("%s: %s adjusted by %v / %vg, want %v / %vg", tc.name, metal, value, grams,
+					tc.values[metal], tc.values[metal]/prices[metal])
+			}
+		}
+	}
+}
+
+func TestCostEstimateIsInTradeCurrency(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	putApprovedRequest(t, stub, "REBAL-1")
+
+	estimate, err := contract.GetRebalanceCostEstimate(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatalf("GetRebalanceCostEstimate: %v", err)
+	}
+
+	// Sell 10,000 of gold, buy 5,000 each of silver and platinum, at a 0.1% fee
+	// and a 0.5% slippage buffer; the buys are funded by the sale
+	want := RebalanceCostEstimate{
+		RequestID:      "REBAL-1",
+		Currency:       BASE_CURRENCY,
+		GrossCost:      20000,
+		TradingFees:    20,
+		SlippageBuffer: 100,
+		NetCost:        20120,
+		CashRequired:   120,
+	}
+	if *estimate != want {
+		t.Errorf("estimate = %+v, want %+v", *estimate, want)
+	}
+}
+
+func TestTradeLedgerReportsTradedValues(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	putApprovedRequest(t, stub, "REBAL-1")
+
+	stub.nextTx("tx2")
+	err := contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+
+	date := stub.txTime.Format("2006-01-02")
+	ledger, err := contract.GetTradeLedger(asAdmin(stub), date, date)
+	if err != nil {
+		t.Fatalf("GetTradeLedger: %v", err)
+	}
+
+	want := map[string]struct {
+		side  string
+		cost  float64
+		price float64
+	}{
+		"BGT": {"SELL", 10000, 5800},
+		"BST": {"BUY", 5000, 75},
+		"BPT": {"BUY", 5000, 3200},
+	}
+	if len(ledger) != len(want) {
+		t.Fatalf("got %d ledger entries, want %d", len(ledger), len(want))
+	}
+	for _, entry := range ledger {
+		expected := want[entry.Metal]
+		if entry.Side != expected.side || entry.Cost != expected.cost || entry.Cost != entry.Amount ||
+			entry.ExecutedPrice != expected.price || entry.RequestID != "REBAL-1" {
+			t.Errorf("%s entry = %+v, want %s of %v at %v", entry.Metal, *entry, expected.side, expected.cost, expected.price)
+		}
+	}
+}
+
+func TestFlaggingKeepsExecution(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	operations := putApprovedRequest(t, stub, "REBAL-1")
+
+	stub.nextTx("tx2")
+	err := contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+
+	stub.nextTx("tx3")
+	err = contract.FlagOperation(asAdmin(stub), "REBAL-2", operations[0].OperationID, "bad fill")
+	if err == nil {
+		t.Error("flagging an operation under another request succeeded")
+	}
+	err = contract.FlagOperation(asAdmin(stub), "REBAL-1", operations[0].OperationID, "")
+	if err == nil {
+		t.Error("flagging without a reason succeeded")
+	}
+	err = contract.FlagOperation(asAdmin(stub), "REBAL-1", operations[0].OperationID, "bad fill")
+	if err != nil {
+		t.Fatalf("FlagOperation: %v", err)
+	}
+
+	flagged, err := contract.GetFlaggedOperations(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("GetFlaggedOperations: %v", err)
+	}
+	if len(flagged) != 1 || flagged[0].OperationID != operations[0].OperationID {
+		t.Fatalf("flagged operations: got %d, want only %s", len(flagged), operations[0].OperationID)
+	}
+	operation := flagged[0]
+	if operation.FlagReason != "bad fill" || operation.FlaggedAt != stub.txTime.Format(time.RFC3339) {
+		t.Errorf("flag recorded as %q at %s", operation.FlagReason, operation.FlaggedAt)
+	}
+	if operation.Status != OPERATION_EXECUTED || operation.ExecutedAmount != operation.Amount {
+		t.Errorf("flagging changed execution: status %s, executed %v of %v", operation.Status,
+			operation.ExecutedAmount, operation.Amount)
+	}
+}
+
+func TestTradeAmountRounding(t *testing.T) {
+	cases := []struct {
+		value    float64
+		decimals int
+		want     float64
+	}{
+		{2.5, 0, 2},
+		{3.5, 0, 4},
+		{-2.5, 0, -2},
+		{0.125, 2, 0.12},
+		{0.375, 2, 0.38},
+		{1234.5678, 2, 1234.57},
+		{1234.5678, -1, 1234.5678}, // Negative decimals leave the value unrounded
+	}
+	for _, tc := range cases {
+		if got := roundHalfEven(tc.value, tc.decimals); got != tc.want {
+			t.Errorf("roundHalfEven(%v, %d) = %v, want %v", tc.value, tc.decimals, got, tc.want)
+		}
+	}
+
+	// Whole-rupee trades around the 1,000 minimum: 999.5 rounds up to it and is
+	// kept, 999.45 rounds down below it and is dropped
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) {
+		policy.TradeRoundingDecimals = 0
+	})
+	deviations := map[string]float64{"gold": 0.5, "silver": -0.5}
+	for totalValue, want := range map[float64]int{1999: 2, 1998.9: 0} {
+		stub.nextTx("gen")
+		holdings := testHoldings
+		operations, err := contract.generateRebalanceOperations(asAdmin(stub), "REBAL-1", deviations, &holdings, totalValue, 1)
+		if err != nil {
+			t.Fatalf("generateRebalanceOperations(%v): %v", totalValue, err)
+		}
+		if len(operations) != want {
+			t.Errorf("basket of %v: got %d operations, want %d", totalValue, len(operations), want)
+		}
+		for _, operation := range operations {
+			if operation.Amount != 1000 {
+				t.Errorf("basket of %v: %s amount %v, want 1000", totalValue, operation.MetalType, operation.Amount)
+			}
+		}
+	}
+}
+
+func TestPolicyHistoryRecordsEachUpdate(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+
+	var times []string
+	for _, minimum := range []float64{2000, 3000} {
+		stub.nextTx("update")
+		times = append(times, stub.txTime.Format("2006-01-02T15:04:05.000000000Z"))
+		updateTestPolicy(t, stub, func(policy *RebalancePolicy) {
+			policy.MinTradeAmount = minimum
+		})
+	}
+
+	history, err := contract.GetRebalancePolicyHistory(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("GetRebalancePolicyHistory: %v", err)
+	}
+
+	// The initial policy is the first version, then one per update in order
+	if len(history) != 3 {
+		t.Fatalf("got %d policy versions, want 3", len(history))
+	}
+	for i, minimum := range []float64{1000, 2000, 3000} {
+		version := history[i]
+		if version.Policy.MinTradeAmount != minimum || version.UpdatedBy != "admin" {
+			t.Errorf("version %d: minimum %v by %s, want %v by admin", i, version.Policy.MinTradeAmount,
+				version.UpdatedBy, minimum)
+		}
+		if i > 0 && version.Timestamp != times[i-1] {
+			t.Errorf("version %d at %s, want the update time %s", i, version.Timestamp, times[i-1])
+		}
+	}
+
+	policy, err := contract.GetRebalancePolicy(asAdmin(stub))
+	if err != nil || policy.MinTradeAmount != 3000 {
+		t.Errorf("active policy minimum: got %v, %v, want 3000", policy.MinTradeAmount, err)
+	}
+}
+
+func TestDeviationReportAgainstCustomTargets(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	before := stateSnapshot(stub)
+
+	// testHoldings sit exactly on a 60/25/15 split, and off the 50/30/20 policy
+	reports := map[string]map[string]float64{
+		`{"gold":0.60,"silver":0.25,"platinum":0.15}`: {"gold": 0, "silver": 0, "platinum": 0},
+		`{"gold":0.50,"silver":0.30,"platinum":0.20}`: testDeviations,
+	}
+	for targets, want := range reports {
+		report, err := contract.GetDeviationReport(asAdmin(stub), targets)
+		if err != nil {
+			t.Fatalf("GetDeviationReport(%s): %v", targets, err)
+		}
+		if report.TotalValue != 100000 || len(report.Metals) != 3 {
+			t.Fatalf("%s: total %v over %d metals", targets, report.TotalValue, len(report.Metals))
+		}
+		maxDeviation := 0.0
+		for _, metal := range report.Metals {
+			if math.Abs(metal.Deviation-want[metal.Metal]) > 1e-9 ||
+				math.Abs(metal.CurrentWeight-metal.TargetWeight-metal.Deviation) > 1e-9 {
+				t.Errorf("%s: %s at %v against %v deviates %v, want %v", targets, metal.Metal,
+					metal.CurrentWeight, metal.TargetWeight, metal.Deviation, want[metal.Metal])
+			}
+			maxDeviation = math.Max(maxDeviation, math.Abs(want[metal.Metal]))
+		}
+		if math.Abs(report.MaxDeviation-maxDeviation) > 1e-9 {
+			t.Errorf("%s: max deviation %v, want %v", targets, report.MaxDeviation, maxDeviation)
+		}
+	}
+
+	_, err := contract.GetDeviationReport(asAdmin(stub), `{"gold":0.60,"silver":0.25,"platinum":0.05}`)
+	if err == nil {
+		t.Error("targets summing to 0.9 were accepted")
+	}
+
+	if !reflect.DeepEqual(stateSnapshot(stub), before) {
+		t.Error("GetDeviationReport wrote state")
+	}
+}
+
+func TestApprovalExpiryBoundary(t *testing.T) {
+	// The default policy keeps approvals for one day: execution at exactly a day
+	// goes ahead, a second later the request expires instead
+	for _, tc := range []struct {
+		age  time.Duration
+		want RequestStatus
+	}{
+		{24 * time.Hour, STATUS_EXECUTED},
+		{24*time.Hour + time.Second, STATUS_EXPIRED},
+	} {
+		contract := &MBTRebalancingContract{}
+		var adjustments []RebalanceAdjustment
+		stub := newRebalancingStub(t, &adjustments)
+		putApprovedRequest(t, stub, "REBAL-1")
+
+		approvedAt := stub.txTime
+		stub.nextTx("tx2")
+		stub.txTime = approvedAt.Add(tc.age)
+		err := contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+		if err != nil {
+			t.Fatalf("after %v: ExecuteRebalance: %v", tc.age, err)
+		}
+
+		request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request.Status != tc.want {
+			t.Errorf("after %v: status %s, want %s", tc.age, request.Status, tc.want)
+		}
+		if traded := len(adjustments) > 0; traded != (tc.want == STATUS_EXECUTED) {
+			t.Errorf("after %v: %d basket adjustments", tc.age, len(adjustments))
+		}
+	}
+}
+
+func TestExpireStaleRequests(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+
+	start := stub.txTime
+	stamp := func(offset time.Duration) string { return start.Add(offset).Format(time.RFC3339) }
+	for _, request := range []RebalanceRequest{
+		{RequestID: "REBAL-1", Status: STATUS_PENDING, CreatedAt: stamp(0)},
+		{RequestID: "REBAL-2", Status: STATUS_APPROVED, CreatedAt: stamp(0), ApprovedAt: stamp(time.Second)},
+		{RequestID: "REBAL-3", Status: STATUS_APPROVED, CreatedAt: stamp(0), ApprovedAt: stamp(0)},
+		{RequestID: "REBAL-4", Status: STATUS_EXECUTED, CreatedAt: stamp(0), ApprovedAt: stamp(0)},
+	} {
+		putRequest(t, stub, request)
+	}
+
+	stub.nextTx("expire")
+	stub.txTime = start.Add(24*time.Hour + time.Second)
+	expired, err := contract.ExpireStaleRequests(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("ExpireStaleRequests: %v", err)
+	}
+	if expired != 2 {
+		t.Errorf("expired %d requests, want 2", expired)
+	}
+
+	want := map[string]RequestStatus{
+		"REBAL-1": STATUS_EXPIRED,
+		"REBAL-2": STATUS_APPROVED, // Approved exactly a day ago
+		"REBAL-3": STATUS_EXPIRED,
+		"REBAL-4": STATUS_EXECUTED,
+	}
+	for requestID, status := range want {
+		request, err := contract.getRebalanceRequest(asAdmin(stub), requestID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request.Status != status {
+			t.Errorf("%s: status %s, want %s", requestID, request.Status, status)
+		}
+	}
+}
+
+func TestApprovalRequiresAVerifiedApprover(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) {
+		policy.ApproverMSPs = []string{"RiskMSP"}
+	})
+	for _, requestID := range []string{"REBAL-1", "REBAL-2"} {
+		putRequest(t, stub, RebalanceRequest{
+			RequestID:        requestID,
+			Status:           STATUS_PENDING,
+			ApprovalRequired: true,
+			CreatedAt:        stub.txTime.Format(time.RFC3339),
+		})
+	}
+
+	stub.nextTx("tx2")
+	before := stateSnapshot(stub)
+	err := contract.ApproveRebalanceRequest(asUser(stub, "mallory"), "REBAL-1", "bob")
+	if err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("approval without authority: got %v, want unauthorized", err)
+	}
+	if !reflect.DeepEqual(stateSnapshot(stub), before) {
+		t.Error("rejected approval wrote state")
+	}
+
+	// One approver holds the attribute, the other belongs to an approver MSP;
+	// either way the verified identity is recorded, not the approverID argument
+	approvers := map[string]*mockContext{
+		"REBAL-1": newMockContext(stub, "bob", map[string]string{"approver": "true"}),
+		"REBAL-2": {stub: stub, identity: &mockIdentity{id: "carol", mspID: "RiskMSP"}},
+	}
+	for requestID, approver := range approvers {
+		stub.nextTx("approve-" + requestID)
+		err = contract.ApproveRebalanceRequest(approver, requestID, "mallory")
+		if err != nil {
+			t.Fatalf("%s: ApproveRebalanceRequest: %v", requestID, err)
+		}
+
+		request, err := contract.getRebalanceRequest(asAdmin(stub), requestID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request.Status != STATUS_APPROVED || request.ApprovedBy != approver.identity.id ||
+			len(request.Approvals) != 1 || request.Approvals[0].Approver != approver.identity.id {
+			t.Errorf("%s: status %s approved by %q, approvals %+v; want APPROVED by %s", requestID,
+				request.Status, request.ApprovedBy, request.Approvals, approver.identity.id)
+		}
+	}
+}
+
+func TestPendingApprovalsExcludeRequestsTheCallerSigned(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) {
+		policy.RequiredApprovals = 2
+	})
+	for _, request := range []RebalanceRequest{
+		{RequestID: "REBAL-1", Status: STATUS_PENDING, ApprovalRequired: true},
+		{RequestID: "REBAL-2", Status: STATUS_PENDING, ApprovalRequired: true},
+		{RequestID: "REBAL-3", Status: STATUS_PENDING},
+		{RequestID: "REBAL-4", Status: STATUS_APPROVED, ApprovalRequired: true},
+	} {
+		request.CreatedAt = stub.txTime.Format(time.RFC3339)
+		putRequest(t, stub, request)
+	}
+
+	approver := func(id string) *mockContext {
+		return newMockContext(stub, id, map[string]string{"approver": "true"})
+	}
+	stub.nextTx("approve")
+	err := contract.ApproveRebalanceRequest(approver("bob"), "REBAL-1", "bob")
+	if err != nil {
+		t.Fatalf("ApproveRebalanceRequest: %v", err)
+	}
+	request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+	if err != nil || request.Status != STATUS_PENDING {
+		t.Fatalf("one of two approvals: status %s, %v; want PENDING", request.Status, err)
+	}
+
+	want := map[string][]string{
+		"bob":   {"REBAL-2"},
+		"carol": {"REBAL-1", "REBAL-2"},
+	}
+	for id, requestIDs := range want {
+		pending, err := contract.GetPendingApprovalsForApprover(approver(id))
+		if err != nil {
+			t.Fatalf("%s: GetPendingApprovalsForApprover: %v", id, err)
+		}
+		var got []string
+		for _, request := range pending {
+			got = append(got, request.RequestID)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, requestIDs) {
+			t.Errorf("%s's queue %v, want %v", id, got, requestIDs)
+		}
+	}
+
+	_, err = contract.GetPendingApprovalsForApprover(asUser(stub, "mallory"))
+	if err == nil {
+		t.Error("a caller without approver authority read an approval queue")
+	}
+}
+
+func TestSimulationMatchesExecution(t *testing.T) {
+	cases := []struct {
+		name        string
+		minimum     float64
+		exceedsBand bool
+	}{
+		{"full plan", 1000, false},
+		{"buys below the minimum", 6000, true}, // Only the gold sale is planned
+	}
+
+	for _, tc := range cases {
+		contract := &MBTRebalancingContract{}
+		var adjustments []RebalanceAdjustment
+		stub := newRebalancingStub(t, &adjustments)
+		updateTestPolicy(t, stub, func(policy *RebalancePolicy) {
+			policy.MinTradeAmount = tc.minimum
+		})
+		putApprovedRequest(t, stub, "REBAL-1")
+		request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.TargetAlloc = map[string]float64{"gold": 0.50, "silver": 0.30, "platinum": 0.20}
+		putRequest(t, stub, *request)
+
+		before := stateSnapshot(stub)
+		simulation, err := contract.SimulateRebalanceOutcome(asAdmin(stub), "REBAL-1")
+		if err != nil {
+			t.Fatalf("%s: SimulateRebalanceOutcome: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(stateSnapshot(stub), before) {
+			t.Errorf("%s: simulation wrote state", tc.name)
+		}
+		if simulation.ExceedsBand != tc.exceedsBand {
+			t.Errorf("%s: exceeds band %t at max deviation %v, want %t", tc.name, simulation.ExceedsBand,
+				simulation.MaxDeviation, tc.exceedsBand)
+		}
+
+		stub.nextTx("tx2")
+		err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+		if err != nil {
+			t.Fatalf("%s: ExecuteRebalance: %v", tc.name, err)
+		}
+		if len(adjustments) != 1 {
+			t.Fatalf("%s: got %d adjustments, want 1", tc.name, len(adjustments))
+		}
+
+		// The holdings the execution leaves are the ones the simulation projected
+		executed := map[string]float64{
+			"gold":     testHoldings.TotalBGTValue + adjustments[0].Values["BGT"],
+			"silver":   testHoldings.TotalBSTValue + adjustments[0].Values["BST"],
+			"platinum": testHoldings.TotalBPTValue + adjustments[0].Values["BPT"],
+		}
+		for metal, value := range executed {
+			if math.Abs(simulation.ProjectedValues[metal]-value) > 1e-6 {
+				t.Errorf("%s: %s projected at %v, executed to %v", tc.name, metal, simulation.ProjectedValues[metal], value)
+			}
+		}
+	}
+}
+
+func TestScheduledRebalanceDueAndNotDue(t *testing.T) {
+	cases := []struct {
+		name string
+		age  time.Duration
+		due  bool
+	}{
+		{"not due", 10 * 24 * time.Hour, false},
+		{"due", 31 * 24 * time.Hour, true},
+	}
+
+	for _, tc := range cases {
+		contract := &MBTRebalancingContract{}
+		var adjustments []RebalanceAdjustment
+		stub := newRebalancingStub(t, &adjustments)
+		holdings := testHoldings
+		holdings.LastRebalance = stub.txTime.Add(-tc.age).Format(time.RFC3339)
+		serveHoldings(t, stub, holdings)
+
+		stub.nextTx("run1")
+		result, err := contract.RunScheduledRebalance(asAdmin(stub))
+		if err != nil {
+			t.Fatalf("%s: RunScheduledRebalance: %v", tc.name, err)
+		}
+		if result.Due != tc.due || result.Executed != tc.due || (result.RequestID != "") != tc.due {
+			t.Errorf("%s: result %+v", tc.name, *result)
+		}
+		if len(adjustments) != map[bool]int{false: 0, true: 1}[tc.due] {
+			t.Errorf("%s: %d basket adjustments", tc.name, len(adjustments))
+		}
+		if tc.due {
+			request, err := contract.getRebalanceRequest(asAdmin(stub), result.RequestID)
+			if err != nil || request.RequestType != "TIME" || request.Status != STATUS_EXECUTED {
+				t.Errorf("%s: request %+v, %v; want an EXECUTED TIME request", tc.name, request, err)
+			}
+		}
+
+		// A second run the same day does nothing, due or not
+		stub.nextTx("run2")
+		before := stateSnapshot(stub)
+		result, err = contract.RunScheduledRebalance(asAdmin(stub))
+		if err != nil {
+			t.Fatalf("%s: second RunScheduledRebalance: %v", tc.name, err)
+		}
+		if result.Due || result.RequestID != "" || !reflect.DeepEqual(stateSnapshot(stub), before) {
+			t.Errorf("%s: second run the same day acted: %+v", tc.name, *result)
+		}
+	}
+}
+
+func TestRebalanceStatisticsOverMixedTriggers(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	holdings := testHoldings
+	holdings.LastRebalance = stub.txTime.AddDate(0, 0, -31).Format(time.RFC3339)
+	serveHoldings(t, stub, holdings)
+
+	// Jan 15: a deviation trigger, executed
+	stub.nextTx("evaluate1")
+	err := contract.EvaluateRebalanceNeed(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("EvaluateRebalanceNeed: %v", err)
+	}
+	stub.nextTx("execute1")
+	err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-evaluate1", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+
+	// Jan 16: the scheduled run, executed in the same call
+	stub.nextTx("scheduled")
+	stub.txTime = stub.txTime.AddDate(0, 0, 1)
+	result, err := contract.RunScheduledRebalance(asAdmin(stub))
+	if err != nil || !result.Executed {
+		t.Fatalf("RunScheduledRebalance: %+v, %v", result, err)
+	}
+
+	// Jan 17: a deviation trigger left pending, which is not counted
+	stub.nextTx("evaluate2")
+	stub.txTime = stub.txTime.AddDate(0, 0, 1)
+	err = contract.EvaluateRebalanceNeed(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("EvaluateRebalanceNeed: %v", err)
+	}
+
+	cases := []struct {
+		from, to               string
+		count, time, deviation int
+		traded, fees           float64
+	}{
+		{"2026-01-15", "2026-01-17", 2, 1, 1, 40000, 40},
+		{"2026-01-16", "2026-01-17", 1, 1, 0, 20000, 20},
+		{"2026-01-17", "2026-01-31", 0, 0, 0, 0, 0},
+	}
+	for _, tc := range cases {
+		stats, err := contract.GetRebalanceStatistics(asAdmin(stub), tc.from, tc.to)
+		if err != nil {
+			t.Fatalf("GetRebalanceStatistics(%s, %s): %v", tc.from, tc.to, err)
+		}
+		maxDeviation := 0.0
+		if tc.count > 0 {
+			maxDeviation = 0.10 // Gold's overweight at each trigger
+		}
+		if stats.RebalanceCount != tc.count || stats.TimeTriggered != tc.time || stats.DeviationTriggered != tc.deviation ||
+			math.Abs(stats.TotalTradedValue-tc.traded) > 1e-6 || math.Abs(stats.TotalFees-tc.fees) > 1e-6 ||
+			math.Abs(stats.AverageMaxDeviation-maxDeviation) > 1e-9 {
+			t.Errorf("%s to %s: %+v", tc.from, tc.to, *stats)
+		}
+	}
+}
+
+func TestGenerationRejectsUnknownMetals(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+
+	// Friendly names and token codes size the same trades
+	for _, deviations := range []map[string]float64{
+		{"gold": 0.10, "silver": -0.10},
+		{"BGT": 0.10, "BST": -0.10},
+	} {
+		stub.nextTx("gen")
+		holdings := testHoldings
+		operations, err := contract.generateRebalanceOperations(asAdmin(stub), "REBAL-1", deviations, &holdings, 100000, 1)
+		if err != nil || len(operations) != 2 {
+			t.Fatalf("deviations %v: %d operations, %v", deviations, len(operations), err)
+		}
+		for _, operation := range operations {
+			if operation.MetalType != "BGT" && operation.MetalType != "BST" {
+				t.Errorf("deviations %v: operation on %s", deviations, operation.MetalType)
+			}
+		}
+	}
+
+	stub.nextTx("gen")
+	holdings := testHoldings
+	_, err := contract.generateRebalanceOperations(asAdmin(stub), "REBAL-1",
+		map[string]float64{"gold": 0.10, "copper": -0.10}, &holdings, 100000, 1)
+	if err == nil || !strings.Contains(err.Error(), "copper") {
+		t.Errorf("copper deviation: got %v, want an unknown metal error", err)
+	}
+}
+
+func TestGenerationAbortsOnAnUnpricedMetal(t *testing.T) {
+	// A reference table for a currency with no platinum price
+	metalPricesByCurrency["TST"] = map[string]float64{"BGT": 5800, "BST": 75}
+	defer delete(metalPricesByCurrency, "TST")
+
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) {
+		policy.Currency = "TST"
+	})
+
+	stub.nextTx("gen")
+	holdings := testHoldings
+	operations, err := contract.generateRebalanceOperations(asAdmin(stub), "REBAL-1", testDeviations, &holdings, 100000, 1)
+	if err == nil || !strings.Contains(err.Error(), "no price available for metal BPT") {
+		t.Fatalf("generation without a platinum price: %d operations, %v", len(operations), err)
+	}
+}
+
+func TestCreateBasketValidatesComposition(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	stub := newMockStub()
+	err := contract.InitializePolicy(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("InitializePolicy: %v", err)
+	}
+
+	invalid := map[string]string{
+		"empty":          `{}`,
+		"short of 1.0":   `{"gold": 0.5, "silver": 0.3}`,
+		"over 1.0":       `{"gold": 0.8, "silver": 0.3}`,
+		"negative":       `{"gold": 1.2, "silver": -0.2}`,
+		"duplicate":      `{"gold": 0.5, "BGT": 0.5}`,
+		"unknown metal":  `{"gold": 0.5, "copper": 0.5}`,
+		"malformed JSON": `{"gold": }`,
+	}
+	for name, compositionJSON := range invalid {
+		stub.nextTx("create-" + name)
+		err := contract.CreateBasket(asAdmin(stub), "BASKET_X", compositionJSON)
+		if err == nil {
+			t.Errorf("%s composition %s was accepted", name, compositionJSON)
+		}
+	}
+	if _, err := contract.GetBasketPolicy(asUser(stub, "alice"), "BASKET_X"); err == nil {
+		t.Fatal("a rejected composition created the basket")
+	}
+
+	stub.nextTx("create-valid")
+	err = contract.CreateBasket(asAdmin(stub), "BASKET_X", `{"BGT": 0.7, "silver": 0.3}`)
+	if err != nil {
+		t.Fatalf("CreateBasket: %v", err)
+	}
+
+	policy, err := contract.GetBasketPolicy(asUser(stub, "alice"), "BASKET_X")
+	if err != nil {
+		t.Fatalf("GetBasketPolicy: %v", err)
+	}
+	defaults, err := contract.GetRebalancePolicy(asUser(stub, "alice"))
+	if err != nil {
+		t.Fatalf("GetRebalancePolicy: %v", err)
+	}
+	if policy.GoldAllocation != 0.7 || policy.SilverAllocation != 0.3 || policy.PlatinumAllocation != 0 {
+		t.Errorf("basket allocations %.2f/%.2f/%.2f, want 0.70/0.30/0.00",
+			policy.GoldAllocation, policy.SilverAllocation, policy.PlatinumAllocation)
+	}
+	if policy.MaxDeviationPercent != defaults.MaxDeviationPercent {
+		t.Errorf("basket max deviation %.4f, want the default %.4f", policy.MaxDeviationPercent, defaults.MaxDeviationPercent)
+	}
+
+	stub.nextTx("create-again")
+	err = contract.CreateBasket(asAdmin(stub), "BASKET_X", `{"gold": 1.0}`)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("recreating BASKET_X: %v", err)
+	}
+}
+
+func TestActiveRequestFollowsTheRequestLifecycle(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+
+	active, err := contract.GetActiveRebalanceRequest(asUser(stub, "alice"), "MBT_BASKET")
+	if err != nil || active != nil {
+		t.Fatalf("before any request: got %v, %v, want none", active, err)
+	}
+
+	stub.nextTx("tx-create")
+	err = contract.CreateRebalanceRequest(asAdmin(stub), nil, nil, testDeviations, "DEVIATION", "gold overweight")
+	if err != nil {
+		t.Fatalf("CreateRebalanceRequest: %v", err)
+	}
+
+	stub.nextTx("tx-read")
+	active, err = contract.GetActiveRebalanceRequest(asUser(stub, "alice"), "MBT_BASKET")
+	if err != nil || active == nil || active.RequestID != "REBAL-tx-create" || active.Status != STATUS_PENDING {
+		t.Fatalf("after creation: got %+v, %v, want PENDING REBAL-tx-create", active, err)
+	}
+
+	for _, status := range []RequestStatus{STATUS_EXECUTED, STATUS_EXPIRED, STATUS_SUPERSEDED} {
+		request := *active
+		request.Status = status
+		putRequest(t, stub, request)
+
+		got, err := contract.GetActiveRebalanceRequest(asUser(stub, "alice"), "MBT_BASKET")
+		if err != nil || got != nil {
+			t.Errorf("after %s: got %v, %v, want none", status, got, err)
+		}
+	}
+}
+
+func TestGlidePathInterpolatesTargets(t *testing.T) {
+	policy := &RebalancePolicy{GoldAllocation: 0.5, SilverAllocation: 0.3, PlatinumAllocation: 0.2}
+	day := func(date string) time.Time {
+		parsed, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	if got := targetAllocation(policy, day("2026-06-01")); got["gold"] != 0.5 || got["silver"] != 0.3 || got["platinum"] != 0.2 {
+		t.Errorf("without a glide path: got %v, want the static allocations", got)
+	}
+
+	policy.GlidePath = []GlidePathPoint{
+		{EffectiveDate: "2026-01-01", Composition: map[string]float64{"BGT": 0.4, "BST": 0.4, "BPT": 0.2}},
+		{EffectiveDate: "2026-01-11", Composition: map[string]float64{"gold": 0.6, "silver": 0.2, "platinum": 0.2}},
+		{EffectiveDate: "2026-01-21", Composition: map[string]float64{"gold": 0.8, "silver": 0.2}},
+	}
+	err := validateGlidePath(policy.GlidePath)
+	if err != nil {
+		t.Fatalf("validateGlidePath: %v", err)
+	}
+
+	tests := []struct {
+		date string
+		want map[string]float64
+	}{
+		{"2025-12-01", map[string]float64{"gold": 0.4, "silver": 0.4, "platinum": 0.2}},
+		{"2026-01-01", map[string]float64{"gold": 0.4, "silver": 0.4, "platinum": 0.2}},
+		{"2026-01-06", map[string]float64{"gold": 0.5, "silver": 0.3, "platinum": 0.2}},
+		{"2026-01-11", map[string]float64{"gold": 0.6, "silver": 0.2, "platinum": 0.2}},
+		{"2026-01-16", map[string]float64{"gold": 0.7, "silver": 0.2, "platinum": 0.1}},
+		{"2026-03-01", map[string]float64{"gold": 0.8, "silver": 0.2, "platinum": 0}},
+	}
+	for _, test := range tests {
+		got := targetAllocation(policy, day(test.date))
+		for metal, want := range test.want {
+			if math.Abs(got[metal]-want) > 1e-9 {
+				t.Errorf("%s: %s target %.4f, want %.4f", test.date, metal, got[metal], want)
+			}
+		}
+	}
+
+	invalid := [][]GlidePathPoint{
+		{{EffectiveDate: "2026-02-01", Composition: map[string]float64{"gold": 1}},
+			{EffectiveDate: "2026-01-01", Composition: map[string]float64{"gold": 1}}},
+		{{EffectiveDate: "01/02/2026", Composition: map[string]float64{"gold": 1}}},
+		{{EffectiveDate: "2026-01-01", Composition: map[string]float64{"gold": 0.5}}},
+	}
+	for _, glidePath := range invalid {
+		if err := validateGlidePath(glidePath); err == nil {
+			t.Errorf("glide path %+v was accepted", glidePath)
+		}
+	}
+}
+
+func TestRequestDetailEmbedsOperations(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	putApprovedRequest(t, stub, "REBAL-1")
+
+	stub.nextTx("tx2")
+	detail, err := contract.GetRebalanceRequestDetail(asUser(stub, "alice"), "REBAL-1")
+	if err != nil {
+		t.Fatalf("GetRebalanceRequestDetail: %v", err)
+	}
+	if detail.Request.RequestID != "REBAL-1" || detail.Request.Status != STATUS_APPROVED {
+		t.Errorf("request %s %s, want APPROVED REBAL-1", detail.Request.RequestID, detail.Request.Status)
+	}
+	if len(detail.Operations) != 3 {
+		t.Fatalf("got %d operations, want 3", len(detail.Operations))
+	}
+	summary := detail.Summary
+	if summary.OperationCount != 3 || summary.BuyCount != 2 || summary.SellCount != 1 || summary.TotalTradeAmount != 20000 {
+		t.Errorf("summary %+v, want 3 operations, 2 buys, 1 sell trading 20000", summary)
+	}
+
+	_, err = contract.GetRebalanceRequestDetail(asUser(stub, "alice"), "REBAL-missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing request: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestFeeTierBoundaries(t *testing.T) {
+	policy := &RebalancePolicy{
+		TradingFeePercent: 0.01,
+		FeeTiers: []FeeTier{
+			{MinAmount: 10000, FeePercent: 0.005},
+			{MinAmount: 100000, FeePercent: 0.002},
+		},
+	}
+
+	tests := []struct {
+		amount, feePercent, fee float64
+	}{
+		{9999.99, 0.01, 100},
+		{10000, 0.005, 50},
+		{99999.99, 0.005, 500},
+		{100000, 0.002, 200},
+		{1000000, 0.002, 2000},
+	}
+	for _, test := range tests {
+		if got := feePercentFor(policy, test.amount); got != test.feePercent {
+			t.Errorf("fee rate on %.2f: %v, want %v", test.amount, got, test.feePercent)
+		}
+		if got := tradingFee(policy, test.amount); got != test.fee {
+			t.Errorf("fee on %.2f: %v, want %v", test.amount, got, test.fee)
+		}
+	}
+
+	invalid := [][]FeeTier{
+		{{MinAmount: 100000, FeePercent: 0.002}, {MinAmount: 10000, FeePercent: 0.005}},
+		{{MinAmount: 10000, FeePercent: 0.005}, {MinAmount: 10000, FeePercent: 0.002}},
+		{{MinAmount: -1, FeePercent: 0.005}},
+		{{MinAmount: 0, FeePercent: 1}},
+	}
+	for _, tiers := range invalid {
+		if err := validateFeeTiers(tiers); err == nil {
+			t.Errorf("fee tiers %+v were accepted", tiers)
+		}
+	}
+}
+
+func TestFindOrphanedOperationsListsOnlyOrphans(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	orphaned := putApprovedRequest(t, stub, "REBAL-1")
+	stub.nextTx("tx2")
+	putApprovedRequest(t, stub, "REBAL-2")
+
+	found, err := contract.FindOrphanedOperations(asAdmin(stub))
+	if err != nil || len(found) != 0 {
+		t.Fatalf("before any request is deleted: got %d orphans, %v", len(found), err)
+	}
+
+	delete(stub.state, "REBAL-1")
+
+	stub.nextTx("tx3")
+	found, err = contract.FindOrphanedOperations(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("FindOrphanedOperations: %v", err)
+	}
+	if len(found) != len(orphaned) {
+		t.Fatalf("got %d orphans, want %d", len(found), len(orphaned))
+	}
+	for _, operation := range found {
+		if operation.RequestID != "REBAL-1" {
+			t.Errorf("operation %s of %s listed as orphaned", operation.OperationID, operation.RequestID)
+		}
+	}
+
+	stub.nextTx("tx4")
+	_, err = contract.PurgeOrphanedOperations(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("PurgeOrphanedOperations: %v", err)
+	}
+
+	stub.nextTx("tx5")
+	found, err = contract.FindOrphanedOperations(asAdmin(stub))
+	if err != nil || len(found) != 0 {
+		t.Errorf("after the purge: got %d orphans, %v", len(found), err)
+	}
+	purged, err := contract.PurgeOrphanedOperations(asAdmin(stub))
+	if err != nil || purged != 0 {
+		t.Errorf("second purge: got %d, %v, want 0", purged, err)
+	}
+}
+
+func TestTerminalRequestsCannotBeExecutedAgain(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	putApprovedRequest(t, stub, "REBAL-1")
+
+	stub.nextTx("tx2")
+	err := contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+
+	for _, status := range []RequestStatus{STATUS_EXECUTED, STATUS_EXPIRED, STATUS_SUPERSEDED} {
+		request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Status = status
+		putRequest(t, stub, *request)
+
+		stub.nextTx("again-" + string(status))
+		before := stateSnapshot(stub)
+		applied := len(adjustments)
+		err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", true, 0)
+		if err == nil {
+			t.Errorf("executing a %s request succeeded", status)
+		}
+		if !reflect.DeepEqual(stateSnapshot(stub), before) || len(adjustments) != applied {
+			t.Errorf("executing a %s request changed state or holdings", status)
+		}
+	}
+}
+
+func TestCostIneffectiveTradesAreSkipped(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+
+	// At the default 0.1% fee a 5% deviation is worth trading down to a ratio of
+	// 0.02, where the 5.00 fee on 5,000 exactly equals 0.02 x the 250 benefit
+	tests := []struct {
+		ratio float64
+		want  []string
+	}{
+		{0, []string{"BGT", "BPT", "BST"}},
+		{0.02, []string{"BGT", "BPT", "BST"}},
+		{0.019, []string{"BGT"}},
+		{0.009, nil},
+	}
+	for _, test := range tests {
+		var adjustments []RebalanceAdjustment
+		stub := newRebalancingStub(t, &adjustments)
+		updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.MinBenefitRatio = test.ratio })
+
+		stub.nextTx("generate")
+		holdings := testHoldings
+		operations, err := contract.generateRebalanceOperations(asAdmin(stub), "REBAL-1", testDeviations, &holdings, 100000, 1)
+		if err != nil {
+			t.Fatalf("ratio %v: %v", test.ratio, err)
+		}
+		var metals []string
+		for _, operation := range operations {
+			metals = append(metals, operation.MetalType)
+		}
+		sort.Strings(metals)
+		if !reflect.DeepEqual(metals, test.want) {
+			t.Errorf("ratio %v: traded %v, want %v", test.ratio, metals, test.want)
+		}
+	}
+}
+
+func TestRelativeDeviationTriggersOnPlatinumFirst(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+
+	// Platinum is 3 points under its 20% target: within the 5% band in absolute
+	// terms, but 15% short of the target in relative ones
+	holdings := BasketHolding{
+		TotalMBTSupply: 100000,
+		TotalBGTValue:  52000,
+		TotalBSTValue:  31000,
+		TotalBPTValue:  17000,
+		LastRebalance:  "2026-01-15T09:00:00Z",
+	}
+
+	for _, mode := range []string{DEVIATION_ABSOLUTE, DEVIATION_RELATIVE} {
+		var adjustments []RebalanceAdjustment
+		stub := newRebalancingStub(t, &adjustments)
+		serveHoldings(t, stub, holdings)
+		updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.DeviationMode = mode })
+
+		stub.nextTx("evaluate")
+		err := contract.EvaluateRebalanceNeed(asAdmin(stub))
+		if err != nil {
+			t.Fatalf("%s: EvaluateRebalanceNeed: %v", mode, err)
+		}
+
+		request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-evaluate")
+		if mode == DEVIATION_ABSOLUTE {
+			if err == nil {
+				t.Errorf("%s: a 3 point deviation created request %+v", mode, request)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: no request created: %v", mode, err)
+		}
+		if request.RequestType != "DEVIATION" || !strings.Contains(request.TriggerReason, "platinum") {
+			t.Errorf("%s: request %s triggered by %q", mode, request.RequestType, request.TriggerReason)
+		}
+		// Trades are still sized by the absolute deviation
+		if math.Abs(request.Deviations["platinum"]+0.03) > 1e-9 {
+			t.Errorf("%s: platinum deviation %v, want -0.03", mode, request.Deviations["platinum"])
+		}
+	}
+}
+
+func TestSelfTestReportsReadiness(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	serveHoldings(t, stub, BasketHolding{TotalMBTSupply: 100000, TotalBGTValue: 50000, TotalBSTValue: 30000,
+		TotalBPTValue: 20000})
+
+	stub.nextTx("probe")
+	before := stateSnapshot(stub)
+	report, err := contract.SelfTest(asUser(stub, "ops"))
+	if err != nil {
+		t.Fatalf("SelfTest: %v", err)
+	}
+	if !report.Healthy {
+		t.Errorf("healthy deployment reported unhealthy: %+v", report.Checks)
+	}
+	if !reflect.DeepEqual(stateSnapshot(stub), before) {
+		t.Error("SelfTest wrote state")
+	}
+
+	// Without an initialized policy the policy check and those depending on it fail
+	unconfigured := newMockStub()
+	unconfigured.invoke = stub.invoke
+	report, err = contract.SelfTest(asUser(unconfigured, "ops"))
+	if err != nil {
+		t.Fatalf("SelfTest without a policy: %v", err)
+	}
+	if report.Healthy {
+		t.Error("a deployment without a policy reported healthy")
+	}
+	failed := map[string]bool{}
+	for _, check := range report.Checks {
+		if !check.Passed {
+			failed[check.Name] = true
+		}
+	}
+	for _, name := range []string{"policy", "allocations"} {
+		if !failed[name] {
+			t.Errorf("check %s passed without a policy", name)
+		}
+	}
+	if len(unconfigured.state) != 0 {
+		t.Errorf("SelfTest without a policy wrote %d keys", len(unconfigured.state))
+	}
+}
+
+func TestResumeRunsOnlyUnfinishedOperations(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	operations := putApprovedRequest(t, stub, "REBAL-1")
+
+	// The first operation executed before the second failed
+	for i, operation := range operations {
+		if i == 0 {
+			operation.Status = OPERATION_EXECUTED
+			operation.ExecutedAmount = operation.Amount
+		} else {
+			operation.Status = OPERATION_FAILED
+			operation.Error = "exchange unavailable"
+		}
+		operationJSON, err := json.Marshal(operation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.state[operation.OperationID] = operationJSON
+	}
+	request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Status = STATUS_FAILED
+	putRequest(t, stub, *request)
+
+	stub.nextTx("resume")
+	err = contract.ResumeRebalance(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatalf("ResumeRebalance: %v", err)
+	}
+
+	if len(adjustments) != 1 {
+		t.Fatalf("got %d adjustments, want 1", len(adjustments))
+	}
+	done, err := normalizeMetal(operations[0].MetalType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, traded := adjustments[0].Values[done]; traded || len(adjustments[0].Values) != len(operations)-1 {
+		t.Errorf("resume adjusted %v, want every metal but the executed %s", adjustments[0].Values, done)
+	}
+
+	request, err = contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+	if err != nil || request.Status != STATUS_EXECUTED {
+		t.Fatalf("after resuming: %v, %v, want EXECUTED", request, err)
+	}
+	resumed, err := contract.GetRebalanceOperations(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, operation := range resumed {
+		if operation.Status != OPERATION_EXECUTED || operation.ExecutedAmount != operation.Amount || operation.Error != "" {
+			t.Errorf("%s after resuming: %s, executed %.2f of %.2f, error %q", operation.OperationID,
+				operation.Status, operation.ExecutedAmount, operation.Amount, operation.Error)
+		}
+	}
+
+	stub.nextTx("resume-again")
+	err = contract.ResumeRebalance(asAdmin(stub), "REBAL-1")
+	if err == nil || len(adjustments) != 1 {
+		t.Errorf("resuming an executed request: got %v with %d adjustments", err, len(adjustments))
+	}
+}
+
+func TestRequestCreationEmitsEvent(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+
+	stub.nextTx("create")
+	err := contract.CreateRebalanceRequest(asAdmin(stub), nil, nil, testDeviations, "DEVIATION", "gold overweight")
+	if err != nil {
+		t.Fatalf("CreateRebalanceRequest: %v", err)
+	}
+
+	payload, ok := stub.events["RebalanceRequestCreated"]
+	if !ok {
+		t.Fatal("no RebalanceRequestCreated event")
+	}
+	var event RebalanceRequestCreatedEvent
+	err = json.Unmarshal(payload, &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := contract.GetRebalancePolicy(asAdmin(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RebalanceRequestCreatedEvent{
+		EventSeq:         event.EventSeq,
+		RequestID:        "REBAL-create",
+		TriggerType:      "DEVIATION",
+		ApprovalRequired: 10000 >= approvalThreshold(policy, 100000),
+		MaxTradeAmount:   10000,
+	}
+	if event != want || event.EventSeq == 0 {
+		t.Errorf("event %+v, want %+v with a sequence number", event, want)
+	}
+
+	// The event announces a request whose operations are already written
+	stub.nextTx("read")
+	detail, err := contract.GetRebalanceRequestDetail(asAdmin(stub), event.RequestID)
+	if err != nil || len(detail.Operations) != 3 {
+		t.Errorf("announced request: %v, %v", detail, err)
+	}
+}
+
+func TestApprovalStatusTracksProgress(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.RequiredApprovals = 3 })
+	putRequest(t, stub, RebalanceRequest{
+		RequestID:        "REBAL-1",
+		Status:           STATUS_PENDING,
+		ApprovalRequired: true,
+		CreatedAt:        stub.txTime.Format(time.RFC3339),
+	})
+
+	approve := func(approver string) {
+		t.Helper()
+		stub.nextTx("approve-" + approver)
+		err := contract.ApproveRebalanceRequest(newMockContext(stub, approver, map[string]string{"approver": "true"}),
+			"REBAL-1", approver)
+		if err != nil {
+			t.Fatalf("approval by %s: %v", approver, err)
+		}
+	}
+
+	approve("bob")
+	approve("carol")
+	status, err := contract.GetRebalanceApprovalStatus(asUser(stub, "alice"), "REBAL-1")
+	if err != nil {
+		t.Fatalf("GetRebalanceApprovalStatus: %v", err)
+	}
+	want := &ApprovalStatus{RequestID: "REBAL-1", Status: STATUS_PENDING, RequiredApprovals: 3,
+		Approvers: []string{"bob", "carol"}, Remaining: 1, CollectedWeight: 2}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("two of three approved: %+v, want %+v", status, want)
+	}
+
+	approve("dave")
+	status, err = contract.GetRebalanceApprovalStatus(asUser(stub, "alice"), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &ApprovalStatus{RequestID: "REBAL-1", Status: STATUS_APPROVED, RequiredApprovals: 3,
+		Approvers: []string{"bob", "carol", "dave"}, Remaining: 0, CollectedWeight: 3, ReadyToExecute: true}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("fully approved: %+v, want %+v", status, want)
+	}
+
+	_, err = contract.GetRebalanceApprovalStatus(asUser(stub, "alice"), "REBAL-missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing request: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestProjectedDriftUnderAGoldSpike(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	serveHoldings(t, stub, BasketHolding{TotalMBTSupply: 100000,
+		TotalBGTValue: 50000, TotalBSTValue: 30000, TotalBPTValue: 20000})
+
+	cases := []struct {
+		name         string
+		priceChanges string
+		wantAlloc    map[string]float64
+		wantMax      float64
+		wantBreach   bool
+	}{
+		{"unchanged", `{}`, map[string]float64{"gold": 0.5, "silver": 0.3, "platinum": 0.2}, 0, false},
+		{"small gold rise", `{"gold":0.05}`,
+			map[string]float64{"gold": 52500.0 / 102500, "silver": 30000.0 / 102500, "platinum": 20000.0 / 102500},
+			52500.0/102500 - 0.5, false},
+		{"gold spike", `{"gold":0.5}`, map[string]float64{"gold": 0.6, "silver": 0.24, "platinum": 0.16}, 0.1, true},
+	}
+	for _, test := range cases {
+		before := stateSnapshot(stub)
+		drift, err := contract.GetProjectedDrift(asUser(stub, "risk"), test.priceChanges)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for metal, want := range test.wantAlloc {
+			if !approxEqual(drift.ProjectedAlloc[metal], want) {
+				t.Errorf("%s: %s projected at %v, want %v", test.name, metal, drift.ProjectedAlloc[metal], want)
+			}
+		}
+		if !approxEqual(drift.MaxDeviation, test.wantMax) || drift.BreachesThreshold != test.wantBreach {
+			t.Errorf("%s: max deviation %v, breach %v; want %v, %v",
+				test.name, drift.MaxDeviation, drift.BreachesThreshold, test.wantMax, test.wantBreach)
+		}
+		if !reflect.DeepEqual(stateSnapshot(stub), before) {
+			t.Errorf("%s: projecting drift wrote state", test.name)
+		}
+	}
+
+	for _, priceChanges := range []string{`{"copper":0.1}`, `{"gold":-1}`} {
+		if _, err := contract.GetProjectedDrift(asUser(stub, "risk"), priceChanges); err == nil {
+			t.Errorf("GetProjectedDrift(%s) succeeded", priceChanges)
+		}
+	}
+}
+
+func TestApprovalThresholdScalesWithAUM(t *testing.T) {
+	// testDeviations' largest trade is 10% of AUM; the absolute threshold is 100k INR
+	cases := []struct {
+		name          string
+		aum           float64
+		percent       float64
+		wantApproval  bool
+		wantThreshold float64
+	}{
+		{"small AUM, absolute only", 100000, 0, false, 100000},
+		{"small AUM, percent stricter", 100000, 0.05, true, 5000},
+		{"small AUM, percent above trade", 100000, 0.2, false, 20000},
+		{"large AUM, absolute only", 10000000, 0, true, 100000},
+		{"large AUM, absolute stricter", 10000000, 0.2, true, 100000},
+	}
+	for _, test := range cases {
+		contract := &MBTRebalancingContract{}
+		var adjustments []RebalanceAdjustment
+		stub := newRebalancingStub(t, &adjustments)
+		serveHoldings(t, stub, BasketHolding{TotalMBTSupply: test.aum,
+			TotalBGTValue: test.aum * 0.6, TotalBSTValue: test.aum * 0.25, TotalBPTValue: test.aum * 0.15})
+		updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.ApprovalThresholdPercent = test.percent })
+
+		policy, err := contract.GetRebalancePolicy(asAdmin(stub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if threshold := approvalThreshold(policy, test.aum); !approxEqual(threshold, test.wantThreshold) {
+			t.Errorf("%s: threshold %v, want %v", test.name, threshold, test.wantThreshold)
+		}
+
+		stub.nextTx("create")
+		err = contract.CreateRebalanceRequest(asAdmin(stub), nil, nil, testDeviations, "DEVIATION", "gold overweight")
+		if err != nil {
+			t.Fatalf("%s: CreateRebalanceRequest: %v", test.name, err)
+		}
+		detail, err := contract.GetRebalanceRequestDetail(asAdmin(stub), "REBAL-create")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if detail.Request.ApprovalRequired != test.wantApproval {
+			t.Errorf("%s: approval required %v, want %v", test.name, detail.Request.ApprovalRequired, test.wantApproval)
+		}
+	}
+}
+
+func TestAtomicRebalanceAbortsWhenAnyOperationWouldFail(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.AtomicRebalance = true })
+	putApprovedRequest(t, stub, "REBAL-1")
+
+	// The basket no longer holds the 10000 of gold the first operation sells
+	holdings := testHoldings
+	holdings.TotalBGTValue = 5000
+	serveHoldings(t, stub, holdings)
+
+	before := stateSnapshot(stub)
+	stub.nextTx("execute")
+	err := contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err == nil || !strings.Contains(err.Error(), "atomic rebalance REBAL-1 aborted") {
+		t.Fatalf("ExecuteRebalance: got %v, want the atomic rebalance aborted", err)
+	}
+	if len(adjustments) != 0 {
+		t.Errorf("aborted rebalance adjusted the basket: %v", adjustments)
+	}
+	if !reflect.DeepEqual(stateSnapshot(stub), before) {
+		t.Error("aborted rebalance wrote state")
+	}
+
+	// Once the gold is back the whole request executes
+	serveHoldings(t, stub, testHoldings)
+	stub.nextTx("retry")
+	err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+	request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Status != STATUS_EXECUTED || len(adjustments) != 1 || len(adjustments[0].Values) != 3 {
+		t.Errorf("after retry: status %s, adjustments %v", request.Status, adjustments)
+	}
+}
+
+func TestEfficiencyScoreOfAnExecutedRebalance(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	putApprovedRequest(t, stub, "REBAL-1")
+	request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.CurrentAlloc = map[string]float64{"gold": 0.6, "silver": 0.25, "platinum": 0.15}
+	request.TargetAlloc = map[string]float64{"gold": 0.5, "silver": 0.3, "platinum": 0.2}
+	putRequest(t, stub, *request)
+
+	if _, err := contract.GetRebalanceEfficiencyScore(asAdmin(stub), "REBAL-1"); err == nil {
+		t.Error("scored a request that has not executed")
+	}
+
+	stub.nextTx("execute")
+	err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+
+	efficiency, err := contract.GetRebalanceEfficiencyScore(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatalf("GetRebalanceEfficiencyScore: %v", err)
+	}
+	// Selling 10000 of gold and buying 5000 each of silver and platinum lands on
+	// target, for 0.1% fees of 20
+	if !approxEqual(efficiency.PreMaxDeviation, 0.1) || !approxEqual(efficiency.PostMaxDeviation, 0) ||
+		!approxEqual(efficiency.DeviationReduction, 0.1) || !approxEqual(efficiency.TotalCost, 20) ||
+		!approxEqual(efficiency.Score, 0.1*100000/20) {
+		t.Errorf("efficiency = %+v", efficiency)
+	}
+	for metal, want := range request.TargetAlloc {
+		if !approxEqual(efficiency.PostTradeAlloc[metal], want) {
+			t.Errorf("%s after trades at %v, want %v", metal, efficiency.PostTradeAlloc[metal], want)
+		}
+	}
+}
+
+func TestOperationsCapBoundsARebalance(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.MaxOperationsPerRebalance = 2 })
+	holdings := testHoldings
+
+	// Deviations too small to trade do not count toward the cap
+	stub.nextTx("within")
+	operations, err := contract.generateRebalanceOperations(asAdmin(stub), "REBAL-1",
+		map[string]float64{"gold": 0.10, "silver": -0.10, "platinum": 0.0005}, &holdings, 100000, 1)
+	if err != nil {
+		t.Fatalf("two operations under a cap of two: %v", err)
+	}
+	if len(operations) != 2 {
+		t.Errorf("got %d operations, want 2", len(operations))
+	}
+
+	stub.nextTx("over")
+	deviations := map[string]float64{"gold": 0.06, "silver": -0.10, "platinum": 0.04}
+	_, err = contract.generateRebalanceOperations(asAdmin(stub), "REBAL-2", deviations, &holdings, 100000, 1)
+	if err == nil || !strings.Contains(err.Error(), "policy maximum of 2 operations") {
+		t.Errorf("three operations under a cap of two: got %v", err)
+	}
+
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.MaxOperationsPerRebalance = 0 })
+	stub.nextTx("uncapped")
+	operations, err = contract.generateRebalanceOperations(asAdmin(stub), "REBAL-3", deviations, &holdings, 100000, 1)
+	if err != nil {
+		t.Fatalf("uncapped: %v", err)
+	}
+	// Operations are generated largest deviation first
+	var order []string
+	for _, operation := range operations {
+		order = append(order, operation.MetalType)
+	}
+	if !reflect.DeepEqual(order, []string{"BST", "BGT", "BPT"}) {
+		t.Errorf("operations in order %v, want largest deviation first", order)
+	}
+
+	policy, err := contract.GetRebalancePolicy(asAdmin(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.MaxOperationsPerRebalance = -1
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := contract.UpdateRebalancePolicy(asAdmin(stub), string(policyJSON)); err == nil {
+		t.Error("a negative operations cap was accepted")
+	}
+}
+
+func TestWeightedApprovalsMixingRoles(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) {
+		policy.ApprovalWeightByRole = map[string]float64{"CFO": 3, "analyst": 0.5}
+		policy.RequiredApprovalWeight = 4
+	})
+	putRequest(t, stub, RebalanceRequest{
+		RequestID:        "REBAL-1",
+		Status:           STATUS_PENDING,
+		ApprovalRequired: true,
+		CreatedAt:        stub.txTime.Format(time.RFC3339),
+	})
+
+	approve := func(approver, role string) error {
+		stub.nextTx("approve-" + approver)
+		attributes := map[string]string{"approver": "true"}
+		if role != "" {
+			attributes["approverRole"] = role
+		}
+		return contract.ApproveRebalanceRequest(newMockContext(stub, approver, attributes), "REBAL-1", approver)
+	}
+	checkProgress := func(label string, wantWeight float64, wantStatus RequestStatus) {
+		t.Helper()
+		status, err := contract.GetRebalanceApprovalStatus(asUser(stub, "alice"), "REBAL-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.CollectedWeight != wantWeight || status.RequiredWeight != 4 || status.Status != wantStatus {
+			t.Errorf("%s: weight %v of %v, status %s; want %v, %s", label,
+				status.CollectedWeight, status.RequiredWeight, status.Status, wantWeight, wantStatus)
+		}
+	}
+
+	if err := approve("bob", "analyst"); err != nil {
+		t.Fatalf("analyst approval: %v", err)
+	}
+	checkProgress("analyst", 0.5, STATUS_PENDING)
+
+	// A role the policy does not weigh counts as 1
+	if err := approve("carol", "ops"); err != nil {
+		t.Fatalf("unweighted approval: %v", err)
+	}
+	checkProgress("analyst and ops", 1.5, STATUS_PENDING)
+
+	if err := approve("bob", "analyst"); err == nil {
+		t.Error("bob approved twice")
+	}
+	checkProgress("duplicate", 1.5, STATUS_PENDING)
+
+	if err := approve("dave", "CFO"); err != nil {
+		t.Fatalf("CFO approval: %v", err)
+	}
+	checkProgress("CFO", 4.5, STATUS_APPROVED)
+
+	request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded []string
+	for _, approval := range request.Approvals {
+		recorded = append(recorded, fmt.Sprintf("%s:%s:%v", approval.Approver, approval.Role, approval.Weight))
+	}
+	if want := []string{"bob:analyst:0.5", "carol:ops:1", "dave:CFO:3"}; !reflect.DeepEqual(recorded, want) {
+		t.Errorf("approvals recorded as %v, want %v", recorded, want)
+	}
+	if request.ApprovedBy != "dave" {
+		t.Errorf("approved by %q, want dave", request.ApprovedBy)
+	}
+}
+
+func TestRequestCountsFollowStatusChanges(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.ApprovalThreshold = 1000 })
+
+	checkCounts := func(label string, want map[RequestStatus]int) {
+		t.Helper()
+		counts, err := contract.GetRebalanceRequestCountByStatus(asUser(stub, "alice"))
+		if err != nil {
+			t.Fatalf("GetRebalanceRequestCountByStatus: %v", err)
+		}
+		total := 0
+		for _, status := range requestStatuses {
+			total += want[status]
+			if counts.Counts[status] != want[status] {
+				t.Errorf("%s: %d %s, want %d", label, counts.Counts[status], status, want[status])
+			}
+		}
+		if counts.Total != total {
+			t.Errorf("%s: total %d, want %d", label, counts.Total, total)
+		}
+	}
+	checkCounts("empty", nil)
+
+	for _, txID := range []string{"create1", "create2"} {
+		stub.nextTx(txID)
+		err := contract.CreateRebalanceRequest(asAdmin(stub), nil, nil, testDeviations, "DEVIATION", "gold overweight")
+		if err != nil {
+			t.Fatalf("CreateRebalanceRequest: %v", err)
+		}
+	}
+	checkCounts("created", map[RequestStatus]int{STATUS_PENDING: 2})
+
+	stub.nextTx("approve")
+	err := contract.ApproveRebalanceRequest(newMockContext(stub, "bob", map[string]string{"approver": "true"}),
+		"REBAL-create1", "bob")
+	if err != nil {
+		t.Fatalf("ApproveRebalanceRequest: %v", err)
+	}
+	checkCounts("approved", map[RequestStatus]int{STATUS_PENDING: 1, STATUS_APPROVED: 1})
+
+	stub.nextTx("execute")
+	err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-create1", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+	checkCounts("executed", map[RequestStatus]int{STATUS_PENDING: 1, STATUS_EXECUTED: 1})
+
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.ApprovalExpirySeconds = 3600 })
+	stub.txTime = stub.txTime.Add(2 * time.Hour)
+	stub.nextTx("expire")
+	expired, err := contract.ExpireStaleRequests(asAdmin(stub))
+	if err != nil || expired != 1 {
+		t.Fatalf("ExpireStaleRequests: %d, %v; want 1 expired", expired, err)
+	}
+	want := map[RequestStatus]int{STATUS_EXECUTED: 1, STATUS_EXPIRED: 1}
+	checkCounts("expired", want)
+
+	// A full recount agrees with the maintained counters
+	stub.nextTx("recount")
+	recount, err := contract.RecountRequestStatuses(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("RecountRequestStatuses: %v", err)
+	}
+	if recount.Total != 2 || recount.Counts[STATUS_EXECUTED] != 1 || recount.Counts[STATUS_EXPIRED] != 1 {
+		t.Errorf("recount = %+v, want %v", recount, want)
+	}
+	checkCounts("recounted", want)
+}
+
+func TestMixedOperationOutcomesAreRecordedPerOperation(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	operations := putApprovedRequest(t, stub, "REBAL-1")
+
+	// The middle operation lost its price and cannot trade; the others still do
+	broken := operations[1]
+	broken.CurrentPrice = 0
+	brokenJSON, err := json.Marshal(broken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.state[broken.OperationID] = brokenJSON
+
+	stub.nextTx("execute")
+	err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+
+	recorded, err := contract.GetRebalanceOperations(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != len(operations) {
+		t.Fatalf("got %d operations, want %d", len(recorded), len(operations))
+	}
+	for _, operation := range recorded {
+		if operation.OperationID == broken.OperationID {
+			if operation.Status != OPERATION_FAILED || operation.ExecutedAmount != 0 ||
+				!strings.Contains(operation.Error, "no price") {
+				t.Errorf("broken operation recorded as %+v", *operation)
+			}
+			continue
+		}
+		if operation.Status != OPERATION_EXECUTED || operation.ExecutedAmount != operation.Amount ||
+			operation.ExecutedAt == "" {
+			t.Errorf("operation %s recorded as %s, executed %v of %v", operation.OperationID,
+				operation.Status, operation.ExecutedAmount, operation.Amount)
+		}
+	}
+
+	// The request fails, but holdings still move by the trades that went through
+	request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Status != STATUS_FAILED {
+		t.Errorf("request %s, want %s", request.Status, STATUS_FAILED)
+	}
+	if len(adjustments) != 1 {
+		t.Fatalf("got %d adjustments, want 1", len(adjustments))
+	}
+	if _, traded := adjustments[0].Values[broken.MetalType]; traded || len(adjustments[0].Values) != len(operations)-1 {
+		t.Errorf("adjusted %v, want every metal but the failed %s", adjustments[0].Values, broken.MetalType)
+	}
+	for status, want := range map[RequestStatus]int{STATUS_APPROVED: 0, STATUS_FAILED: 1} {
+		count, err := getRequestCount(asAdmin(stub), status)
+		if err != nil || count != want {
+			t.Errorf("%s count: got %d, %v, want %d", status, count, err, want)
+		}
+	}
+}
+
+func TestCompositionCheckAtTheTolerance(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.CompositionTolerancePercent = 0.02 })
+	policy, err := contract.GetRebalancePolicy(asAdmin(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name                   string
+		gold, silver, platinum float64
+		wantErr                bool
+	}{
+		{"empty", 0, 0, 0, false},
+		{"inside tolerance", 51900, 29050, 19050, false},
+		{"outside tolerance", 52100, 28950, 18950, true},
+	}
+	for _, test := range cases {
+		holdings := &BasketHolding{TotalBGTValue: test.gold, TotalBSTValue: test.silver, TotalBPTValue: test.platinum}
+		err := contract.checkComposition(asAdmin(stub), holdings, policy)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+
+	// Policies stored before the field existed fall back to the default
+	policy.CompositionTolerancePercent = 0
+	if got := policyCompositionTolerance(policy); got != COMPOSITION_TOLERANCE_PERCENT {
+		t.Errorf("unset tolerance is %v, want the default %v", got, COMPOSITION_TOLERANCE_PERCENT)
+	}
+}
+
+func TestRebalancingStateSizeCountsEachCategory(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	operations := putApprovedRequest(t, stub, "REBAL-1")
+	putRequest(t, stub, RebalanceRequest{RequestID: "REBAL-2", Status: STATUS_PENDING})
+
+	size, err := contract.GetStateSize(asAdmin(stub))
+	if err != nil {
+		t.Fatalf("GetStateSize: %v", err)
+	}
+	// The policy is stored under REBALANCE_POLICY and is not a request
+	counts := map[string]int{}
+	for _, category := range size.Categories {
+		counts[category.Category] = category.Count
+	}
+	if counts["requests"] != 2 || counts["operations"] != len(operations) {
+		t.Errorf("state size = %+v, want 2 requests and %d operations", size.Categories, len(operations))
+	}
+}
+
+func TestAuditTrailCoversTheRequestLifecycle(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	updateTestPolicy(t, stub, func(policy *RebalancePolicy) { policy.ApprovalThreshold = 1000 })
+
+	_, err := contract.GetAuditTrailForRequest(asAdmin(stub), "REBAL-create")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("trail of an unknown request: got %v, want ErrNotFound", err)
+	}
+
+	stub.nextTx("create")
+	err = contract.CreateRebalanceRequest(asAdmin(stub), nil, nil, testDeviations, "DEVIATION", "gold overweight")
+	if err != nil {
+		t.Fatalf("CreateRebalanceRequest: %v", err)
+	}
+	stub.nextTx("approve")
+	err = contract.ApproveRebalanceRequest(newMockContext(stub, "bob", map[string]string{"approver": "true"}),
+		"REBAL-create", "bob")
+	if err != nil {
+		t.Fatalf("ApproveRebalanceRequest: %v", err)
+	}
+
+	operations, err := contract.GetRebalanceOperations(asAdmin(stub), "REBAL-create")
+	if err != nil || len(operations) != 3 {
+		t.Fatalf("operations: %d, %v; want 3", len(operations), err)
+	}
+	failing := operations[2]
+	failing.CurrentPrice = 0
+	failingJSON, err := json.Marshal(failing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.state[failing.OperationID] = failingJSON
+
+	stub.nextTx("execute")
+	err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-create", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+	flagged := operations[0]
+	stub.nextTx("flag")
+	err = contract.FlagOperation(asAdmin(stub), "REBAL-create", flagged.OperationID, "price check")
+	if err != nil {
+		t.Fatalf("FlagOperation: %v", err)
+	}
+
+	trail, err := contract.GetAuditTrailForRequest(asUser(stub, "auditor"), "REBAL-create")
+	if err != nil {
+		t.Fatalf("GetAuditTrailForRequest: %v", err)
+	}
+	if trail.Request.RequestID != "REBAL-create" || trail.Request.Status != STATUS_FAILED {
+		t.Errorf("trail request = %+v", trail.Request)
+	}
+	if len(trail.Approvals) != 1 || trail.Approvals[0].Approver != "bob" ||
+		trail.ApprovalStatus == nil || trail.ApprovalStatus.CollectedWeight != 1 {
+		t.Errorf("trail approvals = %+v, status %+v", trail.Approvals, trail.ApprovalStatus)
+	}
+	if len(trail.Operations) != 3 || trail.Summary.OperationCount != 3 {
+		t.Errorf("trail has %d operations, summary %+v", len(trail.Operations), trail.Summary)
+	}
+	if len(trail.FlaggedOperations) != 1 || trail.FlaggedOperations[0].OperationID != flagged.OperationID ||
+		trail.FlaggedOperations[0].FlagReason != "price check" || trail.FlaggedOperations[0].Status != OPERATION_EXECUTED {
+		t.Errorf("flagged operations = %+v", trail.FlaggedOperations)
+	}
+	if len(trail.FailedOperations) != 1 || trail.FailedOperations[0].OperationID != failing.OperationID ||
+		trail.FailedOperations[0].Error == "" {
+		t.Errorf("failed operations = %+v", trail.FailedOperations)
+	}
+}
+
+func TestTwoHalfTranchesReachTarget(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+
+	for _, fraction := range []float64{-0.1, 1.5, math.NaN()} {
+		holdings := testHoldings
+		err := contract.GenerateRebalanceOperations(asAdmin(stub), "REBAL-bad", testDeviations, &holdings, 100000, fraction)
+		if err == nil {
+			t.Errorf("generating operations at fraction %v succeeded", fraction)
+		}
+	}
+
+	// Generating at half sizes every trade at half the distance to target
+	holdings := testHoldings
+	err := contract.GenerateRebalanceOperations(asAdmin(stub), "REBAL-half", testDeviations, &holdings, 100000, 0.5)
+	if err != nil {
+		t.Fatalf("GenerateRebalanceOperations: %v", err)
+	}
+	half, err := contract.GetRebalanceOperations(asAdmin(stub), "REBAL-half")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"BGT": 5000, "BST": 2500, "BPT": 2500}
+	if len(half) != len(want) {
+		t.Fatalf("got %d operations at half, want %d", len(half), len(want))
+	}
+	for _, operation := range half {
+		if operation.Amount != want[operation.MetalType] {
+			t.Errorf("%s at half: %.2f, want %.2f", operation.MetalType, operation.Amount, want[operation.MetalType])
+		}
+	}
+
+	putApprovedRequest(t, stub, "REBAL-1")
+	for _, fraction := range []float64{-0.5, 2, math.NaN()} {
+		stub.nextTx("bad-fraction")
+		if contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, fraction) == nil {
+			t.Errorf("executing at fraction %v succeeded", fraction)
+		}
+	}
+	if len(adjustments) != 0 {
+		t.Fatalf("rejected fractions moved holdings: %v", adjustments)
+	}
+
+	// Each half pass closes half the gap; together they reach target
+	moved := map[string]float64{}
+	for i, wantStatus := range []RequestStatus{STATUS_PARTIAL, STATUS_EXECUTED} {
+		stub.nextTx(fmt.Sprintf("tranche%d", i+1))
+		err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-1", false, 0.5)
+		if err != nil {
+			t.Fatalf("tranche %d: %v", i+1, err)
+		}
+		request, err := contract.getRebalanceRequest(asAdmin(stub), "REBAL-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if request.Status != wantStatus || request.CompletionFraction != 0.5*float64(i+1) {
+			t.Errorf("after tranche %d: status %s, fraction %v", i+1, request.Status, request.CompletionFraction)
+		}
+		for metal, value := range adjustments[i].Values {
+			moved[metal] += value
+		}
+	}
+	full := map[string]float64{"BGT": -10000, "BST": 5000, "BPT": 5000}
+	for metal, value := range full {
+		if math.Abs(moved[metal]-value) > 1e-6 {
+			t.Errorf("%s moved %v over both tranches, want %v", metal, moved[metal], value)
+		}
+	}
+}
+
+func TestRebalanceSavingsAgainstFullReversion(t *testing.T) {
+	contract := &MBTRebalancingContract{}
+	var adjustments []RebalanceAdjustment
+	stub := newRebalancingStub(t, &adjustments)
+	policy, err := contract.GetRebalancePolicy(asAdmin(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Platinum's 500 deviation is under the minimum trade, so only gold and silver trade
+	deviations := map[string]float64{"gold": 0.105, "silver": -0.1, "platinum": -0.005}
+	stub.nextTx("band")
+	err = contract.CreateRebalanceRequest(asAdmin(stub), nil, nil, deviations, "DEVIATION", "gold overweight")
+	if err != nil {
+		t.Fatalf("CreateRebalanceRequest: %v", err)
+	}
+	stub.nextTx("execute")
+	err = contract.ExecuteRebalance(asAdmin(stub), "REBAL-band", false, 0)
+	if err != nil {
+		t.Fatalf("ExecuteRebalance: %v", err)
+	}
+
+	// A request that never executed saves nothing
+	stub.nextTx("open")
+	err = contract.CreateRebalanceRequest(asAdmin(stub), nil, nil, testDeviations, "DEVIATION", "gold overweight")
+	if err != nil {
+		t.Fatalf("CreateRebalanceRequest: %v", err)
+	}
+
+	date := stub.txTime.Format("2006-01-02")
+	savings, err := contract.GetRebalanceSavings(asAdmin(stub), date, date)
+	if err != nil {
+		t.Fatalf("GetRebalanceSavings: %v", err)
+	}
+	fees := tradingFee(policy, 10500) + tradingFee(policy, 10000)
+	fullFees := fees + tradingFee(policy, 500)
+	if savings.RebalanceCount != 1 || len(savings.Requests) != 1 || savings.Requests[0].RequestID != "REBAL-band" {
+		t.Fatalf("savings cover %d rebalances: %+v", savings.RebalanceCount, savings.Requests)
+	}
+	if !approxEqual(savings.TradedValue, 20500) || !approxEqual(savings.FullReversionValue, 21000) ||
+		!approxEqual(savings.Fees, fees) || !approxEqual(savings.FullReversionFees, fullFees) ||
+		!approxEqual(savings.FeeSavings, fullFees-fees) || savings.FeeSavings <= 0 {
+		t.Errorf("savings = %+v, want 20500 traded of 21000 saving %v", savings, fullFees-fees)
+	}
+	if entry := savings.Requests[0]; !approxEqual(entry.FeeSavings, savings.FeeSavings) {
+		t.Errorf("request savings = %+v", entry)
+	}
+
+	next := stub.txTime.AddDate(0, 0, 1).Format("2006-01-02")
+	savings, err = contract.GetRebalanceSavings(asAdmin(stub), next, next)
+	if err != nil || savings.RebalanceCount != 0 || savings.FeeSavings != 0 {
+		t.Errorf("savings outside the range = %+v, %v", savings, err)
+	}
+}
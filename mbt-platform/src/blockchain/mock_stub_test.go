@@ -0,0 +1,312 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// mockStub is an in-memory world state implementing the parts of the shim the
+// contracts use. Writes are visible immediately; tests run one call per transaction.
+type mockStub struct {
+	shim.ChaincodeStubInterface
+
+	state  map[string][]byte
+	txID   string
+	txTime time.Time
+	events map[string][]byte
+
+	// wrote and paged track the current transaction: like the peer, the mock fails
+	// a transaction that both writes and runs a paginated query
+	wrote, paged bool
+
+	// invoke answers InvokeChaincode calls, keyed by chaincode then function;
+	// invocations records each call as "chaincode.function"
+	invoke      map[string]map[string]func(args [][]byte) peer.Response
+	invocations []string
+}
+
+func newMockStub() *mockStub {
+	return &mockStub{
+		state:  map[string][]byte{},
+		txID:   "tx1",
+		txTime: time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC),
+		events: map[string][]byte{},
+		invoke: map[string]map[string]func(args [][]byte) peer.Response{},
+	}
+}
+
+// nextTx starts a new transaction with its own ID, a minute after the last
+func (s *mockStub) nextTx(txID string) {
+	s.txID = txID
+	s.txTime = s.txTime.Add(time.Minute)
+	s.wrote, s.paged = false, false
+}
+
+func (s *mockStub) GetTxID() string { return s.txID }
+
+func (s *mockStub) GetTxTimestamp() (*timestamppb.Timestamp, error) {
+	return timestamppb.New(s.txTime), nil
+}
+
+func (s *mockStub) GetState(key string) ([]byte, error) { return s.state[key], nil }
+
+func (s *mockStub) PutState(key string, value []byte) error {
+	if s.paged {
+		return errPaginatedWrite
+	}
+	s.wrote = true
+	s.state[key] = value
+	return nil
+}
+
+func (s *mockStub) DelState(key string) error {
+	if s.paged {
+		return errPaginatedWrite
+	}
+	s.wrote = true
+	delete(s.state, key)
+	return nil
+}
+
+var errPaginatedWrite = errors.New("paginated queries are only supported in read-only transactions")
+
+func (s *mockStub) SetEvent(name string, payload []byte) error {
+	s.events[name] = payload
+	return nil
+}
+
+func (s *mockStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	s.invocations = append(s.invocations, chaincodeName+"."+string(args[0]))
+	handler, ok := s.invoke[chaincodeName][string(args[0])]
+	if !ok {
+		return peer.Response{Status: shim.ERROR, Message: "no mock for " + chaincodeName + "." + string(args[0])}
+	}
+	return handler(args[1:])
+}
+
+func (s *mockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	key := "\x00" + objectType + "\x00"
+	for _, attribute := range attributes {
+		key += attribute + "\x00"
+	}
+	return key, nil
+}
+
+func (s *mockStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	parts := strings.Split(strings.TrimPrefix(compositeKey, "\x00"), "\x00")
+	return parts[0], parts[1 : len(parts)-1], nil
+}
+
+// sortedKeys returns the keys matching a filter in key order
+func (s *mockStub) sortedKeys(match func(key string) bool) []string {
+	var keys []string
+	for key := range s.state {
+		if match(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// inRange matches simple keys in [startKey, endKey); composite keys are never in range
+func inRange(startKey, endKey string) func(string) bool {
+	return func(key string) bool {
+		return !strings.HasPrefix(key, "\x00") && key >= startKey && (endKey == "" || key < endKey)
+	}
+}
+
+func (s *mockStub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	return s.iterator(s.sortedKeys(inRange(startKey, endKey))), nil
+}
+
+func (s *mockStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, _ := s.CreateCompositeKey(objectType, keys)
+	return s.iterator(s.sortedKeys(func(key string) bool { return strings.HasPrefix(key, prefix) })), nil
+}
+
+func (s *mockStub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+
+	return s.page(s.sortedKeys(inRange(startKey, endKey)), pageSize, bookmark)
+}
+
+func (s *mockStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+
+	prefix, _ := s.CreateCompositeKey(objectType, keys)
+	return s.page(s.sortedKeys(func(key string) bool { return strings.HasPrefix(key, prefix) }), pageSize, bookmark)
+}
+
+// page returns up to pageSize keys starting at the bookmark, which is the first key
+// of the next page, or empty once the keys are exhausted
+func (s *mockStub) page(keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if s.wrote {
+		return nil, nil, errPaginatedWrite
+	}
+	s.paged = true
+
+	start := 0
+	if bookmark != "" {
+		start = sort.SearchStrings(keys, bookmark)
+	}
+
+	end := start + int(pageSize)
+	next := ""
+	if end < len(keys) {
+		next = keys[end]
+	} else {
+		end = len(keys)
+	}
+
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(end - start), Bookmark: next}
+	return s.iterator(keys[start:end]), metadata, nil
+}
+
+// GetQueryResult runs a CouchDB query whose selector matches fields, dotted for nested
+// ones, by equality and _id by a $regex; other operators are not supported
+func (s *mockStub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	var parsed struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	err := json.Unmarshal([]byte(query), &parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, key := range s.sortedKeys(func(key string) bool { return !strings.HasPrefix(key, "\x00") }) {
+		var document map[string]interface{}
+		if json.Unmarshal(s.state[key], &document) != nil {
+			continue
+		}
+		matched, err := matchesSelector(key, document, parsed.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			keys = append(keys, key)
+		}
+	}
+	return s.iterator(keys), nil
+}
+
+// GetQueryResultWithPagination fails as it does on a LevelDB peer, so contracts
+// take their key-scan fallback
+func (s *mockStub) GetQueryResultWithPagination(query string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+
+	return nil, nil, errors.New("ExecuteQueryWithPagination not supported for leveldb")
+}
+
+// matchesSelector reports whether a document stored under key satisfies a selector
+func matchesSelector(key string, document, selector map[string]interface{}) (bool, error) {
+	for field, want := range selector {
+		if field == "_id" {
+			pattern, ok := want.(map[string]interface{})["$regex"].(string)
+			if !ok {
+				return false, fmt.Errorf("unsupported _id selector %v", want)
+			}
+			if !regexp.MustCompile(pattern).MatchString(key) {
+				return false, nil
+			}
+			continue
+		}
+		if _, isOperator := want.(map[string]interface{}); isOperator {
+			return false, fmt.Errorf("unsupported selector for %s: %v", field, want)
+		}
+
+		var value interface{} = document
+		for _, part := range strings.Split(field, ".") {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				value = nil
+				break
+			}
+			value = object[part]
+		}
+		if value != want {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *mockStub) iterator(keys []string) *mockIterator {
+	iterator := &mockIterator{}
+	for _, key := range keys {
+		iterator.results = append(iterator.results, &queryresult.KV{Key: key, Value: s.state[key]})
+	}
+	return iterator
+}
+
+// mockIterator iterates a snapshot of query results
+type mockIterator struct {
+	results []*queryresult.KV
+}
+
+func (it *mockIterator) HasNext() bool { return len(it.results) > 0 }
+
+func (it *mockIterator) Close() error { return nil }
+
+func (it *mockIterator) Next() (*queryresult.KV, error) {
+	result := it.results[0]
+	it.results = it.results[1:]
+	return result, nil
+}
+
+// mockIdentity is a client identity carrying the given attributes
+type mockIdentity struct {
+	cid.ClientIdentity
+
+	id         string
+	mspID      string
+	attributes map[string]string
+}
+
+func (i *mockIdentity) GetID() (string, error) { return i.id, nil }
+
+func (i *mockIdentity) GetMSPID() (string, error) { return i.mspID, nil }
+
+func (i *mockIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := i.attributes[attrName]
+	return value, found, nil
+}
+
+// mockContext is a transaction context over a mock stub and identity
+type mockContext struct {
+	contractapi.TransactionContextInterface
+
+	stub     *mockStub
+	identity *mockIdentity
+}
+
+func (c *mockContext) GetStub() shim.ChaincodeStubInterface { return c.stub }
+
+func (c *mockContext) GetClientIdentity() cid.ClientIdentity { return c.identity }
+
+// newMockContext returns a context for a caller with the given attributes
+func newMockContext(stub *mockStub, id string, attributes map[string]string) *mockContext {
+	return &mockContext{stub: stub, identity: &mockIdentity{id: id, attributes: attributes}}
+}
+
+// asAdmin and asUser are callers with and without the admin attribute
+func asAdmin(stub *mockStub) *mockContext {
+	return newMockContext(stub, "admin", map[string]string{"admin": "true"})
+}
+
+func asUser(stub *mockStub, id string) *mockContext {
+	return newMockContext(stub, id, map[string]string{})
+}